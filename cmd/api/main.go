@@ -1,10 +1,16 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 
 	"github.com/jamesjarvis/WhatsUpKent/pkg/api"
+	"github.com/jamesjarvis/WhatsUpKent/pkg/notify"
+	"github.com/jamesjarvis/WhatsUpKent/pkg/oidc"
 )
 
 func main() {
@@ -13,7 +19,103 @@ func main() {
 		url = "localhost:9080"
 	}
 
-	err := api.Starter(url)
+	// The address to listen on, such as ":4000"
+	addr := os.Getenv("API_ADDR")
+
+	// The API keys, see api.LoadAPIKeys and cmd/apikey to make one
+	keys, err := api.LoadAPIKeys(os.Getenv("API_KEYS"), os.Getenv("API_KEYS_FILE"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Stop gracefully when kubernetes sends SIGTERM, so a rollout doesn't drop requests
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Users sign in with the OIDC provider at OIDC_ISSUER, such as the university SSO, if it is set
+	var verifier *oidc.Verifier
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		verifier, err = oidc.New(oidc.Config{
+			Issuer:   issuer,
+			Audience: os.Getenv("OIDC_AUDIENCE"),
+			JWKSURL:  os.Getenv("OIDC_JWKS_URL"),
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// The browser frontends allowed to use the api, see api.LoadCORSOptions
+	cors, err := api.LoadCORSOptions(os.LookupEnv)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Serve HTTPS from TLS_CERT_FILE and TLS_KEY_FILE, or Let's Encrypt for TLS_AUTOCERT_HOSTS, see api.LoadTLSOptions
+	tlsOpts, err := api.LoadTLSOptions(os.LookupEnv)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Browse the api with Swagger UI at /docs if SWAGGER_UI is true
+	swaggerUI, _ := strconv.ParseBool(os.Getenv("SWAGGER_UI"))
+
+	// Cache the responses in Redis at REDIS_URL, shared by the replicas, if it is set, otherwise in process
+	var responses api.ResponseStore
+	if redisURL := os.Getenv("REDIS_URL"); redisURL != "" {
+		store, err := api.NewRedisStore(redisURL)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer store.Close()
+		responses = store
+	}
+
+	// Email the users about the changes to their timetables through the server at SMTP_ADDR, if it is set,
+	// with unsubscribe links at PUBLIC_URL signed with UNSUBSCRIBE_SECRET
+	publicURL := os.Getenv("PUBLIC_URL")
+	unsubscribeSecret := os.Getenv("UNSUBSCRIBE_SECRET")
+	var mailer *notify.Mailer
+	if smtpAddr := os.Getenv("SMTP_ADDR"); smtpAddr != "" {
+		if publicURL == "" {
+			log.Fatal("PUBLIC_URL has to be set for the unsubscribe links of the emails")
+		}
+		if len(unsubscribeSecret) < 32 {
+			log.Fatal("UNSUBSCRIBE_SECRET has to be set, to at least 32 characters, for the unsubscribe links of the emails")
+		}
+		mailer, err = notify.NewMailer(notify.SMTPConfig{
+			Addr:     smtpAddr,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Push them to their browsers with the VAPID_PRIVATE_KEY, if it is set, see cmd/vapidkeys to make one
+	var pusher *notify.Pusher
+	if vapidKey := os.Getenv("VAPID_PRIVATE_KEY"); vapidKey != "" {
+		pusher, err = notify.NewPusher(vapidKey, os.Getenv("VAPID_SUBJECT"))
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	err = api.Start(ctx, url, api.ServerOptions{
+		Addr:              addr,
+		Keys:              keys,
+		OIDC:              verifier,
+		CORS:              &cors,
+		TLS:               tlsOpts,
+		SwaggerUI:         swaggerUI,
+		ResponseStore:     responses,
+		Mailer:            mailer,
+		Pusher:            pusher,
+		PublicURL:         publicURL,
+		UnsubscribeSecret: []byte(unsubscribeSecret),
+	})
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/api"
+)
+
+// Prints a new API key as a line of the API_KEYS_FILE, or an entry of API_KEYS
+func main() {
+	name := flag.String("name", "", "who the key is for")
+	scopes := flag.String("scopes", string(api.ScopeRead), "the comma separated scopes of the key, read or admin")
+	flag.Parse()
+	if *name == "" {
+		log.Fatal("Give the key a name with -name")
+	}
+
+	secret, err := api.GenerateAPIKey()
+	if err != nil {
+		log.Fatal(err)
+	}
+	line := api.FormatAPIKey(*name, secret, api.ParseScopes(*scopes)...)
+
+	// Check the key the same way the api will load it
+	if err := api.ParseAPIKeys(strings.NewReader(line), api.NewKeyStore()); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(line)
+}
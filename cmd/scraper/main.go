@@ -1,15 +1,19 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"time"
 
 	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db/migrations"
 	"github.com/jamesjarvis/WhatsUpKent/pkg/scrape"
 )
 
 func main() {
+	ctx := context.Background()
+
 	// Setup Scraper
 	url := os.Getenv("DGRAPH_URL")
 	if url == "" {
@@ -22,6 +26,7 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer client.Close()
 
 	config := scrape.InitialConfig{
 		Url:              url,
@@ -32,17 +37,42 @@ func main() {
 		DownloadPool:     1,
 		ProcessPool:      3,
 		EventProcessPool: 5,
-		DBClient:         client,
+		// The term dates to store, see scrape.LoadTerms, they are scraped from kent without it
+		TermsFile: os.Getenv("TERMS_FILE"),
+		// The changes are kept for the api's feeds and for clients resuming their streams
+		ChangeRetention: time.Hour * 24 * 30,
+		// The events gone from the timetables are kept for ListDeletedEvents, and to be restored if they come back
+		DeletedEventRetention: time.Hour * 24 * 90,
+		DBClient:              db.NewCachedClient(client, 10000, time.Hour),
 	}
 
 	log.Println("Install schema into DB")
-	err = config.DBClient.Setup()
+	diff, err := client.ApplySchema(ctx)
 	if err != nil {
 		log.Fatal(err)
 	}
-	log.Print("Schema successfully updated")
+	if diff.Empty() {
+		log.Print("Schema already up to date")
+	} else {
+		log.Printf("Schema successfully updated, added %v, changed %v", diff.Added, diff.Changed)
+	}
+
+	log.Println("Running migrations")
+	applied, err := client.Migrate(ctx, migrations.All)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, m := range applied {
+		log.Printf("Applied migration %d: %s", m.Version, m.Name)
+	}
+
+	// The term dates are cheap to store, so they are kept up to date every start
+	if errTerms := config.Terms(); errTerms != nil {
+		log.Fatal(errTerms)
+	}
+	log.Println("------------- Term dates stored -------------")
 
-	s, errOld := config.DBClient.GetOldestScrape()
+	s, errOld := config.DBClient.GetOldestScrape(ctx)
 	if errOld != nil {
 		log.Fatal(errOld)
 	}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/notify"
+)
+
+// Prints a new VAPID key pair for the web push notifications, the private key for VAPID_PRIVATE_KEY
+// and the public key the browsers subscribe with, which the api also hands out from /v1/me/notifications
+func main() {
+	privateKey, publicKey, err := notify.GenerateVAPIDKeys()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("VAPID_PRIVATE_KEY=" + privateKey)
+	fmt.Println("VAPID public key: " + publicKey)
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+//dateLayout is how the days are given in the query parameters and answers, such as 2024-10-01
+const dateLayout = "2006-01-02"
+
+//OccupancyJSON is the answer of GET /analytics/occupancy, how many of the rooms of a building are booked through a day
+type OccupancyJSON struct {
+	db.Occupancy
+	//Date is the day the hours are of, in kent's time zone
+	Date string `json:"date"`
+}
+
+//Occupancy returns how many of the rooms of the building with the ?building slug are booked during each hour
+//of ?date, or today without it, for the heatmaps of how busy a building is. The hours are those of the day in kent,
+//so there are 23 or 25 of them on the days the clocks change.
+func (config *Config) Occupancy() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		query := r.URL.Query()
+		now := time.Now().In(kentTime)
+		day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, kentTime)
+		if date := query.Get("date"); date != "" {
+			var err error
+			day, err = time.ParseInLocation(dateLayout, date, kentTime)
+			if err != nil {
+				return badRequest("The date must be a day, such as 2024-10-01.", err)
+			}
+		}
+
+		occupancy, err := config.DBClient.GetBuildingOccupancy(r.Context(), query.Get("building"), day, day.AddDate(0, 0, 1))
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusOK, OccupancyJSON{Occupancy: *occupancy, Date: day.Format(dateLayout)})
+	})
+}
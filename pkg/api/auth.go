@@ -0,0 +1,292 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//Scope is what an API key is allowed to do
+type Scope string
+
+//The scopes of the API keys. An admin key can do everything a read key can.
+const (
+	ScopeRead  Scope = "read"
+	ScopeAdmin Scope = "admin"
+)
+
+const (
+	//apiKeyPrefix starts every generated key, so they are easy to spot in config and logs
+	apiKeyPrefix = "wuk_"
+	//MinAPIKeyLength is the shortest secret a key can have
+	MinAPIKeyLength = 16
+)
+
+//APIKey is a key clients authenticate with, without its secret
+type APIKey struct {
+	//Name says whose key it is, such as "scraper" or "jamesjarvis"
+	Name   string
+	Scopes []Scope
+}
+
+//Allows returns whether the key has the scope, which it does for every scope if it is an admin key
+func (k APIKey) Allows(scope Scope) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+//KeyStore holds the API keys the api accepts, by the hash of their secret so the secrets aren't kept in memory.
+//A nil KeyStore holds no keys.
+type KeyStore struct {
+	mu   sync.RWMutex
+	keys map[[sha256.Size]byte]APIKey
+}
+
+//NewKeyStore returns an empty key store
+func NewKeyStore() *KeyStore {
+	return &KeyStore{keys: make(map[[sha256.Size]byte]APIKey)}
+}
+
+//Add adds a key with the secret, replacing none: the name and secret both have to be new
+func (s *KeyStore) Add(name, secret string, scopes ...Scope) error {
+	if name == "" {
+		return errors.New("An API key needs a name")
+	}
+	if len(secret) < MinAPIKeyLength {
+		return fmt.Errorf("The API key %s has to be at least %d characters long", name, MinAPIKeyLength)
+	}
+	if len(scopes) == 0 {
+		return fmt.Errorf("The API key %s needs at least one scope", name)
+	}
+	for _, scope := range scopes {
+		if scope != ScopeRead && scope != ScopeAdmin {
+			return fmt.Errorf("The API key %s has the unknown scope %q", name, scope)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hash := sha256.Sum256([]byte(secret))
+	if _, ok := s.keys[hash]; ok {
+		return fmt.Errorf("The API key %s has the same secret as another key", name)
+	}
+	for _, k := range s.keys {
+		if k.Name == name {
+			return fmt.Errorf("There is already an API key named %s", name)
+		}
+	}
+	s.keys[hash] = APIKey{Name: name, Scopes: append([]Scope(nil), scopes...)}
+	return nil
+}
+
+//Remove removes the key with the name, returning whether there was one
+func (s *KeyStore) Remove(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, k := range s.keys {
+		if k.Name == name {
+			delete(s.keys, hash)
+			return true
+		}
+	}
+	return false
+}
+
+//Lookup returns the key with the secret, if there is one
+func (s *KeyStore) Lookup(secret string) (APIKey, bool) {
+	if s == nil || secret == "" {
+		return APIKey{}, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	// Looking up the hash rather than comparing secrets doesn't leak how much of a secret was right
+	k, ok := s.keys[sha256.Sum256([]byte(secret))]
+	return k, ok
+}
+
+//Keys returns the keys ordered by name
+func (s *KeyStore) Keys() []APIKey {
+	keys := make([]APIKey, 0)
+	if s == nil {
+		return keys
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, k := range s.keys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+	return keys
+}
+
+//Len returns how many keys there are
+func (s *KeyStore) Len() int {
+	if s == nil {
+		return 0
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.keys)
+}
+
+//GenerateAPIKey returns a new random secret for a key
+func GenerateAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + hex.EncodeToString(b), nil
+}
+
+//FormatAPIKey returns the key as a line of a keys file, see ParseAPIKeys
+func FormatAPIKey(name, secret string, scopes ...Scope) string {
+	names := make([]string, len(scopes))
+	for i, scope := range scopes {
+		names[i] = string(scope)
+	}
+	return fmt.Sprintf("%s %s %s", name, strings.Join(names, ","), secret)
+}
+
+//ParseScopes parses the comma separated scopes, such as "read,admin"
+func ParseScopes(value string) []Scope {
+	scopes := make([]Scope, 0)
+	for _, scope := range strings.Split(value, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, Scope(scope))
+		}
+	}
+	return scopes
+}
+
+//ParseAPIKeys adds the keys read from r to the store, one per line as "<name> <scopes> <secret>",
+//such as "scraper read,admin wuk_3f9...". Blank lines and lines starting with # are skipped.
+func ParseAPIKeys(r io.Reader, store *KeyStore) error {
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 3 {
+			return fmt.Errorf("Line %d of the API keys should be \"<name> <scopes> <secret>\"", line)
+		}
+		if err := store.Add(fields[0], fields[2], ParseScopes(fields[1])...); err != nil {
+			return fmt.Errorf("Line %d of the API keys: %w", line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+//LoadAPIKeys returns the keys from keys, lines as in ParseAPIKeys separated by semicolons,
+//along with the ones in the file at path if it isn't empty. They usually come from the API_KEYS and API_KEYS_FILE variables.
+func LoadAPIKeys(keys, path string) (*KeyStore, error) {
+	store := NewKeyStore()
+	if err := ParseAPIKeys(strings.NewReader(strings.ReplaceAll(keys, ";", "\n")), store); err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return store, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := ParseAPIKeys(f, store); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return store, nil
+}
+
+//apiKeyContextKey is the key of the APIKey in the request context
+type apiKeyContextKey struct{}
+
+//APIKeyFromContext returns the key the request was authenticated with, if it was
+func APIKeyFromContext(ctx context.Context) (APIKey, bool) {
+	k, ok := ctx.Value(apiKeyContextKey{}).(APIKey)
+	return k, ok
+}
+
+//bearerToken returns the token sent as an Authorization: Bearer header
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > len("Bearer ") && strings.EqualFold(auth[:len("Bearer ")], "Bearer ") {
+		return strings.TrimSpace(auth[len("Bearer "):])
+	}
+	return ""
+}
+
+//isJWT returns whether the token looks like a JWT, three base64url parts separated by dots, rather than an API key
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+//unauthorized is the error for a request which isn't authenticated as it needs to be
+func unauthorized(w http.ResponseWriter, message string) *Error {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="whatsupkent"`)
+	return &Error{Code: http.StatusUnauthorized, Status: "Unauthorized", Message: message}
+}
+
+//Authenticate puts the API key the request is sent with in its context, see APIKeyFromContext,
+//or the user a JWT from the OIDC provider was issued to, see UserFromContext.
+//The key is sent as an X-API-Key header or an Authorization: Bearer token, and the JWT as a Bearer token.
+//Requests without either carry on anonymously, as reading doesn't need them, but ones which aren't valid are refused.
+func (config *Config) Authenticate(next http.Handler) http.Handler {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		ctx := r.Context()
+		secret, token := r.Header.Get("X-API-Key"), bearerToken(r)
+		if secret == "" && !isJWT(token) {
+			secret, token = token, ""
+		}
+		if secret != "" {
+			key, ok := config.Keys.Lookup(secret)
+			if !ok {
+				return unauthorized(w, "The API key isn't valid.")
+			}
+			ctx = context.WithValue(ctx, apiKeyContextKey{}, key)
+		}
+		if token != "" {
+			user, err := config.verifyUser(w, r, token)
+			if err != nil {
+				return err
+			}
+			ctx = context.WithValue(ctx, userContextKey{}, user)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+		return nil
+	})
+}
+
+//RequireScope returns middleware refusing the requests which weren't authenticated with a key having the scope
+func (config *Config) RequireScope(scope Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return Handle(func(w http.ResponseWriter, r *http.Request) error {
+			key, ok := APIKeyFromContext(r.Context())
+			if !ok {
+				return unauthorized(w, "This needs an API key.")
+			}
+			if !key.Allows(scope) {
+				return &Error{Code: http.StatusForbidden, Status: "Forbidden", Message: fmt.Sprintf("The API key doesn't have the %s scope.", scope)}
+			}
+			next.ServeHTTP(w, r)
+			return nil
+		})
+	}
+}
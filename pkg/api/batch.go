@@ -0,0 +1,220 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	//MaxBatchRequests is the most sub-requests a batch can have
+	MaxBatchRequests = 20
+	//batchConcurrency is how many of the sub-requests of a batch are answered at once
+	batchConcurrency = 5
+)
+
+//unbatchable are the routes which can't be part of a batch, as they never finish or would batch themselves
+var unbatchable = map[string]bool{
+	"/batch":         true,
+	"/events/stream": true,
+	"/ws":            true,
+}
+
+//BatchJSON is what a batch is posted as
+type BatchJSON struct {
+	Requests []BatchRequestJSON `json:"requests"`
+}
+
+//BatchRequestJSON is one of the requests of a batch
+type BatchRequestJSON struct {
+	//ID is given back with the response, so clients can tell them apart
+	ID string `json:"id,omitempty"`
+	//Method is GET, the only one allowed, if it isn't set
+	Method string `json:"method,omitempty"`
+	//Path is relative to the version the batch is posted to, such as /modules/COMP6580?expand=events
+	Path string `json:"path"`
+}
+
+//BatchResponseJSON is the answer to one of the requests of a batch
+type BatchResponseJSON struct {
+	ID     string `json:"id,omitempty"`
+	Status int    `json:"status"`
+	//Headers are the Content-Type, ETag, X-Total-Count and deprecation headers of the answer
+	Headers map[string]string `json:"headers,omitempty"`
+	//Body is json as it is, or a string holding anything else, such as csv
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+//BatchResultJSON is the answer to a batch, with the responses in the order the requests were sent
+type BatchResultJSON struct {
+	Responses []BatchResponseJSON `json:"responses"`
+}
+
+//batchHeaders are the headers of the sub-responses given back
+var batchHeaders = []string{"Content-Type", "ETag", "X-Total-Count", "Deprecation", "Sunset", "Link"}
+
+//Batch answers several GET requests to the routes of router at once, such as the timetables of several modules,
+//saving the round trips for clients on poor connections. They are answered concurrently, as the key or user
+//the batch was sent with, and each has its own status, so one failing doesn't fail the others.
+//They go through the middleware of the router SetupRouter made, as if they had been sent on their own.
+func (config *Config) Batch(router *mux.Router) http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		var batch BatchJSON
+		defer r.Body.Close()
+		err := json.NewDecoder(io.LimitReader(r.Body, 1048576)).Decode(&batch)
+		if err != nil {
+			return badRequest("Could not read the batch.", err)
+		}
+		if len(batch.Requests) == 0 {
+			return badRequest("The batch has no requests.", nil)
+		}
+		if len(batch.Requests) > MaxBatchRequests {
+			return badRequest(fmt.Sprintf("A batch can have at most %d requests.", MaxBatchRequests), nil)
+		}
+
+		// The sub-requests are routed under the same prefix as the batch, such as /v1
+		prefix := ""
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				prefix = strings.TrimSuffix(template, "/batch")
+			}
+		}
+
+		subs := make([]*http.Request, len(batch.Requests))
+		handlers := make([]http.Handler, len(batch.Requests))
+		for i, req := range batch.Requests {
+			subs[i], handlers[i], err = config.batchRequest(r, router, prefix, req)
+			if err != nil {
+				return err
+			}
+		}
+
+		result := BatchResultJSON{Responses: make([]BatchResponseJSON, len(subs))}
+		sem := make(chan struct{}, batchConcurrency)
+		var wg sync.WaitGroup
+		for i, sub := range subs {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int, sub *http.Request) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				// Each has its own log, which would otherwise overwrite why the others failed
+				rl := &requestLog{}
+				rec := &batchRecorder{header: make(http.Header)}
+				handlers[i].ServeHTTP(rec, sub.WithContext(context.WithValue(sub.Context(), requestLogContextKey{}, rl)))
+				result.Responses[i] = rec.response(batch.Requests[i].ID)
+				if rl.err != nil {
+					logAttrs(r.Context(), slog.Group("batch_"+strconv.Itoa(i),
+						slog.String("path", batch.Requests[i].Path),
+						slog.Int("status", result.Responses[i].Status),
+						slog.String("error", rl.err.Error()),
+					))
+				}
+			}(i, sub)
+		}
+		wg.Wait()
+
+		return writeJSON(w, http.StatusOK, result)
+	})
+}
+
+//batchRequest returns the request for one of the requests of the batch r, checking it can be batched, and what answers it.
+//That is the root router when router has a route for it, so the paths outside the version, such as /metrics, can't be batched.
+func (config *Config) batchRequest(r *http.Request, router *mux.Router, prefix string, req BatchRequestJSON) (*http.Request, http.Handler, error) {
+	method := strings.ToUpper(req.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	if method != http.MethodGet {
+		return nil, nil, badRequest(fmt.Sprintf("The request %q can only be a GET.", req.Path), nil)
+	}
+	target, err := url.Parse(req.Path)
+	if err != nil || !strings.HasPrefix(target.Path, "/") || target.Host != "" {
+		return nil, nil, badRequest(fmt.Sprintf("The path %q must be an absolute path, such as /modules/COMP6580.", req.Path), err)
+	}
+	target.Path = prefix + target.Path
+
+	sub, err := http.NewRequestWithContext(r.Context(), method, target.String(), nil)
+	if err != nil {
+		return nil, nil, badRequest(fmt.Sprintf("The path %q can't be requested.", req.Path), err)
+	}
+	// The key or user the batch was sent with are already in its context
+	sub.RemoteAddr = r.RemoteAddr
+	sub.Header.Set("Accept", "application/json")
+	if accept := r.Header.Get("Accept-Language"); accept != "" {
+		sub.Header.Set("Accept-Language", accept)
+	}
+
+	var match mux.RouteMatch
+	if !router.Match(sub, &match) || match.Route == nil {
+		if match.MatchErr == mux.ErrMethodMismatch {
+			return sub, http.HandlerFunc(MethodNotAllowed), nil
+		}
+		return sub, http.HandlerFunc(NotFound), nil
+	}
+	if template, err := match.Route.GetPathTemplate(); err == nil && unbatchable[strings.TrimPrefix(template, prefix)] {
+		return nil, nil, badRequest(fmt.Sprintf("The path %q can't be part of a batch.", req.Path), nil)
+	}
+	if config.root == nil {
+		return sub, router, nil
+	}
+	return sub, config.root, nil
+}
+
+//batchRecorder holds the answer to a sub-request of a batch
+type batchRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *batchRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *batchRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+}
+
+func (rec *batchRecorder) Write(p []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.body.Write(p)
+}
+
+//response returns the answer as it is given back in the batch
+func (rec *batchRecorder) response(id string) BatchResponseJSON {
+	resp := BatchResponseJSON{ID: id, Status: rec.status, Headers: make(map[string]string)}
+	if resp.Status == 0 {
+		resp.Status = http.StatusOK
+	}
+	for _, name := range batchHeaders {
+		if value := rec.header.Get(name); value != "" {
+			resp.Headers[name] = value
+		}
+	}
+	if rec.body.Len() == 0 {
+		return resp
+	}
+	if json.Valid(rec.body.Bytes()) && strings.Contains(rec.header.Get("Content-Type"), "json") {
+		resp.Body = rec.body.Bytes()
+		return resp
+	}
+	resp.Body, _ = json.Marshal(rec.body.String())
+	return resp
+}
@@ -1,8 +1,9 @@
 package api
 
 import (
+	"context"
 	"hash/fnv"
-	"log"
+	"log/slog"
 	"time"
 
 	badger "github.com/dgraph-io/badger/v2"
@@ -29,7 +30,6 @@ func (config *Config) GetCache(query string) (*string, error) {
 		return nil, err
 	}
 	temp := string(valCopy)
-	log.Println("Successful cache-hit!")
 
 	return &temp, nil
 }
@@ -41,26 +41,34 @@ func (config *Config) SetCache(query string, answer string) error {
 		err := txn.SetEntry(e)
 		return err
 	})
-	log.Println("Saved to cache!")
 	return err
 }
 
 //PerformCachedQuery is the main accessor with cache abilities
-func (config *Config) PerformCachedQuery(query string) (*string, error) {
+//It is the same as PerformQuery if there is no CacheDB
+func (config *Config) PerformCachedQuery(ctx context.Context, query string) (*string, error) {
+	if config.CacheDB == nil {
+		return config.PerformQuery(ctx, query)
+	}
 	//Try to retrieve from cache
 	answer, err := config.GetCache(query)
 	if err != nil {
 		//If its not in the cache
 		if err == badger.ErrKeyNotFound {
 			// Lock.Lock() //The lock can be used if deemed necessary. Doesn't seem to be an issue for now
-			res, queryErr := config.PerformQuery(query)
+			res, queryErr := config.PerformQuery(ctx, query)
 			// Lock.Unlock()
 			if queryErr != nil {
 				return nil, queryErr
 			}
 
+			logAttrs(ctx, slog.Bool("cache_hit", false))
 			//Save to cache in a goroutine
-			go config.SetCache(query, *res)
+			go func() {
+				if err := config.SetCache(query, *res); err != nil {
+					config.Logger.Error("Could not save the query to the cache", "error", err)
+				}
+			}()
 
 			//Return result
 			return res, queryErr
@@ -68,13 +76,18 @@ func (config *Config) PerformCachedQuery(query string) (*string, error) {
 		return nil, err
 	}
 	//If it is in the cache
+	logAttrs(ctx, slog.Bool("cache_hit", true))
 	return answer, nil
 }
 
 //PerformQuery is the main db accessor, without caching abilities.
-func (config *Config) PerformQuery(query string) (*string, error) {
+func (config *Config) PerformQuery(ctx context.Context, query string) (*string, error) {
 	//Get client connection
-	result, err := config.DBClient.ReadOnly(query)
+	result, err := config.DBClient.ReadOnly(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	result, err = scrubPrivate(result)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+	"github.com/jamesjarvis/WhatsUpKent/pkg/ical"
+)
+
+//uidDomain makes the event ids globally unique, as calendar UIDs have to be
+const uidDomain = "whatsupkent.com"
+
+const (
+	//CalendarHistory is how far back the location calendars go without ?from and ?to
+	CalendarHistory = 4 * 7 * 24 * time.Hour
+	//CalendarHorizon is how far ahead the location calendars go without ?from and ?to
+	CalendarHorizon = 26 * 7 * 24 * time.Hour
+)
+
+//GetModuleCalendar returns the events of the module with the code in the path as an iCalendar feed to subscribe to,
+//only those in the rooms ?campus and ?accessible leave in, see filterEvents
+func (config *Config) GetModuleCalendar() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		code := mux.Vars(r)["code"]
+		module, err := config.DBClient.GetModuleFromSDSCode(r.Context(), code)
+		if err != nil {
+			return err
+		}
+		events, err := config.DBClient.GetEventsByModule(r.Context(), code)
+		if err != nil {
+			return err
+		}
+		name := module.Code
+		if module.Name != "" {
+			name += " " + module.Name
+		}
+		return config.writeCalendar(w, r, ical.Calendar{Name: name, Events: calendarEvents(filterEvents(r, events))})
+	})
+}
+
+//GetLocationCalendar returns the bookings of the location with the kent slug in the path as an iCalendar feed,
+//covering the events overlapping ?from and ?to, or from CalendarHistory ago to CalendarHorizon ahead without them
+func (config *Config) GetLocationCalendar() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		from, to, filtered, err := parseDateRange(r)
+		if err != nil {
+			return err
+		}
+		if !filtered {
+			now := time.Now()
+			from, to = now.Add(-CalendarHistory), now.Add(CalendarHorizon)
+		}
+
+		slug := mux.Vars(r)["slug"]
+		location, err := config.DBClient.GetLocationFromKentSlug(r.Context(), slug)
+		if err != nil {
+			return err
+		}
+		events, err := config.DBClient.GetEventsByLocation(r.Context(), slug, from, to)
+		if err != nil {
+			return err
+		}
+		name := location.Name
+		if name == "" {
+			name = location.ID
+		}
+		return config.writeCalendar(w, r, ical.Calendar{Name: name, Events: calendarEvents(events)})
+	})
+}
+
+//MaxTimetableModules is the most modules GET /calendar.ics merges into one timetable
+const MaxTimetableModules = 20
+
+//GetTimetableCalendar merges the events of the comma separated ?modules into one iCalendar feed, a personal timetable.
+//Events shared by several of the modules appear once, with each of those modules' codes as its CATEGORIES.
+//?campus and ?accessible leave out the events in none of the rooms they leave in, see filterEvents.
+func (config *Config) GetTimetableCalendar() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		codes := parseModuleCodes(r)
+		if len(codes) == 0 {
+			return badRequest("Choose the modules of the timetable with ?modules, such as ?modules=COMP6580,COMP5590.", nil)
+		}
+		if len(codes) > MaxTimetableModules {
+			return badRequest(fmt.Sprintf("A timetable can have at most %d modules.", MaxTimetableModules), nil)
+		}
+
+		events := make([]db.Event, 0)
+		categories := make(map[string][]string)
+		for _, code := range codes {
+			// Look the module up first so a mistyped code is answered with a 404, rather than missing from the feed
+			if _, err := config.DBClient.GetModuleFromSDSCode(r.Context(), code); err != nil {
+				return err
+			}
+			moduleEvents, err := config.DBClient.GetEventsByModule(r.Context(), code)
+			if err != nil {
+				return err
+			}
+			for _, e := range filterEvents(r, moduleEvents) {
+				if _, seen := categories[e.UID]; !seen {
+					events = append(events, e)
+				}
+				categories[e.UID] = append(categories[e.UID], code)
+			}
+		}
+		sort.SliceStable(events, func(i, j int) bool {
+			return events[j].StartDate != nil && (events[i].StartDate == nil || events[i].StartDate.Before(*events[j].StartDate))
+		})
+
+		out := make([]ical.Event, 0, len(events))
+		for _, e := range events {
+			if ce, ok := calendarEvent(e); ok {
+				ce.Categories = categories[e.UID]
+				out = append(out, ce)
+			}
+		}
+		return config.writeCalendar(w, r, ical.Calendar{Name: "Timetable " + strings.Join(codes, ", "), Events: out})
+	})
+}
+
+//parseModuleCodes returns the distinct module codes listed in ?modules, in their order
+func parseModuleCodes(r *http.Request) []string {
+	codes := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, value := range r.URL.Query()["modules"] {
+		for _, code := range strings.Split(value, ",") {
+			code = strings.TrimSpace(code)
+			if code != "" && !seen[code] {
+				seen[code] = true
+				codes = append(codes, code)
+			}
+		}
+	}
+	return codes
+}
+
+//calendarEvents converts the events to calendar events, leaving out the ones without a start date
+func calendarEvents(events []db.Event) []ical.Event {
+	out := make([]ical.Event, 0, len(events))
+	for _, e := range events {
+		if ce, ok := calendarEvent(e); ok {
+			out = append(out, ce)
+		}
+	}
+	return out
+}
+
+//calendarEvent converts the event to a calendar event, which it can't be without a start date
+func calendarEvent(e db.Event) (ical.Event, bool) {
+	if e.StartDate == nil {
+		return ical.Event{}, false
+	}
+	id := e.ID
+	if id == "" {
+		id = e.UID
+	}
+	locations := make([]string, 0, len(e.Location))
+	for _, l := range e.Location {
+		locations = append(locations, l.Name)
+	}
+	ce := ical.Event{
+		UID:         id + "@" + uidDomain,
+		Summary:     e.Title,
+		Description: e.Description,
+		Location:    strings.Join(locations, ", "),
+		Start:       *e.StartDate,
+	}
+	if e.EndDate != nil {
+		ce.End = *e.EndDate
+	}
+	return ce, true
+}
+
+//writeCalendar answers with the calendar, stamped with when the timetable was last scraped.
+//That keeps the feed the same until the next scrape, so its ETag is too and the apps polling it get a 304.
+func (config *Config) writeCalendar(w http.ResponseWriter, r *http.Request, cal ical.Calendar) error {
+	latest, err := config.DBClient.GetLatestScrape(r.Context())
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		return err
+	}
+	if latest != nil && latest.LastScraped != nil {
+		cal.Stamp = *latest.LastScraped
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	return ical.Write(w, cal)
+}
@@ -0,0 +1,317 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+const (
+	//DefaultChangeInterval is how often the ChangeHub reads the changes the scraper has recorded
+	DefaultChangeInterval = 5 * time.Second
+	//subscriberBuffer is how many changes a subscriber can fall behind by before it is dropped
+	subscriberBuffer = 64
+	//changeBacklog is how many of the changes a subscriber missed it is sent when it resumes where it left off
+	changeBacklog = 1000
+)
+
+const (
+	//ScrapesTopic is the topic of the ChangeScraped notifications
+	ScrapesTopic = db.ScrapesTopic
+	//AllTopics subscribes to every change
+	AllTopics = "*"
+)
+
+//The types of ChangeJSON
+const (
+	ChangeAdded     = db.ChangeAdded
+	ChangeMoved     = db.ChangeMoved
+	ChangeUpdated   = db.ChangeUpdated
+	ChangeCancelled = db.ChangeCancelled
+	//ChangeScraped isn't a change to an event, but a scrape of a timetable finishing
+	ChangeScraped = db.ChangeScraped
+)
+
+//ChangeJSON is a change to the timetable, as it is pushed to the subscribers
+type ChangeJSON struct {
+	//ID is the Seq of the change in the database, which increases with every change so they can be ordered and resumed from
+	ID int64 `json:"id"`
+	//Type is one of ChangeAdded, ChangeMoved (a new time or place), ChangeUpdated, ChangeCancelled or ChangeScraped
+	Type string `json:"type"`
+	//Event is the event as it is now, rather than as it was when it changed
+	Event *db.Event `json:"event,omitempty"`
+	//Changes holds the fields which changed, for moved and updated events
+	Changes []db.FieldChange `json:"changes,omitempty"`
+	//Scrape is the scrape which finished, for ChangeScraped
+	Scrape *db.Scrape `json:"scrape,omitempty"`
+	//Topics are the topics the change was pushed to, see db.ChangeTopics
+	Topics []string `json:"topics"`
+	//At is when the scraper recorded the change
+	At time.Time `json:"at"`
+}
+
+//changeJSON returns the change recorded in the database as it is pushed to the subscribers
+func changeJSON(c db.Change) ChangeJSON {
+	change := ChangeJSON{ID: c.Seq, Type: c.Type, Event: c.Event, Changes: c.Changes, Scrape: c.Scrape, Topics: c.Topics}
+	// An event deleted since leaves nothing but its uid behind
+	if change.Event != nil && change.Event.ID == "" {
+		change.Event = nil
+	}
+	if change.Topics == nil {
+		change.Topics = make([]string, 0)
+	}
+	if c.At != nil {
+		change.At = *c.At
+	}
+	return change
+}
+
+//subscriber receives the changes on the topics it subscribed to, through send
+type subscriber struct {
+	send chan ChangeJSON
+}
+
+//ChangeHub reads the changes to the timetable the scraper records as it finds them,
+//and pushes them to the subscribers of the modules and locations of the events.
+//The changes are numbered by the database, so every api agrees on their ids and they outlive a restart.
+//Topics are named "module:<code>" and "location:<slug>", along with ScrapesTopic and AllTopics.
+type ChangeHub struct {
+	client db.Client
+	//Interval is how often the changes are read, it is DefaultChangeInterval if it isn't set
+	Interval time.Duration
+	//Logger logs the reads which failed, it is slog.Default() if it isn't set
+	Logger *slog.Logger
+
+	//startMu is held while the hub reads where the changes are up to
+	startMu     sync.Mutex
+	mu          sync.Mutex
+	subscribers map[*subscriber]bool
+	topics      map[string]map[*subscriber]bool
+	//lastID is the id of the latest change published, once started
+	lastID  int64
+	started bool
+}
+
+//NewChangeHub returns a hub of the changes recorded in the database, which Run has to be called to start
+func NewChangeHub(client db.Client) *ChangeHub {
+	return &ChangeHub{
+		client:      client,
+		subscribers: make(map[*subscriber]bool),
+		topics:      make(map[string]map[*subscriber]bool),
+	}
+}
+
+//Run publishes the changes recorded every Interval until ctx is done
+func (h *ChangeHub) Run(ctx context.Context) {
+	interval := h.Interval
+	if interval == 0 {
+		interval = DefaultChangeInterval
+	}
+	logger := h.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := h.check(ctx); err != nil && ctx.Err() == nil {
+			logger.Error("Reading the changes to the timetable failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+//start reads the id of the latest change recorded, which the hub publishes the changes after, unless it has already.
+//The changes recorded before the hub started are only sent to the subscribers resuming after them.
+func (h *ChangeHub) start(ctx context.Context) error {
+	h.startMu.Lock()
+	defer h.startMu.Unlock()
+	h.mu.Lock()
+	started := h.started
+	h.mu.Unlock()
+	if started {
+		return nil
+	}
+
+	var lastID int64
+	latest, err := h.client.GetLatestChange(ctx)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		return err
+	}
+	if latest != nil {
+		lastID = latest.Seq
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastID, h.started = lastID, true
+	return nil
+}
+
+//check publishes the changes recorded since the last one published, a page of db.MaxListLimit at a time
+func (h *ChangeHub) check(ctx context.Context) error {
+	if err := h.start(ctx); err != nil {
+		return err
+	}
+	h.mu.Lock()
+	lastID := h.lastID
+	h.mu.Unlock()
+	for {
+		changes, err := h.client.ListChanges(ctx, db.ChangeFilter{After: lastID}, db.ListOptions{First: db.MaxListLimit})
+		if err != nil {
+			return err
+		}
+		for _, c := range changes {
+			h.publish(changeJSON(c))
+			lastID = c.Seq
+		}
+		if len(changes) < db.MaxListLimit {
+			return nil
+		}
+	}
+}
+
+//subscribe returns a new subscriber to the topics, along with the changes to them after the one with the id lastID,
+//up to the latest changeBacklog of them. A lastID of 0 doesn't return any.
+func (h *ChangeHub) subscribe(ctx context.Context, topics []string, lastID int64) (*subscriber, []ChangeJSON, error) {
+	if err := h.start(ctx); err != nil {
+		return nil, nil, err
+	}
+	s := &subscriber{send: make(chan ChangeJSON, subscriberBuffer)}
+	// The changes up to the latest published are read from the database, and the ones after are sent to s,
+	// so no change is missed, or sent twice, in between
+	h.mu.Lock()
+	h.subscribers[s] = true
+	h.addTopics(s, topics)
+	upTo := h.lastID
+	h.mu.Unlock()
+
+	missed := make([]ChangeJSON, 0)
+	if lastID <= 0 || lastID >= upTo {
+		return s, missed, nil
+	}
+	filter := db.ChangeFilter{After: lastID, Before: upTo + 1}
+	if !contains(topics, AllTopics) {
+		filter.Topics = topics
+	}
+	changes, err := h.client.ListChanges(ctx, filter, db.ListOptions{First: changeBacklog, Descending: true})
+	if err != nil {
+		h.unsubscribe(s)
+		return nil, nil, err
+	}
+	for i := len(changes) - 1; i >= 0; i-- {
+		missed = append(missed, changeJSON(changes[i]))
+	}
+	return s, missed, nil
+}
+
+//wait waits for an Interval, for trying to subscribe again after it failed, returning false if ctx is done first
+func (h *ChangeHub) wait(ctx context.Context) bool {
+	interval := h.Interval
+	if interval == 0 {
+		interval = DefaultChangeInterval
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(interval):
+		return true
+	}
+}
+
+//recent returns the latest changes to the events on the topic, or every one for AllTopics, newest first
+func (h *ChangeHub) recent(ctx context.Context, topic string, limit int) ([]ChangeJSON, error) {
+	filter := db.ChangeFilter{EventsOnly: true}
+	if topic != AllTopics {
+		filter.Topics = []string{topic}
+	}
+	changes, err := h.client.ListChanges(ctx, filter, db.ListOptions{First: limit, Descending: true})
+	if err != nil {
+		return nil, err
+	}
+	recent := make([]ChangeJSON, 0, len(changes))
+	for _, c := range changes {
+		recent = append(recent, changeJSON(c))
+	}
+	return recent, nil
+}
+
+//setTopics subscribes s to the topics in add, and unsubscribes it from the ones in remove
+func (h *ChangeHub) setTopics(s *subscriber, add, remove []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.subscribers[s] {
+		return
+	}
+	h.addTopics(s, add)
+	for _, topic := range remove {
+		delete(h.topics[topic], s)
+		if len(h.topics[topic]) == 0 {
+			delete(h.topics, topic)
+		}
+	}
+}
+
+//addTopics subscribes s to the topics, with h.mu held
+func (h *ChangeHub) addTopics(s *subscriber, topics []string) {
+	for _, topic := range topics {
+		if h.topics[topic] == nil {
+			h.topics[topic] = make(map[*subscriber]bool)
+		}
+		h.topics[topic][s] = true
+	}
+}
+
+//unsubscribe removes s from every topic, and closes its channel if it hadn't been already
+func (h *ChangeHub) unsubscribe(s *subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.drop(s)
+}
+
+//drop is unsubscribe, with h.mu held
+func (h *ChangeHub) drop(s *subscriber) {
+	if !h.subscribers[s] {
+		return
+	}
+	delete(h.subscribers, s)
+	for topic, subscribers := range h.topics {
+		delete(subscribers, s)
+		if len(subscribers) == 0 {
+			delete(h.topics, topic)
+		}
+	}
+	close(s.send)
+}
+
+//publish sends the change once to every subscriber of any of its topics or AllTopics.
+//Subscribers which have fallen too far behind are dropped, rather than holding up everyone else.
+func (h *ChangeHub) publish(change ChangeJSON) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastID = change.ID
+
+	topics := make([]string, 0, len(change.Topics)+1)
+	topics = append(append(topics, change.Topics...), AllTopics)
+	sent := make(map[*subscriber]bool)
+	for _, topic := range topics {
+		for s := range h.topics[topic] {
+			if sent[s] {
+				continue
+			}
+			sent[s] = true
+			select {
+			case s.send <- change:
+			default:
+				h.drop(s)
+			}
+		}
+	}
+}
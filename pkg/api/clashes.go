@@ -0,0 +1,144 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+//ClashesRequestJSON is what POST /clashes is sent, the modules of a timetable, such as the ones a student takes
+//along with one they are thinking of taking
+type ClashesRequestJSON struct {
+	Modules []string `json:"modules"`
+	//From and To choose the window the events are checked over, without them it is every upcoming event
+	From *time.Time `json:"from,omitempty"`
+	To   *time.Time `json:"to,omitempty"`
+}
+
+//ClashingEventJSON is one of the events of a clash, with the module it is an event of
+type ClashingEventJSON struct {
+	Module string   `json:"module"`
+	Event  db.Event `json:"event"`
+}
+
+//ClashJSON is a pair of events of different modules which overlap, from Start to End
+type ClashJSON struct {
+	First  ClashingEventJSON `json:"first"`
+	Second ClashingEventJSON `json:"second"`
+	Start  time.Time         `json:"start"`
+	End    time.Time         `json:"end"`
+}
+
+//ClashesJSON is the answer of POST /clashes, the clashes ordered by when they start
+type ClashesJSON struct {
+	Modules []string    `json:"modules"`
+	Clashes []ClashJSON `json:"clashes"`
+}
+
+//Clashes finds the events of the modules posted which overlap an event of another of the modules,
+//so a student can check whether a module they are thinking of taking fits their timetable.
+//Events of the same module don't clash, as they are usually alternative groups, and neither does an event
+//shared by several of the modules with itself.
+func (config *Config) Clashes() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		var req ClashesRequestJSON
+		defer r.Body.Close()
+		err := json.NewDecoder(io.LimitReader(r.Body, 1048576)).Decode(&req)
+		if err != nil {
+			return badRequest("Could not read the modules.", err)
+		}
+		codes := make([]string, 0, len(req.Modules))
+		seen := make(map[string]bool)
+		for _, code := range req.Modules {
+			code = strings.TrimSpace(code)
+			if code != "" && !seen[code] {
+				seen[code] = true
+				codes = append(codes, code)
+			}
+		}
+		v := &validator{}
+		v.moduleCodes("body", "modules", codes)
+		if len(codes) < 2 {
+			v.fail("body", "modules", "At least two modules are needed to check for clashes.")
+		}
+		if len(codes) > MaxTimetableModules {
+			v.fail("body", "modules", fmt.Sprintf("A timetable can have at most %d modules.", MaxTimetableModules))
+		}
+		if (req.From == nil) != (req.To == nil) {
+			v.fail("body", "to", "Both from and to are needed to check a window.")
+		}
+		if req.From != nil && req.To != nil && req.To.Before(*req.From) {
+			v.fail("body", "to", "The to date can't be before the from date.")
+		}
+		if err := v.err(); err != nil {
+			return err
+		}
+
+		events := make([]ClashingEventJSON, 0)
+		for _, code := range codes {
+			// Look the module up first so a mistyped code is answered with a 404, rather than never clashing
+			if _, err := config.DBClient.GetModuleFromSDSCode(r.Context(), code); err != nil {
+				return err
+			}
+			moduleEvents, err := config.DBClient.GetEventsByModule(r.Context(), code)
+			if err != nil {
+				return err
+			}
+			if req.From == nil {
+				moduleEvents = upcoming(moduleEvents, time.Now())
+			}
+			for _, e := range moduleEvents {
+				if e.StartDate == nil || e.EndDate == nil {
+					continue
+				}
+				if req.From != nil && (e.EndDate.Before(*req.From) || e.StartDate.After(*req.To)) {
+					continue
+				}
+				events = append(events, ClashingEventJSON{Module: code, Event: e})
+			}
+		}
+
+		return writeJSON(w, http.StatusOK, ClashesJSON{Modules: codes, Clashes: findClashes(events)})
+	})
+}
+
+//findClashes returns the pairs of the events of different modules which overlap, ordered by when they start.
+//Events which only touch, one ending as the other starts, don't clash.
+func findClashes(events []ClashingEventJSON) []ClashJSON {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Event.StartDate.Before(*events[j].Event.StartDate)
+	})
+
+	clashes := make([]ClashJSON, 0)
+	for i, first := range events {
+		for _, second := range events[i+1:] {
+			// Sorted by start, so none of the rest can overlap the first either
+			if !second.Event.StartDate.Before(*first.Event.EndDate) {
+				break
+			}
+			if first.Module == second.Module || first.Event.UID == second.Event.UID {
+				continue
+			}
+			end := *first.Event.EndDate
+			if second.Event.EndDate.Before(end) {
+				end = *second.Event.EndDate
+			}
+			clashes = append(clashes, ClashJSON{
+				First:  first,
+				Second: second,
+				Start:  *second.Event.StartDate,
+				End:    end,
+			})
+		}
+	}
+	sort.SliceStable(clashes, func(i, j int) bool {
+		return clashes[i].Start.Before(clashes[j].Start)
+	})
+	return clashes
+}
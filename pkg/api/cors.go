@@ -0,0 +1,182 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//CORSOptions says which browser frontends can use the api, see https://developer.mozilla.org/docs/Web/HTTP/CORS
+type CORSOptions struct {
+	//AllowedOrigins are the origins allowed, such as "https://whatsupkent.com", or "*" for any of them
+	AllowedOrigins []string
+	//AllowedMethods are the methods the frontends can use
+	AllowedMethods []string
+	//AllowedHeaders are the request headers the frontends can send, or "*" for any of them
+	AllowedHeaders []string
+	//ExposedHeaders are the response headers the frontends can read, beyond the ones browsers always let them
+	ExposedHeaders []string
+	//AllowCredentials lets the frontends send cookies and Authorization headers the browser manages
+	AllowCredentials bool
+	//MaxAge is how long browsers can cache the answer to a preflight request
+	MaxAge time.Duration
+}
+
+//DefaultCORSOptions lets any origin use the api, with the methods of its routes
+func DefaultCORSOptions() CORSOptions {
+	return CORSOptions{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE"},
+		AllowedHeaders: []string{"X-Requested-With", "Content-Type", "Authorization", "X-API-Key", "Last-Event-ID", "X-Request-ID"},
+		ExposedHeaders: []string{"X-Total-Count", "Deprecation", "Sunset", "Link", "X-Request-ID"},
+		MaxAge:         10 * time.Minute,
+	}
+}
+
+//LoadCORSOptions returns DefaultCORSOptions with whichever of CORS_ALLOWED_ORIGINS, CORS_ALLOWED_METHODS,
+//CORS_ALLOWED_HEADERS, CORS_EXPOSED_HEADERS (comma separated), CORS_ALLOW_CREDENTIALS (a bool)
+//and CORS_MAX_AGE (a duration such as "10m") lookup finds, usually os.LookupEnv
+func LoadCORSOptions(lookup func(string) (string, bool)) (CORSOptions, error) {
+	opts := DefaultCORSOptions()
+	lists := map[string]*[]string{
+		"CORS_ALLOWED_ORIGINS": &opts.AllowedOrigins,
+		"CORS_ALLOWED_METHODS": &opts.AllowedMethods,
+		"CORS_ALLOWED_HEADERS": &opts.AllowedHeaders,
+		"CORS_EXPOSED_HEADERS": &opts.ExposedHeaders,
+	}
+	for name, list := range lists {
+		if value, ok := lookup(name); ok {
+			*list = splitList(value)
+		}
+	}
+	if value, ok := lookup("CORS_ALLOW_CREDENTIALS"); ok {
+		allow, err := strconv.ParseBool(value)
+		if err != nil {
+			return opts, fmt.Errorf("CORS_ALLOW_CREDENTIALS should be true or false: %w", err)
+		}
+		opts.AllowCredentials = allow
+	}
+	if value, ok := lookup("CORS_MAX_AGE"); ok {
+		maxAge, err := time.ParseDuration(value)
+		if err != nil {
+			return opts, fmt.Errorf("CORS_MAX_AGE should be a duration such as 10m: %w", err)
+		}
+		opts.MaxAge = maxAge
+	}
+	return opts, nil
+}
+
+//splitList returns the trimmed, non empty values of the comma separated list
+func splitList(value string) []string {
+	values := make([]string, 0)
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+//allowsOrigin returns whether the origin is one of the allowed origins
+func (opts CORSOptions) allowsOrigin(origin string) bool {
+	for _, o := range opts.AllowedOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+//anyOrigin returns whether every origin is allowed, and is answered with the same "*" for all of them
+func (opts CORSOptions) anyOrigin() bool {
+	if opts.AllowCredentials {
+		// Browsers refuse credentialed responses allowing "*", so the origin has to be sent back instead
+		return false
+	}
+	for _, o := range opts.AllowedOrigins {
+		if o == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+//allows returns whether value is in the list, case insensitively, or the list has "*"
+func allows(list []string, value string) bool {
+	for _, v := range list {
+		if v == "*" || strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+//Handler wraps next so browsers on the allowed origins can use it, answering their preflight requests itself.
+//Requests from other origins are still served, just without the headers letting the browser read them.
+func (opts CORSOptions) Handler(next http.Handler) http.Handler {
+	methods := strings.Join(opts.AllowedMethods, ", ")
+	exposed := strings.Join(opts.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(opts.MaxAge / time.Second))
+
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		origin := r.Header.Get("Origin")
+		anyOrigin := opts.anyOrigin()
+		if !anyOrigin {
+			// The answer depends on the origin, so caches mustn't give it to the others
+			w.Header().Add("Vary", "Origin")
+		}
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if origin == "" || (!preflight && !opts.allowsOrigin(origin)) {
+			next.ServeHTTP(w, r)
+			return nil
+		}
+
+		allowOrigin := origin
+		if anyOrigin {
+			allowOrigin = "*"
+		}
+		if !preflight {
+			w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+			if opts.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+			if exposed != "" {
+				w.Header().Set("Access-Control-Expose-Headers", exposed)
+			}
+			next.ServeHTTP(w, r)
+			return nil
+		}
+
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		if !opts.allowsOrigin(origin) {
+			return &Error{Code: http.StatusForbidden, Status: "Forbidden", Message: fmt.Sprintf("The origin %s isn't allowed to use the api.", origin)}
+		}
+		method := r.Header.Get("Access-Control-Request-Method")
+		if !allows(opts.AllowedMethods, method) {
+			return &Error{Code: http.StatusForbidden, Status: "Forbidden", Message: fmt.Sprintf("The method %s isn't allowed.", method)}
+		}
+		requested := splitList(r.Header.Get("Access-Control-Request-Headers"))
+		for _, header := range requested {
+			if !allows(opts.AllowedHeaders, header) {
+				return &Error{Code: http.StatusForbidden, Status: "Forbidden", Message: fmt.Sprintf("The header %s isn't allowed.", header)}
+			}
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+		w.Header().Set("Access-Control-Allow-Methods", methods)
+		if len(requested) > 0 {
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+		}
+		if opts.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		if opts.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", maxAge)
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+//eventColumns is the header row of the events as csv
+var eventColumns = []string{"title", "start", "end", "location", "module", "organiser"}
+
+//writeEventsCSV answers with the events as a flat csv, one row per event.
+//Events with several locations, modules or organisers have them separated by "; " in the one column.
+func writeEventsCSV(w http.ResponseWriter, events []db.Event) error {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="events.csv"`)
+
+	out := csv.NewWriter(w)
+	if err := out.Write(eventColumns); err != nil {
+		return err
+	}
+	for _, e := range events {
+		locations := make([]string, len(e.Location))
+		for i, l := range e.Location {
+			locations[i] = l.Name
+		}
+		modules := make([]string, len(e.PartOfModule))
+		for i, m := range e.PartOfModule {
+			modules[i] = m.Code
+		}
+		organisers := make([]string, len(e.Organiser))
+		for i, p := range e.Organiser {
+			organisers[i] = p.Name
+		}
+		err := out.Write([]string{
+			e.Title,
+			formatCSVTime(e.StartDate),
+			formatCSVTime(e.EndDate),
+			strings.Join(locations, "; "),
+			strings.Join(modules, "; "),
+			strings.Join(organisers, "; "),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+//formatCSVTime formats the time as RFC3339, which spreadsheets can read, or leaves it blank if it isn't set
+func formatCSVTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"encoding/base64"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+//encodeCursor returns the opaque ?cursor of the page after the event, which must have a start date.
+//Clients only ever pass it back, so what is in it can change.
+func encodeCursor(e db.Event) string {
+	c := db.CursorAt(e)
+	return base64.RawURLEncoding.EncodeToString([]byte(c.Start.UTC().Format(time.RFC3339Nano) + "," + c.UID))
+}
+
+//parseCursor reads the ?cursor of a page of events, returning nil if there isn't one.
+//A cursor replaces the offset, and goes through the events in the order they start, so it can't be given with either or a ?sort.
+func parseCursor(r *http.Request) (*db.EventCursor, error) {
+	query := r.URL.Query()
+	raw := query.Get("cursor")
+	if raw == "" {
+		return nil, nil
+	}
+	v := &validator{}
+	if query.Get("offset") != "" {
+		v.fail("query", "cursor", "A cursor can't be given along with an offset.")
+		return nil, v.err()
+	}
+	if query.Get("sort") != "" {
+		v.fail("query", "cursor", "A cursor can't be given along with a sort.")
+		return nil, v.err()
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(raw)
+	parts := strings.SplitN(string(decoded), ",", 2)
+	if err != nil || len(parts) != 2 || !strings.HasPrefix(parts[1], "0x") {
+		v.fail("query", "cursor", "The cursor isn't one a page of events was answered with.")
+		return nil, v.err()
+	}
+	start, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		v.fail("query", "cursor", "The cursor isn't one a page of events was answered with.")
+		return nil, v.err()
+	}
+	return &db.EventCursor{Start: start, UID: parts[1]}, nil
+}
+
+//sortEvents orders the events by start date and then uid, the order cursors page through them in
+func sortEvents(events []db.Event) {
+	sort.SliceStable(events, func(i, j int) bool {
+		a, b := events[i].StartDate, events[j].StartDate
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		if !a.Equal(*b) {
+			return a.Before(*b)
+		}
+		return db.CursorAt(events[i]).Precedes(events[j])
+	})
+}
+
+//eventLister lists the pages of some events from the database, for listEventPage
+type eventLister struct {
+	//list returns the page chosen by the options
+	list func(opts db.ListOptions) ([]db.Event, error)
+	//after returns up to opts.First of the events after the cursor
+	after func(cursor db.EventCursor, opts db.ListOptions) ([]db.Event, error)
+	//count returns how many events there are across every page
+	count func(opts db.ListOptions) (*int, error)
+}
+
+//listEventPage lists the page of the events after the cursor, or chosen by the list options without one, in the database.
+//It returns the options the page was listed with, how many events there are and the cursor of the page after it,
+//which is empty if there are no more events. Events sorted by opts.Sort are only paged by offset, so there is never a cursor.
+func listEventPage(l eventLister, cursor *db.EventCursor, opts db.ListOptions) ([]db.Event, db.ListOptions, int, string, error) {
+	var events []db.Event
+	var more bool
+	var err error
+	if cursor != nil {
+		// One more than the page is asked for, to tell whether there is a page after it
+		events, err = l.after(*cursor, db.ListOptions{First: opts.First + 1, Accessible: opts.Accessible, Campus: opts.Campus})
+		if err != nil {
+			return nil, opts, 0, "", err
+		}
+		if more = len(events) > opts.First; more {
+			events = events[:opts.First]
+		}
+		opts.Offset = 0
+	} else {
+		events, err = l.list(opts)
+		if err != nil {
+			return nil, opts, 0, "", err
+		}
+	}
+	if events == nil {
+		events = []db.Event{}
+	}
+	total, err := l.count(opts)
+	if err != nil {
+		return nil, opts, 0, "", err
+	}
+	if cursor == nil {
+		// The cursors go through the events in the order they start, so a sorted list is only paged by offset
+		more = opts.Offset+len(events) < *total && len(opts.Sort) == 0
+	}
+	return events, opts, *total, nextCursor(events, more), nil
+}
+
+//pageEventsAfter returns the page of the events after the cursor, or chosen by the list options without one,
+//along with the cursor of the page after it, which is empty if there are no more events.
+//Events sorted by opts.Sort are only paged by offset, so there is never a cursor.
+func pageEventsAfter(events []db.Event, cursor *db.EventCursor, opts db.ListOptions) ([]db.Event, string) {
+	sortEvents(events)
+	if len(opts.Sort) > 0 {
+		db.SortNodes(events, opts.Sort)
+		start, end := pageBounds(len(events), opts)
+		return events[start:end], ""
+	}
+	if cursor != nil {
+		after := make([]db.Event, 0)
+		for _, e := range events {
+			if cursor.Precedes(e) {
+				after = append(after, e)
+			}
+		}
+		events, opts.Offset = after, 0
+	}
+	start, end := pageBounds(len(events), opts)
+	return events[start:end], nextCursor(events[start:end], end < len(events))
+}
+
+//nextCursor returns the cursor of the page after the page of events, if there are more after it
+func nextCursor(page []db.Event, more bool) string {
+	if !more || len(page) == 0 || page[len(page)-1].StartDate == nil {
+		return ""
+	}
+	return encodeCursor(page[len(page)-1])
+}
+
+//setNextLink links the request to the page after it with a Link header, for the formats with nowhere else to put the cursor
+func setNextLink(w http.ResponseWriter, r *http.Request, next string) {
+	if next == "" {
+		return
+	}
+	u := *r.URL
+	query := u.Query()
+	query.Del("offset")
+	query.Set("cursor", next)
+	u.RawQuery = query.Encode()
+	w.Header().Add("Link", "<"+u.RequestURI()+`>; rel="next"`)
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+//ProblemContentType is the content type of the errors the api answers with, see ProblemJSON
+const ProblemContentType = "application/problem+json"
+
+//problemTypes is where the problem types are named, each one is the slug of its title under it
+const problemTypes = "https://" + uidDomain + "/problems/"
+
+//ProblemJSON is the response sent back in case of an error, an RFC 7807 problem.
+//Clients can tell the kinds of problem apart by their type, rather than by reading the detail.
+type ProblemJSON struct {
+	//Type is a URI naming the kind of problem, such as https://whatsupkent.com/problems/not-found
+	Type string `json:"type"`
+	//Title is a short summary of the kind of problem, which is the same for every problem of its type
+	Title string `json:"title"`
+	//Status is the http status code the problem is answered with
+	Status int `json:"status"`
+	//Detail says what went wrong with this request
+	Detail string `json:"detail"`
+	//RequestID identifies the request in the logs, for reporting the problem
+	RequestID string `json:"request_id,omitempty"`
+	//Errors are what is wrong with each field of a request which failed validation, see ValidationError
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+//problem returns the problem answered with the status code, whose title is also its type
+func problem(code int, title, detail string) ProblemJSON {
+	return ProblemJSON{
+		Type:   problemTypes + strings.ReplaceAll(strings.ToLower(title), " ", "-"),
+		Title:  title,
+		Status: code,
+		Detail: detail,
+	}
+}
+
+//HandlerFunc is a handler which returns its error instead of answering it, see Handle
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+//Error is an error to be answered with a particular status code and message
+type Error struct {
+	//Code is the http status code
+	Code int
+	//Status and Message are sent back as the title and detail of the ProblemJSON
+	Status, Message string
+	//Err is the underlying error, it is logged but not sent back
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+//badRequest is the error for a request which can't be answered as it is
+func badRequest(message string, err error) *Error {
+	return &Error{Code: http.StatusBadRequest, Status: "Bad Request", Message: message, Err: err}
+}
+
+//Handle turns the HandlerFunc into an http handler, answering any error it returns with a ProblemJSON.
+//An Error is answered as it says, anything wrapping db.ErrNotFound with a 404, and everything else with a 500,
+//without the details of what went wrong.
+func Handle(h HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := h(w, r)
+		if err == nil {
+			return
+		}
+		writeError(w, r, err)
+	}
+}
+
+//writeError answers the request with the problem the error maps to, see Handle
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	body := errorResponse(err)
+	// The request log says why it failed, otherwise anything which isn't the client's fault is logged here
+	if !logRequestError(r.Context(), err) && body.Status >= http.StatusInternalServerError {
+		log.Printf("%s %s failed (request %s): %v", r.Method, r.URL.Path, RequestIDFromContext(r.Context()), err)
+	}
+	body.RequestID = RequestIDFromContext(r.Context())
+	if writeErr := writeProblem(w, body); writeErr != nil {
+		log.Printf("%s %s: could not write the error response: %v", r.Method, r.URL.Path, writeErr)
+	}
+}
+
+//errorResponse maps the error to the problem it is answered with
+func errorResponse(err error) ProblemJSON {
+	var apiErr *Error
+	var validationErr *ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return validationErr.problem()
+	case errors.As(err, &apiErr):
+		return problem(apiErr.Code, apiErr.Status, apiErr.Message)
+	case errors.Is(err, db.ErrNotFound):
+		return problem(http.StatusNotFound, "Not Found", err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return problem(http.StatusGatewayTimeout, "Timeout", "The database took too long to answer.")
+	default:
+		return problem(http.StatusInternalServerError, "Internal Server Error", "Something went wrong.")
+	}
+}
+
+//writeProblem answers with the problem, as application/problem+json
+func writeProblem(w http.ResponseWriter, body ProblemJSON) error {
+	marshalled, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(body.Status)
+	_, err = w.Write(marshalled)
+	return err
+}
+
+//NotFound answers the requests for the paths which aren't routed, in place of the router's plain text
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, &Error{Code: http.StatusNotFound, Status: "Not Found", Message: "There is nothing at " + r.URL.Path + "."})
+}
+
+//MethodNotAllowed answers the requests for the paths which are routed, but not for their method
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, &Error{Code: http.StatusMethodNotAllowed, Status: "Method Not Allowed", Message: r.Method + " can't be used on " + r.URL.Path + "."})
+}
+
+//writeJSON answers with the value as json, and the status code if it isn't 200
+func writeJSON(w http.ResponseWriter, code int, v interface{}) error {
+	marshalled, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if code != http.StatusOK {
+		w.WriteHeader(code)
+	}
+	_, err = w.Write(marshalled)
+	return err
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+//MaxETagSize is the largest response an ETag is worked out for, bigger ones are sent on as they are written
+const MaxETagSize = 8 << 20
+
+//ETags tags the successful GET responses with a weak ETag of their body, answering an If-None-Match
+//with the same tag with a 304 rather than the body again, so the clients polling for changes only download them.
+//Responses which are flushed as they are written, such as event streams, aren't tagged.
+func ETags(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ew := &etagWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(ew, r)
+		ew.finish(r)
+	})
+}
+
+//etagWriter holds the response back until the handler is done, so its ETag can be worked out before it is sent
+type etagWriter struct {
+	http.ResponseWriter
+	status    int
+	buf       []byte
+	streaming bool
+}
+
+func (ew *etagWriter) WriteHeader(code int) {
+	if ew.streaming {
+		return
+	}
+	ew.status = code
+}
+
+func (ew *etagWriter) Write(p []byte) (int, error) {
+	if ew.streaming {
+		return ew.ResponseWriter.Write(p)
+	}
+	ew.buf = append(ew.buf, p...)
+	if len(ew.buf) > MaxETagSize {
+		if err := ew.stream(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+//stream gives up on the ETag, sending on what has been written so far and everything after it
+func (ew *etagWriter) stream() error {
+	ew.streaming = true
+	ew.ResponseWriter.WriteHeader(ew.status)
+	buf := ew.buf
+	ew.buf = nil
+	_, err := ew.ResponseWriter.Write(buf)
+	return err
+}
+
+func (ew *etagWriter) Flush() {
+	if !ew.streaming {
+		ew.stream()
+	}
+	if f, ok := ew.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+//Unwrap lets http.ResponseController reach the underlying writer
+func (ew *etagWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
+
+//finish tags the response and sends it, or a 304 if the client already has it
+func (ew *etagWriter) finish(r *http.Request) {
+	if ew.streaming {
+		return
+	}
+	h := ew.Header()
+	if ew.status == http.StatusOK && h.Get("ETag") == "" {
+		sum := sha256.Sum256(ew.buf)
+		// Weak, as the same body can be sent compressed or not
+		h.Set("ETag", `W/"`+hex.EncodeToString(sum[:16])+`"`)
+	}
+	if ew.status == http.StatusOK && etagMatches(r.Header.Get("If-None-Match"), h.Get("ETag")) {
+		h.Del("Content-Type")
+		h.Del("Content-Length")
+		ew.ResponseWriter.WriteHeader(http.StatusNotModified)
+		return
+	}
+	ew.ResponseWriter.WriteHeader(ew.status)
+	ew.ResponseWriter.Write(ew.buf)
+}
+
+//etagMatches returns whether the If-None-Match header has the tag, comparing them weakly as RFC 7232 says to
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/atom"
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+//FeedEntries is how many of the latest changes the feeds list
+const FeedEntries = 100
+
+//feedID is the tag URI (RFC 4151) the ids of the feeds and their entries start with
+const feedID = "tag:" + uidDomain + ",2020:"
+
+//changeTitles are what the entries of the types of changes are titled with
+var changeTitles = map[string]string{
+	ChangeAdded:     "Added",
+	ChangeMoved:     "Moved",
+	ChangeUpdated:   "Updated",
+	ChangeCancelled: "Cancelled",
+}
+
+//ChangesFeed returns an Atom feed of the latest events added, moved, updated and cancelled, newest first,
+//only those of the module with the code ?module if it is set, so they can be followed from a feed reader.
+//The changes are the ones the scraper has recorded, which are kept for a while.
+func (config *Config) ChangesFeed() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		if config.Changes == nil {
+			return &Error{Code: http.StatusServiceUnavailable, Status: "Service Unavailable", Message: "Changes aren't being watched."}
+		}
+		feed := atom.Feed{ID: feedID + "changes", Title: "WhatsUpKent timetable changes", Self: requestURL(r)}
+		topic := AllTopics
+		if code := r.URL.Query().Get("module"); code != "" {
+			module, err := config.DBClient.GetModuleFromSDSCode(r.Context(), code)
+			if err != nil {
+				return err
+			}
+			topic = "module:" + module.Code
+			feed.ID += ":module:" + module.Code
+			feed.Title = module.Code + " timetable changes"
+		}
+
+		changes, err := config.Changes.recent(r.Context(), topic, FeedEntries)
+		if err != nil {
+			return err
+		}
+		for _, change := range changes {
+			// The events deleted since can't be described
+			if change.Event != nil {
+				feed.Entries = append(feed.Entries, changeEntry(change))
+			}
+		}
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		return atom.Write(w, feed)
+	})
+}
+
+//changeEntry returns the feed entry of the change to an event, saying when and where the event is and what changed
+func changeEntry(change ChangeJSON) atom.Entry {
+	e := change.Event
+	entry := atom.Entry{
+		ID:      feedID + "change:" + strconv.FormatInt(change.ID, 10),
+		Title:   changeTitles[change.Type] + ": " + e.Title,
+		Updated: change.At,
+	}
+
+	summary := make([]string, 0, 3)
+	if e.StartDate != nil {
+		when := e.StartDate.In(kentTime).Format("Mon 2 Jan 2006 15:04")
+		if e.EndDate != nil {
+			when += " to " + e.EndDate.In(kentTime).Format("15:04")
+		}
+		summary = append(summary, when)
+	}
+	locations := make([]string, 0, len(e.Location))
+	for _, l := range e.Location {
+		locations = append(locations, l.Name)
+	}
+	if len(locations) > 0 {
+		summary = append(summary, "in "+strings.Join(locations, ", "))
+	}
+	if len(change.Changes) > 0 {
+		fields := make([]string, 0, len(change.Changes))
+		for _, f := range change.Changes {
+			fields = append(fields, changedField(f))
+		}
+		summary = append(summary, "changed the "+strings.Join(fields, ", "))
+	}
+	entry.Summary = strings.Join(summary, ", ")
+	for _, m := range e.PartOfModule {
+		if m.Code != "" {
+			entry.Categories = append(entry.Categories, m.Code)
+		}
+	}
+	return entry
+}
+
+//changedField names the field which changed in words, such as start date for event.start_date
+func changedField(f db.FieldChange) string {
+	return strings.Replace(strings.TrimPrefix(f.Predicate, "event."), "_", " ", -1)
+}
+
+//requestURL returns the absolute URL the request was sent to, going by X-Forwarded-Proto behind a proxy
+func requestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, r.Host, r.URL.RequestURI())
+}
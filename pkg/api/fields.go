@@ -0,0 +1,227 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+//fieldsPattern matches one of the fields in ?fields, such as title or location.name
+var fieldsPattern = regexp.MustCompile(`^[a-z_]+(\.[a-z_]+)*$`)
+
+//fieldsParam trims the json responses to the fields asked for, see SparseFields
+var fieldsParam = apiParam{
+	Name: "fields", In: "query", List: true, Pattern: fieldsPattern,
+	Description: "Comma separated fields to answer with, such as title,start_date,location.name, rather than every one. " +
+		"Fields are named without the prefix of their type, and those of a node within another after a dot.",
+}
+
+//fieldSet is the fields asked for with ?fields, each holding those asked for within it, or nil for all of them
+type fieldSet map[string]fieldSet
+
+//parseFields reads ?fields, such as title,start_date,location.name, returning nil if it isn't given.
+//The fields have been checked by Validate.
+func parseFields(r *http.Request) fieldSet {
+	raw := r.URL.Query().Get("fields")
+	if strings.TrimSpace(raw) == "" {
+		return nil
+	}
+	fields := make(fieldSet)
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		set := fields
+		parts := strings.Split(field, ".")
+		for i, part := range parts {
+			sub, ok := set[part]
+			// A node asked for whole, such as location, stays whole along with location.name
+			if ok && sub == nil {
+				break
+			}
+			if i == len(parts)-1 {
+				set[part] = nil
+				break
+			}
+			if !ok {
+				sub = make(fieldSet)
+				set[part] = sub
+			}
+			set = sub
+		}
+	}
+	return fields
+}
+
+//fieldPredicates returns the predicates to narrow a list query to for ?fields, such as event.title for title
+//with the prefix event, or nil to query every one. Only json is trimmed, so the other formats always get them all.
+func fieldPredicates(r *http.Request, prefix string) []string {
+	fields := parseFields(r)
+	if fields == nil {
+		return nil
+	}
+	if mediaType, err := negotiate(r, eventMediaTypes); err != nil || mediaType != mediaJSON {
+		return nil
+	}
+	predicates := make([]string, 0, len(fields))
+	for name := range fields {
+		predicates = append(predicates, prefix+"."+name)
+	}
+	return predicates
+}
+
+//SparseFields trims the successful json responses to the ?fields asked for. The objects which are nodes,
+//with a uid or predicates such as event.title, keep their uid and the fields asked for, while the envelopes around them,
+//such as a page's data and meta, are kept whole. The other responses, and those flushed as they are written, are sent as they are.
+func SparseFields(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fields := parseFields(r)
+		if fields == nil || r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+		fw := &fieldsWriter{ResponseWriter: w, fields: fields}
+		next.ServeHTTP(fw, r)
+		fw.finish()
+	})
+}
+
+//fieldsWriter holds back a json response until the handler is done, so it can be trimmed to the fields
+type fieldsWriter struct {
+	http.ResponseWriter
+	fields fieldSet
+	status int
+	buf    []byte
+	//decided is set once the status and headers show whether the response is trimmed, passing if it isn't
+	decided, passing bool
+}
+
+//decide works out whether the response is trimmed, sending on the status of those which aren't
+func (fw *fieldsWriter) decide() {
+	if fw.decided {
+		return
+	}
+	fw.decided = true
+	if fw.status == 0 {
+		fw.status = http.StatusOK
+	}
+	fw.passing = fw.status != http.StatusOK || !strings.HasPrefix(fw.Header().Get("Content-Type"), mediaJSON)
+	if fw.passing {
+		fw.ResponseWriter.WriteHeader(fw.status)
+	}
+}
+
+func (fw *fieldsWriter) WriteHeader(code int) {
+	if fw.decided {
+		return
+	}
+	fw.status = code
+	fw.decide()
+}
+
+func (fw *fieldsWriter) Write(p []byte) (int, error) {
+	fw.decide()
+	if fw.passing {
+		return fw.ResponseWriter.Write(p)
+	}
+	fw.buf = append(fw.buf, p...)
+	return len(p), nil
+}
+
+//Flush means the response is a stream, which is sent on as it is
+func (fw *fieldsWriter) Flush() {
+	fw.decide()
+	if !fw.passing {
+		fw.passing = true
+		fw.ResponseWriter.WriteHeader(fw.status)
+		fw.ResponseWriter.Write(fw.buf)
+		fw.buf = nil
+	}
+	if f, ok := fw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+//Unwrap lets http.ResponseController reach the underlying writer
+func (fw *fieldsWriter) Unwrap() http.ResponseWriter {
+	return fw.ResponseWriter
+}
+
+//finish trims the response and sends it, or sends it as it is if it isn't json after all
+func (fw *fieldsWriter) finish() {
+	if !fw.decided || fw.passing {
+		return
+	}
+	body := fw.buf
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	// Numbers are kept as they are written, rather than being rounded through a float64
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err == nil {
+		if trimmed, err := json.Marshal(sparse(v, fw.fields)); err == nil {
+			body = trimmed
+		}
+	}
+	fw.Header().Del("Content-Length")
+	fw.ResponseWriter.WriteHeader(fw.status)
+	fw.ResponseWriter.Write(body)
+}
+
+//sparse trims the decoded json value to the fields, see SparseFields
+func sparse(v interface{}, fields fieldSet) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		for i := range v {
+			v[i] = sparse(v[i], fields)
+		}
+	case map[string]interface{}:
+		if !isNode(v) {
+			for key, value := range v {
+				v[key] = sparse(value, fields)
+			}
+			return v
+		}
+		for key, value := range v {
+			if key == "uid" {
+				continue
+			}
+			sub, ok := fields[fieldName(key)]
+			if !ok {
+				delete(v, key)
+				continue
+			}
+			if sub != nil {
+				v[key] = sparse(value, sub)
+			}
+		}
+	}
+	return v
+}
+
+//isNode returns whether the json object is a node from dgraph, rather than an envelope around them
+func isNode(object map[string]interface{}) bool {
+	if _, ok := object["uid"]; ok {
+		return true
+	}
+	for key := range object {
+		if strings.Contains(key, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+//fieldName returns the name a predicate is asked for by, without the prefix of its type, such as title for event.title.
+//A facet is asked for by its own name, such as weight for event.part_of_module|weight.
+func fieldName(key string) string {
+	if i := strings.LastIndex(key, "|"); i >= 0 {
+		return key[i+1:]
+	}
+	if i := strings.Index(key, "."); i >= 0 {
+		return key[i+1:]
+	}
+	return key
+}
@@ -0,0 +1,637 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+//graphqlSchema mirrors the events, modules, locations and people in the database, along with the edges between them
+const graphqlSchema = `
+	scalar Time
+
+	schema {
+		query: Query
+	}
+
+	type Query {
+		event(id: String!): Event
+		events(from: Time, to: Time, limit: Int, offset: Int): [Event!]!
+		module(code: String!): Module
+		modules(limit: Int, offset: Int): [Module!]!
+		location(slug: String!): Location
+		locations(limit: Int, offset: Int): [Location!]!
+		person(uid: ID!): Person
+		people(q: String, limit: Int, offset: Int): [Person!]!
+	}
+
+	type Event {
+		uid: ID!
+		id: String!
+		title: String!
+		description: String!
+		start: Time
+		end: Time
+		organisers: [Person!]!
+		modules: [Module!]!
+		locations: [Location!]!
+		series: Series
+	}
+
+	type Module {
+		uid: ID!
+		code: String!
+		name: String!
+		subject: String!
+		events(from: Time, to: Time, limit: Int, offset: Int): [Event!]!
+	}
+
+	type Location {
+		uid: ID!
+		slug: String!
+		name: String!
+		disabledAccess: Boolean!
+		capacity: Int
+		campus: String
+		partOf: Location
+		events(from: Time, to: Time): [Event!]!
+	}
+
+	type Person {
+		uid: ID!
+		name: String!
+		email: String!
+		role: String
+		events(from: Time, to: Time, limit: Int, offset: Int): [Event!]!
+	}
+
+	type Series {
+		uid: ID!
+		id: String!
+		title: String!
+		occurrences: [Event!]!
+	}
+`
+
+const (
+	//MaxGraphQLDepth is how deeply a graphql query can nest, each level being another round of database queries
+	MaxGraphQLDepth = 8
+	//MaxGraphQLLookups is how many times a graphql query can look something up in the database,
+	//as every node of a list can look up its own fields
+	MaxGraphQLLookups = 100
+	//MaxGraphQLNodes is how many events, modules, locations, people and series a graphql query can resolve in all
+	MaxGraphQLNodes = 5000
+)
+
+//GraphQLRequest is the json a graphql query is posted as
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+//GraphQL answers graphql queries against the database, posted as a GraphQLRequest
+func (config *Config) GraphQL() http.HandlerFunc {
+	schema := graphql.MustParseSchema(graphqlSchema, &queryResolver{client: config.DBClient}, graphql.MaxDepth(MaxGraphQLDepth))
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		var params GraphQLRequest
+		defer r.Body.Close()
+		err := json.NewDecoder(io.LimitReader(r.Body, 1048576)).Decode(&params)
+		if err != nil {
+			return badRequest("Could not read the graphql request.", err)
+		}
+		ctx := context.WithValue(r.Context(), graphqlBudgetContextKey{}, &graphqlBudget{})
+		return writeJSON(w, http.StatusOK, schema.Exec(ctx, params.Query, params.OperationName, params.Variables))
+	})
+}
+
+//graphqlBudget is how much of MaxGraphQLLookups and MaxGraphQLNodes a graphql query has spent, so a query fanning out
+//over the nodes of long lists fails rather than looking up the fields of each of them
+type graphqlBudget struct {
+	mu      sync.Mutex
+	lookups int
+	nodes   int
+}
+
+//graphqlBudgetContextKey is the key of the graphqlBudget of the query in the request context
+type graphqlBudgetContextKey struct{}
+
+//graphqlSpend takes the lookups and nodes from the budget of the query being resolved, failing once either has run out.
+//The lookups are spent before the database is asked, and the nodes once it has answered.
+func graphqlSpend(ctx context.Context, lookups, nodes int) error {
+	b, ok := ctx.Value(graphqlBudgetContextKey{}).(*graphqlBudget)
+	if !ok {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lookups += lookups
+	b.nodes += nodes
+	if b.lookups > MaxGraphQLLookups {
+		return fmt.Errorf("The query needs more than %d database lookups, ask for the fields of fewer nodes.", MaxGraphQLLookups)
+	}
+	if b.nodes > MaxGraphQLNodes {
+		return fmt.Errorf("The query resolves more than %d nodes, ask for fewer with a limit or a shorter window.", MaxGraphQLNodes)
+	}
+	return nil
+}
+
+//graphqlError is the error a resolver returns to the client, which is as much as Handle would tell it
+func graphqlError(ctx context.Context, err error) error {
+	body := errorResponse(err)
+	if body.Status >= http.StatusInternalServerError && !logRequestError(ctx, err) {
+		log.Printf("graphql query failed: %v", err)
+	}
+	return errors.New(body.Detail)
+}
+
+//graphqlPage returns the list options for the limit and offset arguments, limited the same way as parsePage
+func graphqlPage(limit, offset *int32) (db.ListOptions, error) {
+	opts := db.ListOptions{First: DefaultPageLimit}
+	if limit != nil {
+		if *limit < 1 {
+			return opts, errors.New("The limit must be a positive whole number.")
+		}
+		opts.First = int(*limit)
+		if opts.First > MaxPageLimit {
+			opts.First = MaxPageLimit
+		}
+	}
+	if offset != nil {
+		if *offset < 0 {
+			return opts, errors.New("The offset must be a whole number, and not negative.")
+		}
+		opts.Offset = int(*offset)
+	}
+	return opts, nil
+}
+
+//graphqlWindow returns the window for the from and to arguments, defaulting to the next DefaultEventWindow like parseWindow
+func graphqlWindow(from, to *graphql.Time) (time.Time, time.Time, error) {
+	if from == nil && to == nil {
+		now := time.Now()
+		return now, now.Add(DefaultEventWindow), nil
+	}
+	if from == nil || to == nil {
+		return time.Time{}, time.Time{}, errors.New("Both from and to are needed to filter by date.")
+	}
+	if to.Before(from.Time) {
+		return time.Time{}, time.Time{}, errors.New("The to date can't be before the from date.")
+	}
+	return from.Time, to.Time, nil
+}
+
+type queryResolver struct {
+	client db.Client
+}
+
+func (q *queryResolver) Event(ctx context.Context, args struct{ ID string }) (*eventResolver, error) {
+	if err := graphqlSpend(ctx, 1, 1); err != nil {
+		return nil, err
+	}
+	e, err := q.client.GetEvent(ctx, db.Event{ID: args.ID})
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, graphqlError(ctx, err)
+	}
+	return &eventResolver{client: q.client, e: *e}, nil
+}
+
+func (q *queryResolver) Events(ctx context.Context, args struct {
+	From, To      *graphql.Time
+	Limit, Offset *int32
+}) ([]*eventResolver, error) {
+	opts, err := graphqlPage(args.Limit, args.Offset)
+	if err != nil {
+		return nil, err
+	}
+	if err := graphqlSpend(ctx, 1, 0); err != nil {
+		return nil, err
+	}
+	var events []db.Event
+	if args.From == nil && args.To == nil {
+		events, err = q.client.ListEvents(ctx, opts)
+		if err != nil {
+			return nil, graphqlError(ctx, err)
+		}
+	} else {
+		from, to, err := graphqlWindow(args.From, args.To)
+		if err != nil {
+			return nil, err
+		}
+		events, err = q.client.GetEventsBetween(ctx, from, to, opts)
+		if err != nil {
+			return nil, graphqlError(ctx, err)
+		}
+	}
+	return eventResolvers(ctx, q.client, events)
+}
+
+func (q *queryResolver) Module(ctx context.Context, args struct{ Code string }) (*moduleResolver, error) {
+	if err := graphqlSpend(ctx, 1, 1); err != nil {
+		return nil, err
+	}
+	m, err := q.client.GetModuleFromSDSCode(ctx, args.Code)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, graphqlError(ctx, err)
+	}
+	return moduleResolvers(q.client, []db.Module{*m})[0], nil
+}
+
+func (q *queryResolver) Modules(ctx context.Context, args struct{ Limit, Offset *int32 }) ([]*moduleResolver, error) {
+	opts, err := graphqlPage(args.Limit, args.Offset)
+	if err != nil {
+		return nil, err
+	}
+	if err := graphqlSpend(ctx, 1, 0); err != nil {
+		return nil, err
+	}
+	modules, err := q.client.ListModules(ctx, opts)
+	if err != nil {
+		return nil, graphqlError(ctx, err)
+	}
+	if err := graphqlSpend(ctx, 0, len(modules)); err != nil {
+		return nil, err
+	}
+	return moduleResolvers(q.client, modules), nil
+}
+
+func (q *queryResolver) Location(ctx context.Context, args struct{ Slug string }) (*locationResolver, error) {
+	if err := graphqlSpend(ctx, 1, 1); err != nil {
+		return nil, err
+	}
+	l, err := q.client.GetLocationFromKentSlug(ctx, args.Slug)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, graphqlError(ctx, err)
+	}
+	return &locationResolver{client: q.client, l: *l}, nil
+}
+
+func (q *queryResolver) Locations(ctx context.Context, args struct{ Limit, Offset *int32 }) ([]*locationResolver, error) {
+	opts, err := graphqlPage(args.Limit, args.Offset)
+	if err != nil {
+		return nil, err
+	}
+	if err := graphqlSpend(ctx, 1, 0); err != nil {
+		return nil, err
+	}
+	locations, err := q.client.ListLocations(ctx, opts)
+	if err != nil {
+		return nil, graphqlError(ctx, err)
+	}
+	if err := graphqlSpend(ctx, 0, len(locations)); err != nil {
+		return nil, err
+	}
+	out := make([]*locationResolver, len(locations))
+	for i, l := range locations {
+		out[i] = &locationResolver{client: q.client, l: l}
+	}
+	return out, nil
+}
+
+func (q *queryResolver) Person(ctx context.Context, args struct{ UID graphql.ID }) (*personResolver, error) {
+	if err := graphqlSpend(ctx, 1, 1); err != nil {
+		return nil, err
+	}
+	p, err := q.client.GetPerson(ctx, db.Person{UID: string(args.UID)})
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, graphqlError(ctx, err)
+	}
+	return &personResolver{client: q.client, p: *p}, nil
+}
+
+func (q *queryResolver) People(ctx context.Context, args struct {
+	Q             *string
+	Limit, Offset *int32
+}) ([]*personResolver, error) {
+	opts, err := graphqlPage(args.Limit, args.Offset)
+	if err != nil {
+		return nil, err
+	}
+	name := ""
+	if args.Q != nil {
+		name = *args.Q
+	}
+	if err := graphqlSpend(ctx, 1, 0); err != nil {
+		return nil, err
+	}
+	people, err := q.client.ListPeople(ctx, name, opts)
+	if err != nil {
+		return nil, graphqlError(ctx, err)
+	}
+	if err := graphqlSpend(ctx, 0, len(people)); err != nil {
+		return nil, err
+	}
+	out := make([]*personResolver, len(people))
+	for i, p := range people {
+		out[i] = &personResolver{client: q.client, p: p}
+	}
+	return out, nil
+}
+
+//eventResolvers returns the resolvers of the events, spending them from the budget of the query
+func eventResolvers(ctx context.Context, client db.Client, events []db.Event) ([]*eventResolver, error) {
+	if err := graphqlSpend(ctx, 0, len(events)); err != nil {
+		return nil, err
+	}
+	out := make([]*eventResolver, len(events))
+	for i, e := range events {
+		out[i] = &eventResolver{client: client, e: e}
+	}
+	return out, nil
+}
+
+type eventResolver struct {
+	client db.Client
+	e      db.Event
+}
+
+func (r *eventResolver) UID() graphql.ID     { return graphql.ID(r.e.UID) }
+func (r *eventResolver) ID() string          { return r.e.ID }
+func (r *eventResolver) Title() string       { return r.e.Title }
+func (r *eventResolver) Description() string { return r.e.Description }
+func (r *eventResolver) Start() *graphql.Time {
+	return graphqlTime(r.e.StartDate)
+}
+func (r *eventResolver) End() *graphql.Time {
+	return graphqlTime(r.e.EndDate)
+}
+
+//The organisers, modules, locations and series come with the event, so they only cost the nodes
+
+func (r *eventResolver) Organisers(ctx context.Context) ([]*personResolver, error) {
+	if err := graphqlSpend(ctx, 0, len(r.e.Organiser)); err != nil {
+		return nil, err
+	}
+	out := make([]*personResolver, len(r.e.Organiser))
+	for i, p := range r.e.Organiser {
+		out[i] = &personResolver{client: r.client, p: p}
+	}
+	return out, nil
+}
+
+func (r *eventResolver) Modules(ctx context.Context) ([]*moduleResolver, error) {
+	if err := graphqlSpend(ctx, 0, len(r.e.PartOfModule)); err != nil {
+		return nil, err
+	}
+	return moduleResolvers(r.client, r.e.PartOfModule), nil
+}
+
+func (r *eventResolver) Locations(ctx context.Context) ([]*locationResolver, error) {
+	if err := graphqlSpend(ctx, 0, len(r.e.Location)); err != nil {
+		return nil, err
+	}
+	out := make([]*locationResolver, len(r.e.Location))
+	for i, l := range r.e.Location {
+		out[i] = &locationResolver{client: r.client, l: l}
+	}
+	return out, nil
+}
+
+func (r *eventResolver) Series(ctx context.Context) (*seriesResolver, error) {
+	if r.e.Series == nil {
+		return nil, nil
+	}
+	if err := graphqlSpend(ctx, 0, 1); err != nil {
+		return nil, err
+	}
+	return &seriesResolver{client: r.client, s: *r.e.Series}, nil
+}
+
+func graphqlTime(t *time.Time) *graphql.Time {
+	if t == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *t}
+}
+
+//moduleResolvers returns the resolvers of the modules, which look up their events together
+func moduleResolvers(client db.Client, modules []db.Module) []*moduleResolver {
+	loader := &moduleEventsLoader{client: client, codes: make([]string, len(modules)), loads: make(map[string]*moduleEventsLoad)}
+	out := make([]*moduleResolver, len(modules))
+	for i, m := range modules {
+		loader.codes[i] = m.Code
+		out[i] = &moduleResolver{client: client, m: m, loader: loader}
+	}
+	return out
+}
+
+type moduleResolver struct {
+	client db.Client
+	m      db.Module
+	loader *moduleEventsLoader
+}
+
+func (r *moduleResolver) UID() graphql.ID { return graphql.ID(r.m.UID) }
+func (r *moduleResolver) Code() string    { return r.m.Code }
+func (r *moduleResolver) Name() string    { return r.m.Name }
+func (r *moduleResolver) Subject() string { return r.m.Subject }
+
+func (r *moduleResolver) Events(ctx context.Context, args struct {
+	From, To      *graphql.Time
+	Limit, Offset *int32
+}) ([]*eventResolver, error) {
+	opts, err := graphqlPage(args.Limit, args.Offset)
+	if err != nil {
+		return nil, err
+	}
+	events, err := r.loader.load(ctx, r.m.Code, args.From, args.To)
+	if err != nil {
+		return nil, err
+	}
+	return eventResolvers(ctx, r.client, pageEvents(events, opts))
+}
+
+//moduleEventsLoader looks up the events of every module of a list at once, the first time one of them asks for its events
+//in a window, rather than once for each of the modules
+type moduleEventsLoader struct {
+	client db.Client
+	codes  []string
+
+	mu    sync.Mutex
+	loads map[string]*moduleEventsLoad
+}
+
+//moduleEventsLoad is a lookup of the events of the modules in one window, grouped by module code
+type moduleEventsLoad struct {
+	once   sync.Once
+	events map[string][]db.Event
+	err    error
+}
+
+//load returns the events of the module in the window of the from and to arguments, in order
+func (l *moduleEventsLoader) load(ctx context.Context, code string, fromArg, toArg *graphql.Time) ([]db.Event, error) {
+	from, to, err := graphqlWindow(fromArg, toArg)
+	if err != nil {
+		return nil, err
+	}
+	// Keyed on the arguments, as the default window moves with the clock between the modules asking for it
+	key := ""
+	if fromArg != nil && toArg != nil {
+		key = fromArg.Format(time.RFC3339Nano) + "/" + toArg.Format(time.RFC3339Nano)
+	}
+	l.mu.Lock()
+	ld, ok := l.loads[key]
+	if !ok {
+		ld = &moduleEventsLoad{}
+		l.loads[key] = ld
+	}
+	l.mu.Unlock()
+
+	ld.once.Do(func() {
+		if ld.err = graphqlSpend(ctx, 1, 0); ld.err != nil {
+			return
+		}
+		events, err := l.client.GetEventsByModules(ctx, l.codes, from, to)
+		if err != nil {
+			ld.err = graphqlError(ctx, err)
+			return
+		}
+		ld.events = make(map[string][]db.Event)
+		for _, e := range events {
+			for _, m := range e.PartOfModule {
+				ld.events[m.Code] = append(ld.events[m.Code], e)
+			}
+		}
+	})
+	return ld.events[code], ld.err
+}
+
+type locationResolver struct {
+	client db.Client
+	l      db.Location
+}
+
+func (r *locationResolver) UID() graphql.ID      { return graphql.ID(r.l.UID) }
+func (r *locationResolver) Slug() string         { return r.l.ID }
+func (r *locationResolver) Name() string         { return r.l.Name }
+func (r *locationResolver) DisabledAccess() bool { return r.l.DisabledAccess }
+
+//Capacity is null for the rooms kent doesn't give one for
+func (r *locationResolver) Capacity() *int32 {
+	if r.l.Capacity == 0 {
+		return nil
+	}
+	c := int32(r.l.Capacity)
+	return &c
+}
+
+//Campus is null for the locations kent doesn't say the campus of
+func (r *locationResolver) Campus() *string {
+	if r.l.Campus == "" {
+		return nil
+	}
+	return &r.l.Campus
+}
+
+//PartOf is looked up, as the locations of events and single location lookups don't come with their parent
+func (r *locationResolver) PartOf(ctx context.Context) (*locationResolver, error) {
+	if err := graphqlSpend(ctx, 1, 1); err != nil {
+		return nil, err
+	}
+	ancestors, err := r.client.GetLocationAncestors(ctx, r.l)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, graphqlError(ctx, err)
+	}
+	if len(ancestors) == 0 {
+		return nil, nil
+	}
+	return &locationResolver{client: r.client, l: ancestors[0]}, nil
+}
+
+func (r *locationResolver) Events(ctx context.Context, args struct{ From, To *graphql.Time }) ([]*eventResolver, error) {
+	from, to, err := graphqlWindow(args.From, args.To)
+	if err != nil {
+		return nil, err
+	}
+	if err := graphqlSpend(ctx, 1, 0); err != nil {
+		return nil, err
+	}
+	events, err := r.client.GetEventsByLocation(ctx, r.l.ID, from, to)
+	if err != nil {
+		return nil, graphqlError(ctx, err)
+	}
+	return eventResolvers(ctx, r.client, events)
+}
+
+type personResolver struct {
+	client db.Client
+	p      db.Person
+}
+
+func (r *personResolver) UID() graphql.ID { return graphql.ID(r.p.UID) }
+func (r *personResolver) Name() string    { return r.p.Name }
+func (r *personResolver) Email() string   { return r.p.Email }
+
+//Role is the person's role in the event they were resolved through, if they were
+func (r *personResolver) Role() *string {
+	if r.p.Role == "" {
+		return nil
+	}
+	return &r.p.Role
+}
+
+func (r *personResolver) Events(ctx context.Context, args struct {
+	From, To      *graphql.Time
+	Limit, Offset *int32
+}) ([]*eventResolver, error) {
+	opts, err := graphqlPage(args.Limit, args.Offset)
+	if err != nil {
+		return nil, err
+	}
+	from, to, err := graphqlWindow(args.From, args.To)
+	if err != nil {
+		return nil, err
+	}
+	if err := graphqlSpend(ctx, 1, 0); err != nil {
+		return nil, err
+	}
+	events, err := r.client.GetEventsByOrganiser(ctx, db.Person{UID: r.p.UID, Name: r.p.Name}, from, to, opts)
+	if err != nil {
+		return nil, graphqlError(ctx, err)
+	}
+	return eventResolvers(ctx, r.client, events)
+}
+
+type seriesResolver struct {
+	client db.Client
+	s      db.Series
+}
+
+func (r *seriesResolver) UID() graphql.ID { return graphql.ID(r.s.UID) }
+func (r *seriesResolver) ID() string      { return r.s.ID }
+func (r *seriesResolver) Title() string   { return r.s.Title }
+
+func (r *seriesResolver) Occurrences(ctx context.Context) ([]*eventResolver, error) {
+	if err := graphqlSpend(ctx, 1, 0); err != nil {
+		return nil, err
+	}
+	events, err := r.client.GetSeriesOccurrences(ctx, r.s)
+	if err != nil {
+		return nil, graphqlError(ctx, err)
+	}
+	return eventResolvers(ctx, r.client, events)
+}
@@ -1,74 +1,267 @@
 package api
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
-)
-
-// HandleError simply logs and exits the program if the error exists
-func HandleError(err error) {
-	if err != nil {
-		log.Fatal(err)
-	}
-}
+	"time"
 
-//ErrorJSON is the response sent back in case of an error
-type ErrorJSON struct {
-	Status, Error string
-}
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
 
 //Query performs a read only query
-func (config *Config) Query() func(w http.ResponseWriter, r *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
+func (config *Config) Query() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
 		// Read request body and close it
 		body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
-		// HandleError(err)
+		defer r.Body.Close()
 		if err != nil {
-			fmt.Fprintf(w, err.Error())
+			return badRequest("Could not read the query.", err)
+		}
+		if err := checkPublicQuery(string(body)); err != nil {
+			return err
 		}
-		defer r.Body.Close()
 
 		//Retrieve query result
-		result, err := config.PerformCachedQuery(string(body))
-		w.Header().Set("Content-Type", "application/json")
+		result, err := config.PerformCachedQuery(r.Context(), string(body))
 		if err != nil {
-			w.WriteHeader(500)
-			errorJSON := ErrorJSON{Status: "Query Failed", Error: "Query not correctly formatted."}
-			marshalled, marshallErr := json.Marshal(errorJSON)
-			HandleError(marshallErr)
-			fmt.Fprintf(w, string(marshalled))
-		} else {
-			fmt.Fprintf(w, *result)
+			return &Error{Code: http.StatusInternalServerError, Status: "Query Failed", Message: "Query not correctly formatted.", Err: err}
 		}
-	}
+		w.Header().Set("Content-Type", "application/json")
+		_, err = io.WriteString(w, *result)
+		return err
+	})
 }
 
 //GetQuery performs a read only query without badger
-func (config *Config) GetQuery() func(w http.ResponseWriter, r *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
+func (config *Config) GetQuery() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
 		// Read request body and close it
 		body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
-		HandleError(err)
 		defer r.Body.Close()
+		if err != nil {
+			return badRequest("Could not read the query.", err)
+		}
+		if err := checkPublicQuery(string(body)); err != nil {
+			return err
+		}
 
 		//Retrieve query result
-		result, err := config.PerformQuery(string(body))
+		result, err := config.PerformQuery(r.Context(), string(body))
+		if err != nil {
+			return &Error{Code: http.StatusInternalServerError, Status: "Query Failed", Message: "Query probably not correctly formatted.", Err: err}
+		}
 		w.Header().Set("Content-Type", "application/json")
+		_, err = io.WriteString(w, *result)
+		return err
+	})
+}
+
+//ListEvents returns a page of the events ordered by their start date, or ?sort, see parsePage, or the page after ?cursor.
+//With ?from and ?to only the events starting between them are listed, as json, csv or iCalendar, see negotiate.
+//Without either, only the ?fields asked for are queried. ?campus and ?accessible narrow them to the events in the rooms they leave in.
+func (config *Config) ListEvents() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		opts, err := parsePage(r)
+		if err != nil {
+			return err
+		}
+		opts.Sort = parseSort(r, eventSorts)
+		opts = locationFilter(r, opts)
+		cursor, err := parseCursor(r)
 		if err != nil {
-			HandleError(err)
-			w.WriteHeader(500)
-			errorJSON := ErrorJSON{Status: "Query Failed", Error: "Query probably not correctly formatted."}
-			marshalled, marshallErr := json.Marshal(errorJSON)
-			HandleError(marshallErr)
-			fmt.Fprintf(w, string(marshalled))
+			return err
+		}
+		from, to, filtered, err := parseDateRange(r)
+		if err != nil {
+			return err
+		}
+		ctx := r.Context()
+		lister := eventLister{
+			list: func(opts db.ListOptions) ([]db.Event, error) {
+				return config.DBClient.ListEvents(ctx, opts)
+			},
+			after: func(cursor db.EventCursor, opts db.ListOptions) ([]db.Event, error) {
+				return config.DBClient.ListEventsAfter(ctx, cursor, opts)
+			},
+			count: func(opts db.ListOptions) (*int, error) {
+				return config.DBClient.CountFilteredEvents(ctx, opts)
+			},
+		}
+		if filtered {
+			lister = eventLister{
+				list: func(opts db.ListOptions) ([]db.Event, error) {
+					return config.DBClient.GetEventsBetween(ctx, from, to, opts)
+				},
+				after: func(cursor db.EventCursor, opts db.ListOptions) ([]db.Event, error) {
+					return config.DBClient.GetEventsBetweenAfter(ctx, from, to, cursor, opts)
+				},
+				count: func(opts db.ListOptions) (*int, error) {
+					return config.DBClient.CountEventsBetween(ctx, from, to, opts)
+				},
+			}
 		} else {
-			fmt.Fprintf(w, *result)
+			opts.Fields = fieldPredicates(r, "event")
 		}
+
+		events, opts, total, next, err := listEventPage(lister, cursor, opts)
+		if err != nil {
+			return err
+		}
+		return config.writeEvents(w, r, events, opts, total, next, "WhatsUpKent events")
+	})
+}
+
+//NowSoon is how far ahead GET /now looks for the events starting soon
+const NowSoon = time.Hour
+
+//NowJSON is what is on at a time, the events in progress and those starting in the NowSoon after it
+type NowJSON struct {
+	At           time.Time  `json:"at"`
+	Until        time.Time  `json:"until"`
+	InProgress   []db.Event `json:"in_progress"`
+	StartingSoon []db.Event `json:"starting_soon"`
+}
+
+//Now returns what is on now, or at ?at (an RFC3339 time), and what is starting in the next hour,
+//only in the building with the ?building location id and its rooms if it is set, and the rooms ?campus leaves in.
+//It is the busiest query, so it is read best effort, which may be slightly stale but doesn't wait on the latest timestamp.
+func (config *Config) Now() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		at := time.Now()
+		if raw := r.URL.Query().Get("at"); raw != "" {
+			var err error
+			at, err = time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return badRequest("The at time must be an RFC3339 time, such as 2024-10-01T14:00:00Z.", err)
+			}
+		}
+		until := at.Add(NowSoon)
+
+		events, err := config.DBClient.GetEventsDuring(r.Context(), at, until, r.URL.Query().Get("building"), db.WithBestEffort())
+		if err != nil {
+			return err
+		}
+		now := NowJSON{At: at.UTC(), Until: until.UTC(), InProgress: []db.Event{}, StartingSoon: []db.Event{}}
+		for _, e := range filterEvents(r, events) {
+			// Events ending just as the window starts overlap it, but are already over
+			if !e.EndDate.After(at) {
+				continue
+			}
+			if e.StartDate.After(at) {
+				now.StartingSoon = append(now.StartingSoon, e)
+			} else {
+				now.InProgress = append(now.InProgress, e)
+			}
+		}
+		return writeJSON(w, http.StatusOK, now)
+	})
+}
+
+//parseDateRange reads the ?from and ?to query parameters, which are RFC3339 times such as 2024-10-01T00:00:00Z.
+//It returns whether they were given, they have to be given together.
+func parseDateRange(r *http.Request) (time.Time, time.Time, bool, error) {
+	query := r.URL.Query()
+	rawFrom, rawTo := query.Get("from"), query.Get("to")
+	if rawFrom == "" && rawTo == "" {
+		return time.Time{}, time.Time{}, false, nil
+	}
+	if rawFrom == "" || rawTo == "" {
+		return time.Time{}, time.Time{}, false, badRequest("Both from and to are needed to filter by date.", nil)
+	}
+	from, err := time.Parse(time.RFC3339, rawFrom)
+	if err != nil {
+		return time.Time{}, time.Time{}, false, badRequest("The from date must be an RFC3339 time, such as 2024-10-01T00:00:00Z.", err)
+	}
+	to, err := time.Parse(time.RFC3339, rawTo)
+	if err != nil {
+		return time.Time{}, time.Time{}, false, badRequest("The to date must be an RFC3339 time, such as 2024-10-08T00:00:00Z.", err)
+	}
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, false, badRequest("The to date can't be before the from date.", nil)
+	}
+	return from, to, true, nil
+}
+
+//DefaultEventWindow is how far ahead the endpoints listing what's on somewhere or for someone look without ?from and ?to
+const DefaultEventWindow = 7 * 24 * time.Hour
+
+//parseWindow is parseDateRange, defaulting to the next DefaultEventWindow
+func parseWindow(r *http.Request) (time.Time, time.Time, error) {
+	from, to, filtered, err := parseDateRange(r)
+	if err != nil || filtered {
+		return from, to, err
 	}
+	from = time.Now()
+	return from, from.Add(DefaultEventWindow), nil
+}
+
+//pageEvents returns the page of the events chosen by the list options
+func pageEvents(events []db.Event, opts db.ListOptions) []db.Event {
+	start, end := pageBounds(len(events), opts)
+	return events[start:end]
+}
+
+//pageBounds returns the bounds of the page chosen by the list options, out of n results
+func pageBounds(n int, opts db.ListOptions) (int, int) {
+	if opts.Offset >= n {
+		return n, n
+	}
+	end := n
+	if n-opts.Offset > opts.First {
+		end = opts.Offset + opts.First
+	}
+	return opts.Offset, end
+}
+
+//Healthz is the liveness probe, it succeeds as long as the process is serving requests.
+//It doesn't check the database, so an outage there doesn't get every instance restarted.
+func (config *Config) Healthz() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		return writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+	})
+}
+
+//Readiness is what Ready reports
+type Readiness struct {
+	OK       bool      `json:"ok"`
+	Database db.Status `json:"database"`
+	//MissingSchema holds the predicates and types which haven't been applied to the database yet
+	MissingSchema []string `json:"missing_schema,omitempty"`
+	//SchemaError describes why the schema couldn't be checked
+	SchemaError string `json:"schema_error,omitempty"`
+}
+
+//Ready is the readiness probe, it fails with a 503 while the database can't be reached
+//or the schema hasn't been applied to it, so no traffic is sent to an instance which can't answer it.
+//It is served on both /ready and /readyz.
+func (config *Config) Ready() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		readiness := Readiness{Database: db.Ping(r.Context(), config.DBClient)}
+		if readiness.Database.OK {
+			missing, err := config.DBClient.CheckSchema(r.Context(), db.WithTimeout(db.PingTimeout))
+			if err != nil {
+				readiness.SchemaError = err.Error()
+			} else {
+				readiness.MissingSchema = missing
+				readiness.OK = len(missing) == 0
+			}
+		}
+
+		code := http.StatusOK
+		if !readiness.OK {
+			code = http.StatusServiceUnavailable
+		}
+		return writeJSON(w, code, readiness)
+	})
+}
+
+//Status reports the health of the database for the admin status page, it always succeeds so the status can be read
+func (config *Config) Status() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		return writeJSON(w, http.StatusOK, db.Ping(r.Context(), config.DBClient))
+	})
 }
 
 //Info simply returns a pretty ASCII art
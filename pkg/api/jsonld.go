@@ -0,0 +1,162 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+//schemaContext is the JSON-LD context of the schema.org vocabulary the events are described with
+const schemaContext = "https://schema.org"
+
+//kent is the organisation every event is organised by, which the people organising them are part of
+var kent = &OrganizationLD{Type: "Organization", Name: "University of Kent", URL: "https://www.kent.ac.uk"}
+
+//EventsLD is a page of events as JSON-LD, a graph of schema.org Events for pages to embed in a script tag
+type EventsLD struct {
+	Context string    `json:"@context"`
+	Graph   []EventLD `json:"@graph"`
+}
+
+//EventLD is an event as a schema.org Event
+type EventLD struct {
+	Type        string `json:"@type"`
+	ID          string `json:"@id"`
+	Identifier  string `json:"identifier"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	StartDate   string `json:"startDate"`
+	EndDate     string `json:"endDate,omitempty"`
+	//EventStatus and EventAttendanceMode are schema.org urls, the events listed are always scheduled and in person
+	EventStatus         string        `json:"eventStatus"`
+	EventAttendanceMode string        `json:"eventAttendanceMode"`
+	Location            []PlaceLD     `json:"location,omitempty"`
+	Organizer           []interface{} `json:"organizer"`
+	//About holds the modules the event is part of, as schema.org Courses
+	About []CourseLD `json:"about,omitempty"`
+}
+
+//PlaceLD is a location as a schema.org Place, within the building it is part of if that is known
+type PlaceLD struct {
+	Type                    string              `json:"@type"`
+	Identifier              string              `json:"identifier,omitempty"`
+	Name                    string              `json:"name"`
+	MaximumAttendeeCapacity int                 `json:"maximumAttendeeCapacity,omitempty"`
+	Geo                     *GeoCoordinatesLD   `json:"geo,omitempty"`
+	AmenityFeature          []LocationFeatureLD `json:"amenityFeature,omitempty"`
+	ContainedInPlace        *PlaceLD            `json:"containedInPlace,omitempty"`
+}
+
+//GeoCoordinatesLD is where a place is, as schema.org GeoCoordinates
+type GeoCoordinatesLD struct {
+	Type      string  `json:"@type"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+//LocationFeatureLD is a feature of a place, as a schema.org LocationFeatureSpecification
+type LocationFeatureLD struct {
+	Type  string `json:"@type"`
+	Name  string `json:"name"`
+	Value bool   `json:"value"`
+}
+
+//OrganizationLD is an organisation as a schema.org Organization
+type OrganizationLD struct {
+	Type string `json:"@type"`
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+//PersonLD is someone organising an event as a schema.org Person, affiliated with kent
+type PersonLD struct {
+	Type        string          `json:"@type"`
+	Name        string          `json:"name"`
+	JobTitle    string          `json:"jobTitle,omitempty"`
+	Affiliation *OrganizationLD `json:"affiliation"`
+}
+
+//CourseLD is a module as a schema.org Course, provided by kent
+type CourseLD struct {
+	Type       string          `json:"@type"`
+	CourseCode string          `json:"courseCode"`
+	Name       string          `json:"name,omitempty"`
+	Provider   *OrganizationLD `json:"provider"`
+}
+
+//writeEventsLD answers with the events as JSON-LD, leaving out the ones without a start date as schema.org Events need one
+func writeEventsLD(w http.ResponseWriter, events []db.Event) error {
+	graph := EventsLD{Context: schemaContext, Graph: make([]EventLD, 0, len(events))}
+	for _, e := range events {
+		if ld, ok := eventLD(e); ok {
+			graph.Graph = append(graph.Graph, ld)
+		}
+	}
+	marshalled, err := json.Marshal(graph)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", mediaJSONLD)
+	_, err = w.Write(marshalled)
+	return err
+}
+
+//eventLD converts the event to a schema.org Event, which it can't be without a start date.
+//Its @id is made from the id of the event, as its calendar UID is.
+func eventLD(e db.Event) (EventLD, bool) {
+	if e.StartDate == nil {
+		return EventLD{}, false
+	}
+	id := e.ID
+	if id == "" {
+		id = e.UID
+	}
+	ld := EventLD{
+		Type:                "Event",
+		ID:                  "urn:" + uidDomain + ":event:" + id,
+		Identifier:          id,
+		Name:                e.Title,
+		Description:         e.Description,
+		StartDate:           e.StartDate.Format(time.RFC3339),
+		EventStatus:         "https://schema.org/EventScheduled",
+		EventAttendanceMode: "https://schema.org/OfflineEventAttendanceMode",
+		Organizer:           []interface{}{kent},
+	}
+	if e.EndDate != nil {
+		ld.EndDate = e.EndDate.Format(time.RFC3339)
+	}
+	for _, l := range e.Location {
+		ld.Location = append(ld.Location, placeLD(l))
+	}
+	for _, p := range e.Organiser {
+		ld.Organizer = append(ld.Organizer, PersonLD{Type: "Person", Name: p.Name, JobTitle: p.Role, Affiliation: kent})
+	}
+	for _, m := range e.PartOfModule {
+		ld.About = append(ld.About, CourseLD{Type: "Course", CourseCode: m.Code, Name: m.Name, Provider: kent})
+	}
+	return ld, true
+}
+
+//placeLD converts the location to a schema.org Place, nesting it in the one it is part of
+func placeLD(l db.Location) PlaceLD {
+	place := PlaceLD{
+		Type:                    "Place",
+		Identifier:              l.ID,
+		Name:                    l.Name,
+		MaximumAttendeeCapacity: l.Capacity,
+	}
+	// The coordinates are GeoJSON, longitude first
+	if len(l.Location.Coords) == 2 {
+		place.Geo = &GeoCoordinatesLD{Type: "GeoCoordinates", Latitude: l.Location.Coords[1], Longitude: l.Location.Coords[0]}
+	}
+	if l.DisabledAccess {
+		place.AmenityFeature = []LocationFeatureLD{{Type: "LocationFeatureSpecification", Name: "Wheelchair accessible", Value: true}}
+	}
+	if l.PartOf != nil {
+		parent := placeLD(*l.PartOf)
+		place.ContainedInPlace = &parent
+	}
+	return place
+}
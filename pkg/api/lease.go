@@ -0,0 +1,174 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+const (
+	//leaseTTL is how long a replica holds a lease without renewing it, before another can take its work over
+	leaseTTL = 30 * time.Second
+	//leaseRenew is how often the holder renews its lease and saves how far it has got, and the others try to take it
+	leaseRenew = 10 * time.Second
+)
+
+//leaseHolder is what this replica holds the leases as
+var leaseHolder = newLeaseHolder()
+
+//newLeaseHolder returns the hostname of the replica with a random suffix, as a pod restarting can keep its hostname
+func newLeaseHolder() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 4)
+	rand.Read(b)
+	return host + "-" + hex.EncodeToString(b)
+}
+
+//runLeased calls lead whenever this replica acquires the lease with the name, until ctx is done, so only one replica
+//does the work at a time. lead is given the lease as it was acquired and a context which is cancelled once the lease is lost,
+//and has to return once it is.
+func runLeased(ctx context.Context, client db.Client, name, holder string, logger *slog.Logger, lead func(ctx context.Context, lease *db.Lease)) {
+	ticker := time.NewTicker(leaseRenew)
+	defer ticker.Stop()
+	for {
+		lease, err := client.AcquireLease(ctx, name, holder, leaseTTL)
+		if err == nil {
+			leaseCtx, cancel := context.WithCancel(ctx)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				lead(leaseCtx, lease)
+			}()
+			holdLease(leaseCtx, client, name, holder, logger, done)
+			cancel()
+			<-done
+		} else if !errors.Is(err, db.ErrLeaseHeld) && ctx.Err() == nil {
+			logger.Error("Acquiring a lease failed", "error", err, "lease", name)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+//holdLease renews the lease every leaseRenew, until ctx is done, done is closed or it can't be renewed
+func holdLease(ctx context.Context, client db.Client, name, holder string, logger *slog.Logger, done <-chan struct{}) {
+	ticker := time.NewTicker(leaseRenew)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		if _, err := client.AcquireLease(ctx, name, holder, leaseTTL); err != nil {
+			if ctx.Err() == nil {
+				logger.Warn("Lost a lease", "error", err, "lease", name)
+			}
+			return
+		}
+	}
+}
+
+//followChanges calls dispatch with each change after the cursor of the lease in turn, until ctx is done,
+//saving the cursor every leaseRenew so the replica taking the lease over carries on from there.
+//Without a cursor it starts from the latest change, rather than going through everything from before.
+//what names the work in the logs, such as notifications.
+func followChanges(ctx context.Context, hub *ChangeHub, client db.Client, lease *db.Lease, logger *slog.Logger, what string, dispatch func(context.Context, ChangeJSON)) {
+	lastID, saved := lease.Cursor, lease.Cursor
+	if lastID == 0 {
+		latest, err := client.GetLatestChange(ctx)
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
+			logger.Error("Reading the latest change failed", "error", err, "lease", lease.Name)
+			return
+		}
+		if latest != nil {
+			lastID = latest.Seq
+		}
+	}
+	//save stores lastID as the cursor, failing only if the lease has been lost, as it is tried again on the next tick otherwise
+	save := func(ctx context.Context) error {
+		if lastID == saved {
+			return nil
+		}
+		err := client.SetLeaseCursor(ctx, lease.Name, lease.Holder, lastID)
+		if errors.Is(err, db.ErrLeaseHeld) {
+			return err
+		}
+		if err != nil {
+			logger.Error("Saving how far the "+what+" have got failed", "error", err, "after", lastID)
+			return nil
+		}
+		saved = lastID
+		return nil
+	}
+	defer func() {
+		// ctx is done by now, so the last save is given a moment of its own
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		save(ctx)
+	}()
+
+	ticker := time.NewTicker(leaseRenew)
+	defer ticker.Stop()
+	for ctx.Err() == nil {
+		s, missed, err := hub.subscribe(ctx, []string{AllTopics}, lastID)
+		if err != nil {
+			logger.Error("Subscribing the "+what+" to the changes failed", "error", err)
+			hub.wait(ctx)
+			continue
+		}
+		if len(missed) > 0 && missed[0].ID > lastID+1 {
+			logger.Warn("The "+what+" fell further behind than the backlog of changes, some have been skipped",
+				"from", lastID+1, "to", missed[0].ID-1)
+		}
+		for _, change := range missed {
+			dispatch(ctx, change)
+			lastID = change.ID
+		}
+		err = receiveChanges(ctx, s, ticker.C, save, func(change ChangeJSON) {
+			dispatch(ctx, change)
+			lastID = change.ID
+		})
+		hub.unsubscribe(s)
+		if errors.Is(err, db.ErrLeaseHeld) {
+			return
+		}
+		if errors.Is(err, errDropped) {
+			logger.Warn("The "+what+" fell behind the changes, catching up from the database", "after", lastID)
+		}
+	}
+}
+
+//errDropped is returned by receiveChanges when the hub drops the subscriber for falling behind
+var errDropped = errors.New("The subscriber fell behind the changes")
+
+//receiveChanges passes each change sent to the subscriber to dispatch, saving how far it has got on every tick,
+//until ctx is done, the subscriber is dropped or the lease is lost
+func receiveChanges(ctx context.Context, s *subscriber, tick <-chan time.Time, save func(context.Context) error, dispatch func(ChangeJSON)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick:
+			if err := save(ctx); err != nil {
+				return err
+			}
+		case change, ok := <-s.send:
+			if !ok {
+				return errDropped
+			}
+			dispatch(change)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+//ListLocations returns a page of the buildings and rooms ordered by their slug, or ?sort, see parsePage,
+//only querying the ?fields asked for. ?campus and ?accessible narrow them, see locationFilter.
+func (config *Config) ListLocations() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		opts, err := parsePage(r)
+		if err != nil {
+			return err
+		}
+		opts.Fields = fieldPredicates(r, "location")
+		opts.Sort = parseSort(r, locationSorts)
+		opts = locationFilter(r, opts)
+		locations, err := config.DBClient.ListLocations(r.Context(), opts)
+		if err != nil {
+			return err
+		}
+		if locations == nil {
+			locations = []db.Location{}
+		}
+		total, err := config.DBClient.CountFilteredLocations(r.Context(), opts)
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusOK, newPage(locations, opts, *total))
+	})
+}
+
+//GetLocation returns the location with the kent slug in the path
+func (config *Config) GetLocation() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		location, err := config.DBClient.GetLocationFromKentSlug(r.Context(), mux.Vars(r)["slug"])
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusOK, location)
+	})
+}
+
+//GetLocationEvents returns a page of the events taking place at the location with the kent slug in the path.
+//It lists the events overlapping the window chosen by parseWindow, as json, csv or iCalendar, see negotiate.
+func (config *Config) GetLocationEvents() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		opts, err := parsePage(r)
+		if err != nil {
+			return err
+		}
+		cursor, err := parseCursor(r)
+		if err != nil {
+			return err
+		}
+		from, to, err := parseWindow(r)
+		if err != nil {
+			return err
+		}
+
+		// The events query is empty for unknown slugs, so look the location up first to answer with a 404
+		slug := mux.Vars(r)["slug"]
+		location, err := config.DBClient.GetLocationFromKentSlug(r.Context(), slug)
+		if err != nil {
+			return err
+		}
+		events, err := config.DBClient.GetEventsByLocation(r.Context(), slug, from, to)
+		if err != nil {
+			return err
+		}
+		name := location.Name
+		if name == "" {
+			name = location.ID
+		}
+		page, next := pageEventsAfter(events, cursor, opts)
+		return config.writeEvents(w, r, page, opts, len(events), next, name)
+	})
+}
+
+const (
+	//DefaultFreeDuration is how long the rooms GET /locations/free returns have to be free for without ?duration
+	DefaultFreeDuration = time.Hour
+	//MaxFreeDuration is the longest ?duration GET /locations/free looks for free rooms over
+	MaxFreeDuration = 24 * time.Hour
+)
+
+//FreeLocationsJSON is the answer of GET /locations/free, a page of the free locations along with the window
+type FreeLocationsJSON struct {
+	PageJSON
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+//FreeLocations returns a page of the locations with no events from ?at (now without it) for ?duration (such as 90m),
+//ordered by their slug, with their capacity and disabled access so students can find somewhere to study.
+//With ?building only the rooms in the building with that slug are returned, with ?campus only those on the campus,
+//and with ?accessible=true only those with disabled access.
+func (config *Config) FreeLocations() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		opts, err := parsePage(r)
+		if err != nil {
+			return err
+		}
+		query := r.URL.Query()
+		from := time.Now()
+		if at := query.Get("at"); at != "" {
+			from, err = time.Parse(time.RFC3339, at)
+			if err != nil {
+				return badRequest("The at time must be an RFC3339 time, such as 2024-10-01T14:00:00Z.", err)
+			}
+		}
+		duration := DefaultFreeDuration
+		if d := query.Get("duration"); d != "" {
+			duration, err = time.ParseDuration(d)
+			if err != nil || duration <= 0 {
+				return badRequest("The duration must be a positive duration, such as 90m or 2h.", err)
+			}
+			if duration > MaxFreeDuration {
+				return badRequest(fmt.Sprintf("The duration can be at most %s.", MaxFreeDuration), nil)
+			}
+		}
+		to := from.Add(duration)
+
+		locations, err := config.DBClient.GetFreeLocations(r.Context(), from, to, query.Get("building"))
+		if err != nil {
+			return err
+		}
+		locations = filterLocations(r, locations)
+		start, end := pageBounds(len(locations), opts)
+		return writeJSON(w, http.StatusOK, FreeLocationsJSON{
+			PageJSON: newPage(locations[start:end], opts, len(locations)),
+			From:     from.UTC(),
+			To:       to.UTC(),
+		})
+	})
+}
+
+//locationFilter reads ?accessible and ?campus into the options, narrowing the rooms and the events in them,
+//see db.ListOptions.Includes. The values have been checked by Validate.
+func locationFilter(r *http.Request, opts db.ListOptions) db.ListOptions {
+	query := r.URL.Query()
+	opts.Accessible, _ = strconv.ParseBool(query.Get("accessible"))
+	opts.Campus = query.Get("campus")
+	return opts
+}
+
+//filterLocations returns the locations ?accessible and ?campus leave in, all of them without either
+func filterLocations(r *http.Request, locations []db.Location) []db.Location {
+	filter := locationFilter(r, db.ListOptions{})
+	if !filter.Accessible && filter.Campus == "" {
+		return locations
+	}
+	kept := make([]db.Location, 0, len(locations))
+	for _, l := range locations {
+		if filter.Includes(l) {
+			kept = append(kept, l)
+		}
+	}
+	return kept
+}
+
+//filterEvents returns the events taking place in at least one of the locations ?accessible and ?campus leave in,
+//all of them without either
+func filterEvents(r *http.Request, events []db.Event) []db.Event {
+	filter := locationFilter(r, db.ListOptions{})
+	if !filter.Accessible && filter.Campus == "" {
+		return events
+	}
+	kept := make([]db.Event, 0, len(events))
+	for _, e := range events {
+		for _, l := range e.Location {
+			if filter.Includes(l) {
+				kept = append(kept, e)
+				break
+			}
+		}
+	}
+	return kept
+}
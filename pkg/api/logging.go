@@ -0,0 +1,147 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+//DefaultLogger logs json to stdout, one object per line, which log aggregators can read as they are
+func DefaultLogger() *slog.Logger {
+	return slog.New(slog.NewJSONHandler(os.Stdout, nil))
+}
+
+//requestLog collects what the handlers have to say about the request, to log it all together once it is done
+type requestLog struct {
+	mu    sync.Mutex
+	err   error
+	attrs []slog.Attr
+}
+
+type requestLogContextKey struct{}
+
+//logAttrs adds the attributes to the log of the request, if it is being logged
+func logAttrs(ctx context.Context, attrs ...slog.Attr) {
+	if rl, ok := ctx.Value(requestLogContextKey{}).(*requestLog); ok {
+		rl.mu.Lock()
+		rl.attrs = append(rl.attrs, attrs...)
+		rl.mu.Unlock()
+	}
+}
+
+//logRequestError records why the request failed in its log, returning false if it isn't being logged
+func logRequestError(ctx context.Context, err error) bool {
+	rl, ok := ctx.Value(requestLogContextKey{}).(*requestLog)
+	if ok {
+		rl.mu.Lock()
+		rl.err = err
+		rl.mu.Unlock()
+	}
+	return ok
+}
+
+//LogRequests logs every request once it has been answered with its method, path, status, latency,
+//bytes sent, request id and client, along with the error it failed with, to config.Logger
+func (config *Config) LogRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rl := &requestLog{}
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), requestLogContextKey{}, rl)))
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		client, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			client = r.RemoteAddr
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int64("bytes", rec.bytes),
+			slog.String("client", client),
+		}
+		if id := RequestIDFromContext(r.Context()); id != "" {
+			attrs = append(attrs, slog.String("request_id", id))
+		}
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			attrs = append(attrs, slog.String("forwarded_for", forwarded))
+		}
+		if agent := r.UserAgent(); agent != "" {
+			attrs = append(attrs, slog.String("user_agent", agent))
+		}
+
+		rl.mu.Lock()
+		attrs = append(attrs, rl.attrs...)
+		if rl.err != nil {
+			attrs = append(attrs, slog.String("error", rl.err.Error()))
+		}
+		rl.mu.Unlock()
+
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		config.Logger.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
+
+//statusRecorder records the status and how many bytes of the body were sent
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(p []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(p)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+func (rec *statusRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+//Hijack lets the websockets take over the connection, which is recorded as switching protocols
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("The connection can't be hijacked")
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil && rec.status == 0 {
+		rec.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+//Unwrap lets http.ResponseController reach the underlying writer
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
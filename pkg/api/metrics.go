@@ -0,0 +1,108 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+//Metrics holds the prometheus collectors recording every request the router serves
+type Metrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight prometheus.Gauge
+	panics   *prometheus.CounterVec
+}
+
+//NewMetrics creates the collectors and registers them with reg
+func NewMetrics(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "whatsupkent",
+			Subsystem: "api",
+			Name:      "requests_total",
+			Help:      "Number of requests answered, by route, method and status.",
+		}, []string{"route", "method", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "whatsupkent",
+			Subsystem: "api",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of the requests, by route, method and status. Streams count for as long as they are open.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "whatsupkent",
+			Subsystem: "api",
+			Name:      "requests_in_flight",
+			Help:      "Number of requests being answered right now.",
+		}),
+		panics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "whatsupkent",
+			Subsystem: "api",
+			Name:      "panics_total",
+			Help:      "Number of requests whose handler panicked, by route.",
+		}, []string{"route"}),
+	}
+
+	for _, c := range []prometheus.Collector{m.requests, m.duration, m.inFlight, m.panics} {
+		err := reg.Register(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+//Instrument records metrics for every request served by the routers set up from now on
+func (config *Config) Instrument(reg prometheus.Registerer) error {
+	m, err := NewMetrics(reg)
+	if err != nil {
+		return err
+	}
+	config.Metrics = m
+	return nil
+}
+
+//Middleware records the requests to next, labelled by the path template of their route such as /modules/{code}
+//so the label doesn't grow with every module. It is next as it is if the metrics are nil.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeTemplate(r)
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		code := strconv.Itoa(status)
+		m.requests.WithLabelValues(route, r.Method, code).Inc()
+		m.duration.WithLabelValues(route, r.Method, code).Observe(time.Since(start).Seconds())
+	})
+}
+
+//panicked counts a request to the route whose handler panicked, it does nothing if the metrics are nil
+func (m *Metrics) panicked(route string) {
+	if m != nil {
+		m.panics.WithLabelValues(route).Inc()
+	}
+}
+
+//routeTemplate returns the path template of the request's route, or unknown if it wasn't routed
+func routeTemplate(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return "unknown"
+}
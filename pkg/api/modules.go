@@ -0,0 +1,90 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+//ModuleJSON is a module as the module endpoints return it, with its upcoming events if they were expanded.
+//Events is left out when there are none.
+type ModuleJSON struct {
+	db.Module
+	Events []db.Event `json:"events,omitempty"`
+}
+
+//ListModules returns a page of the modules ordered by their module code, or ?sort, see parsePage,
+//only querying the ?fields asked for
+func (config *Config) ListModules() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		opts, err := parsePage(r)
+		if err != nil {
+			return err
+		}
+		opts.Fields = fieldPredicates(r, "module")
+		opts.Sort = parseSort(r, moduleSorts)
+		modules, err := config.DBClient.ListModules(r.Context(), opts)
+		if err != nil {
+			return err
+		}
+		if modules == nil {
+			modules = []db.Module{}
+		}
+		total, err := config.DBClient.CountModules(r.Context())
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusOK, newPage(modules, opts, *total))
+	})
+}
+
+//GetModule returns the module with the code in the path, with ?expand=events it includes the module's upcoming events
+func (config *Config) GetModule() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		code := mux.Vars(r)["code"]
+		module, err := config.DBClient.GetModuleFromSDSCode(r.Context(), code)
+		if err != nil {
+			return err
+		}
+		resp := ModuleJSON{Module: *module}
+		if expands(r, "events") {
+			events, err := config.DBClient.GetEventsByModule(r.Context(), code)
+			if err != nil {
+				return err
+			}
+			resp.Events = upcoming(events, time.Now())
+		}
+		return writeJSON(w, http.StatusOK, resp)
+	})
+}
+
+//expands returns whether the field is one of the comma separated ?expand values
+func expands(r *http.Request, field string) bool {
+	for _, value := range r.URL.Query()["expand"] {
+		for _, f := range strings.Split(value, ",") {
+			if strings.TrimSpace(f) == field {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//upcoming returns the events which haven't finished by now, keeping their order
+func upcoming(events []db.Event, now time.Time) []db.Event {
+	out := make([]db.Event, 0, len(events))
+	for _, e := range events {
+		end := e.EndDate
+		if end == nil {
+			end = e.StartDate
+		}
+		if end != nil && end.Before(now) {
+			continue
+		}
+		out = append(out, e)
+	}
+	return out
+}
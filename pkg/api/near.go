@@ -0,0 +1,120 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+//The radius GET /events/near looks within without ?radius, and the most it can be set to, in metres
+const (
+	DefaultNearRadius = 500
+	MaxNearRadius     = 5000
+)
+
+//walkingDetour is how much further walking between two points is than as the crow flies, around the buildings and paths
+const walkingDetour = 1.3
+
+//walkingSpeed is how far a student walks in a minute, in metres
+const walkingSpeed = 84
+
+//EventNearJSON is an event found by GetEventsNear, with how far away it is
+type EventNearJSON struct {
+	db.Event
+	//Distance is how far away the event's nearest location is as the crow flies, in metres
+	Distance int `json:"distance"`
+	//WalkingMinutes is roughly how long it takes to walk there, allowing for the paths not going straight
+	WalkingMinutes int `json:"walking_minutes"`
+}
+
+//NearJSON is the answer of GET /events/near
+type NearJSON struct {
+	At     time.Time       `json:"at"`
+	Until  time.Time       `json:"until"`
+	Radius int             `json:"radius"`
+	Events []EventNearJSON `json:"events"`
+}
+
+//walkingMinutes returns roughly how many minutes walking the distance in metres takes, at least a minute
+func walkingMinutes(distance float64) int {
+	minutes := int(math.Ceil(distance * walkingDetour / walkingSpeed))
+	if minutes < 1 {
+		return 1
+	}
+	return minutes
+}
+
+//parseCoordinate reads the query parameter as a latitude or longitude, which must be within [-limit, limit]
+func parseCoordinate(r *http.Request, name string, limit float64) (float64, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return 0, badRequest("The "+name+" is needed to find what is near.", nil)
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(v) || v < -limit || v > limit {
+		return 0, badRequest("The "+name+" must be a number of degrees between -"+strconv.Itoa(int(limit))+" and "+strconv.Itoa(int(limit))+".", err)
+	}
+	return v, nil
+}
+
+//EventsNear returns what is on near ?lat and ?lng, in the ?radius metres around them, now or at ?at and starting in the next hour,
+//nearest first, or in the order they start with ?sort=start_date. Only in the rooms ?campus and ?accessible leave in.
+//Like Now it is read best effort. The rooms whose coordinates weren't found while scraping are never near anywhere.
+func (config *Config) EventsNear() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		lat, err := parseCoordinate(r, "lat", 90)
+		if err != nil {
+			return err
+		}
+		lng, err := parseCoordinate(r, "lng", 180)
+		if err != nil {
+			return err
+		}
+		radius := DefaultNearRadius
+		if raw := r.URL.Query().Get("radius"); raw != "" {
+			radius, err = strconv.Atoi(raw)
+			if err != nil || radius < 1 || radius > MaxNearRadius {
+				return badRequest("The radius must be a whole number of metres, from 1 to "+strconv.Itoa(MaxNearRadius)+".", err)
+			}
+		}
+		at := time.Now()
+		if raw := r.URL.Query().Get("at"); raw != "" {
+			at, err = time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return badRequest("The at time must be an RFC3339 time, such as 2024-10-01T14:00:00Z.", err)
+			}
+		}
+		until := at.Add(NowSoon)
+
+		near, err := config.DBClient.GetEventsNear(r.Context(), db.NewPoint(lat, lng), float64(radius), at, until, db.WithBestEffort())
+		if err != nil {
+			return err
+		}
+		events := make([]db.Event, 0, len(near))
+		distances := make(map[string]float64, len(near))
+		for _, n := range near {
+			// Events ending just as the window starts overlap it, but are already over, as in Now
+			if n.Event.EndDate == nil || !n.Event.EndDate.After(at) {
+				continue
+			}
+			events = append(events, n.Event)
+			distances[n.Event.UID] = n.Distance
+		}
+
+		resp := NearJSON{At: at.UTC(), Until: until.UTC(), Radius: radius, Events: make([]EventNearJSON, 0, len(events))}
+		for _, e := range filterEvents(r, events) {
+			d := distances[e.UID]
+			resp.Events = append(resp.Events, EventNearJSON{Event: e, Distance: int(math.Round(d)), WalkingMinutes: walkingMinutes(d)})
+		}
+		if r.URL.Query().Get("sort") == "start_date" {
+			sort.SliceStable(resp.Events, func(i, j int) bool {
+				return resp.Events[i].StartDate.Before(*resp.Events[j].StartDate)
+			})
+		}
+		return writeJSON(w, http.StatusOK, resp)
+	})
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+	"github.com/jamesjarvis/WhatsUpKent/pkg/ical"
+)
+
+//The media types the event resources can be answered with
+const (
+	mediaJSON     = "application/json"
+	mediaCSV      = "text/csv"
+	mediaCalendar = "text/calendar"
+	mediaJSONLD   = "application/ld+json"
+)
+
+//eventMediaTypes are the media types the event resources offer, the api's preference first
+var eventMediaTypes = []string{mediaJSON, mediaCSV, mediaCalendar, mediaJSONLD}
+
+//formatMediaTypes are the media types chosen by the ?format values, for clients which can't set an Accept header
+var formatMediaTypes = map[string]string{
+	"json":   mediaJSON,
+	"csv":    mediaCSV,
+	"ics":    mediaCalendar,
+	"ical":   mediaCalendar,
+	"jsonld": mediaJSONLD,
+}
+
+//negotiate returns which of the offered media types to answer the request with. ?format chooses one outright,
+//otherwise it is the one the Accept header rates highest, the earliest offered winning a tie,
+//or the first offered if there is no Accept header. It fails with a 406 if none of them are acceptable.
+func negotiate(r *http.Request, offers []string) (string, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		mediaType, ok := formatMediaTypes[strings.ToLower(format)]
+		if ok {
+			for _, offer := range offers {
+				if offer == mediaType {
+					return offer, nil
+				}
+			}
+		}
+		return "", badRequest(fmt.Sprintf("The format %q isn't one of the formats offered.", format), nil)
+	}
+
+	accept := r.Header.Get("Accept")
+	if strings.TrimSpace(accept) == "" {
+		return offers[0], nil
+	}
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := acceptQuality(accept, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	if best == "" {
+		return "", &Error{
+			Code:    http.StatusNotAcceptable,
+			Status:  "Not Acceptable",
+			Message: "This can only be answered with one of " + strings.Join(offers, ", ") + ".",
+		}
+	}
+	return best, nil
+}
+
+//acceptQuality returns the quality the Accept header gives the media type, from the most specific range matching it.
+//It is 0 if no range matches, or the one matching rules the media type out.
+func acceptQuality(accept, mediaType string) float64 {
+	mainType := strings.SplitN(mediaType, "/", 2)[0]
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		accepted, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		s := -1
+		switch {
+		case accepted == mediaType:
+			s = 2
+		case accepted == mainType+"/*":
+			s = 1
+		case accepted == "*/*":
+			s = 0
+		}
+		if s <= specificity {
+			continue
+		}
+		quality := 1.0
+		if value, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		q, specificity = quality, s
+	}
+	return q
+}
+
+//writeEvents answers with the page of the events in the format negotiated for the request, see negotiate.
+//As json they are wrapped in the PageJSON envelope, as csv one row each, as an iCalendar feed called name,
+//and as JSON-LD schema.org Events, with the total sent as an X-Total-Count header for the formats without an envelope.
+//The cursor of the next page, if there is one, is sent in the envelope and as a Link to it.
+func (config *Config) writeEvents(w http.ResponseWriter, r *http.Request, events []db.Event, opts db.ListOptions, total int, next, name string) error {
+	// The answer depends on the Accept header, so caches mustn't give it to clients asking for another format
+	w.Header().Add("Vary", "Accept")
+	mediaType, err := negotiate(r, eventMediaTypes)
+	if err != nil {
+		return err
+	}
+
+	setNextLink(w, r, next)
+	switch mediaType {
+	case mediaCSV:
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		return writeEventsCSV(w, events)
+	case mediaCalendar:
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		return config.writeCalendar(w, r, ical.Calendar{Name: name, Events: calendarEvents(events)})
+	case mediaJSONLD:
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		return writeEventsLD(w, events)
+	default:
+		page := newPage(events, opts, total)
+		page.Meta.NextCursor = next
+		return writeJSON(w, http.StatusOK, page)
+	}
+}
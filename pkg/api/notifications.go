@@ -0,0 +1,388 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+	"github.com/jamesjarvis/WhatsUpKent/pkg/notify"
+)
+
+//The channels users can be notified through
+const (
+	ChannelEmail = "email"
+	ChannelPush  = "push"
+)
+
+const (
+	//MaxPushSubscriptions is how many browsers a user can have pushed to
+	MaxPushSubscriptions = 10
+	//notificationConcurrency is how many users are notified at once
+	notificationConcurrency = 10
+	//notificationLease is the name of the lease held by the replica notifying the users
+	notificationLease = "notifications"
+)
+
+//defaultNotifyChanges are the types of changes users are told about if they haven't chosen any,
+//the ones which change where they need to be and when
+var defaultNotifyChanges = []string{ChangeMoved, ChangeCancelled}
+
+//notifyChangeTypes are the types of changes users can be told about, an event of one of their modules
+//moving room or time, otherwise being updated or being cancelled
+var notifyChangeTypes = map[string]bool{
+	ChangeMoved:     true,
+	ChangeUpdated:   true,
+	ChangeCancelled: true,
+}
+
+//NotificationDispatcher tells the users about the changes a ChangeHub sees to the events of the modules of their timetables,
+//by email or web push as each of them chose, see NotificationsJSON.
+//Only the replica holding the notificationLease tells them, and every notification is recorded so nobody is told twice.
+type NotificationDispatcher struct {
+	hub    *ChangeHub
+	client db.Client
+	//Mailer sends the emails, nobody is emailed if it is nil
+	Mailer *notify.Mailer
+	//Pusher sends the web push messages, nobody is pushed to if it is nil
+	Pusher *notify.Pusher
+	//PublicURL is where the api is served from, such as https://api.whatsupkent.com, for the unsubscribe links of the emails
+	PublicURL string
+	//UnsubscribeSecret signs the tokens of the unsubscribe links, which are left out of the emails without it.
+	//Changing it breaks the links of the emails already sent.
+	UnsubscribeSecret []byte
+	//Logger logs the notifications which couldn't be sent, it is slog.Default() if it isn't set
+	Logger *slog.Logger
+
+	holder string
+	sem    chan struct{}
+}
+
+//NewNotificationDispatcher returns a dispatcher of the changes the hub sees to the users in the database,
+//which Run has to be called to start, and which needs a Mailer or a Pusher to send anything
+func NewNotificationDispatcher(hub *ChangeHub, client db.Client) *NotificationDispatcher {
+	return &NotificationDispatcher{
+		hub:    hub,
+		client: client,
+		holder: leaseHolder,
+		sem:    make(chan struct{}, notificationConcurrency),
+	}
+}
+
+func (d *NotificationDispatcher) logger() *slog.Logger {
+	if d.Logger == nil {
+		return slog.Default()
+	}
+	return d.Logger
+}
+
+//Run notifies the users of the changes until ctx is done, while this replica holds the notificationLease,
+//so only one of the replicas notifies them. The replica taking the lease over carries on from the last change saved on it.
+func (d *NotificationDispatcher) Run(ctx context.Context) {
+	runLeased(ctx, d.client, notificationLease, d.holder, d.logger(), func(ctx context.Context, lease *db.Lease) {
+		followChanges(ctx, d.hub, d.client, lease, d.logger(), "notifications", d.dispatch)
+	})
+}
+
+//dispatch starts notifying the users with the modules of the changed event who want to be told about the change
+func (d *NotificationDispatcher) dispatch(ctx context.Context, change ChangeJSON) {
+	if change.Event == nil || !notifyChangeTypes[change.Type] || (d.Mailer == nil && d.Pusher == nil) {
+		return
+	}
+	codes := make([]string, 0)
+	for _, topic := range change.Topics {
+		if strings.HasPrefix(topic, "module:") {
+			codes = append(codes, strings.TrimPrefix(topic, "module:"))
+		}
+	}
+	if len(codes) == 0 {
+		return
+	}
+	users, err := d.client.ListUsersToNotify(ctx, codes)
+	if err != nil {
+		d.logger().Error("Reading the users to notify failed", "error", err, "change", change.ID)
+		return
+	}
+	for _, u := range users {
+		if !notifyMatches(u, change) {
+			continue
+		}
+		// The slot is taken before the goroutine is started, so a change to a big module can't start one for every user at once
+		select {
+		case d.sem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		go func(u db.User) {
+			defer func() { <-d.sem }()
+			d.notify(ctx, u, change)
+		}(u)
+	}
+}
+
+//notifyMatches returns whether the user wants to be told about the type of the change
+func notifyMatches(u db.User, change ChangeJSON) bool {
+	changes := u.NotifyChanges
+	if len(changes) == 0 {
+		changes = defaultNotifyChanges
+	}
+	return contains(changes, change.Type)
+}
+
+//notify tells the user about the change through each of their channels, forgetting the push subscriptions which have gone.
+//The notification is claimed first, so the user isn't told again by a replica going over the same change after taking the lease over.
+func (d *NotificationDispatcher) notify(ctx context.Context, u db.User, change ChangeJSON) {
+	claimed, err := d.client.ClaimNotification(ctx, change.ID, u.Subject)
+	if err != nil {
+		d.logger().Error("Recording a notification failed", "error", err, "user", u.Subject, "change", change.ID)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	msg := d.message(u, change)
+	if d.Mailer != nil && u.Email != "" && contains(u.NotifyChannels, ChannelEmail) {
+		if err := d.Mailer.Send(u.Email, msg); err != nil {
+			d.logger().Warn("Emailing a user about a change failed", "error", err, "user", u.Subject, "change", change.ID)
+		}
+	}
+	if d.Pusher == nil || !contains(u.NotifyChannels, ChannelPush) {
+		return
+	}
+	gone := make([]string, 0)
+	for _, raw := range u.PushSubscriptions {
+		var sub notify.Subscription
+		if err := json.Unmarshal([]byte(raw), &sub); err != nil {
+			gone = append(gone, raw)
+			continue
+		}
+		err := d.Pusher.Send(ctx, sub, msg)
+		if errors.Is(err, notify.ErrSubscriptionGone) {
+			gone = append(gone, raw)
+		} else if err != nil {
+			d.logger().Warn("Pushing a change to a user failed", "error", err, "user", u.Subject, "change", change.ID)
+		}
+	}
+	if len(gone) > 0 {
+		if err := d.forget(ctx, u.Subject, gone); err != nil {
+			d.logger().Error("Forgetting the push subscriptions which have gone failed", "error", err, "user", u.Subject)
+		}
+	}
+}
+
+//message returns the notification of the change, worded like the entries of the changes feed
+func (d *NotificationDispatcher) message(u db.User, change ChangeJSON) notify.Message {
+	entry := changeEntry(change)
+	msg := notify.Message{Subject: entry.Title, Body: entry.Summary, Tag: change.Event.ID}
+	if token := d.unsubscribeToken(u.Subject); d.PublicURL != "" && token != "" {
+		msg.UnsubscribeURL = strings.TrimSuffix(d.PublicURL, "/") + "/v1/notifications/unsubscribe?token=" + url.QueryEscape(token)
+	}
+	return msg
+}
+
+//unsubscribeToken returns the token of the user's unsubscribe links, the hex HMAC-SHA256 of their subject with the UnsubscribeSecret,
+//so the links can be made again for every email without the token being stored. It is empty without a secret.
+func (d *NotificationDispatcher) unsubscribeToken(subject string) string {
+	if len(d.UnsubscribeSecret) == 0 {
+		return ""
+	}
+	mac := hmac.New(sha256.New, d.UnsubscribeSecret)
+	mac.Write([]byte(subject))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+//unsubscribeHash returns the hex SHA-256 of an unsubscribe token, which is all the database keeps of it
+func unsubscribeHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+//forget drops the push subscriptions of the user, reading them again so the ones added since aren't lost
+func (d *NotificationDispatcher) forget(ctx context.Context, subject string, gone []string) error {
+	u, err := d.client.GetUser(ctx, subject)
+	if err != nil {
+		return err
+	}
+	kept := make([]string, 0, len(u.PushSubscriptions))
+	for _, raw := range u.PushSubscriptions {
+		if !contains(gone, raw) {
+			kept = append(kept, raw)
+		}
+	}
+	u.PushSubscriptions = kept
+	_, err = d.client.SetUserNotifications(ctx, *u)
+	return err
+}
+
+//NotificationsJSON is how a user wants to be told about the changes to the events of the modules of their timetable,
+//what GET /me/notifications answers with and PUT /me/notifications is sent
+type NotificationsJSON struct {
+	//Channels are how the user is told, email or push, they aren't told about anything without any
+	Channels []string `json:"channels"`
+	//Changes are the types of changes they are told about, moved, updated or cancelled. It is moved and cancelled without any.
+	Changes []string `json:"changes"`
+	//PushSubscriptions are the push subscriptions of the user's browsers, which push sends to
+	PushSubscriptions []notify.Subscription `json:"push_subscriptions"`
+	//VAPIDPublicKey is the applicationServerKey the browsers subscribe with, it is left out if push isn't set up
+	VAPIDPublicKey string `json:"vapid_public_key,omitempty"`
+}
+
+//notificationsJSON returns the notification preferences of the user, which are empty if they haven't set any
+func (config *Config) notificationsJSON(u *db.User) NotificationsJSON {
+	out := NotificationsJSON{Channels: []string{}, Changes: defaultNotifyChanges, PushSubscriptions: []notify.Subscription{}}
+	if config.Notifications != nil && config.Notifications.Pusher != nil {
+		out.VAPIDPublicKey = config.Notifications.Pusher.PublicKey()
+	}
+	if u == nil {
+		return out
+	}
+	if len(u.NotifyChannels) > 0 {
+		out.Channels = u.NotifyChannels
+	}
+	if len(u.NotifyChanges) > 0 {
+		out.Changes = u.NotifyChanges
+	}
+	for _, raw := range u.PushSubscriptions {
+		var sub notify.Subscription
+		if err := json.Unmarshal([]byte(raw), &sub); err == nil {
+			out.PushSubscriptions = append(out.PushSubscriptions, sub)
+		}
+	}
+	return out
+}
+
+//GetNotifications returns how the signed in user wants to be told about the changes to their timetable
+func (config *Config) GetNotifications() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		user, _ := UserFromContext(r.Context())
+		saved, err := config.DBClient.GetUser(r.Context(), user.Subject)
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
+			return err
+		}
+		return writeJSON(w, http.StatusOK, config.notificationsJSON(saved))
+	})
+}
+
+//SetNotifications replaces how the signed in user wants to be told about the changes to the events of their timetable's modules,
+//answering with the preferences saved. Sending no channels turns the notifications off.
+func (config *Config) SetNotifications() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		user, _ := UserFromContext(r.Context())
+		var req NotificationsJSON
+		defer r.Body.Close()
+		err := json.NewDecoder(io.LimitReader(r.Body, 1048576)).Decode(&req)
+		if err != nil {
+			return badRequest("Could not read the notifications.", err)
+		}
+
+		var mailer *notify.Mailer
+		var pusher *notify.Pusher
+		if config.Notifications != nil {
+			mailer, pusher = config.Notifications.Mailer, config.Notifications.Pusher
+		}
+		v := &validator{}
+		for _, channel := range req.Channels {
+			switch {
+			case channel == ChannelEmail && mailer == nil:
+				v.fail("body", "channels", "Email notifications aren't set up.")
+			case channel == ChannelEmail && user.Email == "":
+				v.fail("body", "channels", "Your account has no email address to send to.")
+			case channel == ChannelPush && pusher == nil:
+				v.fail("body", "channels", "Push notifications aren't set up.")
+			case channel == ChannelPush && len(req.PushSubscriptions) == 0:
+				v.fail("body", "push_subscriptions", "A push subscription is needed to push to.")
+			case channel != ChannelEmail && channel != ChannelPush:
+				v.fail("body", "channels", fmt.Sprintf("The channel %q isn't email or push.", channel))
+			}
+		}
+		for _, change := range req.Changes {
+			if !notifyChangeTypes[change] {
+				v.fail("body", "changes", fmt.Sprintf("The change %q isn't one of moved, updated or cancelled.", change))
+			}
+		}
+		if len(req.PushSubscriptions) > MaxPushSubscriptions {
+			v.fail("body", "push_subscriptions", fmt.Sprintf("At most %d browsers can be pushed to.", MaxPushSubscriptions))
+		}
+		subscriptions := make([]string, 0, len(req.PushSubscriptions))
+		for _, sub := range req.PushSubscriptions {
+			if err := sub.Validate(); err != nil {
+				v.fail("body", "push_subscriptions", err.Error()+".")
+				continue
+			}
+			raw, err := json.Marshal(sub)
+			if err != nil {
+				return err
+			}
+			subscriptions = append(subscriptions, string(raw))
+		}
+		if err := v.err(); err != nil {
+			return err
+		}
+
+		// The token is made from the subject, so the links of the emails already sent keep working
+		hash := ""
+		if config.Notifications != nil {
+			if token := config.Notifications.unsubscribeToken(user.Subject); token != "" {
+				hash = unsubscribeHash(token)
+			}
+		}
+		now := time.Now()
+		stored := db.User{
+			Subject:           user.Subject,
+			Email:             user.Email,
+			Name:              user.Name,
+			UpdatedAt:         &now,
+			NotifyChannels:    req.Channels,
+			NotifyChanges:     req.Changes,
+			PushSubscriptions: subscriptions,
+			UnsubscribeHash:   hash,
+		}
+		if _, err := config.DBClient.SetUserNotifications(r.Context(), stored); err != nil {
+			return err
+		}
+		saved, err := config.DBClient.GetUser(r.Context(), user.Subject)
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusOK, config.notificationsJSON(saved))
+	})
+}
+
+//UnsubscribedJSON is the answer of /notifications/unsubscribe
+type UnsubscribedJSON struct {
+	Unsubscribed bool `json:"unsubscribed"`
+}
+
+//Unsubscribe turns off the notifications of the user with the ?token of the unsubscribe links in their emails, without signing in.
+//It is both a GET, for the link in the email, and a POST, for the one click unsubscribes of the mail clients (RFC 8058).
+//The rest of the user's preferences are kept, so turning the notifications back on picks up where they left off.
+func (config *Config) Unsubscribe() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			return badRequest("The token of the unsubscribe link is needed.", nil)
+		}
+		u, err := config.DBClient.GetUserByUnsubscribeHash(r.Context(), unsubscribeHash(token))
+		if err != nil {
+			return err
+		}
+		if len(u.NotifyChannels) > 0 {
+			u.NotifyChannels = nil
+			if _, err := config.DBClient.SetUserNotifications(r.Context(), *u); err != nil {
+				return err
+			}
+		}
+		return writeJSON(w, http.StatusOK, UnsubscribedJSON{Unsubscribed: true})
+	})
+}
@@ -0,0 +1,819 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+//OpenAPIVersion is the version of the api given in its OpenAPI document
+const OpenAPIVersion = "1.0.0"
+
+//apiParam describes a path or query parameter of an operation
+type apiParam struct {
+	Name string
+	//In is "query" or "path", path parameters are always required
+	In          string
+	Description string
+	Required    bool
+	//Type is the json schema type of the value, string if it is empty
+	Type   string
+	Format string
+	//List is set for the parameters which are comma separated lists, each item of which is checked
+	List bool
+	//Enum, Pattern, Minimum and Maximum are the values the parameter can have, which Validate checks
+	Enum             []string
+	Pattern          *regexp.Regexp
+	Minimum, Maximum *int
+}
+
+//apiOperation documents what a route does, for the OpenAPI document
+type apiOperation struct {
+	Summary     string
+	Description string
+	Tags        []string
+	Params      []apiParam
+	//Body is a value of the type the operation is posted as json, if it takes a body
+	Body interface{}
+	//BodyType is the content type of a body which isn't json, such as a dgraph query
+	BodyType string
+	//Response is a value of the type the operation answers with as json, or of the items of the page if Page is set
+	Response interface{}
+	Page     bool
+	//Status is the status of a successful answer, it is 200 if it isn't set
+	Status int
+	//ContentTypes are the other content types the operation can answer with, such as text/csv
+	ContentTypes []string
+	//Security is the scheme the operation needs, "apiKey" or "user"
+	Security string
+}
+
+//The parameters shared by several operations
+var (
+	pageParams = []apiParam{
+		{Name: "limit", In: "query", Type: "integer", Minimum: &one, Description: "How many results to return, at most 500. It defaults to 50."},
+		{Name: "offset", In: "query", Type: "integer", Minimum: &zero, Description: "How many results to skip."},
+	}
+	//eventPageParams page through the lists of events, by offset or cursor
+	eventPageParams = params(pageParams, []apiParam{
+		{Name: "cursor", In: "query", Description: "The next_cursor of the page before, to page through the events without skipping or repeating any as they change. It can't be given with an offset or a sort."},
+	})
+	windowParams = []apiParam{
+		{Name: "from", In: "query", Format: "date-time", Description: "Only the events overlapping from and to, which have to be given together."},
+		{Name: "to", In: "query", Format: "date-time", Description: "Only the events overlapping from and to, which have to be given together."},
+	}
+	formatParam = apiParam{Name: "format", In: "query", Enum: []string{"json", "csv", "ics", "jsonld"}, Description: "json, csv, ics or jsonld to choose the format, for clients which can't set an Accept header."}
+	yearParam   = apiParam{Name: "year", In: "query", Type: "integer", Minimum: &one, Description: "The year the academic year starts in, such as 2024 for 2024/25. It defaults to the current one."}
+	//locationParams narrow the rooms, or the events, to those in the ones on a campus or with disabled access, see locationFilter
+	locationParams = []apiParam{
+		{Name: "campus", In: "query", Enum: db.Campuses, Description: "canterbury or medway to only include the rooms on the campus, or the events in one."},
+		{Name: "accessible", In: "query", Type: "boolean", Description: "true to only include the rooms with disabled access, or the events in one."},
+	}
+
+	unsubscribeTokenParam = apiParam{Name: "token", In: "query", Required: true, Description: "The token of the unsubscribe link in the emails."}
+)
+
+//params joins the lists of parameters
+func params(lists ...[]apiParam) []apiParam {
+	joined := make([]apiParam, 0)
+	for _, list := range lists {
+		joined = append(joined, list...)
+	}
+	return joined
+}
+
+//operations documents the routes set up by SetupRouter, keyed by their method and path template without the version prefix
+var operations = map[string]apiOperation{
+	"GET /": {
+		Summary:      "Welcome",
+		Tags:         []string{"meta"},
+		ContentTypes: []string{"text/plain"},
+	},
+	"POST /": {
+		Summary:     "Run a read only dgraph query",
+		Description: "The users, the notifications they were sent, the webhooks, their deliveries and the scrape jobs can't be queried.",
+		Tags:        []string{"query"},
+		BodyType:    "text/plain",
+		Response:    map[string]interface{}{},
+	},
+	"GET /events": {
+		Summary:      "List the events",
+		Description:  "Ordered by their start date, or sort.",
+		Tags:         []string{"events"},
+		Params:       params(eventPageParams, windowParams, []apiParam{formatParam, fieldsParam, sortParam(eventSorts)}, locationParams),
+		Response:     db.Event{},
+		Page:         true,
+		ContentTypes: []string{"text/csv", "text/calendar", "application/ld+json"},
+	},
+	"GET /events/stream": {
+		Summary: "Stream the changes to the timetable",
+		Description: "Server-sent events, event-change or scrape-completed, each holding a ChangeJSON. " +
+			"Reconnecting with a Last-Event-ID header first sends the changes missed, up to the latest 1000 of them.",
+		Tags: []string{"changes"},
+		Params: []apiParam{
+			{Name: "modules", In: "query", List: true, Pattern: moduleCodePattern, Description: "Comma separated module codes to follow, every change is sent without modules or locations."},
+			{Name: "locations", In: "query", List: true, Description: "Comma separated location slugs to follow."},
+			{Name: "last_event_id", In: "query", Type: "integer", Minimum: &zero, Description: "The id of the last change received, for clients which can't send Last-Event-ID."},
+		},
+		ContentTypes: []string{"text/event-stream"},
+	},
+	"GET /events/near": {
+		Summary: "Get what is on near a point",
+		Description: "The events in progress and those starting in the next hour in the rooms within radius metres of lat and lng, " +
+			"nearest first with roughly how many minutes walking away they are. Read best effort like /now.",
+		Tags: []string{"events"},
+		Params: params([]apiParam{
+			{Name: "lat", In: "query", Type: "number", Required: true, Description: "The latitude to look around, in degrees."},
+			{Name: "lng", In: "query", Type: "number", Required: true, Description: "The longitude to look around, in degrees."},
+			{Name: "radius", In: "query", Type: "integer", Minimum: &one, Maximum: &maxRadius, Description: "How far to look in metres. It defaults to 500."},
+			{Name: "at", In: "query", Format: "date-time", Description: "An RFC3339 time to look from instead of now."},
+			{Name: "sort", In: "query", Enum: []string{"distance", "start_date"}, Description: "distance, the nearest first, which is the default, or start_date."},
+		}, locationParams),
+		Response: NearJSON{},
+	},
+	"GET /now": {
+		Summary:     "Get what is on now",
+		Description: "The events in progress and those starting in the next hour, read best effort so it may be a few moments stale.",
+		Tags:        []string{"events"},
+		Params: params([]apiParam{
+			{Name: "at", In: "query", Format: "date-time", Description: "An RFC3339 time to look from instead of now."},
+			{Name: "building", In: "query", Description: "The location id of a building, to only include the events in it and its rooms."},
+			fieldsParam,
+		}, locationParams),
+		Response: NowJSON{},
+	},
+	"GET /modules": {
+		Summary:     "List the modules",
+		Description: "Ordered by their module code, or sort.",
+		Tags:        []string{"modules"},
+		Params:      params(pageParams, []apiParam{fieldsParam, sortParam(moduleSorts)}),
+		Response:    db.Module{},
+		Page:        true,
+	},
+	"GET /modules/{code}": {
+		Summary:  "Get a module",
+		Tags:     []string{"modules"},
+		Params:   []apiParam{{Name: "expand", In: "query", List: true, Enum: []string{"events"}, Description: "events to include the module's upcoming events."}, fieldsParam},
+		Response: ModuleJSON{},
+	},
+	"GET /modules/{code}/calendar.ics": {
+		Summary:      "Subscribe to a module's events",
+		Tags:         []string{"calendars"},
+		Params:       locationParams,
+		ContentTypes: []string{"text/calendar"},
+	},
+	"GET /modules/{code}/weeks/{n}": {
+		Summary:     "Get an academic week of a module",
+		Description: "Kent numbers the weeks of the academic year from 1, from the week its first term starts, see GET /terms. The module's events are grouped by the day they start on, Monday first.",
+		Tags:        []string{"modules"},
+		Params:      params([]apiParam{yearParam}, locationParams),
+		Response:    WeekJSON{},
+	},
+	"GET /modules/{code}/weeks/{n}/events": {
+		Summary:      "List the events of a module in an academic week",
+		Tags:         []string{"modules", "events"},
+		Params:       params(eventPageParams, []apiParam{yearParam, formatParam, fieldsParam}, locationParams),
+		Response:     db.Event{},
+		Page:         true,
+		ContentTypes: []string{"text/csv", "text/calendar", "application/ld+json"},
+	},
+	"GET /locations": {
+		Summary:     "List the buildings and rooms",
+		Description: "Ordered by their slug, or sort.",
+		Tags:        []string{"locations"},
+		Params:      params(pageParams, []apiParam{fieldsParam, sortParam(locationSorts)}, locationParams),
+		Response:    db.Location{},
+		Page:        true,
+	},
+	"GET /locations/free": {
+		Summary:     "List the rooms free to study in",
+		Description: "The locations with no events over the window, ordered by their slug.",
+		Tags:        []string{"locations"},
+		Params: params([]apiParam{
+			{Name: "at", In: "query", Format: "date-time", Description: "When the window starts, it is now without it."},
+			{Name: "duration", In: "query", Format: "duration", Description: "How long the window is, such as 90m, at most 24h. It defaults to 1h."},
+			{Name: "building", In: "query", Description: "Only the rooms in the building with this slug."},
+		}, locationParams, pageParams),
+		Response: FreeLocationsJSON{},
+	},
+	"GET /locations/{slug}": {
+		Summary:  "Get a location",
+		Tags:     []string{"locations"},
+		Params:   []apiParam{fieldsParam},
+		Response: db.Location{},
+	},
+	"GET /locations/{slug}/events": {
+		Summary:      "List the events at a location",
+		Description:  "The events of the next week without from and to.",
+		Tags:         []string{"locations", "events"},
+		Params:       params(eventPageParams, windowParams, []apiParam{formatParam, fieldsParam}),
+		Response:     db.Event{},
+		Page:         true,
+		ContentTypes: []string{"text/csv", "text/calendar", "application/ld+json"},
+	},
+	"GET /locations/{slug}/calendar.ics": {
+		Summary:      "Subscribe to a location's bookings",
+		Description:  "From four weeks ago to 26 weeks ahead without from and to.",
+		Tags:         []string{"calendars"},
+		Params:       windowParams,
+		ContentTypes: []string{"text/calendar"},
+	},
+	"GET /people": {
+		Summary:     "List the people",
+		Description: "Ordered by their name.",
+		Tags:        []string{"people"},
+		Params:      params([]apiParam{{Name: "q", In: "query", Description: "Only the people with any of its words in their name."}}, pageParams, []apiParam{fieldsParam}),
+		Response:    db.Person{},
+		Page:        true,
+	},
+	"GET /people/{id}/events": {
+		Summary:      "List the events a person organises",
+		Description:  "The events of the next week without from and to.",
+		Tags:         []string{"people", "events"},
+		Params:       params(eventPageParams, windowParams, []apiParam{formatParam, fieldsParam}, locationParams),
+		Response:     db.Event{},
+		Page:         true,
+		ContentTypes: []string{"text/csv", "text/calendar", "application/ld+json"},
+	},
+	"GET /calendar.ics": {
+		Summary:      "Subscribe to a timetable of several modules",
+		Tags:         []string{"calendars"},
+		Params:       params([]apiParam{{Name: "modules", In: "query", Required: true, List: true, Pattern: moduleCodePattern, Description: "Comma separated module codes, at most 20."}}, locationParams),
+		ContentTypes: []string{"text/calendar"},
+	},
+	"POST /clashes": {
+		Summary:     "Find the clashes between the events of several modules",
+		Description: "Pairs of events of different modules which overlap, with when they overlap, over the upcoming events or between from and to. At least 2 and at most 20 modules.",
+		Tags:        []string{"modules"},
+		Body:        ClashesRequestJSON{},
+		Response:    ClashesJSON{},
+	},
+	"GET /feeds/changes.atom": {
+		Summary:      "Follow the changes to the timetable in a feed reader",
+		Description:  "An Atom feed of the latest 100 events added, moved, updated and cancelled, newest first.",
+		Tags:         []string{"changes"},
+		Params:       []apiParam{{Name: "module", In: "query", Pattern: moduleCodePattern, Description: "A module code, to only include the changes to its events."}},
+		ContentTypes: []string{"application/atom+xml"},
+	},
+	"POST /graphql": {
+		Summary:     "Run a graphql query",
+		Description: "A query can nest at most 8 deep, look things up in the database at most 100 times and resolve at most 5000 nodes.",
+		Tags:        []string{"query"},
+		Body:        GraphQLRequest{},
+		Response:    map[string]interface{}{},
+	},
+	"GET /ws": {
+		Summary:     "Subscribe to the changes to the timetable over a websocket",
+		Description: "Each message is a ChangeJSON, and the subscriptions can be changed by sending a SubscriptionJSON.",
+		Tags:        []string{"changes"},
+		Params: []apiParam{
+			{Name: "modules", In: "query", List: true, Pattern: moduleCodePattern, Description: "Comma separated module codes to follow."},
+			{Name: "locations", In: "query", List: true, Description: "Comma separated location slugs to follow."},
+		},
+		Status: http.StatusSwitchingProtocols,
+	},
+	"GET /search": {
+		Summary:     "Search the events, modules and locations",
+		Description: "Best matches first.",
+		Tags:        []string{"search"},
+		Params:      params([]apiParam{{Name: "q", In: "query", Required: true, Description: "What to search for."}}, pageParams, []apiParam{fieldsParam}, locationParams),
+		Response:    SearchResultJSON{},
+		Page:        true,
+	},
+	"GET /analytics/occupancy": {
+		Summary:     "Get how busy a building is",
+		Description: "How many of its rooms are booked during each hour of a day in kent's time zone.",
+		Tags:        []string{"analytics"},
+		Params: []apiParam{
+			{Name: "building", In: "query", Required: true, Description: "The slug of the building."},
+			{Name: "date", In: "query", Format: "date", Description: "The day, such as 2024-10-01. It defaults to today."},
+		},
+		Response: OccupancyJSON{},
+	},
+	"GET /terms": {
+		Summary:     "Get the term dates of an academic year",
+		Description: "The terms, and when week 1 starts, which the weeks of the module week views are numbered from. Without the terms stored the weeks are numbered from the last Monday of September.",
+		Tags:        []string{"calendars"},
+		Params:      []apiParam{yearParam},
+		Response:    TermsJSON{},
+	},
+	"POST /batch": {
+		Summary:     "Send several GET requests at once",
+		Description: "At most 20, answered concurrently and each with its own status. The paths are relative to the version, such as /modules/COMP6580.",
+		Tags:        []string{"query"},
+		Body:        BatchJSON{},
+		Response:    BatchResultJSON{},
+	},
+	"GET /ready": {
+		Summary:     "Check the api is ready for traffic",
+		Description: "The same as /readyz.",
+		Tags:        []string{"meta"},
+		Response:    Readiness{},
+	},
+	"GET /healthz": {
+		Summary:  "Check the api is alive",
+		Tags:     []string{"meta"},
+		Response: map[string]bool{},
+	},
+	"GET /readyz": {
+		Summary:     "Check the api is ready for traffic",
+		Description: "Answers with a 503 while the database can't be reached or its schema hasn't been applied.",
+		Tags:        []string{"meta"},
+		Response:    Readiness{},
+	},
+	"GET /me": {
+		Summary:  "Get the signed in user",
+		Tags:     []string{"users"},
+		Response: User{},
+		Security: "user",
+	},
+	"GET /me/timetable": {
+		Summary:  "Get the signed in user's timetable",
+		Tags:     []string{"users"},
+		Response: TimetableJSON{},
+		Security: "user",
+	},
+	"POST /me/timetable": {
+		Summary:     "Save the signed in user's timetable",
+		Description: "Replaces the modules of the timetable with the ones posted, at most 20.",
+		Tags:        []string{"users"},
+		Body:        TimetableRequestJSON{},
+		Response:    TimetableJSON{},
+		Security:    "user",
+	},
+	"GET /me/notifications": {
+		Summary:     "Get how the signed in user is notified",
+		Description: "The channels and types of changes to the events of the timetable's modules the user is told about.",
+		Tags:        []string{"users", "notifications"},
+		Response:    NotificationsJSON{},
+		Security:    "user",
+	},
+	"PUT /me/notifications": {
+		Summary:     "Choose how the signed in user is notified",
+		Description: "Email or push them when the events of the timetable's modules are moved, updated or cancelled. No channels turns it off.",
+		Tags:        []string{"users", "notifications"},
+		Body:        NotificationsJSON{},
+		Response:    NotificationsJSON{},
+		Security:    "user",
+	},
+	"GET /notifications/unsubscribe": {
+		Summary:     "Unsubscribe from the notifications",
+		Description: "The link in the emails, which turns a user's notifications off without signing in.",
+		Tags:        []string{"notifications"},
+		Params:      []apiParam{unsubscribeTokenParam},
+		Response:    UnsubscribedJSON{},
+	},
+	"POST /notifications/unsubscribe": {
+		Summary:     "Unsubscribe from the notifications with one click",
+		Description: "The List-Unsubscribe-Post (RFC 8058) of the emails, for mail clients to unsubscribe with.",
+		Tags:        []string{"notifications"},
+		Params:      []apiParam{unsubscribeTokenParam},
+		Response:    UnsubscribedJSON{},
+	},
+	"GET /me/timetable/events": {
+		Summary:      "List the events of the signed in user's timetable",
+		Description:  "The events of the modules of the timetable merged, those of the next week without from and to.",
+		Tags:         []string{"users", "events"},
+		Params:       params(eventPageParams, windowParams, []apiParam{formatParam, fieldsParam}, locationParams),
+		Response:     db.Event{},
+		Page:         true,
+		ContentTypes: []string{"text/csv", "text/calendar", "application/ld+json"},
+		Security:     "user",
+	},
+	"GET /admin/status": {
+		Summary:  "Check the health of the database",
+		Tags:     []string{"admin"},
+		Response: db.Status{},
+		Security: "apiKey",
+	},
+	"POST /admin/scrapes": {
+		Summary:     "Queue a scrape",
+		Description: "Of a range of at most 1000 feed ids, or of the feeds of a module. The scraper picks it up ahead of its scheduled rescrapes, and its progress can be polled at the Location answered with.",
+		Tags:        []string{"admin"},
+		Body:        ScrapeJobRequestJSON{},
+		Response:    db.ScrapeJob{},
+		Status:      http.StatusAccepted,
+		Security:    "apiKey",
+	},
+	"GET /admin/scrapes/{id}": {
+		Summary:  "Get how far a queued scrape has got",
+		Tags:     []string{"admin"},
+		Response: db.ScrapeJob{},
+		Security: "apiKey",
+	},
+	"POST /admin/webhooks": {
+		Summary:     "Register a webhook",
+		Description: "The url is posted the changes to the events of the modules and locations given, or of every event, signed with an X-WhatsUpKent-Signature of sha256= and the hex HMAC-SHA256 with the secret of the X-WhatsUpKent-Timestamp, a dot and the body. Failed deliveries are retried with a backoff. The secret is generated if it isn't given and is only answered with here.",
+		Tags:        []string{"admin"},
+		Body:        WebhookRequestJSON{},
+		Response:    WebhookJSON{},
+		Status:      http.StatusCreated,
+		Security:    "apiKey",
+	},
+	"GET /admin/webhooks": {
+		Summary:  "List the webhooks",
+		Tags:     []string{"admin"},
+		Response: WebhooksJSON{},
+		Security: "apiKey",
+	},
+	"GET /admin/webhooks/{id}": {
+		Summary:  "Get a webhook",
+		Tags:     []string{"admin"},
+		Response: WebhookJSON{},
+		Security: "apiKey",
+	},
+	"DELETE /admin/webhooks/{id}": {
+		Summary:  "Delete a webhook",
+		Tags:     []string{"admin"},
+		Status:   http.StatusNoContent,
+		Security: "apiKey",
+	},
+	"GET /admin/webhooks/{id}/deliveries": {
+		Summary:     "List the latest deliveries to a webhook",
+		Description: "Newest first, with how many attempts each took and what the webhook last answered. The deliveries are kept as long as the changes are.",
+		Tags:        []string{"admin"},
+		Response:    WebhookDeliveriesJSON{},
+		Security:    "apiKey",
+	},
+	"GET /metrics": {
+		Summary:      "Prometheus metrics",
+		Tags:         []string{"meta"},
+		ContentTypes: []string{"text/plain"},
+	},
+	"GET /openapi.json": {
+		Summary:      "This document",
+		Tags:         []string{"meta"},
+		ContentTypes: []string{"application/json"},
+	},
+	"GET /docs": {
+		Summary:      "Browse this document with Swagger UI",
+		Tags:         []string{"meta"},
+		ContentTypes: []string{"text/html"},
+	},
+}
+
+var (
+	//pathParamPattern matches the regular expressions mux path variables can have, such as {id:[0-9]+}
+	pathParamPattern = regexp.MustCompile(`\{([^}:]+):[^}]*\}`)
+	//pathVariablePattern matches the path variables once their regular expressions are taken out
+	pathVariablePattern = regexp.MustCompile(`\{([^}]+)\}`)
+)
+
+//OpenAPI serves the OpenAPI 3 document describing the routes of the router, for generating clients.
+//Routes which aren't documented in operations are still listed, and logged once so they get documented.
+func (config *Config) OpenAPI(router *mux.Router) http.HandlerFunc {
+	var once sync.Once
+	var document []byte
+	var documentErr error
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		// The router is only complete once SetupRouter has returned, so the document is built on the first request
+		once.Do(func() {
+			var undocumented []string
+			var spec map[string]interface{}
+			spec, undocumented, documentErr = openAPIDocument(router, config.Versions())
+			if documentErr == nil {
+				document, documentErr = json.Marshal(spec)
+			}
+			if len(undocumented) > 0 {
+				config.Logger.Warn("Some routes aren't documented in the OpenAPI document", "routes", undocumented)
+			}
+		})
+		if documentErr != nil {
+			return documentErr
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write(document)
+		return err
+	})
+}
+
+//openAPIDocument walks the router for its routes, describing each with its entry in operations,
+//which is found without the version prefix of the route. The routes served without a version prefix
+//as well as under the first version are marked as deprecated, as are the routes of the deprecated versions.
+//It returns the routes without an entry.
+func openAPIDocument(router *mux.Router, versions []Version) (map[string]interface{}, []string, error) {
+	type route struct {
+		method, template string
+	}
+	routes := make([]route, 0)
+	served := make(map[route]bool)
+	err := router.Walk(func(r *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := r.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := r.GetMethods()
+		if err != nil {
+			// Subrouter prefixes such as /admin aren't routes of their own
+			return nil
+		}
+		template = pathParamPattern.ReplaceAllString(template, "{$1}")
+		for _, method := range methods {
+			routes = append(routes, route{method, template})
+			served[route{method, template}] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b := &schemaBuilder{components: make(map[string]interface{})}
+	paths := make(map[string]interface{})
+	undocumented := make([]string, 0)
+	for _, rt := range routes {
+		path, deprecated := rt.template, false
+		for i, v := range versions {
+			if strings.HasPrefix(rt.template, "/"+v.Name+"/") {
+				path, deprecated = strings.TrimPrefix(rt.template, "/"+v.Name), !v.Deprecated.IsZero()
+				break
+			}
+			if i == 0 && served[route{rt.method, "/" + v.Name + rt.template}] {
+				deprecated = true
+			}
+		}
+
+		op, ok := operations[rt.method+" "+path]
+		if !ok {
+			undocumented = append(undocumented, rt.method+" "+rt.template)
+			op = apiOperation{Summary: rt.method + " " + rt.template}
+		}
+		item, ok := paths[rt.template].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[rt.template] = item
+		}
+		described := b.operation(rt.template, op)
+		if deprecated {
+			described["deprecated"] = true
+		}
+		item[strings.ToLower(rt.method)] = described
+	}
+	sort.Strings(undocumented)
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "WhatsUpKent",
+			"description": "Everything going on at the University of Kent, see https://whatsupkent.com",
+			"version":     OpenAPIVersion,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": b.components,
+			"securitySchemes": map[string]interface{}{
+				"apiKey": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+				"user":   map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+	}, undocumented, nil
+}
+
+//operation describes the operation on the path as an OpenAPI operation object
+func (b *schemaBuilder) operation(path string, op apiOperation) map[string]interface{} {
+	out := map[string]interface{}{"summary": op.Summary}
+	if op.Description != "" {
+		out["description"] = op.Description
+	}
+	if len(op.Tags) > 0 {
+		out["tags"] = op.Tags
+	}
+
+	parameters := make([]interface{}, 0)
+	all := make([]apiParam, 0, len(op.Params))
+	for _, name := range pathVariablePattern.FindAllStringSubmatch(path, -1) {
+		p, ok := pathParams[name[1]]
+		if !ok {
+			p = apiParam{Name: name[1], In: "path"}
+		}
+		all = append(all, p)
+	}
+	for _, p := range append(all, op.Params...) {
+		schema := map[string]interface{}{"type": "string"}
+		if p.Type != "" {
+			schema["type"] = p.Type
+		}
+		if p.Format != "" {
+			schema["format"] = p.Format
+		}
+		if len(p.Enum) > 0 {
+			schema["enum"] = p.Enum
+		}
+		if p.Pattern != nil {
+			schema["pattern"] = p.Pattern.String()
+		}
+		if p.Minimum != nil {
+			schema["minimum"] = *p.Minimum
+		}
+		if p.Maximum != nil {
+			schema["maximum"] = *p.Maximum
+		}
+		param := map[string]interface{}{"name": p.Name, "in": p.In, "schema": schema}
+		if p.List {
+			param["schema"] = map[string]interface{}{"type": "array", "items": schema}
+			param["explode"] = false
+		}
+		if p.Description != "" {
+			param["description"] = p.Description
+		}
+		if p.Required || p.In == "path" {
+			param["required"] = true
+		}
+		parameters = append(parameters, param)
+	}
+	if len(parameters) > 0 {
+		out["parameters"] = parameters
+	}
+
+	switch {
+	case op.Body != nil:
+		out["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": b.schema(reflect.TypeOf(op.Body))}},
+		}
+	case op.BodyType != "":
+		out["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  map[string]interface{}{op.BodyType: map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}},
+		}
+	}
+
+	content := make(map[string]interface{})
+	if op.Response != nil {
+		schema := b.schema(reflect.TypeOf(op.Response))
+		if op.Page {
+			schema = map[string]interface{}{
+				"type":     "object",
+				"required": []string{"data", "meta"},
+				"properties": map[string]interface{}{
+					"data": map[string]interface{}{"type": "array", "items": schema},
+					"meta": b.schema(reflect.TypeOf(PageMeta{})),
+				},
+			}
+		}
+		content["application/json"] = map[string]interface{}{"schema": schema}
+	}
+	for _, contentType := range op.ContentTypes {
+		content[contentType] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+	}
+	success := map[string]interface{}{"description": op.Summary}
+	if len(content) > 0 {
+		success["content"] = content
+	}
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	out["responses"] = map[string]interface{}{
+		strconv.Itoa(status): success,
+		"default": map[string]interface{}{
+			"description": "The request failed",
+			"content": map[string]interface{}{
+				ProblemContentType: map[string]interface{}{"schema": b.schema(reflect.TypeOf(ProblemJSON{}))},
+			},
+		},
+	}
+
+	switch op.Security {
+	case "apiKey":
+		out["security"] = []interface{}{map[string]interface{}{"apiKey": []string{}}}
+	case "user":
+		out["security"] = []interface{}{map[string]interface{}{"user": []string{}}}
+	}
+	return out
+}
+
+//schemaBuilder turns go types into json schemas, putting the named structs into components so they are described once
+type schemaBuilder struct {
+	components map[string]interface{}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+//schema returns the json schema of the values of the type as encoding/json marshals them
+func (b *schemaBuilder) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == reflect.TypeOf(time.Duration(0)):
+		return map[string]interface{}{"type": "integer", "format": "int64", "description": "Nanoseconds"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := b.components[t.Name()]; !ok {
+			// Held with a placeholder while it is described, for types which contain themselves such as Location
+			b.components[t.Name()] = map[string]interface{}{}
+			b.components[t.Name()] = b.object(t)
+		}
+		return ref
+	}
+	// Interfaces can hold anything
+	return map[string]interface{}{}
+}
+
+//object describes the struct's fields as the properties of an object, the ones without omitempty being required
+func (b *schemaBuilder) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := make([]string, 0)
+	b.fields(t, properties, &required)
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+//fields adds the fields of the struct to the properties, along with the fields of the structs it embeds
+func (b *schemaBuilder) fields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options := tag, ""
+		if comma := strings.Index(tag, ","); comma >= 0 {
+			name, options = tag[:comma], tag[comma+1:]
+		}
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				b.fields(embedded, properties, required)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			// Unexported
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = b.schema(field.Type)
+		if !strings.Contains(options, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+//swaggerUI is the page browsing the OpenAPI document, with Swagger UI loaded from a CDN
+const swaggerUI = `<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="utf-8">
+	<title>WhatsUpKent api</title>
+	<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+	<div id="swagger-ui"></div>
+	<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+	<script>
+		window.ui = SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});
+	</script>
+</body>
+</html>
+`
+
+//SwaggerUI serves a page to browse and try out the api described by /openapi.json
+func SwaggerUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	io.WriteString(w, swaggerUI)
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+const (
+	//DefaultPageLimit is the number of results a list endpoint returns without a ?limit
+	DefaultPageLimit = 50
+	//MaxPageLimit is the most results a list endpoint returns, larger limits are capped to it
+	MaxPageLimit = 500
+)
+
+//PageJSON is the response envelope of the list endpoints
+type PageJSON struct {
+	Data interface{} `json:"data"`
+	Meta PageMeta    `json:"meta"`
+}
+
+//PageMeta describes which page of the results was returned, out of how many
+type PageMeta struct {
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+	//Total is the number of results across every page
+	Total int `json:"total"`
+	//NextCursor is the ?cursor of the page after this one, for the lists of events, it is left out on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+	//Truncated is set when only some of the matches were ranked, so there are more results than Total
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+//parsePage reads the ?limit and ?offset query parameters into the list options
+func parsePage(r *http.Request) (db.ListOptions, error) {
+	opts := db.ListOptions{First: DefaultPageLimit}
+	query := r.URL.Query()
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return opts, badRequest("The limit must be a positive whole number.", err)
+		}
+		if n > MaxPageLimit {
+			n = MaxPageLimit
+		}
+		opts.First = n
+	}
+	if offset := query.Get("offset"); offset != "" {
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			return opts, badRequest("The offset must be a whole number, and not negative.", err)
+		}
+		opts.Offset = n
+	}
+	return opts, nil
+}
+
+//newPage wraps one page of the results in the envelope
+func newPage(data interface{}, opts db.ListOptions, total int) PageJSON {
+	return PageJSON{
+		Data: data,
+		Meta: PageMeta{Limit: opts.First, Offset: opts.Offset, Total: total},
+	}
+}
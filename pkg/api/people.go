@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+//ListPeople returns a page of the people ordered by their name, see parsePage.
+//With ?q only the people with any of its words in their name are listed.
+func (config *Config) ListPeople() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		opts, err := parsePage(r)
+		if err != nil {
+			return err
+		}
+		name := r.URL.Query().Get("q")
+		people, err := config.DBClient.ListPeople(r.Context(), name, opts)
+		if err != nil {
+			return err
+		}
+		if people == nil {
+			people = []db.Person{}
+		}
+		total, err := config.DBClient.CountPeople(r.Context(), name)
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusOK, newPage(people, opts, *total))
+	})
+}
+
+//GetPersonEvents returns a page of the events organised by the person with the Uid in the path,
+//overlapping the window chosen by parseWindow, such as a member of staff's timetable, as json, csv or iCalendar, see negotiate
+func (config *Config) GetPersonEvents() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		opts, err := parsePage(r)
+		if err != nil {
+			return err
+		}
+		cursor, err := parseCursor(r)
+		if err != nil {
+			return err
+		}
+		from, to, err := parseWindow(r)
+		if err != nil {
+			return err
+		}
+
+		// The events query is empty for unknown people, so look them up first to answer with a 404
+		person, err := config.DBClient.GetPerson(r.Context(), db.Person{UID: mux.Vars(r)["id"]})
+		if err != nil {
+			return err
+		}
+		ctx := r.Context()
+		lister := eventLister{
+			list: func(opts db.ListOptions) ([]db.Event, error) {
+				return config.DBClient.GetEventsByOrganiser(ctx, *person, from, to, opts)
+			},
+			after: func(cursor db.EventCursor, opts db.ListOptions) ([]db.Event, error) {
+				return config.DBClient.GetEventsByOrganiserAfter(ctx, *person, from, to, cursor, opts)
+			},
+			count: func(opts db.ListOptions) (*int, error) {
+				return config.DBClient.CountEventsByOrganiser(ctx, *person, from, to, opts)
+			},
+		}
+		events, opts, total, next, err := listEventPage(lister, cursor, locationFilter(r, opts))
+		if err != nil {
+			return err
+		}
+		return config.writeEvents(w, r, events, opts, total, next, person.Name)
+	})
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+//privatePrefixes are the predicates holding the users and the notifications they were sent, the webhooks and their deliveries
+//and the scrape jobs, which the raw queries can't read
+var privatePrefixes = []string{"user.", "notification.", "webhook.", "delivery.", "job."}
+
+//privatePredicate matches a private predicate named in a query, including its reverse edges
+var privatePredicate = regexp.MustCompile(`(^|[^\w.])~?(user|notification|webhook|delivery|job)\.`)
+
+//privateType matches the private types named in a query, by type() or expand()
+var privateType = regexp.MustCompile(`(type|expand)\(\s*<?(User|Notification|Webhook|WebhookDelivery|ScrapeJob)\b`)
+
+//checkPublicQuery returns a bad request if the raw query names a private predicate or type
+func checkPublicQuery(query string) error {
+	if privatePredicate.MatchString(query) || privateType.MatchString(query) {
+		return badRequest("Users, notifications, webhooks, their deliveries and scrape jobs can't be queried.", nil)
+	}
+	return nil
+}
+
+//scrubPrivate removes the private predicates from a query result, which expand(_all_) can still return
+func scrubPrivate(result []byte) ([]byte, error) {
+	if !containsAny(result, privatePrefixes) {
+		return result, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(result))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(scrubValue(v))
+}
+
+//containsAny returns whether any of the prefixes appear in the result
+func containsAny(result []byte, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if bytes.Contains(result, []byte(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+//scrubValue removes the private predicates from every object in v
+func scrubValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, item := range value {
+			if isPrivate(key) {
+				delete(value, key)
+				continue
+			}
+			value[key] = scrubValue(item)
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = scrubValue(item)
+		}
+	}
+	return v
+}
+
+//isPrivate returns whether the key of a result is a private predicate, or a reverse edge or facet of one
+func isPrivate(key string) bool {
+	key = strings.TrimPrefix(key, "~")
+	for _, prefix := range privatePrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
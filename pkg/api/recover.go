@@ -0,0 +1,43 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+//Recover answers a request whose handler panics with a 500 problem, rather than the connection being dropped.
+//The panic is logged with its stack and the request's id and counted in the metrics.
+//A handler aborting its response with http.ErrAbortHandler is left to the server, which drops the connection quietly.
+func (config *Config) Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			route := routeTemplate(r)
+			config.Metrics.panicked(route)
+			config.Logger.ErrorContext(r.Context(), "The handler panicked",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"route", route,
+				"request_id", RequestIDFromContext(r.Context()),
+				"panic", fmt.Sprint(p),
+				"stack", string(debug.Stack()))
+
+			err := fmt.Errorf("The handler panicked: %v", p)
+			if rec.status != 0 {
+				// Some of the response has gone, so all that can be done is cutting it short
+				logRequestError(r.Context(), err)
+				panic(http.ErrAbortHandler)
+			}
+			writeError(rec, r, err)
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
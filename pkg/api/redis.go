@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+//redisPrefix namespaces the keys the api keeps in Redis, so it can share a server
+const redisPrefix = "whatsupkent:"
+
+//RedisStore is a ResponseStore in Redis, which every replica of the api shares,
+//so a response cached by one is answered by all of them and a change seen by one invalidates it for all
+type RedisStore struct {
+	client *redis.Client
+}
+
+//NewRedisStore connects to the Redis server at the url, such as redis://:password@localhost:6379/0
+func NewRedisStore(url string) (*RedisStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisStore{client: redis.NewClient(opts)}, nil
+}
+
+//Ping checks the server can be reached
+func (s *RedisStore) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
+//Close closes the connections to the server
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
+
+//Get returns the response stored under the key, or nil if there isn't one which hasn't expired
+func (s *RedisStore) Get(ctx context.Context, key string) (*CachedResponse, error) {
+	value, err := s.client.Get(ctx, redisPrefix+key).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var resp CachedResponse
+	if err := json.Unmarshal(value, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+//Set stores the response under the key, which Redis expires once the ttl is up
+func (s *RedisStore) Set(ctx context.Context, key string, resp CachedResponse, ttl time.Duration) error {
+	value, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, redisPrefix+key, value, ttl).Err()
+}
+
+//Generations returns the generation of each topic
+func (s *RedisStore) Generations(ctx context.Context, topics []string) ([]int64, error) {
+	keys := make([]string, len(topics))
+	for i, topic := range topics {
+		keys[i] = redisPrefix + "generation:" + topic
+	}
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	gens := make([]int64, len(topics))
+	for i, value := range values {
+		// A topic which has never been invalidated has no key, which is generation 0
+		if str, ok := value.(string); ok {
+			gens[i], err = strconv.ParseInt(str, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return gens, nil
+}
+
+//Invalidate bumps the generation of each topic in one round trip. The responses under the old generations
+//are left for Redis to expire.
+func (s *RedisStore) Invalidate(ctx context.Context, topics []string) error {
+	pipe := s.client.Pipeline()
+	for _, topic := range topics {
+		pipe.Incr(ctx, redisPrefix+"generation:"+topic)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
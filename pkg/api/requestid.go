@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//RequestIDHeader is the header a request's id is accepted from and answered with
+const RequestIDHeader = "X-Request-ID"
+
+//maxRequestIDLength is the longest id accepted from a client, a longer one is replaced
+const maxRequestIDLength = 128
+
+//RequestIDs gives every request an id, the one it was sent with in X-Request-ID if it is reasonable or a new one.
+//The id is answered with in X-Request-ID and put in the request's context, see RequestIDFromContext,
+//so it is logged with the request, sent back with any problem and recorded on the spans around the dgraph queries.
+func RequestIDs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(db.WithRequestID(r.Context(), id)))
+	})
+}
+
+//RequestIDFromContext returns the id RequestIDs gave the request, or "" if it didn't go through RequestIDs
+func RequestIDFromContext(ctx context.Context) string {
+	return db.RequestIDFromContext(ctx)
+}
+
+//validRequestID returns whether the id is safe to log and send back, which is whether it is short and printable
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+//newRequestID returns a new random request id, or "" in the unlikely case there is no randomness to be had
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+//traceRequestIDs records the request's id on the span around it, which otelhttp starts inside RequestIDs
+func traceRequestIDs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := RequestIDFromContext(r.Context()); id != "" {
+			trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("request.id", id))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
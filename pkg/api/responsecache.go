@@ -0,0 +1,384 @@
+package api
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	//DefaultResponseCacheSize is how many responses the in-process store keeps, the least recently used are dropped
+	DefaultResponseCacheSize = 2000
+	//MaxCachedResponseSize is the largest response body which is cached, bigger ones are always answered afresh
+	MaxCachedResponseSize = 1 << 20
+)
+
+//The TTLs of the cached responses, see cacheTTL
+const (
+	//nowTTL is how long what's on now is cached, as it goes stale by the minute
+	nowTTL = 30 * time.Second
+	//eventsTTL is how long the lists of upcoming events are cached, the scrapes invalidate them before then
+	eventsTTL = 5 * time.Minute
+	//listTTL is how long the lists of modules, locations and people are cached
+	listTTL = 15 * time.Minute
+	//nodeTTL is how long a single module or location is cached
+	nodeTTL = time.Hour
+	//pastTTL is how long the weeks which are over are cached, as their timetable rarely changes
+	pastTTL = 24 * time.Hour
+)
+
+//cacheTTLs are how long the responses of each route are cached for, by their method and path template without the version.
+//Routes which aren't listed, such as those of the admin, the users and the streams, are never cached.
+var cacheTTLs = map[string]time.Duration{
+	"GET /events":                          eventsTTL,
+	"GET /events/near":                     nowTTL,
+	"GET /now":                             nowTTL,
+	"GET /modules":                         listTTL,
+	"GET /modules/{code}":                  nodeTTL,
+	"GET /modules/{code}/calendar.ics":     eventsTTL,
+	"GET /modules/{code}/weeks/{n}":        eventsTTL,
+	"GET /modules/{code}/weeks/{n}/events": eventsTTL,
+	"GET /locations":                       listTTL,
+	"GET /locations/free":                  time.Minute,
+	"GET /locations/{slug}":                nodeTTL,
+	"GET /locations/{slug}/events":         eventsTTL,
+	"GET /locations/{slug}/calendar.ics":   eventsTTL,
+	"GET /people":                          listTTL,
+	"GET /people/{id}/events":              eventsTTL,
+	"GET /calendar.ics":                    eventsTTL,
+	"GET /search":                          listTTL,
+	"GET /analytics/occupancy":             eventsTTL,
+	"GET /terms":                           nodeTTL,
+}
+
+//cachedHeaders are the headers of a response which are cached along with its body
+var cachedHeaders = []string{"Content-Type", "Content-Disposition", "X-Total-Count", "Link", "Vary"}
+
+//CachedResponse is a response kept by a ResponseStore
+type CachedResponse struct {
+	Header   map[string][]string `json:"header"`
+	Body     []byte              `json:"body"`
+	StoredAt time.Time           `json:"stored_at"`
+}
+
+//ResponseStore keeps the responses a ResponseCache caches, in process or somewhere shared such as Redis.
+//The responses are tagged with topics, such as module:CO324, which are invalidated by bumping their generation,
+//since the generations are part of the keys the responses are stored under.
+type ResponseStore interface {
+	//Get returns the response stored under the key, or nil if there isn't one which hasn't expired
+	Get(ctx context.Context, key string) (*CachedResponse, error)
+	//Set stores the response under the key until the ttl is up
+	Set(ctx context.Context, key string, resp CachedResponse, ttl time.Duration) error
+	//Generations returns the generation of each topic, which is 0 until it is invalidated
+	Generations(ctx context.Context, topics []string) ([]int64, error)
+	//Invalidate bumps the generation of each topic, so the responses tagged with it aren't found again
+	Invalidate(ctx context.Context, topics []string) error
+}
+
+//ResponseCache caches the successful GET responses of the routes in cacheTTLs, keyed on their path, query and Accept header.
+//The responses about a module or location are dropped once a change to one of its events is seen
+//after a scrape, and every other response once any change is, see Run.
+type ResponseCache struct {
+	Store ResponseStore
+	//Logger logs the store failing, the requests are still answered without the cache
+	Logger *slog.Logger
+}
+
+//NewResponseCache returns a cache of the responses in the store
+func NewResponseCache(store ResponseStore) *ResponseCache {
+	return &ResponseCache{Store: store}
+}
+
+func (c *ResponseCache) logger() *slog.Logger {
+	if c.Logger == nil {
+		return slog.Default()
+	}
+	return c.Logger
+}
+
+//Run invalidates the cached responses affected by the changes the hub sees until ctx is done,
+//subscribing to the hub again if it is dropped for falling behind, after dropping everything as it may have missed some.
+func (c *ResponseCache) Run(ctx context.Context, hub *ChangeHub) {
+	for ctx.Err() == nil {
+		s, _, err := hub.subscribe(ctx, []string{AllTopics}, 0)
+		if err != nil {
+			c.logger().Error("Subscribing to the changes failed", "error", err)
+			hub.wait(ctx)
+			continue
+		}
+		for open := true; open; {
+			select {
+			case <-ctx.Done():
+				open = false
+			case change, ok := <-s.send:
+				if !ok {
+					open = false
+					c.invalidate(ctx, []string{AllTopics})
+					continue
+				}
+				// Scrapes are invalidated too, as a scrape can change the modules and locations without moving any events
+				c.invalidate(ctx, append([]string{AllTopics}, change.Topics...))
+			}
+		}
+		hub.unsubscribe(s)
+	}
+}
+
+func (c *ResponseCache) invalidate(ctx context.Context, topics []string) {
+	if err := c.Store.Invalidate(ctx, topics); err != nil {
+		c.logger().Error("Could not invalidate the cached responses", "error", err, "topics", topics)
+	}
+}
+
+//cacheTTL returns how long the response to the request can be cached for, or 0 if it can't be.
+//The weeks which are already over are cached for longer, as their timetable is settled.
+func cacheTTL(r *http.Request, versions []Version) time.Duration {
+	if r.Method != http.MethodGet {
+		return 0
+	}
+	route := r.Method + " " + unversionedTemplate(r, versions)
+	ttl := cacheTTLs[route]
+	if ttl == 0 {
+		return 0
+	}
+	if strings.HasPrefix(route, "GET /modules/{code}/weeks/{n}") && weekOver(r) {
+		return pastTTL
+	}
+	return ttl
+}
+
+//weekOver returns whether the week of the request is over, going by the weeks kent numbers without the terms stored,
+//a month after it has ended so the terms can't have moved it. Only the weeks of an explicit ?year can be over,
+//as which is the current year without it depends on the terms too.
+func weekOver(r *http.Request) bool {
+	n, err := parseWeekNumber(r)
+	if err != nil {
+		return false
+	}
+	year, given, err := parseYear(r)
+	if err != nil || !given {
+		return false
+	}
+	week := defaultCalendar(year).Week(n)
+	return week.To.AddDate(0, 1, 0).Before(time.Now())
+}
+
+//cacheTopic returns the topic the response to the request is about, which is the module or location in its path,
+//or AllTopics for the responses which any change could affect. Only the generation of that topic is part of its key,
+//so the responses about a module aren't dropped for the changes to the others.
+func cacheTopic(r *http.Request) string {
+	vars := mux.Vars(r)
+	if code, ok := vars["code"]; ok {
+		return "module:" + code
+	}
+	if slug, ok := vars["slug"]; ok {
+		return "location:" + slug
+	}
+	return AllTopics
+}
+
+//Middleware answers the requests for the routes in cacheTTLs from the cache, caching the responses which aren't in it.
+//A request sent with Cache-Control: no-cache is answered afresh, and its response cached for the next.
+//It is next as it is if the cache is nil.
+func (c *ResponseCache) Middleware(versions []Version) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if c == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ttl := cacheTTL(r, versions)
+			if ttl == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx := r.Context()
+			topic := cacheTopic(r)
+			gens, err := c.Store.Generations(ctx, []string{topic})
+			if err != nil {
+				c.logger().Error("Could not read the cache", "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			key := responseKey(r, gens)
+
+			if !strings.Contains(r.Header.Get("Cache-Control"), "no-cache") {
+				cached, err := c.Store.Get(ctx, key)
+				if err != nil {
+					c.logger().Error("Could not read the cache", "error", err)
+				}
+				if cached != nil {
+					logAttrs(ctx, slog.Bool("cache_hit", true))
+					for name, values := range cached.Header {
+						w.Header()[name] = values
+					}
+					w.Header().Set("Age", strconv.Itoa(int(time.Since(cached.StoredAt)/time.Second)))
+					w.Write(cached.Body)
+					return
+				}
+			}
+
+			logAttrs(ctx, slog.Bool("cache_hit", false))
+			tw := &teeWriter{ResponseWriter: w}
+			next.ServeHTTP(tw, r)
+			if tw.status != http.StatusOK || tw.skip {
+				return
+			}
+			resp := CachedResponse{Header: make(map[string][]string), Body: tw.buf, StoredAt: time.Now()}
+			for _, name := range cachedHeaders {
+				if values := w.Header()[name]; len(values) > 0 {
+					resp.Header[name] = values
+				}
+			}
+			if err := c.Store.Set(ctx, key, resp, ttl); err != nil {
+				c.logger().Error("Could not save the response to the cache", "error", err)
+			}
+		})
+	}
+}
+
+//responseKey returns the key the response to the request is cached under, for the generations of its topics.
+//The query is encoded in order, so the same parameters in another order share the response.
+func responseKey(r *http.Request, gens []int64) string {
+	h := sha256.New()
+	h.Write([]byte(r.URL.Path + "?" + r.URL.Query().Encode() + "\n" + r.Header.Get("Accept")))
+	for _, gen := range gens {
+		h.Write([]byte("\n" + strconv.FormatInt(gen, 10)))
+	}
+	return "response:" + hex.EncodeToString(h.Sum(nil))
+}
+
+//teeWriter sends the response on as it is written, keeping a copy of it to cache unless it is too big or streamed
+type teeWriter struct {
+	http.ResponseWriter
+	status int
+	buf    []byte
+	skip   bool
+}
+
+func (tw *teeWriter) WriteHeader(code int) {
+	if tw.status == 0 {
+		tw.status = code
+	}
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *teeWriter) Write(p []byte) (int, error) {
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	if !tw.skip {
+		if len(tw.buf)+len(p) > MaxCachedResponseSize {
+			tw.skip, tw.buf = true, nil
+		} else {
+			tw.buf = append(tw.buf, p...)
+		}
+	}
+	return tw.ResponseWriter.Write(p)
+}
+
+//Flush means the response is a stream, which isn't cached
+func (tw *teeWriter) Flush() {
+	tw.skip, tw.buf = true, nil
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+//Unwrap lets http.ResponseController reach the underlying writer
+func (tw *teeWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+//MemoryStore is a ResponseStore in process, which keeps the most recently used responses up to its size
+type MemoryStore struct {
+	mu          sync.Mutex
+	size        int
+	order       *list.List
+	entries     map[string]*list.Element
+	generations map[string]int64
+}
+
+type memoryEntry struct {
+	key     string
+	resp    CachedResponse
+	expires time.Time
+}
+
+//NewMemoryStore returns an in-process store of up to size responses
+func NewMemoryStore(size int) *MemoryStore {
+	return &MemoryStore{
+		size:        size,
+		order:       list.New(),
+		entries:     make(map[string]*list.Element),
+		generations: make(map[string]int64),
+	}
+}
+
+//Get returns the response stored under the key, or nil if there isn't one which hasn't expired
+func (s *MemoryStore) Get(ctx context.Context, key string) (*CachedResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	entry := el.Value.(*memoryEntry)
+	if time.Now().After(entry.expires) {
+		s.order.Remove(el)
+		delete(s.entries, key)
+		return nil, nil
+	}
+	s.order.MoveToFront(el)
+	resp := entry.resp
+	return &resp, nil
+}
+
+//Set stores the response under the key until the ttl is up, dropping the least recently used response if the store is full
+func (s *MemoryStore) Set(ctx context.Context, key string, resp CachedResponse, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := &memoryEntry{key: key, resp: resp, expires: time.Now().Add(ttl)}
+	if el, ok := s.entries[key]; ok {
+		el.Value = entry
+		s.order.MoveToFront(el)
+		return nil
+	}
+	s.entries[key] = s.order.PushFront(entry)
+	for s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryEntry).key)
+	}
+	return nil
+}
+
+//Generations returns the generation of each topic
+func (s *MemoryStore) Generations(ctx context.Context, topics []string) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	gens := make([]int64, len(topics))
+	for i, topic := range topics {
+		gens[i] = s.generations[topic]
+	}
+	return gens, nil
+}
+
+//Invalidate bumps the generation of each topic. The responses under the old generations are left to be dropped
+//as they expire or fall out of use.
+func (s *MemoryStore) Invalidate(ctx context.Context, topics []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, topic := range topics {
+		s.generations[topic]++
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+//MaxScrapeJobFeeds is the most timetable feeds a scrape job can ask for by range
+const MaxScrapeJobFeeds = 1000
+
+//ScrapeJobRequestJSON is a scrape asked for through POST /admin/scrapes,
+//of either the range of feed ids [from, to) or the feeds which found the events of a module
+type ScrapeJobRequestJSON struct {
+	From   int    `json:"from,omitempty"`
+	To     int    `json:"to,omitempty"`
+	Module string `json:"module,omitempty"`
+}
+
+//newID returns a new random id, for the scrape jobs and webhooks
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+//CreateScrapeJob queues a scrape of a range of feeds or the feeds of a module, which the scraper picks up
+//ahead of its scheduled rescrapes, instead of waiting for them to come round.
+//It answers with a 202 and the job, whose progress can be polled at its Location.
+func (config *Config) CreateScrapeJob() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		var req ScrapeJobRequestJSON
+		defer r.Body.Close()
+		err := json.NewDecoder(io.LimitReader(r.Body, 1048576)).Decode(&req)
+		if err != nil {
+			return badRequest("Could not read the scrape.", err)
+		}
+		req.Module = strings.TrimSpace(req.Module)
+		byRange := req.From != 0 || req.To != 0
+		if byRange == (req.Module != "") {
+			return badRequest("A scrape needs either a range of feeds, from and to, or a module.", nil)
+		}
+		v := &validator{}
+		if byRange {
+			if req.From <= 0 {
+				v.fail("body", "from", "The range of feeds must be from a positive id.")
+			}
+			if req.To <= req.From {
+				v.fail("body", "to", "The range of feeds must be up to a larger id than it is from.")
+			} else if req.To-req.From > MaxScrapeJobFeeds {
+				v.fail("body", "to", fmt.Sprintf("A scrape can be of at most %d feeds.", MaxScrapeJobFeeds))
+			}
+		} else {
+			v.moduleCodes("body", "module", []string{req.Module})
+		}
+		if err := v.err(); err != nil {
+			return err
+		}
+		if !byRange {
+			if _, err := config.DBClient.GetModuleFromSDSCode(r.Context(), req.Module); err != nil {
+				return err
+			}
+		}
+
+		id, err := newID()
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		job := db.ScrapeJob{ID: id, Status: db.JobQueued, From: req.From, To: req.To, Module: req.Module, RequestedAt: &now}
+		if _, err := config.DBClient.UpsertScrapeJob(r.Context(), job); err != nil {
+			return err
+		}
+
+		// The job is polled under the same prefix it was queued with, such as /v1
+		w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+id)
+		return writeJSON(w, http.StatusAccepted, job)
+	})
+}
+
+//GetScrapeJob returns the scrape job with the id in the path, to poll how far it has got
+func (config *Config) GetScrapeJob() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		job, err := config.DBClient.GetScrapeJob(r.Context(), mux.Vars(r)["id"])
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusOK, job)
+	})
+}
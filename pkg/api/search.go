@@ -0,0 +1,95 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+//SearchResultJSON is one of the results of GET /search, holding the event, module or location named by Type
+type SearchResultJSON struct {
+	//Type is one of "event", "module" or "location"
+	Type string `json:"type"`
+	//Score is higher for better matches, it is comparable across the types
+	Score    int          `json:"score"`
+	Event    *db.Event    `json:"event,omitempty"`
+	Module   *db.Module   `json:"module,omitempty"`
+	Location *db.Location `json:"location,omitempty"`
+}
+
+//Search searches the events, modules and locations for ?q, returning a page of the results best matches first, see parsePage.
+//Equally good matches are ordered events first, then modules, then locations.
+func (config *Config) Search() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		opts, err := parsePage(r)
+		if err != nil {
+			return err
+		}
+		query := strings.TrimSpace(r.URL.Query().Get("q"))
+		if query == "" {
+			return badRequest("Search for something with ?q.", nil)
+		}
+
+		results, truncated, err := config.search(r, query)
+		if err != nil {
+			return err
+		}
+		sort.SliceStable(results, func(i, j int) bool {
+			return results[i].Score > results[j].Score
+		})
+
+		page := make([]SearchResultJSON, 0, opts.First)
+		if opts.Offset < len(results) {
+			page = results[opts.Offset:]
+			if len(page) > opts.First {
+				page = page[:opts.First]
+			}
+		}
+		body := newPage(page, opts, len(results))
+		body.Meta.Truncated = truncated
+		return writeJSON(w, http.StatusOK, body)
+	})
+}
+
+//search returns every event, module and location matching the query, each type in the order the database ranked them.
+//The events and locations are narrowed by ?campus and ?accessible, see filterEvents.
+//Only the first db.MaxListLimit matching events are ranked, so it also returns whether there may be more of them.
+func (config *Config) search(r *http.Request, query string) ([]SearchResultJSON, bool, error) {
+	ctx := r.Context()
+	results := make([]SearchResultJSON, 0)
+
+	events, err := config.DBClient.SearchEvents(ctx, query, db.ListOptions{First: db.MaxListLimit})
+	if err != nil {
+		return nil, false, err
+	}
+	truncated := len(events) == db.MaxListLimit
+	filter := locationFilter(r, db.ListOptions{})
+	for i := range events {
+		if len(filterEvents(r, []db.Event{events[i].Event})) == 0 {
+			continue
+		}
+		results = append(results, SearchResultJSON{Type: "event", Score: events[i].Score, Event: &events[i].Event})
+	}
+
+	modules, err := config.DBClient.SearchModules(ctx, query)
+	if err != nil {
+		return nil, false, err
+	}
+	for i := range modules {
+		results = append(results, SearchResultJSON{Type: "module", Score: modules[i].Score, Module: &modules[i].Module})
+	}
+
+	locations, err := config.DBClient.SearchLocations(ctx, query)
+	if err != nil {
+		return nil, false, err
+	}
+	for i := range locations {
+		if !filter.Includes(locations[i].Location) {
+			continue
+		}
+		results = append(results, SearchResultJSON{Type: "location", Score: locations[i].Score, Location: &locations[i].Location})
+	}
+	return results, truncated, nil
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+//The fields each list can be sorted by with ?sort, and the predicates they sort by
+var (
+	eventSorts = map[string]string{
+		"start_date": "event.start_date",
+		"end_date":   "event.end_date",
+		"title":      "event.title",
+	}
+	moduleSorts = map[string]string{
+		"code":    "module.code",
+		"name":    "module.name",
+		"subject": "module.subject",
+	}
+	locationSorts = map[string]string{
+		"id":       "location.id",
+		"name":     "location.name",
+		"capacity": "location.capacity",
+	}
+)
+
+//sortParam describes ?sort for a list sorted by the fields, which Validate checks against them
+func sortParam(sorts map[string]string) apiParam {
+	fields := make([]string, 0, len(sorts))
+	for field := range sorts {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	enum := make([]string, 0, 2*len(fields))
+	for _, field := range fields {
+		enum = append(enum, field, "-"+field)
+	}
+	return apiParam{
+		Name: "sort", In: "query", List: true, Enum: enum,
+		Description: "Comma separated fields to sort by in turn, each descending if it starts with a -, such as " +
+			fields[0] + ",-" + fields[len(fields)-1] + ". The fields are " + strings.Join(fields, ", ") + ".",
+	}
+}
+
+//parseSort reads ?sort, such as start_date,-title, into the keys to sort by, returning nil if it isn't given.
+//The fields have been checked against the sorts by Validate.
+func parseSort(r *http.Request, sorts map[string]string) []db.SortKey {
+	raw := r.URL.Query().Get("sort")
+	if strings.TrimSpace(raw) == "" {
+		return nil
+	}
+	keys := make([]db.SortKey, 0)
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		descending := strings.HasPrefix(field, "-")
+		if predicate, ok := sorts[strings.TrimPrefix(field, "-")]; ok {
+			keys = append(keys, db.SortKey{Predicate: predicate, Descending: descending})
+		}
+	}
+	return keys
+}
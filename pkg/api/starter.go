@@ -1,49 +1,237 @@
 package api
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
+	"time"
 
 	badger "github.com/dgraph-io/badger/v2"
-	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+	"github.com/jamesjarvis/WhatsUpKent/pkg/notify"
+	"github.com/jamesjarvis/WhatsUpKent/pkg/oidc"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 )
 
-// Config is the API configuration
+// Config is the API configuration, which all of the handlers hang off
 type Config struct {
-	//URL is the url for the dgraph database
-	URL string
 	// DBClient is the database client
-	DBClient *db.ConfigDB
-	// CacheDB is the cache client
+	DBClient db.Client
+	// CacheDB is the cache client, queries aren't cached if it is nil
 	CacheDB *badger.DB
 	// Lock is a global lock for database operations, just makes it a bit nicer.
 	Lock *sync.Mutex
+	// Changes pushes the changes to the timetable to the websocket clients, it only watches for them once it is Run
+	Changes *ChangeHub
+	// Webhooks posts the changes the ChangeHub sees to the registered webhooks, once it is Run
+	Webhooks *WebhookDispatcher
+	// Notifications tells the users about the changes the ChangeHub sees to their timetables, once it is Run
+	Notifications *NotificationDispatcher
+	// Responses caches the responses of the routes which can be, they aren't cached if it is nil
+	Responses *ResponseCache
+	// Keys are the API keys the api accepts, without any the admin endpoints can't be used
+	Keys *KeyStore
+	// OIDC verifies the tokens users sign in with, without it the user endpoints can't be used
+	OIDC *oidc.Verifier
+	// CORS says which browser frontends can use the api
+	CORS CORSOptions
+	// Logger logs the requests and anything else going on, it is DefaultLogger unless the deployment has its own
+	Logger *slog.Logger
+	// Metrics records the requests for /metrics, they aren't recorded if it is nil, see Instrument
+	Metrics *Metrics
+	// SwaggerUI mounts a Swagger UI at /docs to browse the OpenAPI document at /openapi.json
+	SwaggerUI bool
+
+	// root is the router SetupRouter made, which the requests of a batch are routed through with all of its middleware
+	root http.Handler
+}
+
+// DefaultAddr is the address the api listens on if ServerOptions.Addr isn't set
+const DefaultAddr = ":4000"
+
+// Defaults for the ServerOptions timeouts
+const (
+	DefaultReadTimeout  = 10 * time.Second
+	DefaultWriteTimeout = 30 * time.Second
+	DefaultIdleTimeout  = 2 * time.Minute
+	// DefaultShutdownTimeout is shorter than the 30 seconds kubernetes waits before killing the pod
+	DefaultShutdownTimeout = 20 * time.Second
+)
+
+// ServerOptions configures the http server the api listens with
+type ServerOptions struct {
+	// Addr is the address to listen on, such as ":4000" or "127.0.0.1:8080". It defaults to DefaultAddr.
+	Addr string
+	// ReadTimeout bounds reading a whole request, body included. It defaults to DefaultReadTimeout.
+	ReadTimeout time.Duration
+	// WriteTimeout bounds handling the request and writing the response. It defaults to DefaultWriteTimeout.
+	WriteTimeout time.Duration
+	// IdleTimeout is how long a keep-alive connection waits for its next request. It defaults to DefaultIdleTimeout.
+	IdleTimeout time.Duration
+	// ShutdownTimeout is how long in-flight requests are given to finish once the server is stopped,
+	// before their connections are closed. It defaults to DefaultShutdownTimeout.
+	ShutdownTimeout time.Duration
+	// Keys are the API keys the api accepts, see LoadAPIKeys
+	Keys *KeyStore
+	// OIDC verifies the tokens users sign in with, see oidc.New
+	OIDC *oidc.Verifier
+	// CORS says which browser frontends can use the api. It defaults to DefaultCORSOptions.
+	CORS *CORSOptions
+	// Logger is where the api logs to, such as a handler shipping the logs to an aggregator. It defaults to DefaultLogger.
+	Logger *slog.Logger
+	// TLS serves the api over HTTPS, from certificate files or Let's Encrypt, see LoadTLSOptions.
+	// It is served over plain http if it is nil, for a proxy in front to terminate TLS.
+	TLS *TLSOptions
+	// SwaggerUI mounts a Swagger UI at /docs, see Config.SwaggerUI
+	SwaggerUI bool
+	// ResponseStore is where the responses are cached, such as a RedisStore shared by the replicas.
+	// It defaults to a MemoryStore of DefaultResponseCacheSize responses.
+	ResponseStore ResponseStore
+	// Mailer emails the users about the changes to their timetables, and Pusher pushes them to their browsers.
+	// Users can't choose a channel which isn't set up.
+	Mailer *notify.Mailer
+	Pusher *notify.Pusher
+	// PublicURL is where the api is served from, such as https://api.whatsupkent.com, for the unsubscribe links of the emails
+	PublicURL string
+	// UnsubscribeSecret signs the tokens of the unsubscribe links, see NotificationDispatcher.UnsubscribeSecret
+	UnsubscribeSecret []byte
+}
+
+// server returns the http server serving handler, with the defaults filled in
+func (opts ServerOptions) server(handler http.Handler) *http.Server {
+	srv := &http.Server{
+		Addr:         opts.Addr,
+		Handler:      handler,
+		ReadTimeout:  opts.ReadTimeout,
+		WriteTimeout: opts.WriteTimeout,
+		IdleTimeout:  opts.IdleTimeout,
+	}
+	if srv.Addr == "" {
+		srv.Addr = DefaultAddr
+	}
+	if srv.ReadTimeout == 0 {
+		srv.ReadTimeout = DefaultReadTimeout
+	}
+	if srv.WriteTimeout == 0 {
+		srv.WriteTimeout = DefaultWriteTimeout
+	}
+	if srv.IdleTimeout == 0 {
+		srv.IdleTimeout = DefaultIdleTimeout
+	}
+	return srv
+}
+
+// New returns the api configuration for the database client and cache, which can be nil
+func New(client db.Client, cacheDB *badger.DB) *Config {
+	logger := DefaultLogger()
+	changes := NewChangeHub(client)
+	changes.Logger = logger
+	webhooks := NewWebhookDispatcher(changes, client)
+	webhooks.Logger = logger
+	notifications := NewNotificationDispatcher(changes, client)
+	notifications.Logger = logger
+	responses := NewResponseCache(NewMemoryStore(DefaultResponseCacheSize))
+	responses.Logger = logger
+	return &Config{
+		DBClient:      client,
+		CacheDB:       cacheDB,
+		Lock:          &sync.Mutex{},
+		Changes:       changes,
+		Webhooks:      webhooks,
+		Notifications: notifications,
+		Responses:     responses,
+		CORS:          DefaultCORSOptions(),
+		Logger:        logger,
+	}
 }
 
-// SetupRouter returns a router with all the routes attached
+// NewRouter returns a router serving the api from the database client and cache, which can be nil
+func NewRouter(client db.Client, cacheDB *badger.DB) *mux.Router {
+	return New(client, cacheDB).SetupRouter()
+}
+
+// Handler returns the router wrapped in the request id, logging, CORS and tracing middleware, as the server runs it
+func (config *Config) Handler() http.Handler {
+	// Continue traces started by the caller, so the spans around the dgraph queries join them
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	traced := otelhttp.NewHandler(traceRequestIDs(config.SetupRouter()), "api")
+
+	return RequestIDs(config.LogRequests(config.CORS.Handler(traced)))
+}
+
+// SetupRouter returns a router with all the routes attached.
+// The api is served under /v1, and the other versions side by side with it, see Versions,
+// while the probes, metrics and documentation are served without a version.
+// Every route can be sent an API key or a user's token, the ones under /admin need a key with the admin scope
+// and the ones under /me need a user. Responses are compressed for the clients accepting it, and tagged with ETags.
+// They are cached, see ResponseCache, and trimmed to the ?fields asked for, see SparseFields.
+// A handler panicking is answered with a 500, see Recover.
 func (config *Config) SetupRouter() *mux.Router {
 	router := mux.NewRouter()
+	router.NotFoundHandler = http.HandlerFunc(NotFound)
+	router.MethodNotAllowedHandler = http.HandlerFunc(MethodNotAllowed)
+	router.Use(config.Metrics.Middleware)
+	router.Use(config.Recover)
+	router.Use(Compress(DefaultCompressMinSize))
+	router.Use(ETags)
+	router.Use(config.Authenticate)
+	router.Use(config.Validate)
+	router.Use(config.Responses.Middleware(config.Versions()))
+	router.Use(SparseFields)
 
 	router.HandleFunc("/", Info).Methods("GET")
-	router.HandleFunc("/", config.Query()).Methods("POST")
+	router.HandleFunc("/ready", config.Ready()).Methods("GET")
+	router.HandleFunc("/healthz", config.Healthz()).Methods("GET")
+	router.HandleFunc("/readyz", config.Ready()).Methods("GET")
+	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	router.HandleFunc("/openapi.json", config.OpenAPI(router)).Methods("GET")
+	if config.SwaggerUI {
+		router.HandleFunc("/docs", SwaggerUI).Methods("GET")
+	}
 
+	config.mountVersions(router)
+
+	config.root = router
 	return router
 }
 
-// Starter starts the server
+// Starter starts the server on DefaultAddr, shutting it down gracefully on SIGINT or SIGTERM
 func Starter(url string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return Start(ctx, url, ServerOptions{})
+}
+
+// Start connects to the dgraph database at url, and serves the api with the given server options until ctx is done.
+// The server is then shut down gracefully, so the requests in flight can finish, and Start returns nil.
+func Start(ctx context.Context, url string, opts ServerOptions) error {
+	logger := opts.Logger
+	if logger == nil {
+		logger = DefaultLogger()
+	}
 
-	log.Println("Setting up DB Client")
+	logger.Info("Setting up DB Client")
 	// Set up a new DB client
 	Client, err := db.NewClient(url)
 	if err != nil {
 		return err
 	}
+	defer Client.Close()
+	err = Client.Instrument(prometheus.DefaultRegisterer)
+	if err != nil {
+		return err
+	}
 
-	log.Println("Setting up Cache client")
+	logger.Info("Setting up Cache client")
 	// Set up a new cache client
 	CacheDB, err := badger.Open(badger.DefaultOptions("/cache"))
 	if err != nil {
@@ -52,19 +240,95 @@ func Starter(url string) error {
 
 	defer CacheDB.Close()
 
-	config := &Config{
-		URL:      url,
-		DBClient: Client,
-		CacheDB:  CacheDB,
-		Lock:     &sync.Mutex{},
+	config := New(Client, CacheDB)
+	config.Logger = logger
+	config.Changes.Logger = logger
+	config.Webhooks.Logger = logger
+	config.Notifications.Logger = logger
+	config.Notifications.Mailer = opts.Mailer
+	config.Notifications.Pusher = opts.Pusher
+	config.Notifications.PublicURL = opts.PublicURL
+	config.Notifications.UnsubscribeSecret = opts.UnsubscribeSecret
+	config.Responses.Logger = logger
+	if opts.ResponseStore != nil {
+		config.Responses.Store = opts.ResponseStore
+	}
+	err = config.Instrument(prometheus.DefaultRegisterer)
+	if err != nil {
+		return err
+	}
+	config.Keys = opts.Keys
+	config.OIDC = opts.OIDC
+	config.SwaggerUI = opts.SwaggerUI
+	if opts.CORS != nil {
+		config.CORS = *opts.CORS
+	}
+	if config.Keys.Len() == 0 {
+		logger.Warn("No API keys are set up, so the admin endpoints can't be used")
+	}
+	go config.Changes.Run(ctx)
+	go config.Webhooks.Run(ctx)
+	go config.Notifications.Run(ctx)
+	go config.Responses.Run(ctx, config.Changes)
+
+	srv := opts.server(config.Handler())
+	servers := []*http.Server{srv}
+	if opts.TLS != nil {
+		var challenges *http.Server
+		srv.TLSConfig, challenges, err = opts.TLS.config()
+		if err != nil {
+			return err
+		}
+		if challenges != nil {
+			logger.Info("Answering the Let's Encrypt challenges", "addr", challenges.Addr, "hosts", opts.TLS.Hosts)
+			servers = append(servers, challenges)
+		}
+	}
+	logger.Info("🤖 Starting api service", "addr", srv.Addr, "tls", srv.TLSConfig != nil)
+	return serve(ctx, opts.ShutdownTimeout, logger, servers...)
+}
+
+// serve runs the servers until ctx is done or one of them fails, then stops them all accepting connections
+// and waits up to timeout for the requests in flight to finish.
+// The servers with a TLS config are served over HTTPS, with the certificates it has.
+func serve(ctx context.Context, timeout time.Duration, logger *slog.Logger, servers ...*http.Server) error {
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
 	}
 
-	headers := handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization"})
-	methods := handlers.AllowedMethods([]string{"GET", "POST"})
-	origins := handlers.AllowedOrigins([]string{"*"})
+	errs := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func(srv *http.Server) {
+			if srv.TLSConfig != nil {
+				errs <- srv.ListenAndServeTLS("", "")
+			} else {
+				errs <- srv.ListenAndServe()
+			}
+		}(srv)
+	}
 
-	router := config.SetupRouter()
+	var failed error
+	stopped := 0
+	select {
+	case failed = <-errs:
+		// That server has stopped already, the others still need shutting down
+		stopped++
+	case <-ctx.Done():
+		logger.Info("Shutting down, waiting for requests in flight to finish")
+	}
 
-	log.Println("🤖 Starting api service on port 4000 .......")
-	return http.ListenAndServe(":4000", handlers.CORS(headers, methods, origins)(router))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for _, srv := range servers {
+		err := srv.Shutdown(shutdownCtx)
+		if err != nil && failed == nil {
+			failed = err
+		}
+	}
+	for ; stopped < len(servers); stopped++ {
+		if err := <-errs; err != http.ErrServerClosed && failed == nil {
+			failed = err
+		}
+	}
+	return failed
 }
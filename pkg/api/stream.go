@@ -0,0 +1,122 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+//streamKeepAlive is how often a comment is sent down an idle stream, so proxies don't close it
+const streamKeepAlive = 30 * time.Second
+
+//The event names of the server-sent events
+const (
+	streamEventChange = "event-change"
+	streamScrapeDone  = "scrape-completed"
+)
+
+//Stream pushes the changes to the timetable as server-sent events, for the clients which can't use WebSocket.
+//Each change is an event-change event, or a scrape-completed event when a scrape finishes, holding a ChangeJSON.
+//The stream follows the comma separated ?modules and ?locations, along with every scrape, or every change without them.
+//A client reconnecting with a Last-Event-ID header, or ?last_event_id, first gets the changes it missed.
+func (config *Config) Stream() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		if config.Changes == nil {
+			return &Error{Code: http.StatusServiceUnavailable, Status: "Service Unavailable", Message: "Changes aren't being watched."}
+		}
+		lastID, err := parseLastEventID(r)
+		if err != nil {
+			return err
+		}
+		topics := subscriptionTopics(r)
+		if len(topics) == 0 {
+			topics = []string{AllTopics}
+		} else {
+			topics = append(topics, ScrapesTopic)
+		}
+
+		s, missed, err := config.Changes.subscribe(r.Context(), topics, lastID)
+		if err != nil {
+			return err
+		}
+		defer config.Changes.unsubscribe(s)
+
+		rc := http.NewResponseController(w)
+		// The stream outlives the server's write timeout
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil && err != http.ErrNotSupported {
+			return err
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		// Stop nginx from buffering the stream
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		for _, change := range missed {
+			if err := writeStreamEvent(w, change); err != nil {
+				return nil
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return nil
+		}
+
+		ticker := time.NewTicker(streamKeepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return nil
+			case change, ok := <-s.send:
+				// The subscriber was dropped for falling behind, the client can resume from the last id it got
+				if !ok {
+					return nil
+				}
+				if err := writeStreamEvent(w, change); err != nil {
+					return nil
+				}
+			case <-ticker.C:
+				if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+					return nil
+				}
+			}
+			if err := rc.Flush(); err != nil {
+				return nil
+			}
+		}
+	})
+}
+
+//parseLastEventID returns the id of the last change the client got, from the Last-Event-ID header or ?last_event_id,
+//or 0 if it hasn't got any
+func parseLastEventID(r *http.Request) (int64, error) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("last_event_id")
+	}
+	if value == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return 0, badRequest("The last event id has to be the id of a change.", err)
+	}
+	return id, nil
+}
+
+//writeStreamEvent writes the change as a server-sent event, named after its type
+func writeStreamEvent(w io.Writer, change ChangeJSON) error {
+	data, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	name := streamEventChange
+	if change.Type == ChangeScraped {
+		name = streamScrapeDone
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", change.ID, name, data)
+	return err
+}
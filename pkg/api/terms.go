@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+//AcademicCalendar is how kent numbers the weeks of an academic year, from its terms stored by the scraper
+type AcademicCalendar struct {
+	//Year is the year the academic year starts in, 2024 for 2024/25
+	Year int
+	//Start is when week 1 begins, the Monday of the week the first term starts,
+	//or the last Monday of September if none of the terms are stored, see academicYearStart
+	Start time.Time
+	Terms []db.Term
+}
+
+//defaultCalendar returns the calendar of the academic year starting in the year without any of its terms
+func defaultCalendar(year int) *AcademicCalendar {
+	return &AcademicCalendar{Year: year, Start: academicYearStart(year), Terms: []db.Term{}}
+}
+
+//newCalendar returns the calendar of the academic year starting in the year with its terms, in the order they start
+func newCalendar(year int, terms []db.Term) *AcademicCalendar {
+	calendar := defaultCalendar(year)
+	calendar.Terms = terms
+	for _, t := range terms {
+		if t.StartDate == nil {
+			continue
+		}
+		start := t.StartDate.In(kentTime)
+		day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, kentTime)
+		// Monday is the first day of kent's weeks, where Go's start on Sunday
+		calendar.Start = day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+		break
+	}
+	return calendar
+}
+
+//Week returns week n of the academic year, numbered from 1
+func (c *AcademicCalendar) Week(n int) Week {
+	// AddDate rather than adding hours, so the weeks either side of the clocks changing still start at midnight
+	from := c.Start.AddDate(0, 0, 7*(n-1))
+	return Week{Year: c.Year, Number: n, From: from, To: from.AddDate(0, 0, 7)}
+}
+
+//WeekOf returns the number of the week the time is in, which is 0 or less before week 1
+func (c *AcademicCalendar) WeekOf(t time.Time) int {
+	t = t.In(kentTime)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, kentTime)
+	// Rounded, as the days the clocks change on are an hour longer or shorter
+	days := int((day.Sub(c.Start).Hours() + 12) / 24)
+	if days < 0 {
+		return -((-days + 6) / 7) + 1
+	}
+	return days/7 + 1
+}
+
+//Name returns the academic year as kent writes it, such as 2024/25
+func (c *AcademicCalendar) Name() string {
+	return fmt.Sprintf("%d/%02d", c.Year, (c.Year+1)%100)
+}
+
+//academicCalendar returns the calendar of the academic year starting in the year, numbered by its terms if they are stored
+func (config *Config) academicCalendar(ctx context.Context, year int) (*AcademicCalendar, error) {
+	terms, err := config.DBClient.ListTerms(ctx, year)
+	if err != nil {
+		return nil, err
+	}
+	return newCalendar(year, terms), nil
+}
+
+//currentCalendar returns the calendar of the academic year the time is in
+func (config *Config) currentCalendar(ctx context.Context, t time.Time) (*AcademicCalendar, error) {
+	year := t.In(kentTime).Year()
+	calendar, err := config.academicCalendar(ctx, year)
+	if err != nil || !t.Before(calendar.Start) {
+		return calendar, err
+	}
+	return config.academicCalendar(ctx, year-1)
+}
+
+//requestCalendar returns the calendar of the academic year starting in the request's ?year, or the current one without it
+func (config *Config) requestCalendar(r *http.Request) (*AcademicCalendar, error) {
+	year, given, err := parseYear(r)
+	if err != nil {
+		return nil, err
+	}
+	if !given {
+		return config.currentCalendar(r.Context(), time.Now())
+	}
+	return config.academicCalendar(r.Context(), year)
+}
+
+//TermJSON is a term, with the weeks of the academic year it covers
+type TermJSON struct {
+	db.Term
+	FirstWeek int `json:"first_week"`
+	LastWeek  int `json:"last_week"`
+}
+
+//TermsJSON is the answer of GET /terms, the academic calendar of a year
+type TermsJSON struct {
+	AcademicYear string     `json:"academic_year"`
+	Year         int        `json:"year"`
+	WeekOne      time.Time  `json:"week_one"`
+	Weeks        int        `json:"weeks"`
+	Terms        []TermJSON `json:"terms"`
+}
+
+//Terms returns the terms of the academic year starting in ?year, or the current one without it, with when week 1 starts,
+//so clients can number the weeks the way the week views do rather than hardcoding the term dates.
+//The terms are empty for the years the scraper hasn't stored, which are numbered from the last Monday of September.
+func (config *Config) Terms() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		calendar, err := config.requestCalendar(r)
+		if err != nil {
+			return err
+		}
+
+		resp := TermsJSON{
+			AcademicYear: calendar.Name(),
+			Year:         calendar.Year,
+			WeekOne:      calendar.Start,
+			Weeks:        AcademicWeeks,
+			Terms:        make([]TermJSON, 0, len(calendar.Terms)),
+		}
+		for _, t := range calendar.Terms {
+			term := TermJSON{Term: t}
+			if t.StartDate != nil {
+				term.FirstWeek = calendar.WeekOf(*t.StartDate)
+			}
+			// The end date is the day after the term's last
+			if t.EndDate != nil {
+				term.LastWeek = calendar.WeekOf(t.EndDate.AddDate(0, 0, -1))
+			}
+			resp.Terms = append(resp.Terms, term)
+		}
+		return writeJSON(w, http.StatusOK, resp)
+	})
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+//TimetableRequestJSON is what POST /me/timetable is sent, the modules the user takes
+type TimetableRequestJSON struct {
+	Modules []string `json:"modules"`
+}
+
+//TimetableJSON is the timetable a user saved, the modules they take in module code order
+type TimetableJSON struct {
+	Modules   []db.Module `json:"modules"`
+	UpdatedAt *time.Time  `json:"updated_at,omitempty"`
+}
+
+//timetableJSON returns the timetable of the user, which is empty if they haven't saved one
+func timetableJSON(u *db.User) TimetableJSON {
+	if u == nil {
+		return TimetableJSON{Modules: []db.Module{}}
+	}
+	out := TimetableJSON{Modules: u.Modules, UpdatedAt: u.UpdatedAt}
+	if out.Modules == nil {
+		out.Modules = []db.Module{}
+	}
+	return out
+}
+
+//SaveTimetable replaces the modules of the signed in user's timetable with the ones posted, answering with the timetable saved.
+//Posting no modules clears it. The timetable is kept under the user's subject, along with their email and name for the notifications.
+func (config *Config) SaveTimetable() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		user, _ := UserFromContext(r.Context())
+		var req TimetableRequestJSON
+		defer r.Body.Close()
+		err := json.NewDecoder(io.LimitReader(r.Body, 1048576)).Decode(&req)
+		if err != nil {
+			return badRequest("Could not read the timetable.", err)
+		}
+		codes := make([]string, 0, len(req.Modules))
+		seen := make(map[string]bool)
+		for _, code := range req.Modules {
+			code = strings.TrimSpace(code)
+			if code != "" && !seen[code] {
+				seen[code] = true
+				codes = append(codes, code)
+			}
+		}
+		v := &validator{}
+		v.moduleCodes("body", "modules", codes)
+		if len(codes) > MaxTimetableModules {
+			v.fail("body", "modules", fmt.Sprintf("A timetable can have at most %d modules.", MaxTimetableModules))
+		}
+		if err := v.err(); err != nil {
+			return err
+		}
+
+		modules := make([]db.Module, 0, len(codes))
+		for _, code := range codes {
+			m, err := config.DBClient.GetModuleFromSDSCode(r.Context(), code)
+			if errors.Is(err, db.ErrNotFound) {
+				v.fail("body", "modules", fmt.Sprintf("There is no module %s.", code))
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			modules = append(modules, *m)
+		}
+		if err := v.err(); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		stored := db.User{Subject: user.Subject, Email: user.Email, Name: user.Name, Modules: modules, UpdatedAt: &now}
+		if _, err := config.DBClient.SetUserTimetable(r.Context(), stored); err != nil {
+			return err
+		}
+		saved, err := config.DBClient.GetUser(r.Context(), user.Subject)
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusOK, timetableJSON(saved))
+	})
+}
+
+//GetTimetable returns the signed in user's timetable, which is empty until they save one
+func (config *Config) GetTimetable() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		user, _ := UserFromContext(r.Context())
+		saved, err := config.DBClient.GetUser(r.Context(), user.Subject)
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
+			return err
+		}
+		return writeJSON(w, http.StatusOK, timetableJSON(saved))
+	})
+}
+
+//GetTimetableEvents returns a page of the events of the modules of the signed in user's timetable merged into one schedule,
+//overlapping the window chosen by parseWindow, as json, csv or iCalendar, see negotiate.
+//An event of several of the modules appears once, and there are none until the user saves a timetable.
+func (config *Config) GetTimetableEvents() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		user, _ := UserFromContext(r.Context())
+		opts, err := parsePage(r)
+		if err != nil {
+			return err
+		}
+		cursor, err := parseCursor(r)
+		if err != nil {
+			return err
+		}
+		from, to, err := parseWindow(r)
+		if err != nil {
+			return err
+		}
+
+		events, err := config.DBClient.GetUserEvents(r.Context(), user.Subject, from, to)
+		if err != nil {
+			return err
+		}
+		events = filterEvents(r, events)
+		page, next := pageEventsAfter(events, cursor, opts)
+		return config.writeEvents(w, r, page, opts, len(events), next, "My timetable")
+	})
+}
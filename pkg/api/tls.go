@@ -0,0 +1,111 @@
+package api
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+//DefaultChallengeAddr is where the Let's Encrypt http-01 challenges are answered if TLSOptions.ChallengeAddr isn't set.
+//Let's Encrypt only ever asks on port 80.
+const DefaultChallengeAddr = ":80"
+
+//TLSOptions serves the api over HTTPS itself, for deployments without a proxy terminating TLS in front of it.
+//Either CertFile and KeyFile are set, or Hosts are, to have the certificates issued by Let's Encrypt.
+type TLSOptions struct {
+	//CertFile and KeyFile are the paths to a PEM certificate, chain included, and its private key
+	CertFile string
+	KeyFile  string
+	//Hosts are the host names Let's Encrypt issues certificates for, such as "api.whatsupkent.com"
+	Hosts []string
+	//CacheDir is where the issued certificates are kept, so they aren't asked for again on every restart.
+	//They are only kept in memory if it is empty, which runs into the Let's Encrypt rate limits quickly.
+	CacheDir string
+	//Email is given to Let's Encrypt to warn about certificates which are about to expire
+	Email string
+	//ChallengeAddr is where the http-01 challenges are answered, it defaults to DefaultChallengeAddr.
+	//Every other request to it is redirected to https.
+	ChallengeAddr string
+}
+
+//LoadTLSOptions returns the TLS options from TLS_CERT_FILE and TLS_KEY_FILE, or TLS_AUTOCERT_HOSTS (comma separated),
+//TLS_AUTOCERT_CACHE, TLS_AUTOCERT_EMAIL and TLS_CHALLENGE_ADDR, which lookup finds, usually os.LookupEnv.
+//It returns nil if none of them are set, for the api to be served over plain http.
+func LoadTLSOptions(lookup func(string) (string, bool)) (*TLSOptions, error) {
+	get := func(name string) string {
+		value, _ := lookup(name)
+		return value
+	}
+	opts := &TLSOptions{
+		CertFile:      get("TLS_CERT_FILE"),
+		KeyFile:       get("TLS_KEY_FILE"),
+		Hosts:         splitList(get("TLS_AUTOCERT_HOSTS")),
+		CacheDir:      get("TLS_AUTOCERT_CACHE"),
+		Email:         get("TLS_AUTOCERT_EMAIL"),
+		ChallengeAddr: get("TLS_CHALLENGE_ADDR"),
+	}
+	if opts.CertFile == "" && opts.KeyFile == "" && len(opts.Hosts) == 0 {
+		return nil, nil
+	}
+	return opts, opts.validate()
+}
+
+//validate checks the options set up exactly one way of getting the certificate
+func (opts *TLSOptions) validate() error {
+	files := opts.CertFile != "" || opts.KeyFile != ""
+	switch {
+	case files && len(opts.Hosts) > 0:
+		return errors.New("TLS can use either a certificate file or Let's Encrypt, not both")
+	case files && (opts.CertFile == "" || opts.KeyFile == ""):
+		return errors.New("TLS needs both a certificate file and its key file")
+	case !files && len(opts.Hosts) == 0:
+		return errors.New("TLS needs a certificate file or the hosts to ask Let's Encrypt for certificates for")
+	}
+	return nil
+}
+
+//config returns the TLS config for the api server, and the server answering the Let's Encrypt challenges
+//if the certificates come from there, or nil if they come from files
+func (opts *TLSOptions) config() (*tls.Config, *http.Server, error) {
+	err := opts.validate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if opts.CertFile != "" {
+		// Loaded up front, so a broken certificate stops the api starting rather than failing every handshake
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{cert},
+		}, nil, nil
+	}
+
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(opts.Hosts...),
+		Email:      opts.Email,
+	}
+	if opts.CacheDir != "" {
+		manager.Cache = autocert.DirCache(opts.CacheDir)
+	}
+	tlsConfig := manager.TLSConfig()
+	tlsConfig.MinVersion = tls.VersionTLS12
+
+	challenges := &http.Server{
+		Addr:         opts.ChallengeAddr,
+		Handler:      manager.HTTPHandler(nil),
+		ReadTimeout:  DefaultReadTimeout,
+		WriteTimeout: DefaultWriteTimeout,
+		IdleTimeout:  DefaultIdleTimeout,
+	}
+	if challenges.Addr == "" {
+		challenges.Addr = DefaultChallengeAddr
+	}
+	return tlsConfig, challenges, nil
+}
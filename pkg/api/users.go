@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/oidc"
+)
+
+//User is who signed in with the OIDC provider, such as the university SSO
+type User struct {
+	//Subject identifies the user for the provider, and is what their personal data is kept under
+	Subject string `json:"subject"`
+	Email   string `json:"email,omitempty"`
+	Name    string `json:"name,omitempty"`
+}
+
+//userContextKey is the key of the User in the request context
+type userContextKey struct{}
+
+//UserFromContext returns the user the request was sent by, if it was sent with a valid token
+func UserFromContext(ctx context.Context) (User, bool) {
+	u, ok := ctx.Value(userContextKey{}).(User)
+	return u, ok
+}
+
+//verifyUser returns the user the token sent with the request was issued to
+func (config *Config) verifyUser(w http.ResponseWriter, r *http.Request, token string) (User, error) {
+	if config.OIDC == nil {
+		return User{}, unauthorized(w, "Signing in isn't set up.")
+	}
+	claims, err := config.OIDC.Verify(r.Context(), token)
+	if errors.Is(err, oidc.ErrInvalidToken) {
+		invalid := unauthorized(w, "The token isn't valid.")
+		invalid.Err = err
+		return User{}, invalid
+	}
+	if err != nil {
+		// The provider couldn't be asked for its keys, which isn't the user's fault
+		return User{}, &Error{Code: http.StatusServiceUnavailable, Status: "Service Unavailable", Message: "The token couldn't be checked.", Err: err}
+	}
+	return User{Subject: claims.Subject, Email: claims.Email, Name: claims.Name}, nil
+}
+
+//RequireUser refuses the requests which weren't sent with a valid token from the OIDC provider
+func (config *Config) RequireUser(next http.Handler) http.Handler {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		if _, ok := UserFromContext(r.Context()); !ok {
+			return unauthorized(w, "This needs you to sign in.")
+		}
+		next.ServeHTTP(w, r)
+		return nil
+	})
+}
+
+//Me returns the user who sent the request
+func (config *Config) Me() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		user, _ := UserFromContext(r.Context())
+		return writeJSON(w, http.StatusOK, user)
+	})
+}
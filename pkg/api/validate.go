@@ -0,0 +1,204 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+//moduleCodePattern matches kent's module codes, such as CO324, the way the scraper finds them in the feeds
+var moduleCodePattern = regexp.MustCompile(`^[A-Z]{1,4}[0-9]{1,4}$`)
+
+//The bounds of the integer parameters
+var (
+	zero      = 0
+	one       = 1
+	weeks     = AcademicWeeks
+	maxRadius = MaxNearRadius
+)
+
+//pathParams describe the path variables which are checked, by their name in the route templates.
+//The others, such as the location slugs, are only ever looked up, so a malformed one is just not found.
+var pathParams = map[string]apiParam{
+	"code": {Name: "code", In: "path", Pattern: moduleCodePattern, Description: "A module code, such as CO324."},
+	"n":    {Name: "n", In: "path", Type: "integer", Minimum: &one, Maximum: &weeks, Description: "The academic week, from 1."},
+}
+
+//FieldError is what is wrong with one parameter or field of the body of a request
+type FieldError struct {
+	//Field is the name of the parameter, or the json field of the body
+	Field string `json:"field"`
+	//In is where the field is, "query", "path" or "body"
+	In     string `json:"in"`
+	Detail string `json:"detail"`
+}
+
+//ValidationError is the error for a request whose parameters or body don't hold up, answered with a 400
+//listing every field which is wrong rather than only the first
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	details := make([]string, 0, len(e.Errors))
+	for _, f := range e.Errors {
+		details = append(details, f.Field+": "+f.Detail)
+	}
+	return "The request isn't valid: " + strings.Join(details, "; ")
+}
+
+//problem returns the 400 the error is answered with
+func (e *ValidationError) problem() ProblemJSON {
+	detail := "A parameter isn't valid."
+	if len(e.Errors) == 1 {
+		detail = e.Errors[0].Detail
+	} else if len(e.Errors) > 1 {
+		detail = fmt.Sprintf("%d parameters aren't valid.", len(e.Errors))
+	}
+	p := problem(http.StatusBadRequest, "Validation Failed", detail)
+	p.Errors = e.Errors
+	return p
+}
+
+//validator collects what is wrong with a request's fields, see ValidationError
+type validator struct {
+	errors []FieldError
+}
+
+//fail records what is wrong with the field
+func (v *validator) fail(in, field, detail string) {
+	v.errors = append(v.errors, FieldError{Field: field, In: in, Detail: detail})
+}
+
+//moduleCodes checks every code in the list is a module code
+func (v *validator) moduleCodes(in, field string, codes []string) {
+	for _, code := range codes {
+		if !moduleCodePattern.MatchString(strings.TrimSpace(code)) {
+			v.fail(in, field, fmt.Sprintf("%q isn't a module code, such as CO324.", code))
+		}
+	}
+}
+
+//err returns the ValidationError of everything wrong, or nil if nothing is
+func (v *validator) err() error {
+	if len(v.errors) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: v.errors}
+}
+
+//param checks one value of the parameter against its description
+func (v *validator) param(p apiParam, value string) {
+	values := []string{value}
+	if p.List {
+		values = strings.Split(value, ",")
+	}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" && p.List {
+			continue
+		}
+		switch {
+		case p.Type == "integer":
+			n, err := strconv.Atoi(value)
+			switch {
+			case err != nil:
+				v.fail(p.In, p.Name, fmt.Sprintf("%q isn't a whole number.", value))
+			case p.Minimum != nil && n < *p.Minimum:
+				v.fail(p.In, p.Name, fmt.Sprintf("It must be at least %d.", *p.Minimum))
+			case p.Maximum != nil && n > *p.Maximum:
+				v.fail(p.In, p.Name, fmt.Sprintf("It must be at most %d.", *p.Maximum))
+			}
+		case p.Type == "number":
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				v.fail(p.In, p.Name, fmt.Sprintf("%q isn't a number.", value))
+			}
+		case p.Type == "boolean":
+			if _, err := strconv.ParseBool(value); err != nil {
+				v.fail(p.In, p.Name, fmt.Sprintf("%q isn't true or false.", value))
+			}
+		case p.Format == "date-time":
+			if _, err := time.Parse(time.RFC3339, value); err != nil {
+				v.fail(p.In, p.Name, fmt.Sprintf("%q isn't an RFC3339 time, such as 2024-10-01T14:00:00Z.", value))
+			}
+		case p.Format == "date":
+			if _, err := time.Parse(dateLayout, value); err != nil {
+				v.fail(p.In, p.Name, fmt.Sprintf("%q isn't a date, such as 2024-10-01.", value))
+			}
+		case p.Format == "duration":
+			if _, err := time.ParseDuration(value); err != nil {
+				v.fail(p.In, p.Name, fmt.Sprintf("%q isn't a duration, such as 90m or 2h.", value))
+			}
+		}
+		if len(p.Enum) > 0 && !contains(p.Enum, value) {
+			v.fail(p.In, p.Name, fmt.Sprintf("%q isn't one of %s.", value, strings.Join(p.Enum, ", ")))
+		}
+		switch {
+		case p.Pattern == nil || p.Pattern.MatchString(value):
+		case p.Pattern == moduleCodePattern:
+			v.fail(p.In, p.Name, fmt.Sprintf("%q isn't a module code, such as CO324.", value))
+		default:
+			v.fail(p.In, p.Name, fmt.Sprintf("%q doesn't match the pattern %s.", value, p.Pattern))
+		}
+	}
+}
+
+//Validate checks the path and query parameters of the requests against how their route's entry in operations
+//describes them before the handler runs, answering any which don't hold up with a 400 listing what is wrong with each.
+//It catches malformed values before they get anywhere near a dgraph query, the handlers still check what they use.
+func (config *Config) Validate(next http.Handler) http.Handler {
+	versions := config.Versions()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := &validator{}
+		for name, value := range mux.Vars(r) {
+			if p, ok := pathParams[name]; ok {
+				v.param(p, value)
+			}
+		}
+		if op, ok := routeOperation(r, versions); ok {
+			query := r.URL.Query()
+			for _, p := range op.Params {
+				if p.In != "query" {
+					continue
+				}
+				values, given := query[p.Name]
+				if !given {
+					if p.Required {
+						v.fail(p.In, p.Name, "This parameter is needed.")
+					}
+					continue
+				}
+				for _, value := range values {
+					v.param(p, value)
+				}
+			}
+		}
+		if err := v.err(); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+//routeOperation returns the entry in operations of the request's route, found without its version prefix
+func routeOperation(r *http.Request, versions []Version) (apiOperation, bool) {
+	op, ok := operations[r.Method+" "+unversionedTemplate(r, versions)]
+	return op, ok
+}
+
+//unversionedTemplate returns the path template of the request's route without its version prefix, such as /modules/{code}
+func unversionedTemplate(r *http.Request, versions []Version) string {
+	template := pathParamPattern.ReplaceAllString(routeTemplate(r), "{$1}")
+	for _, v := range versions {
+		if strings.HasPrefix(template, "/"+v.Name+"/") {
+			return strings.TrimPrefix(template, "/"+v.Name)
+		}
+	}
+	return template
+}
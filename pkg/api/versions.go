@@ -0,0 +1,132 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+//Version is one version of the api, served under its own prefix such as /v1 side by side with the others,
+//so a breaking change to a response can be made in a new version without breaking the clients of the old one
+type Version struct {
+	//Name is the prefix the version is served under, such as "v1"
+	Name string
+	//Routes registers the handlers of the version on its subrouter
+	Routes func(router *mux.Router)
+	//Deprecated is when the version was deprecated, it isn't if it is zero
+	Deprecated time.Time
+	//Sunset is when the version is going to stop being served, if that has been decided
+	Sunset time.Time
+}
+
+//LegacyDeprecated is when the routes without a version prefix were deprecated in favour of /v1
+var LegacyDeprecated = time.Date(2026, time.October, 14, 0, 0, 0, 0, time.UTC)
+
+//Versions returns every version of the api, oldest first.
+//Register a new version here with its own routes, copying the ones of the previous version which don't change.
+func (config *Config) Versions() []Version {
+	return []Version{
+		{Name: "v1", Routes: config.routesV1},
+	}
+}
+
+//routesV1 registers the routes of the first version of the api
+func (config *Config) routesV1(router *mux.Router) {
+	router.HandleFunc("/", config.Query()).Methods("POST")
+	router.HandleFunc("/events", config.ListEvents()).Methods("GET")
+	router.HandleFunc("/events/stream", config.Stream()).Methods("GET")
+	router.HandleFunc("/events/near", config.EventsNear()).Methods("GET")
+	router.HandleFunc("/now", config.Now()).Methods("GET")
+	router.HandleFunc("/modules", config.ListModules()).Methods("GET")
+	router.HandleFunc("/modules/{code}", config.GetModule()).Methods("GET")
+	router.HandleFunc("/modules/{code}/calendar.ics", config.GetModuleCalendar()).Methods("GET")
+	router.HandleFunc("/modules/{code}/weeks/{n}", config.GetModuleWeek()).Methods("GET")
+	router.HandleFunc("/modules/{code}/weeks/{n}/events", config.GetModuleWeekEvents()).Methods("GET")
+	router.HandleFunc("/locations", config.ListLocations()).Methods("GET")
+	// Before /locations/{slug}, which would take free for a slug
+	router.HandleFunc("/locations/free", config.FreeLocations()).Methods("GET")
+	router.HandleFunc("/locations/{slug}", config.GetLocation()).Methods("GET")
+	router.HandleFunc("/locations/{slug}/events", config.GetLocationEvents()).Methods("GET")
+	router.HandleFunc("/locations/{slug}/calendar.ics", config.GetLocationCalendar()).Methods("GET")
+	router.HandleFunc("/people", config.ListPeople()).Methods("GET")
+	router.HandleFunc("/people/{id}/events", config.GetPersonEvents()).Methods("GET")
+	router.HandleFunc("/calendar.ics", config.GetTimetableCalendar()).Methods("GET")
+	router.HandleFunc("/clashes", config.Clashes()).Methods("POST")
+	router.HandleFunc("/feeds/changes.atom", config.ChangesFeed()).Methods("GET")
+	router.HandleFunc("/graphql", config.GraphQL()).Methods("POST")
+	router.HandleFunc("/ws", config.WebSocket()).Methods("GET")
+	router.HandleFunc("/search", config.Search()).Methods("GET")
+	router.HandleFunc("/analytics/occupancy", config.Occupancy()).Methods("GET")
+	router.HandleFunc("/terms", config.Terms()).Methods("GET")
+	router.HandleFunc("/notifications/unsubscribe", config.Unsubscribe()).Methods("GET", "POST")
+	router.HandleFunc("/batch", config.Batch(router)).Methods("POST")
+
+	me := router.PathPrefix("/me").Subrouter()
+	me.Use(config.RequireUser)
+	me.HandleFunc("", config.Me()).Methods("GET")
+	me.HandleFunc("/timetable", config.GetTimetable()).Methods("GET")
+	me.HandleFunc("/timetable", config.SaveTimetable()).Methods("POST")
+	me.HandleFunc("/timetable/events", config.GetTimetableEvents()).Methods("GET")
+	me.HandleFunc("/notifications", config.GetNotifications()).Methods("GET")
+	me.HandleFunc("/notifications", config.SetNotifications()).Methods("PUT")
+
+	admin := router.PathPrefix("/admin").Subrouter()
+	admin.Use(config.RequireScope(ScopeAdmin))
+	admin.HandleFunc("/status", config.Status()).Methods("GET")
+	admin.HandleFunc("/scrapes", config.CreateScrapeJob()).Methods("POST")
+	admin.HandleFunc("/scrapes/{id}", config.GetScrapeJob()).Methods("GET")
+	admin.HandleFunc("/webhooks", config.CreateWebhook()).Methods("POST")
+	admin.HandleFunc("/webhooks", config.ListWebhooks()).Methods("GET")
+	admin.HandleFunc("/webhooks/{id}", config.GetWebhook()).Methods("GET")
+	admin.HandleFunc("/webhooks/{id}", config.DeleteWebhook()).Methods("DELETE")
+	admin.HandleFunc("/webhooks/{id}/deliveries", config.GetWebhookDeliveries()).Methods("GET")
+}
+
+//deprecation returns middleware sending the Deprecation (RFC 9745) and Sunset (RFC 8594) headers of a deprecated version,
+//with a link to the same route in the version succeeding it, which successor works out from the path if there is one
+func deprecation(deprecated, sunset time.Time, successor func(path string) string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("Deprecation", "@"+strconv.FormatInt(deprecated.Unix(), 10))
+			if !sunset.IsZero() {
+				h.Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+			}
+			if successor != nil {
+				h.Add("Link", "<"+successor(r.URL.Path)+`>; rel="successor-version"`)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+//mountVersions serves every version under its prefix, and the first one without a prefix as well,
+//as the routes were before they were versioned, so the clients from back then keep working
+func (config *Config) mountVersions(router *mux.Router) {
+	versions := config.Versions()
+	for i, v := range versions {
+		sub := router.PathPrefix("/" + v.Name).Subrouter()
+		if !v.Deprecated.IsZero() {
+			var successor func(string) string
+			if i+1 < len(versions) {
+				prefix, next := "/"+v.Name, "/"+versions[i+1].Name
+				successor = func(path string) string {
+					return next + strings.TrimPrefix(path, prefix)
+				}
+			}
+			sub.Use(deprecation(v.Deprecated, v.Sunset, successor))
+		}
+		v.Routes(sub)
+	}
+
+	// Last, as it matches every path the routes before it don't
+	legacy := router.NewRoute().Subrouter()
+	first := "/" + versions[0].Name
+	legacy.Use(deprecation(LegacyDeprecated, time.Time{}, func(path string) string {
+		return first + path
+	}))
+	versions[0].Routes(legacy)
+}
@@ -0,0 +1,517 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+const (
+	//WebhookAttempts is how many times a delivery is tried before it is given up on
+	WebhookAttempts = 5
+	//webhookBackoff is how long the first retry of a delivery waits, each one after waits twice as long
+	webhookBackoff = 2 * time.Second
+	//webhookTimeout bounds each attempt at a delivery
+	webhookTimeout = 10 * time.Second
+	//webhookConcurrency is how many deliveries are made at once
+	webhookConcurrency = 10
+	//webhookDeliveryLog is how many of the latest deliveries to a webhook are listed
+	webhookDeliveryLog = 100
+	//webhookLease is the lease the replica delivering the changes holds
+	webhookLease = "webhooks"
+	//webhookRefresh is how long the webhooks are cached for before they are read from the database again
+	webhookRefresh = time.Minute
+	//MinWebhookSecretLength is the shortest secret a webhook can be registered with
+	MinWebhookSecretLength = 16
+)
+
+//The headers sent with each delivery
+const (
+	WebhookChangeHeader    = "X-WhatsUpKent-Change"
+	WebhookDeliveryHeader  = "X-WhatsUpKent-Delivery"
+	WebhookTimestampHeader = "X-WhatsUpKent-Timestamp"
+	WebhookSignatureHeader = "X-WhatsUpKent-Signature"
+)
+
+//defaultWebhookChanges are the types of changes delivered to the webhooks registered without any
+var defaultWebhookChanges = []string{ChangeAdded, ChangeMoved, ChangeCancelled}
+
+//webhookChangeTypes are the types of changes a webhook can be registered for
+var webhookChangeTypes = map[string]bool{
+	ChangeAdded:     true,
+	ChangeMoved:     true,
+	ChangeUpdated:   true,
+	ChangeCancelled: true,
+}
+
+//WebhookDeliveryJSON is a delivery of a change to a webhook, with how the attempts at it have gone so far
+type WebhookDeliveryJSON struct {
+	ID       string `json:"id"`
+	ChangeID int64  `json:"change_id"`
+	Type     string `json:"type"`
+	//Event is the id of the event which changed
+	Event    string `json:"event,omitempty"`
+	Attempts int    `json:"attempts"`
+	//Status is what the webhook answered the last attempt with, it is left out if it couldn't be reached
+	Status    int       `json:"status,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Delivered bool      `json:"delivered"`
+	At        time.Time `json:"at"`
+}
+
+//WebhookDispatcher posts the changes seen by a ChangeHub to the webhooks whose filters they match.
+//Each delivery is a ChangeJSON, signed with the webhook's secret, and is retried with a backoff if it fails.
+//Only the replica holding the webhookLease posts them, and every delivery is stored so none is posted twice.
+type WebhookDispatcher struct {
+	hub    *ChangeHub
+	client db.Client
+	//HTTPClient makes the deliveries, it is http.DefaultClient if it isn't set
+	HTTPClient *http.Client
+	//Logger logs the deliveries given up on, it is slog.Default() if it isn't set
+	Logger *slog.Logger
+
+	holder   string
+	sem      chan struct{}
+	mu       sync.Mutex
+	webhooks []db.Webhook
+	loaded   time.Time
+}
+
+//NewWebhookDispatcher returns a dispatcher of the changes the hub sees to the webhooks in the database,
+//which Run has to be called to start
+func NewWebhookDispatcher(hub *ChangeHub, client db.Client) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		hub:    hub,
+		client: client,
+		holder: leaseHolder,
+		sem:    make(chan struct{}, webhookConcurrency),
+	}
+}
+
+func (d *WebhookDispatcher) logger() *slog.Logger {
+	if d.Logger == nil {
+		return slog.Default()
+	}
+	return d.Logger
+}
+
+//Run delivers the changes until ctx is done, while this replica holds the webhookLease,
+//so only one of the replicas delivers them. The replica taking the lease over carries on from the last change saved on it.
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	runLeased(ctx, d.client, webhookLease, d.holder, d.logger(), func(ctx context.Context, lease *db.Lease) {
+		followChanges(ctx, d.hub, d.client, lease, d.logger(), "webhooks", d.dispatch)
+	})
+}
+
+//dispatch starts delivering the change to every webhook it matches
+func (d *WebhookDispatcher) dispatch(ctx context.Context, change ChangeJSON) {
+	if change.Type == ChangeScraped {
+		return
+	}
+	webhooks, err := d.current(ctx)
+	if err != nil {
+		d.logger().Error("Reading the webhooks failed", "error", err, "change", change.ID)
+		return
+	}
+	for _, w := range webhooks {
+		if !webhookMatches(w, change) {
+			continue
+		}
+		// The slot is taken before the goroutine is started, so a burst of changes can't start one for every delivery at once
+		select {
+		case d.sem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		go func(w db.Webhook) {
+			defer func() { <-d.sem }()
+			d.deliver(ctx, w, change)
+		}(w)
+	}
+}
+
+//current returns the webhooks, read from the database if they haven't been for webhookRefresh
+func (d *WebhookDispatcher) current(ctx context.Context) ([]db.Webhook, error) {
+	d.mu.Lock()
+	if d.webhooks != nil && time.Since(d.loaded) < webhookRefresh {
+		defer d.mu.Unlock()
+		return d.webhooks, nil
+	}
+	d.mu.Unlock()
+
+	webhooks, err := d.client.ListWebhooks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.webhooks, d.loaded = webhooks, time.Now()
+	return webhooks, nil
+}
+
+//Invalidate makes the next change read the webhooks from the database, after they have been registered or deleted
+func (d *WebhookDispatcher) Invalidate() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.webhooks = nil
+}
+
+//webhookMatches returns whether the change is of a type the webhook is registered for,
+//to an event of one of its modules or locations if it has any
+func webhookMatches(w db.Webhook, change ChangeJSON) bool {
+	changes := w.Changes
+	if len(changes) == 0 {
+		changes = defaultWebhookChanges
+	}
+	if !contains(changes, change.Type) {
+		return false
+	}
+	if len(w.Modules) == 0 && len(w.Locations) == 0 {
+		return true
+	}
+	for _, topic := range change.Topics {
+		if strings.HasPrefix(topic, "module:") && contains(w.Modules, strings.TrimPrefix(topic, "module:")) {
+			return true
+		}
+		if strings.HasPrefix(topic, "location:") && contains(w.Locations, strings.TrimPrefix(topic, "location:")) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+//signWebhook returns the signature of a delivery, the hex HMAC-SHA256 with the secret of the timestamp, a dot and the body.
+//Signing the timestamp lets receivers turn away old deliveries being replayed.
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+//deliver claims the delivery of the change to the webhook, then posts it until it answers with a 2xx,
+//it answers with an error retrying won't fix, or WebhookAttempts have been made, storing how it went
+func (d *WebhookDispatcher) deliver(ctx context.Context, w db.Webhook, change ChangeJSON) {
+	id, err := newID()
+	if err != nil {
+		d.logger().Error("Delivering a change to a webhook failed", "error", err, "webhook", w.ID)
+		return
+	}
+	delivery := db.WebhookDelivery{ID: id, Webhook: &w, Change: change.ID, Type: change.Type}
+	if change.Event != nil {
+		delivery.Event = change.Event.ID
+	}
+	claimed, err := d.client.ClaimWebhookDelivery(ctx, delivery)
+	if err != nil {
+		d.logger().Error("Claiming a delivery to a webhook failed", "error", err, "webhook", w.ID, "change", change.ID)
+		return
+	}
+	if claimed == nil {
+		return
+	}
+	delivery = *claimed
+	defer func() { d.record(delivery) }()
+
+	body, err := json.Marshal(change)
+	if err != nil {
+		delivery.Error = err.Error()
+		return
+	}
+	backoff := webhookBackoff
+	for delivery.Attempts < WebhookAttempts {
+		if delivery.Attempts > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		delivery.Attempts++
+		status, err := d.post(ctx, w, delivery.ID, change.Type, body)
+		delivery.Status = status
+		if err == nil && status >= 200 && status < 300 {
+			delivery.Delivered, delivery.Error = true, ""
+			break
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+		} else {
+			delivery.Error = fmt.Sprintf("The webhook answered with %d", status)
+		}
+		// The webhook turning the delivery away isn't going to change its mind
+		if err == nil && status < 500 && status != http.StatusRequestTimeout && status != http.StatusTooManyRequests {
+			break
+		}
+	}
+	if !delivery.Delivered {
+		d.logger().Warn("Giving up on delivering a change to a webhook", "webhook", w.ID, "delivery", delivery.ID, "attempts", delivery.Attempts, "error", delivery.Error)
+	}
+}
+
+//post makes one attempt at a delivery, returning the status the webhook answered with
+func (d *WebhookDispatcher) post(ctx context.Context, w db.Webhook, deliveryID, changeType string, body []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "WhatsUpKent-Webhooks")
+	req.Header.Set(WebhookChangeHeader, changeType)
+	req.Header.Set(WebhookDeliveryHeader, deliveryID)
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, signWebhook(w.Secret, timestamp, body))
+
+	client := d.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Read some of the answer, so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	return resp.StatusCode, nil
+}
+
+//record stores how the attempts at the delivery went, given a moment of its own as ctx may be done by now
+func (d *WebhookDispatcher) record(delivery db.WebhookDelivery) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	update := db.WebhookDelivery{
+		UID:       delivery.UID,
+		Attempts:  delivery.Attempts,
+		Status:    delivery.Status,
+		Error:     delivery.Error,
+		Delivered: delivery.Delivered,
+	}
+	if _, err := d.client.UpdateWebhookDelivery(ctx, update); err != nil {
+		d.logger().Error("Storing a delivery to a webhook failed", "error", err, "delivery", delivery.ID)
+	}
+}
+
+//WebhookRequestJSON is a webhook registered through POST /admin/webhooks
+type WebhookRequestJSON struct {
+	URL string `json:"url"`
+	//Secret is generated if it isn't given, and is only ever answered with when the webhook is registered
+	Secret    string   `json:"secret,omitempty"`
+	Modules   []string `json:"modules,omitempty"`
+	Locations []string `json:"locations,omitempty"`
+	//Changes are the types of changes to deliver, added, moved, updated or cancelled. It is added, moved and cancelled without them.
+	Changes []string `json:"changes,omitempty"`
+}
+
+//WebhookJSON is a webhook as the admin endpoints return it, without its secret except when it is registered
+type WebhookJSON struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Modules   []string  `json:"modules"`
+	Locations []string  `json:"locations"`
+	Changes   []string  `json:"changes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+//WebhooksJSON is the list of the webhooks, oldest first
+type WebhooksJSON struct {
+	Webhooks []WebhookJSON `json:"webhooks"`
+}
+
+//WebhookDeliveriesJSON is the log of the latest deliveries to a webhook, newest first
+type WebhookDeliveriesJSON struct {
+	Deliveries []WebhookDeliveryJSON `json:"deliveries"`
+}
+
+//webhookDeliveryJSON returns the delivery as the endpoints return it
+func webhookDeliveryJSON(d db.WebhookDelivery) WebhookDeliveryJSON {
+	out := WebhookDeliveryJSON{
+		ID:        d.ID,
+		ChangeID:  d.Change,
+		Type:      d.Type,
+		Event:     d.Event,
+		Attempts:  d.Attempts,
+		Status:    d.Status,
+		Error:     d.Error,
+		Delivered: d.Delivered,
+	}
+	if d.At != nil {
+		out.At = *d.At
+	}
+	return out
+}
+
+//webhookJSON returns the webhook as the endpoints return it, leaving out its secret
+func webhookJSON(w db.Webhook) WebhookJSON {
+	out := WebhookJSON{ID: w.ID, URL: w.URL, Modules: w.Modules, Locations: w.Locations, Changes: w.Changes}
+	if out.Modules == nil {
+		out.Modules = []string{}
+	}
+	if out.Locations == nil {
+		out.Locations = []string{}
+	}
+	if len(out.Changes) == 0 {
+		out.Changes = defaultWebhookChanges
+	}
+	if w.CreatedAt != nil {
+		out.CreatedAt = *w.CreatedAt
+	}
+	return out
+}
+
+//CreateWebhook registers a URL to be posted the changes to the events of the modules and locations given, or every event.
+//It answers with a 201 and the webhook, including its secret, which isn't shown again.
+//Each delivery is signed with an X-WhatsUpKent-Signature header, see signWebhook.
+func (config *Config) CreateWebhook() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		var req WebhookRequestJSON
+		defer r.Body.Close()
+		err := json.NewDecoder(io.LimitReader(r.Body, 1048576)).Decode(&req)
+		if err != nil {
+			return badRequest("Could not read the webhook.", err)
+		}
+		v := &validator{}
+		target, err := url.Parse(req.URL)
+		if err != nil || (target.Scheme != "https" && target.Scheme != "http") || target.Host == "" {
+			v.fail("body", "url", "The url must be an absolute http or https URL.")
+		}
+		v.moduleCodes("body", "modules", req.Modules)
+		for _, change := range req.Changes {
+			if !webhookChangeTypes[change] {
+				v.fail("body", "changes", fmt.Sprintf("The change %q isn't one of added, moved, updated or cancelled.", change))
+			}
+		}
+		if req.Secret != "" && len(req.Secret) < MinWebhookSecretLength {
+			v.fail("body", "secret", fmt.Sprintf("The secret has to be at least %d characters long.", MinWebhookSecretLength))
+		}
+		if err := v.err(); err != nil {
+			return err
+		}
+		if req.Secret == "" {
+			b := make([]byte, 32)
+			if _, err := rand.Read(b); err != nil {
+				return err
+			}
+			req.Secret = hex.EncodeToString(b)
+		}
+
+		id, err := newID()
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		webhook := db.Webhook{
+			ID:        id,
+			URL:       target.String(),
+			Secret:    req.Secret,
+			Modules:   req.Modules,
+			Locations: req.Locations,
+			Changes:   req.Changes,
+			CreatedAt: &now,
+		}
+		if _, err := config.DBClient.UpsertWebhook(r.Context(), webhook); err != nil {
+			return err
+		}
+		if config.Webhooks != nil {
+			config.Webhooks.Invalidate()
+		}
+
+		resp := webhookJSON(webhook)
+		resp.Secret = webhook.Secret
+		w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+id)
+		return writeJSON(w, http.StatusCreated, resp)
+	})
+}
+
+//ListWebhooks returns every webhook, oldest first
+func (config *Config) ListWebhooks() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		webhooks, err := config.DBClient.ListWebhooks(r.Context())
+		if err != nil {
+			return err
+		}
+		resp := WebhooksJSON{Webhooks: make([]WebhookJSON, 0, len(webhooks))}
+		for _, webhook := range webhooks {
+			resp.Webhooks = append(resp.Webhooks, webhookJSON(webhook))
+		}
+		return writeJSON(w, http.StatusOK, resp)
+	})
+}
+
+//GetWebhook returns the webhook with the id in the path
+func (config *Config) GetWebhook() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		webhook, err := config.DBClient.GetWebhook(r.Context(), mux.Vars(r)["id"])
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusOK, webhookJSON(*webhook))
+	})
+}
+
+//DeleteWebhook stops the changes being delivered to the webhook with the id in the path, answering with a 204
+func (config *Config) DeleteWebhook() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		webhook, err := config.DBClient.GetWebhook(r.Context(), mux.Vars(r)["id"])
+		if err != nil {
+			return err
+		}
+		if err := config.DBClient.DeleteWebhook(r.Context(), *webhook); err != nil {
+			return err
+		}
+		if config.Webhooks != nil {
+			config.Webhooks.Invalidate()
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
+
+//GetWebhookDeliveries returns the latest deliveries to the webhook with the id in the path, newest first,
+//with how many attempts each took and what the webhook last answered
+func (config *Config) GetWebhookDeliveries() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		webhook, err := config.DBClient.GetWebhook(r.Context(), mux.Vars(r)["id"])
+		if err != nil {
+			return err
+		}
+		deliveries, err := config.DBClient.ListWebhookDeliveries(r.Context(), *webhook, webhookDeliveryLog)
+		if err != nil {
+			return err
+		}
+		resp := WebhookDeliveriesJSON{Deliveries: make([]WebhookDeliveryJSON, 0, len(deliveries))}
+		for _, delivery := range deliveries {
+			resp.Deliveries = append(resp.Deliveries, webhookDeliveryJSON(delivery))
+		}
+		return writeJSON(w, http.StatusOK, resp)
+	})
+}
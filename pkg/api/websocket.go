@@ -0,0 +1,126 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	//wsWriteWait is how long a message can take to be written to the client
+	wsWriteWait = 10 * time.Second
+	//wsPongWait is how long the client has to answer a ping before the connection is closed
+	wsPongWait = 60 * time.Second
+	//wsPingPeriod is how often the client is pinged, which has to be more often than wsPongWait
+	wsPingPeriod = wsPongWait * 9 / 10
+	//wsMaxMessageSize is the largest message a client can send
+	wsMaxMessageSize = 4096
+)
+
+//SubscriptionJSON is what a websocket client sends to change the topics it is subscribed to
+type SubscriptionJSON struct {
+	Subscribe   []string `json:"subscribe"`
+	Unsubscribe []string `json:"unsubscribe"`
+}
+
+var upgrader = websocket.Upgrader{
+	// The api is open to every origin, as the CORS headers say
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+//WebSocket pushes the changes to the timetable to the client as ChangeJSON messages, see ChangeHub.
+//The client starts off subscribed to the comma separated ?modules and ?locations,
+//and can send a SubscriptionJSON at any time to change its topics.
+func (config *Config) WebSocket() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		if config.Changes == nil {
+			return &Error{Code: http.StatusServiceUnavailable, Status: "Service Unavailable", Message: "Changes aren't being watched."}
+		}
+		topics := subscriptionTopics(r)
+		s, _, err := config.Changes.subscribe(r.Context(), topics, 0)
+		if err != nil {
+			return err
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			config.Changes.unsubscribe(s)
+			// The upgrader has already answered the client
+			logRequestError(r.Context(), err)
+			return nil
+		}
+		go config.writeChanges(conn, s)
+		config.readSubscriptions(conn, s)
+		return nil
+	})
+}
+
+//subscriptionTopics returns the topics of the comma separated ?modules and ?locations
+func subscriptionTopics(r *http.Request) []string {
+	topics := make([]string, 0)
+	query := r.URL.Query()
+	for _, prefix := range []string{"module", "location"} {
+		for _, value := range query[prefix+"s"] {
+			for _, key := range strings.Split(value, ",") {
+				if key = strings.TrimSpace(key); key != "" {
+					topics = append(topics, prefix+":"+key)
+				}
+			}
+		}
+	}
+	return topics
+}
+
+//readSubscriptions applies the SubscriptionJSON messages from the client until the connection is closed,
+//keeping the connection alive as long as the client answers the pings
+func (config *Config) readSubscriptions(conn *websocket.Conn, s *subscriber) {
+	defer func() {
+		config.Changes.unsubscribe(s)
+		conn.Close()
+	}()
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	for {
+		var msg SubscriptionJSON
+		if err := conn.ReadJSON(&msg); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				config.Logger.Warn("Websocket connection failed", "error", err)
+			}
+			return
+		}
+		config.Changes.setTopics(s, msg.Subscribe, msg.Unsubscribe)
+	}
+}
+
+//writeChanges writes the changes sent to the subscriber to the client, pinging it in between.
+//It closes the connection once the subscriber is dropped, such as for falling behind.
+func (config *Config) writeChanges(conn *websocket.Conn, s *subscriber) {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer func() {
+		ticker.Stop()
+		conn.Close()
+	}()
+	for {
+		select {
+		case change, ok := <-s.send:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := conn.WriteJSON(change); err != nil {
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	// The time zone database is embedded, so the weeks are in kent's time wherever the api runs
+	_ "time/tzdata"
+
+	"github.com/gorilla/mux"
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+//AcademicWeeks is how many weeks kent numbers in an academic year
+const AcademicWeeks = 52
+
+//kentTime is the time zone of the university, which the days of a week are in
+var kentTime = func() *time.Location {
+	loc, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		panic(fmt.Sprintf("The Europe/London time zone isn't in the embedded time zone database: %v", err))
+	}
+	return loc
+}()
+
+//Week is one of the weeks of an academic year, from the Monday it starts to the Monday after
+type Week struct {
+	//Year is the year the academic year starts in, 2024 for 2024/25
+	Year   int
+	Number int
+	From   time.Time
+	To     time.Time
+}
+
+//academicYearStart returns when week 1 of the academic year starting in the year begins without its terms stored,
+//the last Monday of September, which is when kent starts numbering the weeks
+func academicYearStart(year int) time.Time {
+	start := time.Date(year, time.September, 30, 0, 0, 0, 0, kentTime)
+	for start.Weekday() != time.Monday {
+		start = start.AddDate(0, 0, -1)
+	}
+	return start
+}
+
+//parseYear reads the ?year the academic year starts in, returning whether it was given
+func parseYear(r *http.Request) (int, bool, error) {
+	raw := r.URL.Query().Get("year")
+	if raw == "" {
+		return 0, false, nil
+	}
+	year, err := strconv.Atoi(raw)
+	if err != nil || year < 1965 || year > 9999 {
+		return 0, false, badRequest("The year must be the year the academic year starts in, such as 2024 for 2024/25.", err)
+	}
+	return year, true, nil
+}
+
+//parseWeekNumber reads the week number in the path
+func parseWeekNumber(r *http.Request) (int, error) {
+	n, err := strconv.Atoi(mux.Vars(r)["n"])
+	if err != nil || n < 1 || n > AcademicWeeks {
+		return 0, badRequest(fmt.Sprintf("The week must be a number from 1 to %d.", AcademicWeeks), err)
+	}
+	return n, nil
+}
+
+//parseWeek reads the week number in the path, and the ?year the academic year starts in, defaulting to the current one,
+//numbering the weeks by the academic calendar of the year, see AcademicCalendar
+func (config *Config) parseWeek(r *http.Request) (Week, error) {
+	n, err := parseWeekNumber(r)
+	if err != nil {
+		return Week{}, err
+	}
+	calendar, err := config.requestCalendar(r)
+	if err != nil {
+		return Week{}, err
+	}
+	return calendar.Week(n), nil
+}
+
+//DayJSON is a day of a week, with the events starting on it
+type DayJSON struct {
+	//Date is the day in kent, such as 2024-09-30
+	Date    string     `json:"date"`
+	Weekday string     `json:"weekday"`
+	Events  []db.Event `json:"events"`
+}
+
+//WeekJSON is an academic week of a module, with its events grouped by the day they start on, Monday first
+type WeekJSON struct {
+	Module       string    `json:"module"`
+	AcademicYear string    `json:"academic_year"`
+	Week         int       `json:"week"`
+	From         time.Time `json:"from"`
+	To           time.Time `json:"to"`
+	Days         []DayJSON `json:"days"`
+}
+
+//moduleWeekEvents returns the events of the module with the code in the path which take place during the week,
+//only those in the rooms ?campus and ?accessible leave in, see filterEvents
+func (config *Config) moduleWeekEvents(r *http.Request) (*db.Module, Week, []db.Event, error) {
+	week, err := config.parseWeek(r)
+	if err != nil {
+		return nil, Week{}, nil, err
+	}
+	code := mux.Vars(r)["code"]
+	module, err := config.DBClient.GetModuleFromSDSCode(r.Context(), code)
+	if err != nil {
+		return nil, Week{}, nil, err
+	}
+	events, err := config.DBClient.GetEventsByModule(r.Context(), code)
+	if err != nil {
+		return nil, Week{}, nil, err
+	}
+	during := make([]db.Event, 0)
+	for _, e := range filterEvents(r, events) {
+		if e.StartDate != nil && !e.StartDate.Before(week.From) && e.StartDate.Before(week.To) {
+			during = append(during, e)
+		}
+	}
+	return module, week, during, nil
+}
+
+//GetModuleWeek returns week {n} of the academic year of the module with the code in the path, as kent numbers them
+//by its academic calendar, with the dates it covers and the module's events on each of its days.
+//?year chooses the academic year by the year it starts in, it is the current one without it.
+func (config *Config) GetModuleWeek() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		module, week, events, err := config.moduleWeekEvents(r)
+		if err != nil {
+			return err
+		}
+		resp := WeekJSON{
+			Module:       module.Code,
+			AcademicYear: fmt.Sprintf("%d/%02d", week.Year, (week.Year+1)%100),
+			Week:         week.Number,
+			From:         week.From,
+			To:           week.To,
+			Days:         make([]DayJSON, 7),
+		}
+		for i := range resp.Days {
+			day := week.From.AddDate(0, 0, i)
+			resp.Days[i] = DayJSON{Date: day.Format("2006-01-02"), Weekday: day.Weekday().String(), Events: []db.Event{}}
+		}
+		for _, e := range events {
+			start := e.StartDate.In(kentTime)
+			day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, kentTime)
+			i := int(day.Sub(week.From).Hours()+12) / 24
+			resp.Days[i].Events = append(resp.Days[i].Events, e)
+		}
+		return writeJSON(w, http.StatusOK, resp)
+	})
+}
+
+//GetModuleWeekEvents returns a page of the events of the module with the code in the path during week {n}
+//of the academic year, see GetModuleWeek, as json, csv or iCalendar, see negotiate
+func (config *Config) GetModuleWeekEvents() http.HandlerFunc {
+	return Handle(func(w http.ResponseWriter, r *http.Request) error {
+		opts, err := parsePage(r)
+		if err != nil {
+			return err
+		}
+		cursor, err := parseCursor(r)
+		if err != nil {
+			return err
+		}
+		module, week, events, err := config.moduleWeekEvents(r)
+		if err != nil {
+			return err
+		}
+		name := fmt.Sprintf("%s week %d", module.Code, week.Number)
+		page, next := pageEventsAfter(events, cursor, opts)
+		return config.writeEvents(w, r, page, opts, len(events), next, name)
+	})
+}
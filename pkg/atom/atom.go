@@ -0,0 +1,124 @@
+//Package atom writes feeds in the Atom syndication format (RFC 4287), so they can be followed from feed readers
+package atom
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+//Namespace is the xml namespace of Atom feeds
+const Namespace = "http://www.w3.org/2005/Atom"
+
+//Generator names whatsupkent as what made the feed
+const Generator = "WhatsUpKent"
+
+//Feed is an Atom feed of entries
+type Feed struct {
+	//ID has to be an IRI which stays the same, such as a tag URI
+	ID    string
+	Title string
+	//Self is the URL the feed is fetched from, which readers subscribe to
+	Self string
+	//Updated is when the feed last changed, it is the latest entry's if it isn't set, or the current time without any
+	Updated time.Time
+	Entries []Entry
+}
+
+//Entry is one of the entries of a feed
+type Entry struct {
+	//ID has to be an IRI unique to the entry, which stays the same if the entry is fetched again
+	ID      string
+	Title   string
+	Summary string
+	Updated time.Time
+	//Link is the web page of what the entry is about, if there is one
+	Link string
+	//Categories are shown by some readers to group the entries, such as the modules of an event
+	Categories []string
+}
+
+type xmlFeed struct {
+	XMLName   xml.Name   `xml:"feed"`
+	Namespace string     `xml:"xmlns,attr"`
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Updated   string     `xml:"updated"`
+	Generator string     `xml:"generator"`
+	Author    xmlAuthor  `xml:"author"`
+	Links     []xmlLink  `xml:"link"`
+	Entries   []xmlEntry `xml:"entry"`
+}
+
+type xmlAuthor struct {
+	Name string `xml:"name"`
+}
+
+type xmlLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type xmlCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type xmlEntry struct {
+	ID         string        `xml:"id"`
+	Title      string        `xml:"title"`
+	Updated    string        `xml:"updated"`
+	Summary    string        `xml:"summary,omitempty"`
+	Links      []xmlLink     `xml:"link"`
+	Categories []xmlCategory `xml:"category"`
+}
+
+//formatTime formats a time the way Atom's date constructs are, RFC 3339 in UTC
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+//Write writes the feed to w
+func Write(w io.Writer, feed Feed) error {
+	updated := feed.Updated
+	if updated.IsZero() {
+		for _, e := range feed.Entries {
+			if e.Updated.After(updated) {
+				updated = e.Updated
+			}
+		}
+	}
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+
+	out := xmlFeed{
+		Namespace: Namespace,
+		ID:        feed.ID,
+		Title:     feed.Title,
+		Updated:   formatTime(updated),
+		Generator: Generator,
+		// A feed needs an author unless every entry has one
+		Author:  xmlAuthor{Name: Generator},
+		Entries: make([]xmlEntry, 0, len(feed.Entries)),
+	}
+	if feed.Self != "" {
+		out.Links = append(out.Links, xmlLink{Rel: "self", Href: feed.Self})
+	}
+	for _, e := range feed.Entries {
+		entry := xmlEntry{ID: e.ID, Title: e.Title, Updated: formatTime(e.Updated), Summary: e.Summary}
+		if e.Link != "" {
+			entry.Links = append(entry.Links, xmlLink{Rel: "alternate", Href: e.Link})
+		}
+		for _, c := range e.Categories {
+			entry.Categories = append(entry.Categories, xmlCategory{Term: c})
+		}
+		out.Entries = append(out.Entries, entry)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(out)
+}
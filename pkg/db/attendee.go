@@ -0,0 +1,144 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// AddAttendee links the person to the event as one of the people attending it, doing nothing if they already are.
+// The event is matched on its Uid or its ID, and the person on their Uid.
+// An error wrapping ErrNotFound is returned if either of them doesn't exist.
+func (config *DB) AddAttendee(ctx context.Context, event Event, person Person, options ...Option) error {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+	return config.linkAttendee(ctx, "AddAttendee", event, person, &Mutation{
+		SetNquads: []byte("uid(v) <event.attendee> uid(p) ."),
+	})
+}
+
+// RemoveAttendee undoes AddAttendee, doing nothing if the person wasn't attending the event
+func (config *DB) RemoveAttendee(ctx context.Context, event Event, person Person, options ...Option) error {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+	return config.linkAttendee(ctx, "RemoveAttendee", event, person, &Mutation{
+		DelNquads: []byte("uid(v) <event.attendee> uid(p) ."),
+	})
+}
+
+// linkAttendee runs the mutation on the event.attendee edge between the event, bound to v, and the person, bound to p.
+// Like markEvent, the event is matched whether or not it is soft deleted.
+func (config *DB) linkAttendee(ctx context.Context, op string, event Event, person Person, mu *Mutation) error {
+	if person.UID == "" {
+		return fmt.Errorf("%s needs a person with a Uid", op)
+	}
+	var eventBlock, key string
+	switch {
+	case event.UID != "":
+		eventBlock, key = "v as var(func: uid($event)) @filter(type(Event))", event.UID
+	case event.ID != "":
+		eventBlock, key = "v as var(func: eq(event.id, $event))", event.ID
+	default:
+		return fmt.Errorf("%s needs an event with a Uid or an ID", op)
+	}
+
+	req := &Request{
+		Query: fmt.Sprintf(`query Attendee($event: string, $person: string) {
+			%s
+			p as var(func: uid($person)) @filter(type(Person))
+			event(func: uid(v)) { uid }
+			person(func: uid(p)) { uid }
+		}`, eventBlock),
+		Vars: map[string]string{"$event": key, "$person": person.UID},
+	}
+	// Without the condition a missing event or person would be created as an empty node
+	mu.Cond = "@if(gt(len(v), 0) AND gt(len(p), 0))"
+	req.Mutations = []*Mutation{mu}
+
+	resp, err := config.commit(ctx, op, req)
+	if err != nil {
+		return err
+	}
+	type Root struct {
+		Event []struct {
+			UID string `json:"uid"`
+		} `json:"event"`
+		Person []struct {
+			UID string `json:"uid"`
+		} `json:"person"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return err
+	}
+	if len(r.Event) == 0 {
+		if event.UID != "" {
+			return notFound("Event", "uid", event.UID)
+		}
+		return notFound("Event", "event.id", event.ID)
+	}
+	if len(r.Person) == 0 {
+		return notFound("Person", "uid", person.UID)
+	}
+	return nil
+}
+
+// GetEventAttendees returns the people attending the event, ordered by name.
+// The event is matched on its Uid or its ID, and an error wrapping ErrNotFound is returned if it doesn't exist.
+func (config *DB) GetEventAttendees(ctx context.Context, event Event, options ...Option) ([]Person, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	var eventFunc, key string
+	switch {
+	case event.UID != "":
+		eventFunc, key = "uid($key)", event.UID
+	case event.ID != "":
+		eventFunc, key = "eq(event.id, $key)", event.ID
+	default:
+		return nil, errors.New("GetEventAttendees needs an event with a Uid or an ID")
+	}
+
+	txn := config.readTxn(ctx)
+
+	q := fmt.Sprintf(
+		`query EventAttendees($key: string) {
+			event(func: %s) @filter(type(Event) AND NOT has(event.deleted_at)) {
+				uid
+				event.attendee (orderasc: person.name) {
+					uid
+					person.name
+					person.email
+				}
+			}
+		}`, eventFunc)
+
+	resp, err := config.runQuery(ctx, txn, "GetEventAttendees", q, map[string]string{"$key": key})
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Event []struct {
+			Attendees []Person `json:"event.attendee"`
+		} `json:"event"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Event) == 0 {
+		if event.UID != "" {
+			return nil, notFound("Event", "uid", event.UID)
+		}
+		return nil, notFound("Event", "event.id", event.ID)
+	}
+	if r.Event[0].Attendees == nil {
+		return []Person{}, nil
+	}
+	return r.Event[0].Attendees, nil
+}
@@ -0,0 +1,239 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// GetFreeLocations returns the locations with no events overlapping the window (from, to), ordered by their id,
+// such as the rooms free to study in this afternoon. A room is free from the end of one event to the start of the next,
+// so the events which only touch the window, ending at from or starting at to, don't make it busy.
+// If building is set, only the rooms which are part of the building with that location.id are returned,
+// and an error wrapping ErrNotFound is returned if there is no such building.
+func (config *DB) GetFreeLocations(ctx context.Context, from, to time.Time, building string, options ...Option) ([]Location, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	params := "$from: string, $to: string"
+	buildingBlock := ""
+	filter := "NOT uid(busy)"
+	variables := make(map[string]string)
+	variables["$from"] = formatTime(from)
+	variables["$to"] = formatTime(to)
+	if building != "" {
+		params += ", $building: string"
+		buildingBlock = `building(func: eq(location.id, $building)) @filter(type(Location)) {
+				uid
+				rooms as ~location.part_of
+			}`
+		filter += " AND uid(rooms)"
+		variables["$building"] = building
+	}
+
+	txn := config.readTxn(ctx)
+	q := fmt.Sprintf(
+		`query FreeLocations(%s) {
+			%s
+			busy as var(func: type(Location)) @cascade {
+				~event.location @filter(type(Event) AND NOT has(event.deleted_at) AND lt(event.start_date, $to) AND gt(event.end_date, $from)) {
+					uid
+				}
+			}
+			free(func: type(Location), orderasc: location.id) @filter(%s) {
+				uid
+				location.id
+				location.name
+				location.loc
+				location.disabled_access
+				location.campus
+				location.capacity
+			}
+		}
+	`, params, buildingBlock, filter)
+
+	resp, err := config.runQuery(ctx, txn, "GetFreeLocations", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Building []struct {
+			UID string `json:"uid"`
+		} `json:"building"`
+		Free []Location `json:"free"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	if building != "" && len(r.Building) == 0 {
+		return nil, notFound("Location", "location.id", building)
+	}
+
+	if r.Free == nil {
+		return make([]Location, 0), nil
+	}
+	return r.Free, nil
+}
+
+// MaxEventDuration is the longest an event GetEventsDuring returns can be, bounding how long before the window
+// the events have to be looked for. The timetables' events are a few hours at most.
+const MaxEventDuration = 24 * time.Hour
+
+// GetEventsDuring returns the events overlapping the window [from, to], ordered by their start date,
+// such as what is on now and in the next hour. Only those starting within MaxEventDuration of from are looked at.
+// If building is set, only the events taking place in the building with that location.id or one of its rooms are returned,
+// and an error wrapping ErrNotFound is returned if there is no such building.
+func (config *DB) GetEventsDuring(ctx context.Context, from, to time.Time, building string, options ...Option) ([]Event, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	params := "$from: string, $to: string, $earliest: string"
+	buildingBlock := ""
+	filter := "type(Event) AND NOT has(event.deleted_at) AND ge(event.end_date, $from)"
+	variables := make(map[string]string)
+	variables["$from"] = formatTime(from)
+	variables["$to"] = formatTime(to)
+	variables["$earliest"] = formatTime(from.Add(-MaxEventDuration))
+	if building != "" {
+		params += ", $building: string"
+		buildingBlock = `buildings as building(func: eq(location.id, $building)) @filter(type(Location)) {
+				uid
+				rooms as ~location.part_of
+			}
+			var(func: uid(buildings, rooms)) {
+				located as ~event.location
+			}`
+		filter += " AND uid(located)"
+		variables["$building"] = building
+	}
+
+	txn := config.readTxn(ctx)
+	// Rooted on the start dates between the earliest an event overlapping the window can start and its end,
+	// rather than every event ending after from, which is everything to come
+	q := fmt.Sprintf(
+		`query EventsDuring(%s) {
+			%s
+			events(func: between(event.start_date, $earliest, $to), orderasc: event.start_date) @filter(%s) {
+				%s
+			}
+		}
+	`, params, buildingBlock, filter, eventPredicates)
+
+	resp, err := config.runQuery(ctx, txn, "GetEventsDuring", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Building []struct {
+			UID string `json:"uid"`
+		} `json:"building"`
+		Events []Event `json:"events"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	if building != "" && len(r.Building) == 0 {
+		return nil, notFound("Location", "location.id", building)
+	}
+
+	if r.Events == nil {
+		return make([]Event, 0), nil
+	}
+	return r.Events, nil
+}
+
+// Interval is a span of time, such as when someone is busy
+type Interval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// GetPersonFreeBusy returns the merged intervals the person with the Uid is busy within (from, to), going by the events they organise,
+// or an error wrapping ErrNotFound if there is no such person
+func (config *DB) GetPersonFreeBusy(ctx context.Context, personUID string, from, to time.Time, options ...Option) ([]Interval, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	if personUID == "" {
+		return nil, errors.New("GetPersonFreeBusy needs the Uid of a person")
+	}
+
+	txn := config.readTxn(ctx)
+	q := `query PersonFreeBusy($key: string, $from: string, $to: string) {
+			person(func: uid($key)) @filter(type(Person)) {
+				uid
+				events: ~event.organiser (orderasc: event.start_date) @filter(type(Event) AND NOT has(event.deleted_at) AND lt(event.start_date, $to) AND gt(event.end_date, $from)) {
+					event.start_date
+					event.end_date
+				}
+			}
+		}
+	`
+	variables := make(map[string]string)
+	variables["$key"] = personUID
+	variables["$from"] = formatTime(from)
+	variables["$to"] = formatTime(to)
+
+	resp, err := config.runQuery(ctx, txn, "GetPersonFreeBusy", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Person []struct {
+			Events []Event `json:"events"`
+		} `json:"person"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Person) == 0 {
+		return nil, notFound("Person", "uid", personUID)
+	}
+	return BusyIntervals(r.Person[0].Events, from, to), nil
+}
+
+// BusyIntervals returns the time the events take up within [from, to], in order,
+// merging the events which overlap or follow straight on from each other. Events without both dates are skipped.
+func BusyIntervals(events []Event, from, to time.Time) []Interval {
+	intervals := make([]Interval, 0, len(events))
+	for _, e := range events {
+		if e.StartDate == nil || e.EndDate == nil || e.StartDate.After(to) || e.EndDate.Before(from) {
+			continue
+		}
+		in := Interval{Start: *e.StartDate, End: *e.EndDate}
+		if in.Start.Before(from) {
+			in.Start = from
+		}
+		if in.End.After(to) {
+			in.End = to
+		}
+		intervals = append(intervals, in)
+	}
+	sort.Slice(intervals, func(i, j int) bool {
+		return intervals[i].Start.Before(intervals[j].Start)
+	})
+
+	merged := make([]Interval, 0, len(intervals))
+	for _, in := range intervals {
+		if n := len(merged); n > 0 && !in.Start.After(merged[n-1].End) {
+			if in.End.After(merged[n-1].End) {
+				merged[n-1].End = in.End
+			}
+			continue
+		}
+		merged = append(merged, in)
+	}
+	return merged
+}
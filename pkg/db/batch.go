@@ -0,0 +1,196 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DefaultBatchSize is the number of events sent per mutation if no chunk size is given
+const DefaultBatchSize = 500
+
+// BatchUpsertEvents upserts the events in chunks of chunkSize, using one upsert block per chunk
+// instead of one transaction per event. The events it changes get a revision of their stored copy, as with UpsertEvent.
+// Only the last of the events with the same event.id is stored, as the upsert blocks of a chunk can't see each other.
+// The returned slice holds the uid of each event, in the same order as the input.
+func (config *DB) BatchUpsertEvents(ctx context.Context, events []Event, chunkSize int, options ...Option) ([]string, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	if chunkSize <= 0 {
+		chunkSize = DefaultBatchSize
+	}
+
+	// index is where each of the events is in unique
+	unique := make([]Event, 0, len(events))
+	index := make([]int, len(events))
+	seen := make(map[string]int)
+	for i, e := range events {
+		if e.UID == "" && e.ID != "" {
+			if j, ok := seen[e.ID]; ok {
+				unique[j] = e
+				index[i] = j
+				continue
+			}
+			seen[e.ID] = len(unique)
+		}
+		index[i] = len(unique)
+		unique = append(unique, e)
+	}
+
+	uniqueUIDs := make([]string, len(unique))
+	for start := 0; start < len(unique); start += chunkSize {
+		end := start + chunkSize
+		if end > len(unique) {
+			end = len(unique)
+		}
+
+		err := config.WithTxn(ctx, func(txn *Txn) error {
+			return config.upsertEventChunk(ctx, txn, unique[start:end], start, uniqueUIDs[start:end])
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	uids := make([]string, len(events))
+	for i := range events {
+		uids[i] = uniqueUIDs[index[i]]
+	}
+	return uids, nil
+}
+
+// chunkRevisions returns the chunk with a revision of the stored copy of each event appended, if storing it would
+// change that copy, as withRevision does for UpsertEvent, reading the stored copies in one query
+func (config *DB) chunkRevisions(ctx context.Context, txn *Txn, chunk []Event, offset int) ([]Event, error) {
+	params := make([]string, 0)
+	blocks := make([]string, 0)
+	variables := make(map[string]string)
+	for i, e := range chunk {
+		n := offset + i
+		switch {
+		case e.UID != "":
+			params = append(params, fmt.Sprintf("$id%d: string", n))
+			blocks = append(blocks, fmt.Sprintf("e%d(func: uid($id%d)) @filter(NOT has(event.deleted_at)) {\n%s\n}", n, n, eventPredicates))
+			variables[fmt.Sprintf("$id%d", n)] = e.UID
+		case e.ID != "":
+			params = append(params, fmt.Sprintf("$id%d: string", n))
+			blocks = append(blocks, fmt.Sprintf("e%d(func: eq(event.id, $id%d)) @filter(NOT has(event.deleted_at)) {\n%s\n}", n, n, eventPredicates))
+			variables[fmt.Sprintf("$id%d", n)] = e.ID
+		}
+	}
+	if len(blocks) == 0 {
+		return chunk, nil
+	}
+
+	q := fmt.Sprintf("query BatchStored(%s) {\n%s\n}", strings.Join(params, ", "), strings.Join(blocks, "\n"))
+	resp, err := config.runQuery(ctx, txn, "BatchUpsertEvents", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	var stored map[string][]Event
+	err = json.Unmarshal(resp.JSON, &stored)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Event, len(chunk))
+	copy(out, chunk)
+	for i := range out {
+		n := offset + i
+		found := stored[fmt.Sprintf("e%d", n)]
+		if len(found) == 0 {
+			continue
+		}
+		if rev := revisionOf(found[0], out[i]); rev != nil {
+			// Each revision is a blank node of its own
+			rev.UID = fmt.Sprintf("_:revision%d", n)
+			out[i].Revisions = append(out[i].Revisions, *rev)
+		}
+	}
+	return out, nil
+}
+
+// upsertEventChunk writes a single chunk of events as one upsert block in the transaction, filling in uids as it goes.
+// Events with an event.id are matched against existing nodes, the rest are created as blank nodes.
+// offset is the position of the chunk within the whole batch, and keeps the blank node names unique.
+func (config *DB) upsertEventChunk(ctx context.Context, txn *Txn, chunk []Event, offset int, uids []string) error {
+	chunk, err := config.chunkRevisions(ctx, txn, chunk, offset)
+	if err != nil {
+		return err
+	}
+	toWrite := make([]Event, len(chunk))
+	restore := make([]string, 0)
+	params := make([]string, 0)
+	blocks := make([]string, 0)
+	variables := make(map[string]string)
+	for i, e := range chunk {
+		n := offset + i
+		if e.UID == "" {
+			if e.ID != "" {
+				params = append(params, fmt.Sprintf("$id%d: string", n))
+				blocks = append(blocks, fmt.Sprintf("v%d as var(func: eq(event.id, $id%d))", n, n))
+				blocks = append(blocks, fmt.Sprintf("u%d(func: uid(v%d)) { uid }", n, n))
+				variables[fmt.Sprintf("$id%d", n)] = e.ID
+				e.UID = fmt.Sprintf("uid(v%d)", n)
+				if e.DeletedAt == nil {
+					restore = append(restore, fmt.Sprintf("uid(v%d) <event.deleted_at> * .", n))
+				}
+			} else {
+				e.UID = fmt.Sprintf("_:event%d", n)
+			}
+		}
+		toWrite[i] = e
+	}
+
+	pb, err := json.Marshal(toWrite)
+	if err != nil {
+		return err
+	}
+
+	req := &Request{
+		Mutations: []*Mutation{{SetJSON: pb}},
+	}
+	if len(restore) > 0 {
+		// As with UpsertEvent, events stored again are restored if they were soft deleted
+		req.Mutations = append(req.Mutations, &Mutation{DelNquads: []byte(strings.Join(restore, "\n"))})
+	}
+	if len(blocks) > 0 {
+		req.Query = fmt.Sprintf("query BatchUpsert(%s) {\n%s\n}", strings.Join(params, ", "), strings.Join(blocks, "\n"))
+		req.Vars = variables
+	}
+
+	assigned, err := config.runRequest(ctx, txn, "BatchUpsertEvents", req)
+	if err != nil {
+		return err
+	}
+
+	// Existing nodes come back in the query blocks, new ones in the assigned uids
+	var existing map[string][]struct {
+		UID string `json:"uid"`
+	}
+	if len(blocks) > 0 {
+		err = json.Unmarshal(assigned.JSON, &existing)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, e := range chunk {
+		n := offset + i
+		switch {
+		case e.UID != "":
+			uids[i] = e.UID
+		case e.ID != "":
+			if found := existing[fmt.Sprintf("u%d", n)]; len(found) > 0 {
+				uids[i] = found[0].UID
+			} else {
+				uids[i] = assigned.UIDs[fmt.Sprintf("uid(v%d)", n)]
+			}
+		default:
+			uids[i] = assigned.UIDs[fmt.Sprintf("event%d", n)]
+		}
+	}
+	return nil
+}
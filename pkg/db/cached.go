@@ -0,0 +1,216 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// CachedClient wraps a Client, caching lookups of locations, modules and people, including those which found nothing.
+// These rarely change but are looked up for every scraped event, so this saves a round trip per event.
+// Writes through the CachedClient invalidate the cache for that type of node, writes made elsewhere
+// are only picked up once the entries expire.
+// Lookups inside a transaction always go to the database.
+// The lookups return copies of the cached nodes, so callers changing them don't change what the next lookup returns,
+// and those read best effort are cached apart from the others, as they may be staler.
+type CachedClient struct {
+	Client
+	locations *lru
+	modules   *lru
+	people    *lru
+}
+
+// CachedClient must always satisfy the Client interface
+var _ Client = (*CachedClient)(nil)
+
+// NewCachedClient wraps the client with an lru cache of the given size per node type, whose entries expire after ttl
+func NewCachedClient(c Client, size int, ttl time.Duration) *CachedClient {
+	return &CachedClient{
+		Client:    c,
+		locations: newLRU(size, ttl),
+		modules:   newLRU(size, ttl),
+		people:    newLRU(size, ttl),
+	}
+}
+
+// GetLocationFromKentSlug returns the cached location, falling back to the database
+func (c *CachedClient) GetLocationFromKentSlug(ctx context.Context, slug string, options ...Option) (*Location, error) {
+	key := readKey(ctx, slug, options)
+	if cached, ok := c.locations.get(key); ok {
+		if cached.(*Location) == nil {
+			return nil, notFound("Location", "location.id", slug)
+		}
+		return copyLocation(cached.(*Location)), nil
+	}
+	loc, err := c.Client.GetLocationFromKentSlug(ctx, slug, options...)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			c.locations.set(key, (*Location)(nil))
+		}
+		return nil, err
+	}
+	c.locations.set(key, copyLocation(loc))
+	return loc, nil
+}
+
+// UpsertLocation upserts the location and invalidates the cached locations
+func (c *CachedClient) UpsertLocation(ctx context.Context, loc Location, options ...Option) (*Response, error) {
+	defer c.locations.purge()
+	return c.Client.UpsertLocation(ctx, loc, options...)
+}
+
+// UpsertLocationTxn upserts the location and invalidates the cached locations once the transaction commits,
+// so that a lookup made in the meantime can't cache the location as it was before
+func (c *CachedClient) UpsertLocationTxn(ctx context.Context, txn *Txn, loc Location, options ...Option) (*Response, error) {
+	resp, err := c.Client.UpsertLocationTxn(ctx, txn, loc, options...)
+	if err == nil {
+		txn.onCommit(c.locations.purge)
+	}
+	return resp, err
+}
+
+// DeleteLocation deletes the location and invalidates the cached locations
+func (c *CachedClient) DeleteLocation(ctx context.Context, loc Location, cascade bool, options ...Option) error {
+	defer c.locations.purge()
+	return c.Client.DeleteLocation(ctx, loc, cascade, options...)
+}
+
+// GetModule returns the cached module, falling back to the database
+func (c *CachedClient) GetModule(ctx context.Context, m Module, options ...Option) (*Module, error) {
+	key := "code:" + m.Code
+	if m.UID != "" {
+		key = "uid:" + m.UID
+	}
+	cacheKey := readKey(ctx, key, options)
+	if cached, ok := c.modules.get(cacheKey); ok {
+		if cached.(*Module) == nil {
+			return nil, notFound("Module", "key", key)
+		}
+		return copyModule(cached.(*Module)), nil
+	}
+	mod, err := c.Client.GetModule(ctx, m, options...)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			c.modules.set(cacheKey, (*Module)(nil))
+		}
+		return nil, err
+	}
+	c.modules.set(cacheKey, copyModule(mod))
+	return mod, nil
+}
+
+// GetModuleFromSDSCode returns the cached module, falling back to the database
+func (c *CachedClient) GetModuleFromSDSCode(ctx context.Context, slug string, options ...Option) (*Module, error) {
+	return c.GetModule(ctx, Module{Code: slug}, options...)
+}
+
+// UpsertModule upserts the module and invalidates the cached modules
+func (c *CachedClient) UpsertModule(ctx context.Context, m Module, options ...Option) (*Response, error) {
+	defer c.modules.purge()
+	return c.Client.UpsertModule(ctx, m, options...)
+}
+
+// UpsertModuleTxn upserts the module and invalidates the cached modules once the transaction commits,
+// so that a lookup made in the meantime can't cache the module as it was before
+func (c *CachedClient) UpsertModuleTxn(ctx context.Context, txn *Txn, m Module, options ...Option) (*Response, error) {
+	resp, err := c.Client.UpsertModuleTxn(ctx, txn, m, options...)
+	if err == nil {
+		txn.onCommit(c.modules.purge)
+	}
+	return resp, err
+}
+
+// GetPerson returns the cached person, falling back to the database
+func (c *CachedClient) GetPerson(ctx context.Context, person Person, options ...Option) (*Person, error) {
+	key := "name:" + person.Name
+	if person.UID != "" {
+		key = "uid:" + person.UID
+	}
+	cacheKey := readKey(ctx, key, options)
+	if cached, ok := c.people.get(cacheKey); ok {
+		if cached.(*Person) == nil {
+			return nil, notFound("Person", "key", key)
+		}
+		return copyPerson(cached.(*Person)), nil
+	}
+	p, err := c.Client.GetPerson(ctx, person, options...)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			c.people.set(cacheKey, (*Person)(nil))
+		}
+		return nil, err
+	}
+	c.people.set(cacheKey, copyPerson(p))
+	return p, nil
+}
+
+// UpsertPerson upserts the person and invalidates the cached people
+func (c *CachedClient) UpsertPerson(ctx context.Context, person Person, options ...Option) (*Response, error) {
+	defer c.people.purge()
+	return c.Client.UpsertPerson(ctx, person, options...)
+}
+
+// UpsertPersonTxn upserts the person and invalidates the cached people once the transaction commits,
+// so that a lookup made in the meantime can't cache the person as it was before
+func (c *CachedClient) UpsertPersonTxn(ctx context.Context, txn *Txn, person Person, options ...Option) (*Response, error) {
+	resp, err := c.Client.UpsertPersonTxn(ctx, txn, person, options...)
+	if err == nil {
+		txn.onCommit(c.people.purge)
+	}
+	return resp, err
+}
+
+// DeletePerson deletes the person and invalidates the cached people
+func (c *CachedClient) DeletePerson(ctx context.Context, person Person, cascade bool, options ...Option) error {
+	defer c.people.purge()
+	return c.Client.DeletePerson(ctx, person, cascade, options...)
+}
+
+// readKey returns the key a lookup is cached under, keeping those read best effort apart from the others.
+// The other options don't change what is read, so they share the same entries.
+func readKey(ctx context.Context, key string, options []Option) string {
+	o := optionsFrom(ctx)
+	for _, opt := range options {
+		opt(&o)
+	}
+	if o.bestEffort {
+		return "best-effort:" + key
+	}
+	return key
+}
+
+// copyLocation returns a copy of the location, including the location it is part of, so neither shares anything with the other
+func copyLocation(l *Location) *Location {
+	if l == nil {
+		return nil
+	}
+	c := *l
+	c.Location.Coords = append([]float64(nil), l.Location.Coords...)
+	c.DType = append([]string(nil), l.DType...)
+	c.PartOf = copyLocation(l.PartOf)
+	if l.ImportedAt != nil {
+		t := *l.ImportedAt
+		c.ImportedAt = &t
+	}
+	return &c
+}
+
+// copyModule returns a copy of the module, which shares nothing with it
+func copyModule(m *Module) *Module {
+	if m == nil {
+		return nil
+	}
+	c := *m
+	c.DType = append([]string(nil), m.DType...)
+	return &c
+}
+
+// copyPerson returns a copy of the person, which shares nothing with them
+func copyPerson(p *Person) *Person {
+	if p == nil {
+		return nil
+	}
+	c := *p
+	c.DType = append([]string(nil), p.DType...)
+	return &c
+}
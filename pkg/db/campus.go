@@ -0,0 +1,33 @@
+package db
+
+import "strings"
+
+// The campuses kent has, as they are stored in location.campus
+const (
+	CampusCanterbury = "canterbury"
+	CampusMedway     = "medway"
+)
+
+// Campuses are every campus a location can be on
+var Campuses = []string{CampusCanterbury, CampusMedway}
+
+// IsCampus returns whether c is one of Campuses
+func IsCampus(c string) bool {
+	for _, campus := range Campuses {
+		if c == campus {
+			return true
+		}
+	}
+	return false
+}
+
+// CampusFromName returns the campus kent names, such as "Canterbury" or "Medway Campus", or "" if it isn't one of Campuses
+func CampusFromName(name string) string {
+	name = strings.ToLower(name)
+	for _, campus := range Campuses {
+		if strings.Contains(name, campus) {
+			return campus
+		}
+	}
+	return ""
+}
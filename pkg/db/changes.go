@@ -0,0 +1,311 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The types of Change
+const (
+	ChangeAdded     = "added"
+	ChangeMoved     = "moved"
+	ChangeUpdated   = "updated"
+	ChangeCancelled = "cancelled"
+	// ChangeScraped isn't a change to an event, but a scrape of a timetable finishing
+	ChangeScraped = "scraped"
+)
+
+// ScrapesTopic is the topic of the ChangeScraped changes
+const ScrapesTopic = "scrapes"
+
+// changePredicates are the predicates of a Change the getters return, with the event as it is now
+const changePredicates = `uid
+	change.seq
+	change.type
+	change.fields
+	change.topic
+	change.at
+	change.event {
+		` + eventPredicates + `
+	}
+	change.scrape {
+		uid
+		scrape.id
+		scrape.last_scraped
+	}`
+
+// ChangeFilter narrows the changes ListChanges returns
+type ChangeFilter struct {
+	// After and Before only return the changes with a Seq after and before them, when they are set
+	After  int64
+	Before int64
+	// Topics only returns the changes to any of them, every change if it is empty
+	Topics []string
+	// EventsOnly leaves out the ChangeScraped changes
+	EventsOnly bool
+}
+
+// ChangeOf returns the change storing the event makes, described by its diff, or nil if it doesn't change anything.
+// The stored event is the one the diff is against, nil if it is created. The Event of the change is left for the caller
+// to point at the stored event, as a created event has no uid yet.
+func ChangeOf(stored *Event, event Event, diff EventDiff) *Change {
+	if diff.Empty() {
+		return nil
+	}
+	if diff.Created || stored == nil {
+		return &Change{Type: ChangeAdded, Topics: ChangeTopics(event)}
+	}
+	change := &Change{Type: ChangeUpdated, Changes: diff.Changes}
+	for _, f := range diff.Changes {
+		switch f.Predicate {
+		case "event.start_date", "event.end_date", "event.location":
+			change.Type = ChangeMoved
+		}
+	}
+	// Whoever followed the old modules or locations hears about the change too, such as a room's screen losing the event
+	change.Topics = ChangeTopics(*stored, event)
+	return change
+}
+
+// ChangeTopics returns the distinct topics of the modules and locations of the events,
+// named "module:<code>" and "location:<id>"
+func ChangeTopics(events ...Event) []string {
+	topics := make([]string, 0)
+	seen := make(map[string]bool)
+	add := func(topic string) {
+		if !seen[topic] {
+			seen[topic] = true
+			topics = append(topics, topic)
+		}
+	}
+	for _, e := range events {
+		for _, m := range e.PartOfModule {
+			if m.Code != "" {
+				add("module:" + m.Code)
+			}
+		}
+		for _, l := range e.Location {
+			if l.ID != "" {
+				add("location:" + l.ID)
+			}
+		}
+	}
+	return topics
+}
+
+// RecordChanges stores the changes in a single transaction, numbering them on from the latest change recorded.
+// change.seq is an upsert index, so transactions recording changes at the same time conflict and are retried,
+// so the changes are committed in the order of their Seq and a reader after the latest Seq it read never misses any.
+func (config *DB) RecordChanges(ctx context.Context, changes []Change, options ...Option) error {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	if len(changes) == 0 {
+		return nil
+	}
+	return config.WithTxn(ctx, func(txn *Txn) error {
+		seq, err := config.latestChangeSeq(ctx, txn)
+		if err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		nodes := make([]Change, len(changes))
+		for i, c := range changes {
+			seq++
+			c.UID = "_:change" + strconv.Itoa(i)
+			c.Seq = seq
+			c.DType = []string{"Change"}
+			if c.At == nil {
+				c.At = &now
+			}
+			if len(c.Changes) > 0 {
+				fields, err := json.Marshal(c.Changes)
+				if err != nil {
+					return err
+				}
+				c.Fields = string(fields)
+			}
+			nodes[i] = c
+		}
+		req, err := mutationRequest(nodes)
+		if err != nil {
+			return err
+		}
+		_, err = config.runRequest(ctx, txn, "RecordChanges", req)
+		return err
+	})
+}
+
+// latestChangeSeq returns the Seq of the latest change recorded, or 0 if there aren't any
+func (config *DB) latestChangeSeq(ctx context.Context, txn *Txn) (int64, error) {
+	latest, err := config.getLatestChange(ctx, txn, "uid\n\tchange.seq")
+	if errors.Is(err, ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return latest.Seq, nil
+}
+
+// GetLatestChange returns the latest change recorded, or an error wrapping ErrNotFound if there aren't any
+func (config *DB) GetLatestChange(ctx context.Context, options ...Option) (*Change, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+	return config.getLatestChange(ctx, config.readTxn(ctx), changePredicates)
+}
+
+func (config *DB) getLatestChange(ctx context.Context, txn *Txn, predicates string) (*Change, error) {
+	q := fmt.Sprintf(
+		`{
+			change(func: has(change.seq), orderdesc: change.seq, first: 1) @filter(type(Change)) {
+				%s
+			}
+		}
+	`, predicates)
+	resp, err := config.runQuery(ctx, txn, "GetLatestChange", q, nil)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Change []Change `json:"change"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Change) == 0 {
+		return nil, notFound("Change", "type", "Change")
+	}
+	return &r.Change[0], nil
+}
+
+// ListChanges returns a page of the changes the filter lets through, oldest first or newest first if opts is Descending.
+// Only First and Descending are used of opts, the changes are paged through with the filter's After and Before.
+func (config *DB) ListChanges(ctx context.Context, filter ChangeFilter, opts ListOptions, options ...Option) ([]Change, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	variables := make(map[string]string)
+	variables["$first"] = strconv.Itoa(opts.first())
+	params := []string{"$first: int"}
+	filters := []string{"type(Change)"}
+	root := "has(change.seq)"
+	if filter.After > 0 {
+		root = "gt(change.seq, $after)"
+		params = append(params, "$after: int")
+		variables["$after"] = strconv.FormatInt(filter.After, 10)
+	}
+	if filter.Before > 0 {
+		filters = append(filters, "lt(change.seq, $before)")
+		params = append(params, "$before: int")
+		variables["$before"] = strconv.FormatInt(filter.Before, 10)
+	}
+	if len(filter.Topics) > 0 {
+		topics := make([]string, len(filter.Topics))
+		for i, topic := range filter.Topics {
+			name := "$topic" + strconv.Itoa(i)
+			topics[i] = "eq(change.topic, " + name + ")"
+			params = append(params, name+": string")
+			variables[name] = topic
+		}
+		filters = append(filters, "("+strings.Join(topics, " OR ")+")")
+	}
+	if filter.EventsOnly {
+		filters = append(filters, "NOT eq(change.type, \""+ChangeScraped+"\")")
+	}
+	order := "orderasc"
+	if opts.Descending {
+		order = "orderdesc"
+	}
+
+	txn := config.readTxn(ctx)
+	q := fmt.Sprintf(
+		`query ListChanges(%s) {
+			changes(func: %s, %s: change.seq, first: $first) @filter(%s) {
+				%s
+			}
+		}
+	`, strings.Join(params, ", "), root, order, strings.Join(filters, " AND "), changePredicates)
+	resp, err := config.runQuery(ctx, txn, "ListChanges", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Changes []Change `json:"changes"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	for i := range r.Changes {
+		if r.Changes[i].Fields == "" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(r.Changes[i].Fields), &r.Changes[i].Changes); err != nil {
+			return nil, err
+		}
+	}
+	if r.Changes == nil {
+		return make([]Change, 0), nil
+	}
+	return r.Changes, nil
+}
+
+// DeleteChangesBefore removes up to limit of the changes recorded before the time, oldest first,
+// returning how many were removed, so they can be kept for a while without piling up forever
+func (config *DB) DeleteChangesBefore(ctx context.Context, before time.Time, limit int, options ...Option) (int, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+	q :=
+		`query OldChanges($before: string, $first: int) {
+			changes(func: lt(change.at, $before), orderasc: change.at, first: $first) @filter(type(Change)) {
+				uid
+			}
+		}
+	`
+	variables := make(map[string]string)
+	variables["$before"] = formatTime(before)
+	variables["$first"] = strconv.Itoa(ListOptions{First: limit}.first())
+	resp, err := config.runQuery(ctx, txn, "DeleteChangesBefore", q, variables)
+	if err != nil {
+		return 0, err
+	}
+	type Root struct {
+		Changes []struct {
+			UID string `json:"uid"`
+		} `json:"changes"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return 0, err
+	}
+	if len(r.Changes) == 0 {
+		return 0, nil
+	}
+	nquads := make([]string, 0, len(r.Changes))
+	for _, c := range r.Changes {
+		nquads = append(nquads, fmt.Sprintf("<%s> * * .", c.UID))
+	}
+	req := &Request{
+		Mutations: []*Mutation{{DelNquads: []byte(strings.Join(nquads, "\n"))}},
+	}
+	_, err = config.commit(ctx, "DeleteChangesBefore", req)
+	if err != nil {
+		return 0, err
+	}
+	return len(r.Changes), nil
+}
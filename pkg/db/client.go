@@ -0,0 +1,147 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// Client is the set of database operations used by the api and the scraper.
+// DB is the production implementation backed by dgraph, tests can swap in a fake.
+// Every operation takes Options tuning how that one call is run, such as WithTimeout.
+type Client interface {
+	// Setup installs the schema into the database
+	Setup(ctx context.Context, options ...Option) error
+	// CheckVersion returns the version of the database, it is what Ping uses to check the database is up
+	CheckVersion(ctx context.Context, options ...Option) (string, error)
+	// CheckSchema returns the predicates and types of Schema missing from the database, empty once Setup has run
+	CheckSchema(ctx context.Context, options ...Option) ([]string, error)
+
+	// WithTxn runs fn in a single transaction, for use with the ...Txn variants below
+	WithTxn(ctx context.Context, fn func(txn *Txn) error, options ...Option) error
+
+	GetScrape(ctx context.Context, scrape Scrape, options ...Option) (*Scrape, error)
+	GetScrapeTxn(ctx context.Context, txn *Txn, scrape Scrape, options ...Option) (*Scrape, error)
+	UpsertScrape(ctx context.Context, scrape Scrape, options ...Option) (*Response, error)
+	UpsertScrapeTxn(ctx context.Context, txn *Txn, scrape Scrape, options ...Option) (*Response, error)
+	DeleteScrape(ctx context.Context, scrape Scrape, cascade bool, options ...Option) error
+	GetOldestScrape(ctx context.Context, options ...Option) (*Scrape, error)
+	GetLatestScrape(ctx context.Context, options ...Option) (*Scrape, error)
+	ListScrapes(ctx context.Context, opts ListOptions, options ...Option) ([]Scrape, error)
+	GetScrapesOlderThan(ctx context.Context, age time.Duration, limit int, options ...Option) ([]Scrape, error)
+	GetScrapesSince(ctx context.Context, since time.Time, limit int, options ...Option) ([]Scrape, error)
+	PurgeStaleEvents(ctx context.Context, scrape Scrape, currentEventIDs []string, from, to time.Time, options ...Option) ([]Event, error)
+	UpsertScrapeJob(ctx context.Context, job ScrapeJob, options ...Option) (*Response, error)
+	GetScrapeJob(ctx context.Context, id string, options ...Option) (*ScrapeJob, error)
+	GetQueuedScrapeJobs(ctx context.Context, limit int, options ...Option) ([]ScrapeJob, error)
+	GetModuleScrapeIDs(ctx context.Context, moduleCode string, options ...Option) ([]int, error)
+
+	RecordChanges(ctx context.Context, changes []Change, options ...Option) error
+	GetLatestChange(ctx context.Context, options ...Option) (*Change, error)
+	ListChanges(ctx context.Context, filter ChangeFilter, opts ListOptions, options ...Option) ([]Change, error)
+	DeleteChangesBefore(ctx context.Context, before time.Time, limit int, options ...Option) (int, error)
+
+	UpsertWebhook(ctx context.Context, webhook Webhook, options ...Option) (*Response, error)
+	GetWebhook(ctx context.Context, id string, options ...Option) (*Webhook, error)
+	ListWebhooks(ctx context.Context, options ...Option) ([]Webhook, error)
+	DeleteWebhook(ctx context.Context, webhook Webhook, options ...Option) error
+	ClaimWebhookDelivery(ctx context.Context, delivery WebhookDelivery, options ...Option) (*WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, delivery WebhookDelivery, options ...Option) (*Response, error)
+	ListWebhookDeliveries(ctx context.Context, webhook Webhook, limit int, options ...Option) ([]WebhookDelivery, error)
+	DeleteWebhookDeliveriesBefore(ctx context.Context, before time.Time, limit int, options ...Option) (int, error)
+
+	UpsertTerm(ctx context.Context, term Term, options ...Option) (*Response, error)
+	ListTerms(ctx context.Context, year int, options ...Option) ([]Term, error)
+	SetUserTimetable(ctx context.Context, user User, options ...Option) (*Response, error)
+	GetUser(ctx context.Context, subject string, options ...Option) (*User, error)
+	GetUserEvents(ctx context.Context, subject string, from, to time.Time, options ...Option) ([]Event, error)
+	SetUserNotifications(ctx context.Context, user User, options ...Option) (*Response, error)
+	GetUserByUnsubscribeHash(ctx context.Context, hash string, options ...Option) (*User, error)
+	ListUsersToNotify(ctx context.Context, moduleCodes []string, options ...Option) ([]User, error)
+	ClaimNotification(ctx context.Context, change int64, subject string, options ...Option) (bool, error)
+	AcquireLease(ctx context.Context, name, holder string, ttl time.Duration, options ...Option) (*Lease, error)
+	SetLeaseCursor(ctx context.Context, name, holder string, cursor int64, options ...Option) error
+
+	GetEvent(ctx context.Context, event Event, options ...Option) (*Event, error)
+	GetEventTxn(ctx context.Context, txn *Txn, event Event, options ...Option) (*Event, error)
+	UpsertEvent(ctx context.Context, event Event, options ...Option) (*Response, error)
+	UpsertEventTxn(ctx context.Context, txn *Txn, event Event, options ...Option) (*Response, error)
+	UpsertEventIfNewer(ctx context.Context, event Event, scrape Scrape, options ...Option) (bool, error)
+	GetEventHistory(ctx context.Context, eventID string, options ...Option) ([]Revision, error)
+	MergeEvent(ctx context.Context, event Event, clear []string, options ...Option) (*Event, error)
+	DiffEvent(ctx context.Context, incoming Event, options ...Option) (*EventDiff, error)
+	BatchUpsertEvents(ctx context.Context, events []Event, chunkSize int, options ...Option) ([]string, error)
+	ListEvents(ctx context.Context, opts ListOptions, options ...Option) ([]Event, error)
+	ListEventsAfter(ctx context.Context, cursor EventCursor, opts ListOptions, options ...Option) ([]Event, error)
+	GetEventsBetween(ctx context.Context, start, end time.Time, opts ListOptions, options ...Option) ([]Event, error)
+	GetEventsBetweenAfter(ctx context.Context, start, end time.Time, cursor EventCursor, opts ListOptions, options ...Option) ([]Event, error)
+	GetEventsDuring(ctx context.Context, from, to time.Time, building string, options ...Option) ([]Event, error)
+	SearchEvents(ctx context.Context, query string, opts ListOptions, options ...Option) ([]EventMatch, error)
+	GetEventsByModule(ctx context.Context, moduleCode string, options ...Option) ([]Event, error)
+	GetEventsByModules(ctx context.Context, moduleCodes []string, from, to time.Time, options ...Option) ([]Event, error)
+	GetEventsByLocation(ctx context.Context, locationID string, from, to time.Time, options ...Option) ([]Event, error)
+	GetEventsByOrganiser(ctx context.Context, person Person, from, to time.Time, opts ListOptions, options ...Option) ([]Event, error)
+	GetEventsByOrganiserAfter(ctx context.Context, person Person, from, to time.Time, cursor EventCursor, opts ListOptions, options ...Option) ([]Event, error)
+	DeleteEvent(ctx context.Context, event Event, cascade bool, options ...Option) error
+	SoftDeleteEvent(ctx context.Context, event Event, options ...Option) error
+	RestoreEvent(ctx context.Context, event Event, options ...Option) error
+	ListDeletedEvents(ctx context.Context, opts ListOptions, options ...Option) ([]Event, error)
+	DeleteEventsDeletedBefore(ctx context.Context, before time.Time, limit int, options ...Option) (int, error)
+	AddAttendee(ctx context.Context, event Event, person Person, options ...Option) error
+	RemoveAttendee(ctx context.Context, event Event, person Person, options ...Option) error
+	GetEventAttendees(ctx context.Context, event Event, options ...Option) ([]Person, error)
+
+	UpsertSeries(ctx context.Context, series Series, options ...Option) (*Response, error)
+	GetSeries(ctx context.Context, series Series, options ...Option) (*Series, error)
+	GetSeriesOccurrences(ctx context.Context, series Series, options ...Option) ([]Event, error)
+
+	GetLocationFromKentSlug(ctx context.Context, slug string, options ...Option) (*Location, error)
+	GetLocationFromKentSlugTxn(ctx context.Context, txn *Txn, slug string, options ...Option) (*Location, error)
+	UpsertLocation(ctx context.Context, loc Location, options ...Option) (*Response, error)
+	UpsertLocationTxn(ctx context.Context, txn *Txn, loc Location, options ...Option) (*Response, error)
+	ListLocations(ctx context.Context, opts ListOptions, options ...Option) ([]Location, error)
+	SearchLocations(ctx context.Context, query string, options ...Option) ([]LocationMatch, error)
+	GetBuildingRooms(ctx context.Context, building Location, options ...Option) ([]Location, error)
+	GetLocationAncestors(ctx context.Context, loc Location, options ...Option) ([]Location, error)
+	GetLocationsNear(ctx context.Context, point Loc, radius float64, options ...Option) ([]Location, error)
+	GetEventsNear(ctx context.Context, point Loc, radius float64, from, to time.Time, options ...Option) ([]EventNear, error)
+	GetFreeLocations(ctx context.Context, from, to time.Time, building string, options ...Option) ([]Location, error)
+	DeleteLocation(ctx context.Context, loc Location, cascade bool, options ...Option) error
+
+	GetModule(ctx context.Context, m Module, options ...Option) (*Module, error)
+	GetModuleTxn(ctx context.Context, txn *Txn, m Module, options ...Option) (*Module, error)
+	GetModuleFromSDSCode(ctx context.Context, slug string, options ...Option) (*Module, error)
+	SearchModules(ctx context.Context, query string, options ...Option) ([]ModuleMatch, error)
+	ListModules(ctx context.Context, opts ListOptions, options ...Option) ([]Module, error)
+	UpsertModule(ctx context.Context, m Module, options ...Option) (*Response, error)
+	UpsertModuleTxn(ctx context.Context, txn *Txn, m Module, options ...Option) (*Response, error)
+
+	GetPerson(ctx context.Context, person Person, options ...Option) (*Person, error)
+	ListPeople(ctx context.Context, name string, opts ListOptions, options ...Option) ([]Person, error)
+	GetPersonTxn(ctx context.Context, txn *Txn, person Person, options ...Option) (*Person, error)
+	UpsertPerson(ctx context.Context, person Person, options ...Option) (*Response, error)
+	UpsertPersonTxn(ctx context.Context, txn *Txn, person Person, options ...Option) (*Response, error)
+	DeletePerson(ctx context.Context, person Person, cascade bool, options ...Option) error
+	GetPersonFreeBusy(ctx context.Context, personUID string, from, to time.Time, options ...Option) ([]Interval, error)
+
+	CountNodesWithField(ctx context.Context, f string, options ...Option) (*int, error)
+	CountEvents(ctx context.Context, options ...Option) (*int, error)
+	CountLiveEvents(ctx context.Context, options ...Option) (*int, error)
+	CountFilteredEvents(ctx context.Context, opts ListOptions, options ...Option) (*int, error)
+	CountEventsBetween(ctx context.Context, start, end time.Time, opts ListOptions, options ...Option) (*int, error)
+	CountEventsByOrganiser(ctx context.Context, person Person, from, to time.Time, opts ListOptions, options ...Option) (*int, error)
+	CountFilteredLocations(ctx context.Context, opts ListOptions, options ...Option) (*int, error)
+	CountLocations(ctx context.Context, options ...Option) (*int, error)
+	CountModules(ctx context.Context, options ...Option) (*int, error)
+	CountPeople(ctx context.Context, name string, options ...Option) (*int, error)
+	CountScrapes(ctx context.Context, options ...Option) (*int, error)
+	GetEventCountsByModule(ctx context.Context, limit int, options ...Option) ([]ModuleEventCount, error)
+	GetEventCountsByLocation(ctx context.Context, limit int, options ...Option) ([]LocationEventCount, error)
+	GetEventsPerDay(ctx context.Context, from, to time.Time, options ...Option) ([]DayEventCount, error)
+	GetBuildingOccupancy(ctx context.Context, building string, from, to time.Time, options ...Option) (*Occupancy, error)
+
+	// ReadOnly performs a raw read only query, returning the json response
+	ReadOnly(ctx context.Context, q string, options ...Option) ([]byte, error)
+}
+
+// DB must always satisfy the Client interface
+var _ Client = (*DB)(nil)
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// UpsertEventIfNewer is UpsertEvent, but only writes the event if scrape is newer than the stored copy of it,
+// going by scrape.last_scraped. This stops an old, slow scrape run from overwriting what a later run already stored.
+// The scrape is matched on its Uid, or on scrape.id if it has none, and must have LastScraped set.
+// A scrape which hasn't been stored yet counts as newer. It returns whether the event was written.
+func (config *DB) UpsertEventIfNewer(ctx context.Context, event Event, scrape Scrape, options ...Option) (bool, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	if scrape.LastScraped == nil {
+		return false, errors.New("UpsertEventIfNewer needs a scrape with LastScraped set")
+	}
+	var scrapeParam, scrapeKey, scrapeFunc string
+	switch {
+	case scrape.UID != "":
+		scrapeParam, scrapeKey, scrapeFunc = "$scrape: string", scrape.UID, "uid($scrape)"
+	case scrape.ID != 0:
+		scrapeParam, scrapeKey, scrapeFunc = "$scrape: int", strconv.Itoa(scrape.ID), "eq(scrape.id, $scrape)"
+	default:
+		return false, errors.New("UpsertEventIfNewer needs a scrape with a Uid or an ID")
+	}
+
+	var written bool
+	err := config.WithTxn(ctx, func(txn *Txn) error {
+		ev, err := config.withRevision(ctx, txn, event)
+		if err != nil {
+			return err
+		}
+		req, err := eventRequest(ev)
+		if err != nil {
+			return err
+		}
+
+		params := []string{"$scraped: string", scrapeParam}
+		req.Vars = map[string]string{"$scraped": formatTime(*scrape.LastScraped), "$scrape": scrapeKey}
+		blocks := []string{
+			fmt.Sprintf("s as var(func: %s) @filter(ge(scrape.last_scraped, $scraped))", scrapeFunc),
+			"stale(func: uid(s)) { uid }",
+		}
+		// eventRequest only keys the event on event.id when it has no uid, binding it to v
+		if event.UID == "" && event.ID != "" {
+			params = append(params, "$key: string")
+			req.Vars["$key"] = event.ID
+			blocks = append(blocks, "v as var(func: eq(event.id, $key))")
+		}
+		req.Query = fmt.Sprintf("query UpsertIfNewer(%s) {\n%s\n}", strings.Join(params, ", "), strings.Join(blocks, "\n"))
+		// A stored scrape at least as recent as this one means a later run has already written the event
+		for _, mu := range req.Mutations {
+			mu.Cond = "@if(eq(len(s), 0))"
+		}
+
+		resp, err := config.runRequest(ctx, txn, "UpsertEventIfNewer", req)
+		if err != nil {
+			return err
+		}
+		type Root struct {
+			Stale []struct {
+				UID string `json:"uid"`
+			} `json:"stale"`
+		}
+
+		var r Root
+		err = json.Unmarshal(resp.JSON, &r)
+		if err != nil {
+			return err
+		}
+		written = len(r.Stale) == 0
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return written, nil
+}
@@ -2,45 +2,231 @@ package db
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"sync"
+	"time"
 
-	"github.com/dgraph-io/dgo/v200"
-	"github.com/dgraph-io/dgo/v200/protos/api"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/encoding/gzip"
 )
 
-// ConfigDB is the configuration for DGraph
-type ConfigDB struct {
-	DBClient *dgo.Dgraph
+// DB is the connection to a dgraph cluster, which all of the database operations hang off.
+// It owns a pool of gRPC connections, which are closed by Close.
+type DB struct {
+	// MaxAttempts is how many times a mutation is tried if its transaction is aborted
+	MaxAttempts int
+	// RetryBackoff is the delay before retrying an aborted mutation, doubling with each attempt
+	RetryBackoff time.Duration
+	// Metrics records the latency and result of every operation, see Instrument. Nothing is recorded if it is nil.
+	Metrics *Metrics
+	// TracerProvider creates the spans around every call to dgraph, the global provider is used if it is nil
+	TracerProvider trace.TracerProvider
+
+	client    dgraphClient
+	conns     []*grpc.ClientConn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// ConfigDB is the old name of DB.
+//
+// Deprecated: use DB.
+type ConfigDB = DB
+
+// DefaultHealthCheckInterval is how often the connections are checked if ConnectOptions.HealthCheckInterval isn't set
+const DefaultHealthCheckInterval = 10 * time.Second
+
+// ErrClosed is returned by Wait after the DB has been closed
+var ErrClosed = errors.New("The database connection is closed")
+
+// ConnectOptions describes how to connect to a dgraph cluster
+type ConnectOptions struct {
+	// CACertFile is the PEM file used to verify the server, enabling TLS when set
+	CACertFile string
+	// CertFile and KeyFile are the PEM client certificate and key, for clusters requiring mutual TLS
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the name the server certificate is verified against
+	ServerName string
+	// User and Password are the ACL credentials to log in with, logging in is skipped if User is empty
+	User     string
+	Password string
+	// PoolSize is how many gRPC connections are opened, requests are spread across them. It defaults to 1.
+	PoolSize int
+	// HealthCheckInterval is how often connections which failed are told to reconnect straight away,
+	// rather than waiting out gRPC's backoff. It defaults to DefaultHealthCheckInterval, and a negative value disables it.
+	HealthCheckInterval time.Duration
+	// DialOptions are appended to the default gRPC dial options
+	DialOptions []grpc.DialOption
 }
 
 // NewClient sets up a gRPC and returns a new dgraph connection
-func NewClient(url string) (*ConfigDB, error) {
+func NewClient(url string) (*DB, error) {
+	return Connect(url, ConnectOptions{})
+}
+
+// Connect dials the dgraph alpha at addr, over TLS if a CA certificate is given,
+// and logs in with the ACL credentials if there are any.
+// The DB should be closed once it is no longer needed.
+func Connect(addr string, opts ConnectOptions) (*DB, error) {
+	transport, err := opts.transport()
+	if err != nil {
+		return nil, err
+	}
+
 	// Dial a gRPC connection. The address to dial to can be configured when
 	// setting up the dgraph cluster.
-	dialOpts := append([]grpc.DialOption{},
-		grpc.WithInsecure(),
-		grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)))
-	d, err := grpc.Dial(url, dialOpts...)
+	dialOpts := append([]grpc.DialOption{
+		transport,
+		grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name))},
+		opts.DialOptions...)
+
+	poolSize := opts.PoolSize
+	if poolSize <= 0 {
+		poolSize = 1
+	}
+	config := &DB{
+		MaxAttempts:  DefaultMaxAttempts,
+		RetryBackoff: DefaultRetryBackoff,
+		done:         make(chan struct{}),
+	}
+	for i := 0; i < poolSize; i++ {
+		d, err := grpc.Dial(addr, dialOpts...)
+		if err != nil {
+			config.Close()
+			return nil, err
+		}
+		config.conns = append(config.conns, d)
+	}
+	config.client = newDgraphClient(config.conns)
+
+	if opts.User != "" {
+		err = config.client.login(context.Background(), opts.User, opts.Password)
+		if err != nil {
+			config.Close()
+			return nil, err
+		}
+	}
+
+	interval := opts.HealthCheckInterval
+	if interval == 0 {
+		interval = DefaultHealthCheckInterval
+	}
+	if interval > 0 {
+		go config.watchConnections(interval)
+	}
+
+	return config, nil
+}
 
+// Close stops the health checks and closes every connection in the pool
+func (config *DB) Close() error {
+	var err error
+	config.closeOnce.Do(func() {
+		close(config.done)
+		for _, c := range config.conns {
+			if cerr := c.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	})
+	return err
+}
+
+// Healthy returns whether at least one of the connections in the pool is ready to use
+func (config *DB) Healthy() bool {
+	for _, c := range config.conns {
+		if c.GetState() == connectivity.Ready {
+			return true
+		}
+	}
+	return false
+}
+
+// Reconnect makes the connections which have failed try to reconnect now, instead of after their backoff.
+// It is useful after dgraph has been restarted.
+func (config *DB) Reconnect() {
+	for _, c := range config.conns {
+		if c.GetState() == connectivity.TransientFailure {
+			c.ResetConnectBackoff()
+		}
+	}
+}
+
+// Wait blocks until one of the connections is ready, reconnecting failed ones as it goes,
+// or until ctx is done or the DB is closed.
+func (config *DB) Wait(ctx context.Context) error {
+	for !config.Healthy() {
+		select {
+		case <-config.done:
+			return ErrClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+			config.Reconnect()
+		}
+	}
+	return nil
+}
+
+// watchConnections calls Reconnect every interval until the DB is closed
+func (config *DB) watchConnections(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-config.done:
+			return
+		case <-ticker.C:
+			config.Reconnect()
+		}
+	}
+}
+
+// transport returns the dial option for a TLS connection if a CA certificate is configured, and an insecure one otherwise
+func (opts ConnectOptions) transport() (grpc.DialOption, error) {
+	if opts.CACertFile == "" {
+		if opts.CertFile != "" || opts.KeyFile != "" {
+			return nil, errors.New("A CA certificate is required to use a client certificate")
+		}
+		return grpc.WithInsecure(), nil
+	}
+
+	ca, err := ioutil.ReadFile(opts.CACertFile)
 	if err != nil {
 		return nil, err
 	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("No certificates found in " + opts.CACertFile)
+	}
 
-	db := dgo.NewDgraphClient(
-		api.NewDgraphClient(d),
-	)
+	tlsConfig := &tls.Config{
+		RootCAs:    pool,
+		ServerName: opts.ServerName,
+	}
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
 
-	return &ConfigDB{
-		DBClient: db,
-	}, nil
+	return grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)), nil
 }
 
 // Setup initiates the schema into the database
-func (config *ConfigDB) Setup() error {
-	// Install a schema into dgraph. Accounts have a `name` and a `balance`.
-	err := config.DBClient.Alter(context.Background(), &api.Operation{
-		Schema: Schema,
-	})
+func (config *DB) Setup(ctx context.Context, options ...Option) error {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	_, err := config.ApplySchema(ctx)
 	return err
 }
@@ -0,0 +1,325 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// knownPredicates is every predicate declared in Schema.
+// Predicates can't be passed as query variables, so anything interpolated into a query is checked against this first.
+var knownPredicates = func() map[string]bool {
+	preds := make(map[string]bool)
+	re := regexp.MustCompile(`(?m)^([\w.]+):`)
+	for _, match := range re.FindAllStringSubmatch(Schema, -1) {
+		preds[match[1]] = true
+	}
+	return preds
+}()
+
+// IsKnownPredicate returns whether the predicate is part of the database schema
+func IsKnownPredicate(f string) bool {
+	return knownPredicates[f]
+}
+
+// CountNodesWithField returns the number of nodes which contain the specified field
+// this is a good indicator of the number of nodes of a certain type
+// the field must be one of the predicates in the schema, otherwise an error is returned
+func (config *DB) CountNodesWithField(ctx context.Context, f string, options ...Option) (*int, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	if !IsKnownPredicate(f) {
+		return nil, fmt.Errorf("Unknown predicate %q", f)
+	}
+
+	txn := config.readTxn(ctx)
+
+	q := fmt.Sprintf(
+		`query Count {
+			nodeCount(func: has(%s)) {
+				nodeCount: count(uid)
+			}
+		}
+		`, f)
+
+	resp, err := config.runQuery(ctx, txn, "CountNodesWithField", q, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	type Root struct {
+		NodeCount []struct {
+			NodeCount int `json:"nodeCount"`
+		} `json:"nodeCount"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	count := 0
+	if len(r.NodeCount) > 0 {
+		count = r.NodeCount[0].NodeCount
+	}
+	return &count, nil
+}
+
+// CountEvents returns the number of events in the database
+func (config *DB) CountEvents(ctx context.Context, options ...Option) (*int, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+	return config.CountNodesWithField(ctx, "event.id")
+}
+
+// CountLocations returns the number of locations in the database
+func (config *DB) CountLocations(ctx context.Context, options ...Option) (*int, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+	return config.CountNodesWithField(ctx, "location.id")
+}
+
+// CountModules returns the number of modules in the database
+func (config *DB) CountModules(ctx context.Context, options ...Option) (*int, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+	return config.CountNodesWithField(ctx, "module.code")
+}
+
+// CountPeople returns the number of people, only counting the ones ListPeople would match if name is set
+func (config *DB) CountPeople(ctx context.Context, name string, options ...Option) (*int, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+
+	params, filter := peopleFilter(name)
+	if params != "" {
+		params = "(" + strings.TrimPrefix(params, ", ") + ")"
+	}
+	q := fmt.Sprintf(
+		`query CountPeople%s {
+			people(func: type(Person)) %s {
+				total: count(uid)
+			}
+		}
+	`, params, filter)
+	variables := make(map[string]string)
+	if name != "" {
+		variables["$name"] = name
+	}
+
+	resp, err := config.runQuery(ctx, txn, "CountPeople", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		People []struct {
+			Total int `json:"total"`
+		} `json:"people"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	count := 0
+	if len(r.People) > 0 {
+		count = r.People[0].Total
+	}
+	return &count, nil
+}
+
+// CountScrapes returns the number of scrapes in the database
+func (config *DB) CountScrapes(ctx context.Context, options ...Option) (*int, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+	return config.CountNodesWithField(ctx, "scrape.id")
+}
+
+// CountLiveEvents returns the number of events which haven't been soft deleted, which are the ones ListEvents pages through
+func (config *DB) CountLiveEvents(ctx context.Context, options ...Option) (*int, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+
+	q := `query CountLiveEvents {
+			live(func: type(Event)) @filter(NOT has(event.deleted_at)) {
+				total: count(uid)
+			}
+		}
+	`
+
+	resp, err := config.runQuery(ctx, txn, "CountLiveEvents", q, nil)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Live []struct {
+			Total int `json:"total"`
+		} `json:"live"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	count := 0
+	if len(r.Live) > 0 {
+		count = r.Live[0].Total
+	}
+	return &count, nil
+}
+
+// CountFilteredEvents returns the number of events which haven't been soft deleted in at least one of the locations
+// the Accessible and Campus of the options leave in, which are the ones ListEvents pages through with them
+func (config *DB) CountFilteredEvents(ctx context.Context, opts ListOptions, options ...Option) (*int, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	block, filter, err := opts.locatedEvents()
+	if err != nil {
+		return nil, err
+	}
+	txn := config.readTxn(ctx)
+	q := fmt.Sprintf(`query CountFilteredEvents {
+			%s
+			total(func: type(Event)) @filter(NOT has(event.deleted_at)%s) {
+				count: count(uid)
+			}
+		}
+	`, block, filter)
+
+	return config.countQuery(ctx, txn, "CountFilteredEvents", q, nil)
+}
+
+// CountEventsBetween returns the number of events GetEventsBetween pages through with the options
+func (config *DB) CountEventsBetween(ctx context.Context, start, end time.Time, opts ListOptions, options ...Option) (*int, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	block, filter, err := opts.locatedEvents()
+	if err != nil {
+		return nil, err
+	}
+	txn := config.readTxn(ctx)
+	q := fmt.Sprintf(`query CountEventsBetween($start: string, $end: string) {
+			%s
+			total(func: between(event.start_date, $start, $end)) @filter(type(Event) AND NOT has(event.deleted_at)%s) {
+				count: count(uid)
+			}
+		}
+	`, block, filter)
+	variables := map[string]string{
+		"$start": formatTime(start),
+		"$end":   formatTime(end),
+	}
+
+	return config.countQuery(ctx, txn, "CountEventsBetween", q, variables)
+}
+
+// CountEventsByOrganiser returns the number of events GetEventsByOrganiser pages through with the options
+func (config *DB) CountEventsByOrganiser(ctx context.Context, person Person, from, to time.Time, opts ListOptions, options ...Option) (*int, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	block, filter, err := opts.locatedEvents()
+	if err != nil {
+		return nil, err
+	}
+	txn := config.readTxn(ctx)
+	root, key := organiserRoot(person)
+	q := fmt.Sprintf(`query CountEventsByOrganiser($key: string, $from: string, $to: string) {
+			%s
+			person(func: %s) @filter(type(Person)) {
+				count: count(~event.organiser @filter(type(Event) AND NOT has(event.deleted_at) AND le(event.start_date, $to) AND ge(event.end_date, $from)%s))
+			}
+		}
+	`, block, root, filter)
+	variables := map[string]string{
+		"$key":  key,
+		"$from": formatTime(from),
+		"$to":   formatTime(to),
+	}
+
+	resp, err := config.runQuery(ctx, txn, "CountEventsByOrganiser", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Person []struct {
+			Count int `json:"count"`
+		} `json:"person"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	count := 0
+	for _, p := range r.Person {
+		count += p.Count
+	}
+	return &count, nil
+}
+
+// CountFilteredLocations returns the number of locations the Accessible and Campus of the options leave in,
+// which are the ones ListLocations pages through with them
+func (config *DB) CountFilteredLocations(ctx context.Context, opts ListOptions, options ...Option) (*int, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	filter, err := opts.locationFilter()
+	if err != nil {
+		return nil, err
+	}
+	if filter != "" {
+		filter = "@filter(" + filter + ")"
+	}
+	txn := config.readTxn(ctx)
+	q := fmt.Sprintf(`query CountFilteredLocations {
+			total(func: type(Location)) %s {
+				count: count(uid)
+			}
+		}
+	`, filter)
+
+	return config.countQuery(ctx, txn, "CountFilteredLocations", q, nil)
+}
+
+// countQuery runs a query counting the nodes in its total block
+func (config *DB) countQuery(ctx context.Context, txn *Txn, name, q string, vars map[string]string) (*int, error) {
+	resp, err := config.runQuery(ctx, txn, name, q, vars)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Total []struct {
+			Count int `json:"count"`
+		} `json:"total"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	count := 0
+	if len(r.Total) > 0 {
+		count = r.Total[0].Count
+	}
+	return &count, nil
+}
@@ -0,0 +1,286 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DedupeMerge describes one set of duplicate events merged by DeduplicateEvents
+type DedupeMerge struct {
+	// Reason is the field the events were duplicates on, either "event.id" or "title, start and location"
+	Reason string
+	// Canonical is the uid of the event which was kept
+	Canonical string
+	// Removed are the uids of the duplicates which were merged into it and deleted
+	Removed []string
+}
+
+// DedupeReport lists the merges made by DeduplicateEvents
+type DedupeReport struct {
+	Merges []DedupeMerge
+}
+
+// Removed returns the total number of events deleted
+func (r *DedupeReport) Removed() int {
+	n := 0
+	for _, m := range r.Merges {
+		n += len(m.Removed)
+	}
+	return n
+}
+
+// DeduplicateEvents finds events sharing an event.id, or sharing the same title, start date and locations,
+// and merges each set of duplicates into the oldest of them.
+// The edges of the duplicates, including their attendees, series and the scrapes which found them,
+// are moved onto the kept event before they are deleted.
+func (config *DB) DeduplicateEvents(ctx context.Context, options ...Option) (*DedupeReport, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	report := &DedupeReport{Merges: make([]DedupeMerge, 0)}
+
+	idGroups, err := config.duplicateGroups(ctx, "event.id")
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range idGroups {
+		id, _ := group["event.id"].(string)
+		q := `query Duplicates($id: string) {
+			members(func: eq(event.id, $id)) @filter(type(Event)) {
+				uid
+			}
+		}`
+		members, err := config.duplicateMembers(ctx, q, map[string]string{"$id": id})
+		if err != nil {
+			return nil, err
+		}
+		uids := make([]string, len(members))
+		for i, m := range members {
+			uids[i] = m.UID
+		}
+		merge, err := config.mergeDuplicates(ctx, "event.id", uids)
+		if err != nil {
+			return nil, err
+		}
+		if merge != nil {
+			report.Merges = append(report.Merges, *merge)
+		}
+	}
+
+	// Scraping the same event under a new id leaves the same title, time and room behind
+	timeGroups, err := config.duplicateGroups(ctx, "event.title, event.start_date")
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range timeGroups {
+		title, _ := group["event.title"].(string)
+		start, _ := group["event.start_date"].(string)
+		q := `query Duplicates($title: string, $start: string) {
+			members(func: eq(event.title, $title)) @filter(type(Event) AND eq(event.start_date, $start)) {
+				uid
+				event.location {
+					uid
+				}
+			}
+		}`
+		members, err := config.duplicateMembers(ctx, q, map[string]string{"$title": title, "$start": start})
+		if err != nil {
+			return nil, err
+		}
+
+		// Events with the same title at the same time in different rooms are separate seminar groups
+		byLocation := make(map[string][]string)
+		for _, m := range members {
+			byLocation[m.locationKey()] = append(byLocation[m.locationKey()], m.UID)
+		}
+		for _, uids := range byLocation {
+			merge, err := config.mergeDuplicates(ctx, "title, start and location", uids)
+			if err != nil {
+				return nil, err
+			}
+			if merge != nil {
+				report.Merges = append(report.Merges, *merge)
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// duplicateMember is an event found by duplicateMembers
+type duplicateMember struct {
+	UID      string `json:"uid"`
+	Location []struct {
+		UID string `json:"uid"`
+	} `json:"event.location"`
+}
+
+// locationKey identifies the set of locations of the event, whatever order they are in
+func (m duplicateMember) locationKey() string {
+	uids := make([]string, len(m.Location))
+	for i, l := range m.Location {
+		uids[i] = l.UID
+	}
+	sort.Strings(uids)
+	return strings.Join(uids, ",")
+}
+
+// duplicateGroups groups the events by the predicates, returning the groups with more than one event in them
+func (config *DB) duplicateGroups(ctx context.Context, predicates string) ([]map[string]interface{}, error) {
+	q := fmt.Sprintf(`{
+		groups(func: type(Event)) @groupby(%s) {
+			count(uid)
+		}
+	}`, predicates)
+
+	resp, err := config.runQuery(ctx, config.readTxn(ctx), "DeduplicateEvents", q, nil)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Groups []struct {
+			GroupBy []map[string]interface{} `json:"@groupby"`
+		} `json:"groups"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]map[string]interface{}, 0)
+	for _, g := range r.Groups {
+		for _, group := range g.GroupBy {
+			if count, _ := group["count"].(float64); count > 1 {
+				groups = append(groups, group)
+			}
+		}
+	}
+	return groups, nil
+}
+
+// duplicateMembers runs the query, which must return the events of a group in a block named members
+func (config *DB) duplicateMembers(ctx context.Context, q string, vars map[string]string) ([]duplicateMember, error) {
+	resp, err := config.runQuery(ctx, config.readTxn(ctx), "DeduplicateEvents", q, vars)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Members []duplicateMember `json:"members"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	return r.Members, nil
+}
+
+// mergeDuplicates moves the edges of every event onto the one with the lowest uid, which was created first,
+// and deletes the others. It returns nil if there is nothing to merge.
+func (config *DB) mergeDuplicates(ctx context.Context, reason string, uids []string) (*DedupeMerge, error) {
+	if len(uids) < 2 {
+		return nil, nil
+	}
+	list := append([]string{}, uids...)
+	sort.Slice(list, func(i, j int) bool {
+		a, _ := strconv.ParseUint(strings.TrimPrefix(list[i], "0x"), 16, 64)
+		b, _ := strconv.ParseUint(strings.TrimPrefix(list[j], "0x"), 16, 64)
+		return a < b
+	})
+	canonical, removed := list[0], list[1:]
+
+	q := fmt.Sprintf(`{
+		duplicates(func: uid(%s)) {
+			uid
+			event.organiser { uid }
+			event.part_of_module { uid }
+			event.location { uid }
+			event.revision { uid }
+			event.attendee { uid }
+			event.series { uid }
+			~scrape.found_event { uid }
+		}
+		canonical(func: uid(%s)) {
+			event.series { uid }
+		}
+	}`, strings.Join(removed, ", "), canonical)
+	resp, err := config.runQuery(ctx, config.readTxn(ctx), "DeduplicateEvents", q, nil)
+	if err != nil {
+		return nil, err
+	}
+	type edge struct {
+		UID string `json:"uid"`
+	}
+	type Root struct {
+		Duplicates []struct {
+			UID          string `json:"uid"`
+			Organiser    []edge `json:"event.organiser"`
+			PartOfModule []edge `json:"event.part_of_module"`
+			Location     []edge `json:"event.location"`
+			Revision     []edge `json:"event.revision"`
+			Attendee     []edge `json:"event.attendee"`
+			Series       *edge  `json:"event.series"`
+			Scrapes      []edge `json:"~scrape.found_event"`
+		} `json:"duplicates"`
+		Canonical []struct {
+			Series *edge `json:"event.series"`
+		} `json:"canonical"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	// An event is in a single series, so the kept event only takes one from the duplicates if it has none of its own
+	hasSeries := len(r.Canonical) > 0 && r.Canonical[0].Series != nil
+
+	set := make([]string, 0)
+	del := make([]string, 0)
+	for _, d := range r.Duplicates {
+		outgoing := map[string][]edge{
+			"event.organiser":      d.Organiser,
+			"event.part_of_module": d.PartOfModule,
+			"event.location":       d.Location,
+			"event.revision":       d.Revision,
+			"event.attendee":       d.Attendee,
+		}
+		for pred, edges := range outgoing {
+			for _, e := range edges {
+				set = append(set, fmt.Sprintf("<%s> <%s> <%s> .", canonical, pred, e.UID))
+			}
+		}
+		if d.Series != nil && !hasSeries {
+			set = append(set, fmt.Sprintf("<%s> <event.series> <%s> .", canonical, d.Series.UID))
+			hasSeries = true
+		}
+		for _, s := range d.Scrapes {
+			set = append(set, fmt.Sprintf("<%s> <scrape.found_event> <%s> .", s.UID, canonical))
+			del = append(del, fmt.Sprintf("<%s> <scrape.found_event> <%s> .", s.UID, d.UID))
+		}
+		del = append(del, fmt.Sprintf("<%s> * * .", d.UID))
+	}
+
+	mu := &Mutation{DelNquads: []byte(strings.Join(del, "\n"))}
+	if len(set) > 0 {
+		mu.SetNquads = []byte(strings.Join(set, "\n"))
+	}
+	_, err = config.commit(ctx, "DeduplicateEvents", &Request{Mutations: []*Mutation{mu}})
+	if err != nil {
+		return nil, err
+	}
+
+	return &DedupeMerge{
+		Reason:    reason,
+		Canonical: canonical,
+		Removed:   removed,
+	}, nil
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// DeleteEvent deletes the event with the given Uid from the database.
+// If cascade is set, the scrape.found_event edges pointing at it are removed as well.
+func (config *DB) DeleteEvent(ctx context.Context, event Event, cascade bool, options ...Option) error {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+	return config.deleteNode(ctx, event.UID, cascade, "scrape.found_event")
+}
+
+// DeleteScrape deletes the scrape with the given Uid from the database.
+// Nothing points at a scrape, so cascade has no effect, it is accepted for symmetry.
+func (config *DB) DeleteScrape(ctx context.Context, scrape Scrape, cascade bool, options ...Option) error {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+	return config.deleteNode(ctx, scrape.UID, cascade)
+}
+
+// DeleteLocation deletes the location with the given Uid from the database.
+// If cascade is set, the event.location edges pointing at it are removed as well.
+func (config *DB) DeleteLocation(ctx context.Context, loc Location, cascade bool, options ...Option) error {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+	return config.deleteNode(ctx, loc.UID, cascade, "event.location")
+}
+
+// DeletePerson deletes the person with the given Uid from the database.
+// If cascade is set, the event.organiser and event.attendee edges pointing at them are removed as well.
+func (config *DB) DeletePerson(ctx context.Context, person Person, cascade bool, options ...Option) error {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+	return config.deleteNode(ctx, person.UID, cascade, "event.organiser", "event.attendee")
+}
+
+// DeleteWebhook deletes the webhook with the given Uid from the database, along with the log of its deliveries
+func (config *DB) DeleteWebhook(ctx context.Context, webhook Webhook, options ...Option) error {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	if webhook.UID == "" {
+		return fmt.Errorf("Cannot delete a node without a uid")
+	}
+	req := &Request{
+		Query: `query Delete($uid: string) {
+			n as var(func: uid($uid)) {
+				~delivery.webhook { d as uid }
+			}
+		}`,
+		Vars:      map[string]string{"$uid": webhook.UID},
+		Mutations: []*Mutation{{DelNquads: []byte("uid(n) * * .\nuid(d) * * .")}},
+	}
+	_, err := config.commit(ctx, "DeleteWebhook", req)
+	return err
+}
+
+// deleteNode removes every predicate of the node with the given uid.
+// When cascading, the incoming edges listed are deleted too, which needs the predicates to have @reverse.
+func (config *DB) deleteNode(ctx context.Context, uid string, cascade bool, incoming ...string) error {
+	if uid == "" {
+		return fmt.Errorf("Cannot delete a node without a uid")
+	}
+	reverse := make([]string, 0)
+	nquads := []string{"uid(n) * * ."}
+	if cascade {
+		for i, pred := range incoming {
+			reverse = append(reverse, fmt.Sprintf("~%s { p%d as uid }", pred, i))
+			nquads = append(nquads, fmt.Sprintf("uid(p%d) <%s> uid(n) .", i, pred))
+		}
+	}
+
+	block := "n as var(func: uid($uid))"
+	if len(reverse) > 0 {
+		block = fmt.Sprintf("%s {\n%s\n}", block, strings.Join(reverse, "\n"))
+	}
+	q := fmt.Sprintf(
+		`query Delete($uid: string) {
+			%s
+		}`, block)
+
+	req := &Request{
+		Query:     q,
+		Vars:      map[string]string{"$uid": uid},
+		Mutations: []*Mutation{{DelNquads: []byte(strings.Join(nquads, "\n"))}},
+	}
+
+	_, err := config.commit(ctx, "Delete", req)
+	return err
+}
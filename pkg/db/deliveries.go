@@ -0,0 +1,191 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// deliveryPredicates are the predicates of a WebhookDelivery the getters return
+const deliveryPredicates = `uid
+	delivery.key
+	delivery.id
+	delivery.change
+	delivery.type
+	delivery.event
+	delivery.attempts
+	delivery.status
+	delivery.error
+	delivery.delivered
+	delivery.at`
+
+// WebhookDeliveryKey returns the delivery.key of the change with the Seq being posted to the webhook with the webhook.id
+func WebhookDeliveryKey(change int64, webhookID string) string {
+	return strconv.FormatInt(change, 10) + ":" + webhookID
+}
+
+// ClaimWebhookDelivery stores the delivery to its Webhook, which needs a Uid and an ID, before it is posted,
+// returning it with its Uid and Key, or nil if the change has already been claimed for the webhook,
+// so it is only posted once even if two replicas try.
+// delivery.key is an upsert index, so two claims of the same delivery conflict and the retried one finds the other.
+func (config *DB) ClaimWebhookDelivery(ctx context.Context, delivery WebhookDelivery, options ...Option) (*WebhookDelivery, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	if delivery.Webhook == nil || delivery.Webhook.UID == "" || delivery.Webhook.ID == "" {
+		return nil, errors.New("ClaimWebhookDelivery needs a webhook with a Uid and an ID")
+	}
+	webhook := delivery.Webhook
+	if delivery.At == nil {
+		now := time.Now().UTC()
+		delivery.At = &now
+	}
+	delivery.UID = "_:delivery"
+	delivery.Key = WebhookDeliveryKey(delivery.Change, webhook.ID)
+	delivery.Webhook = &Webhook{UID: webhook.UID}
+	delivery.DType = []string{"WebhookDelivery"}
+	pb, err := json.Marshal(delivery)
+	if err != nil {
+		return nil, err
+	}
+	req := &Request{
+		Query: `query Claim($key: string) {
+			v as var(func: eq(delivery.key, $key))
+			found(func: uid(v)) { uid }
+		}`,
+		Vars:      map[string]string{"$key": delivery.Key},
+		Mutations: []*Mutation{{SetJSON: pb, Cond: "@if(eq(len(v), 0))"}},
+	}
+	resp, err := config.commit(ctx, "ClaimWebhookDelivery", req)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Found []struct {
+			UID string `json:"uid"`
+		} `json:"found"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Found) > 0 {
+		return nil, nil
+	}
+	delivery.UID, delivery.Webhook, delivery.DType = resp.UIDs["delivery"], webhook, nil
+	return &delivery, nil
+}
+
+// UpdateWebhookDelivery stores how the attempts at the claimed delivery with the Uid went
+func (config *DB) UpdateWebhookDelivery(ctx context.Context, delivery WebhookDelivery, options ...Option) (*Response, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	if delivery.UID == "" {
+		return nil, errors.New("UpdateWebhookDelivery needs a delivery with a Uid")
+	}
+	// The key and the webhook are never changed, and are left out so the upsert index isn't written again
+	delivery.Key, delivery.Webhook = "", nil
+	req, err := mutationRequest(delivery)
+	if err != nil {
+		return nil, err
+	}
+	return config.commit(ctx, "UpdateWebhookDelivery", req)
+}
+
+// ListWebhookDeliveries returns up to limit of the latest deliveries to the webhook with the Uid, newest first
+func (config *DB) ListWebhookDeliveries(ctx context.Context, webhook Webhook, limit int, options ...Option) ([]WebhookDelivery, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	if webhook.UID == "" {
+		return nil, errors.New("ListWebhookDeliveries needs a webhook with a Uid")
+	}
+	txn := config.readTxn(ctx)
+	q := fmt.Sprintf(
+		`query Deliveries($uid: string, $first: int) {
+			webhook(func: uid($uid)) @filter(type(Webhook)) {
+				deliveries: ~delivery.webhook(orderdesc: delivery.at, first: $first) @filter(type(WebhookDelivery)) {
+					%s
+				}
+			}
+		}
+	`, deliveryPredicates)
+	variables := make(map[string]string)
+	variables["$uid"] = webhook.UID
+	variables["$first"] = strconv.Itoa(ListOptions{First: limit}.first())
+	resp, err := config.runQuery(ctx, txn, "ListWebhookDeliveries", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Webhook []struct {
+			Deliveries []WebhookDelivery `json:"deliveries"`
+		} `json:"webhook"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Webhook) == 0 || r.Webhook[0].Deliveries == nil {
+		return make([]WebhookDelivery, 0), nil
+	}
+	return r.Webhook[0].Deliveries, nil
+}
+
+// DeleteWebhookDeliveriesBefore removes up to limit of the deliveries claimed before the time, oldest first,
+// returning how many were removed, so they are kept as long as the changes are
+func (config *DB) DeleteWebhookDeliveriesBefore(ctx context.Context, before time.Time, limit int, options ...Option) (int, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+	q :=
+		`query OldDeliveries($before: string, $first: int) {
+			deliveries(func: lt(delivery.at, $before), orderasc: delivery.at, first: $first) @filter(type(WebhookDelivery)) {
+				uid
+			}
+		}
+	`
+	variables := make(map[string]string)
+	variables["$before"] = formatTime(before)
+	variables["$first"] = strconv.Itoa(ListOptions{First: limit}.first())
+	resp, err := config.runQuery(ctx, txn, "DeleteWebhookDeliveriesBefore", q, variables)
+	if err != nil {
+		return 0, err
+	}
+	type Root struct {
+		Deliveries []struct {
+			UID string `json:"uid"`
+		} `json:"deliveries"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return 0, err
+	}
+	if len(r.Deliveries) == 0 {
+		return 0, nil
+	}
+	nquads := make([]string, 0, len(r.Deliveries))
+	for _, d := range r.Deliveries {
+		nquads = append(nquads, fmt.Sprintf("<%s> * * .", d.UID))
+	}
+	req := &Request{
+		Mutations: []*Mutation{{DelNquads: []byte(strings.Join(nquads, "\n"))}},
+	}
+	_, err = config.commit(ctx, "DeleteWebhookDeliveriesBefore", req)
+	if err != nil {
+		return 0, err
+	}
+	return len(r.Deliveries), nil
+}
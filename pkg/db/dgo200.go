@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dgraph-io/dgo/v200"
+	"github.com/dgraph-io/dgo/v200/protos/api"
+	"google.golang.org/grpc"
+)
+
+// dgo200 is the dgraphClient for dgraph v20.x clusters
+type dgo200 struct {
+	dg    *dgo.Dgraph
+	conns []*grpc.ClientConn
+}
+
+func newDgraphClient(conns []*grpc.ClientConn) dgraphClient {
+	clients := make([]api.DgraphClient, 0, len(conns))
+	for _, conn := range conns {
+		clients = append(clients, api.NewDgraphClient(conn))
+	}
+	return &dgo200{dg: dgo.NewDgraphClient(clients...), conns: conns}
+}
+
+func (c *dgo200) newTxn() dgraphTxn {
+	return &dgo200Txn{c.dg.NewTxn()}
+}
+
+func (c *dgo200) newReadOnlyTxn(bestEffort bool) dgraphTxn {
+	txn := c.dg.NewReadOnlyTxn()
+	if bestEffort {
+		txn.BestEffort()
+	}
+	return &dgo200Txn{txn}
+}
+
+func (c *dgo200) alter(ctx context.Context, schema string) error {
+	return c.dg.Alter(ctx, &api.Operation{Schema: schema})
+}
+
+func (c *dgo200) login(ctx context.Context, user, password string) error {
+	return c.dg.Login(ctx, user, password)
+}
+
+// checkVersion tries each connection in turn until one answers
+func (c *dgo200) checkVersion(ctx context.Context) (string, error) {
+	var version *api.Version
+	var err error
+	for _, conn := range c.conns {
+		version, err = api.NewDgraphClient(conn).CheckVersion(ctx, &api.Check{})
+		if err == nil {
+			return version.Tag, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return "", err
+}
+
+type dgo200Txn struct {
+	txn *dgo.Txn
+}
+
+func (t *dgo200Txn) query(ctx context.Context, q string, vars map[string]string) (*Response, error) {
+	var resp *api.Response
+	var err error
+	if len(vars) == 0 {
+		resp, err = t.txn.Query(ctx, q)
+	} else {
+		resp, err = t.txn.QueryWithVars(ctx, q, vars)
+	}
+	if err != nil {
+		return nil, dgo200Err(err)
+	}
+	return &Response{JSON: resp.Json, UIDs: resp.Uids}, nil
+}
+
+func (t *dgo200Txn) do(ctx context.Context, req *Request) (*Response, error) {
+	r := &api.Request{
+		Query:     req.Query,
+		Vars:      req.Vars,
+		CommitNow: req.CommitNow,
+	}
+	for _, mu := range req.Mutations {
+		r.Mutations = append(r.Mutations, &api.Mutation{
+			SetJson:    mu.SetJSON,
+			DeleteJson: mu.DeleteJSON,
+			SetNquads:  mu.SetNquads,
+			DelNquads:  mu.DelNquads,
+			Cond:       mu.Cond,
+		})
+	}
+	resp, err := t.txn.Do(ctx, r)
+	if err != nil {
+		return nil, dgo200Err(err)
+	}
+	return &Response{JSON: resp.Json, UIDs: resp.Uids}, nil
+}
+
+func (t *dgo200Txn) commit(ctx context.Context) error {
+	return dgo200Err(t.txn.Commit(ctx))
+}
+
+func (t *dgo200Txn) discard(ctx context.Context) error {
+	return t.txn.Discard(ctx)
+}
+
+// dgo200Err replaces dgo's ErrAborted with ErrAborted, leaving other errors as they are
+func dgo200Err(err error) error {
+	if errors.Is(err, dgo.ErrAborted) {
+		return ErrAborted
+	}
+	return err
+}
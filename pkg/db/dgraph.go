@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrAborted is returned when a transaction is aborted because a concurrent one changed the same data.
+// Operations retry on it, see DB.MaxAttempts.
+var ErrAborted = errors.New("The transaction was aborted by a conflicting one")
+
+// Request is a query and the mutations to run with it, such as an upsert block
+type Request struct {
+	// Query is the query the mutations are conditional on, its variables are available to them
+	Query string
+	// Vars are the values of the query variables, keyed by their names including the $
+	Vars      map[string]string
+	Mutations []*Mutation
+	// CommitNow commits the transaction as soon as the request has run
+	CommitNow bool
+}
+
+// Mutation is a set of changes, in JSON or RDF N-Quads
+type Mutation struct {
+	SetJSON    []byte
+	DeleteJSON []byte
+	SetNquads  []byte
+	DelNquads  []byte
+	// Cond is an @if condition on the query variables, the mutation is skipped unless it holds
+	Cond string
+}
+
+// Response is what the database returned for a query or a request
+type Response struct {
+	// JSON is the result of the query, keyed by the names of its blocks
+	JSON []byte
+	// UIDs maps the blank nodes and uid variables in the mutations to the uids they were given
+	UIDs map[string]string
+}
+
+// Txn is a transaction, as started by WithTxn for the ...Txn variants of the operations
+type Txn struct {
+	txn dgraphTxn
+	// committed are run by WithTxn once the transaction has been committed
+	committed []func()
+}
+
+// onCommit runs fn once the transaction has been committed.
+// Without a transaction, as with memdb, the writes are already done so fn runs straight away.
+func (t *Txn) onCommit(fn func()) {
+	if t == nil {
+		fn()
+		return
+	}
+	t.committed = append(t.committed, fn)
+}
+
+// Do runs the request in the transaction, for migrations and other writes not covered by an operation
+func (t *Txn) Do(ctx context.Context, req *Request) (*Response, error) {
+	return t.txn.do(ctx, req)
+}
+
+// dgraphClient is the part of a dgo client the DB uses.
+// The dgo clients implement it, so nothing else depends on a version of dgo.
+type dgraphClient interface {
+	newTxn() dgraphTxn
+	newReadOnlyTxn(bestEffort bool) dgraphTxn
+	alter(ctx context.Context, schema string) error
+	login(ctx context.Context, user, password string) error
+	checkVersion(ctx context.Context) (string, error)
+}
+
+// dgraphTxn is a transaction of a dgraphClient. Aborted transactions fail with ErrAborted.
+type dgraphTxn interface {
+	query(ctx context.Context, q string, vars map[string]string) (*Response, error)
+	do(ctx context.Context, req *Request) (*Response, error)
+	commit(ctx context.Context) error
+	discard(ctx context.Context) error
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"errors"
+)
+
+// FieldChange is a field of an event which an update changes, holding the stored and incoming values
+type FieldChange struct {
+	Predicate string      `json:"predicate"`
+	Old       interface{} `json:"old"`
+	New       interface{} `json:"new"`
+}
+
+// EventDiff describes what storing an event would change, as returned by DiffEvent
+type EventDiff struct {
+	// Created is whether there is no stored event yet, so storing it would create one
+	Created bool `json:"created"`
+	// Changes holds the fields whose stored value would change, in schema order
+	Changes []FieldChange `json:"changes"`
+	// Stored is the stored event the incoming one was compared with, nil if it is Created
+	Stored *Event `json:"-"`
+}
+
+// Empty returns whether storing the event would be a no-op
+func (d *EventDiff) Empty() bool {
+	return !d.Created && len(d.Changes) == 0
+}
+
+// DiffEvent compares the incoming event with the stored one, matched as GetEvent matches it,
+// and returns what storing it would change, without writing anything.
+// Like an upsert, fields which aren't set in the incoming event are left alone, so they don't count as changes.
+func (config *DB) DiffEvent(ctx context.Context, incoming Event, options ...Option) (*EventDiff, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	existing, err := config.GetEvent(ctx, incoming)
+	if errors.Is(err, ErrNotFound) {
+		return &EventDiff{Created: true, Changes: Event{}.Diff(incoming)}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &EventDiff{Changes: existing.Diff(incoming), Stored: existing}, nil
+}
+
+// Diff returns the fields the update would change if it was stored over e, in schema order.
+// Fields which aren't set in the update are skipped, and edges are compared as Equal compares them.
+func (e Event) Diff(update Event) []FieldChange {
+	changes := make([]FieldChange, 0)
+	change := func(predicate string, old, updated interface{}) {
+		changes = append(changes, FieldChange{Predicate: predicate, Old: old, New: updated})
+	}
+
+	if update.Title != "" && update.Title != e.Title {
+		change("event.title", e.Title, update.Title)
+	}
+	if update.Description != "" && update.Description != e.Description {
+		change("event.description", e.Description, update.Description)
+	}
+	if update.StartDate != nil && !sameTime(update.StartDate, e.StartDate) {
+		change("event.start_date", e.StartDate, update.StartDate)
+	}
+	if update.EndDate != nil && !sameTime(update.EndDate, e.EndDate) {
+		change("event.end_date", e.EndDate, update.EndDate)
+	}
+	if len(update.Organiser) > 0 && !sameOrganisers(update.Organiser, e.Organiser) {
+		change("event.organiser", e.Organiser, update.Organiser)
+	}
+	if len(update.PartOfModule) > 0 && !sameModules(update.PartOfModule, e.PartOfModule) {
+		change("event.part_of_module", e.PartOfModule, update.PartOfModule)
+	}
+	if len(update.Location) > 0 && !sameLocations(update.Location, e.Location) {
+		change("event.location", e.Location, update.Location)
+	}
+	if update.Series != nil && (e.Series == nil || e.Series.UID != update.Series.UID) {
+		change("event.series", e.Series, update.Series)
+	}
+	return changes
+}
+
+// sameOrganisers returns whether every person in the update already organises the event in the same role
+func sameOrganisers(update, existing []Person) bool {
+	for _, p := range update {
+		found := false
+		for _, p2 := range existing {
+			found = found || ((p.UID != "" && p.UID == p2.UID || p.Name == p2.Name) && p.Role == p2.Role)
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// sameModules returns whether every module in the update is already one of the event's modules
+func sameModules(update, existing []Module) bool {
+	for _, m := range update {
+		found := false
+		for _, m2 := range existing {
+			found = found || m.Equal(m2)
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,56 @@
+package db
+
+// This contains the errors returned by the db package
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is returned, wrapped, by the getters when the node they are looking for doesn't exist.
+// Check for it with errors.Is.
+var ErrNotFound = errors.New("Not found")
+
+// ErrReadOnly is returned, wrapped in a MutationError, by operations which would write to the database
+// when they are run WithReadOnly
+var ErrReadOnly = errors.New("Refusing to write to the database in a read only operation")
+
+// ErrLeaseHeld is returned, wrapped, by AcquireLease and SetLeaseCursor when another replica holds the lease
+var ErrLeaseHeld = errors.New("The lease is held by someone else")
+
+// notFound returns an error wrapping ErrNotFound, describing what was being looked for
+func notFound(kind, field, value string) error {
+	return fmt.Errorf("%w: no %s with %s %q", ErrNotFound, kind, field, value)
+}
+
+// QueryError is returned when dgraph fails to run a query, as opposed to the query finding nothing
+type QueryError struct {
+	// Op is the name of the operation which ran the query
+	Op  string
+	Err error
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%s query failed: %v", e.Op, e.Err)
+}
+
+// Unwrap returns the underlying dgraph error
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+// MutationError is returned when dgraph fails to run a mutation or commit a transaction
+type MutationError struct {
+	// Op is the name of the operation which ran the mutation
+	Op  string
+	Err error
+}
+
+func (e *MutationError) Error() string {
+	return fmt.Sprintf("%s mutation failed: %v", e.Op, e.Err)
+}
+
+// Unwrap returns the underlying dgraph error
+func (e *MutationError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// runQuery runs the read only query in the transaction, passing the variables if there are any.
+// Failures are wrapped in a QueryError naming the operation.
+func (config *DB) runQuery(ctx context.Context, txn *Txn, op, q string, vars map[string]string) (*Response, error) {
+	ctx, span := config.startSpan(ctx, op, "query", q, vars)
+	start := time.Now()
+	resp, err := txn.txn.query(ctx, q, vars)
+	config.Metrics.observe(op, "query", start, err)
+	endSpan(span, resp, err)
+	if err != nil {
+		return nil, &QueryError{Op: op, Err: err}
+	}
+	return resp, nil
+}
+
+// checkWritable returns an error if the operation running in ctx was given WithReadOnly
+func checkWritable(ctx context.Context, op string) error {
+	if optionsFrom(ctx).readOnly {
+		return &MutationError{Op: op, Err: ErrReadOnly}
+	}
+	return nil
+}
+
+// runRequest runs the request, usually an upsert block, in the transaction.
+// Failures are wrapped in a MutationError naming the operation.
+func (config *DB) runRequest(ctx context.Context, txn *Txn, op string, req *Request) (*Response, error) {
+	if err := checkWritable(ctx, op); err != nil {
+		return nil, err
+	}
+	ctx, span := config.startSpan(ctx, op, "mutation", req.Query, req.Vars)
+	start := time.Now()
+	resp, err := txn.txn.do(ctx, req)
+	config.Metrics.observe(op, "mutation", start, err)
+	endSpan(span, resp, err)
+	if err != nil {
+		return nil, &MutationError{Op: op, Err: err}
+	}
+	return resp, nil
+}
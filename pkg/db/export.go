@@ -0,0 +1,236 @@
+package db
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ExportFormat is the format ExportAll writes the nodes in
+type ExportFormat string
+
+const (
+	// ExportJSON writes one json object per line for every node, with edges as {"uid": ...} objects
+	ExportJSON ExportFormat = "json"
+	// ExportRDF writes every predicate of every node as N-Quads, which dgraph live and bulk loaders accept
+	ExportRDF ExportFormat = "rdf"
+)
+
+// exportTypes are the node types written by ExportAll, in the order they are written.
+// Nodes are written before the events pointing at them, so an Import can resolve most edges as it goes.
+var exportTypes = []string{"Location", "Module", "Person", "Series", "Revision", "Event", "Scrape", "ScrapeJob", "Webhook", "Term", "User"}
+
+// exportFacets are the facets stored on the edges of each predicate, which have to be asked for by name
+var exportFacets = map[string]string{
+	"event.organiser":      "role",
+	"event.part_of_module": "weight, required",
+}
+
+// exportPageSize is how many nodes are fetched from dgraph at a time while exporting
+const exportPageSize = 1000
+
+// ExportAll streams every node of the exportTypes in the database to w in the given format, with the facets on their edges.
+// Nodes are read a page at a time, so the whole database is never held in memory.
+func (config *DB) ExportAll(ctx context.Context, w io.Writer, format ExportFormat, options ...Option) error {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	if format != ExportJSON && format != ExportRDF {
+		return fmt.Errorf("Unknown export format %q", format)
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, t := range exportTypes {
+		err := config.exportType(ctx, bw, format, t)
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// exportType writes every node of the dgraph type t, paging through them in uid order
+func (config *DB) exportType(ctx context.Context, w *bufio.Writer, format ExportFormat, t string) error {
+	predicates, err := exportPredicates(t)
+	if err != nil {
+		return err
+	}
+	q := fmt.Sprintf(
+		`query Export($first: int, $after: string) {
+			nodes(func: type(%s), first: $first, after: $after) {
+				uid
+				dgraph.type
+				%s
+			}
+		}`, t, strings.Join(predicates, "\n"))
+
+	after := "0x0"
+	for {
+		variables := make(map[string]string)
+		variables["$first"] = strconv.Itoa(exportPageSize)
+		variables["$after"] = after
+
+		resp, err := config.runQuery(ctx, config.readTxn(ctx), "ExportAll", q, variables)
+		if err != nil {
+			return err
+		}
+		type Root struct {
+			Nodes []map[string]interface{} `json:"nodes"`
+		}
+
+		var r Root
+		err = json.Unmarshal(resp.JSON, &r)
+		if err != nil {
+			return err
+		}
+
+		for _, node := range r.Nodes {
+			if format == ExportJSON {
+				err = writeJSONLine(w, node)
+			} else {
+				err = writeNQuads(w, node)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(r.Nodes) < exportPageSize {
+			return nil
+		}
+		after, _ = r.Nodes[len(r.Nodes)-1]["uid"].(string)
+	}
+}
+
+// exportPredicates returns the predicates of the dgraph type t to query, as they are declared in the Schema.
+// Edges are selected by their uid and any facets they have.
+func exportPredicates(t string) ([]string, error) {
+	start := strings.Index(Schema, "\ntype "+t+" {")
+	if start < 0 {
+		return nil, fmt.Errorf("No type %s in the schema", t)
+	}
+	body := Schema[start+len("\ntype "+t+" {"):]
+	body = body[:strings.Index(body, "}")]
+
+	predicates := make([]string, 0)
+	for _, line := range strings.Split(body, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), ":")
+		if len(fields) != 2 {
+			continue
+		}
+		name, kind := strings.TrimSpace(fields[0]), strings.Trim(strings.TrimSpace(fields[1]), "[]")
+		// Scalar types are lower case, and edges are typed by the node they point at
+		if kind == "" || !unicode.IsUpper(rune(kind[0])) {
+			predicates = append(predicates, name)
+			continue
+		}
+		if facets, ok := exportFacets[name]; ok {
+			name += " @facets(" + facets + ")"
+		}
+		predicates = append(predicates, name+" { uid }")
+	}
+	return predicates, nil
+}
+
+func writeJSONLine(w *bufio.Writer, node map[string]interface{}) error {
+	b, err := json.Marshal(node)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// writeNQuads writes a line per value of every predicate of the node, in predicate order
+func writeNQuads(w *bufio.Writer, node map[string]interface{}) error {
+	subject, _ := node["uid"].(string)
+	predicates := make([]string, 0, len(node))
+	for p := range node {
+		if p != "uid" {
+			predicates = append(predicates, p)
+		}
+	}
+	sort.Strings(predicates)
+
+	for _, p := range predicates {
+		values, ok := node[p].([]interface{})
+		if !ok {
+			values = []interface{}{node[p]}
+		}
+		for _, v := range values {
+			object, err := nquadObject(v)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(w, "<%s> <%s> %s .\n", subject, p, object)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// nquadObject formats a value returned by dgraph as the object of an N-Quad, followed by its facets if it has any.
+// Objects holding only a uid and facets are edges, and any other object is a geojson location.
+func nquadObject(v interface{}) (string, error) {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		if uid, ok := edgeUID(value); ok {
+			return "<" + uid + ">" + nquadFacets(value), nil
+		}
+		b, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		return literal(string(b)) + "^^<geo:geojson>", nil
+	case bool:
+		return literal(strconv.FormatBool(value)) + "^^<xs:boolean>", nil
+	case float64:
+		if value == float64(int64(value)) {
+			return literal(strconv.FormatInt(int64(value), 10)) + "^^<xs:int>", nil
+		}
+		return literal(strconv.FormatFloat(value, 'g', -1, 64)) + "^^<xs:float>", nil
+	case string:
+		return literal(value), nil
+	default:
+		return "", fmt.Errorf("Cannot export value %v of type %T", v, v)
+	}
+}
+
+// nquadFacets formats the facets of an edge returned by dgraph, which are keyed by predicate|facet, in facet order
+func nquadFacets(edge map[string]interface{}) string {
+	facets := make([]string, 0)
+	for key, v := range edge {
+		i := strings.Index(key, "|")
+		if i < 0 {
+			continue
+		}
+		facet := key[i+1:]
+		switch value := v.(type) {
+		case string:
+			facets = append(facets, facet+"="+literal(value))
+		case bool:
+			facets = append(facets, facet+"="+strconv.FormatBool(value))
+		case float64:
+			facets = append(facets, facet+"="+strconv.FormatFloat(value, 'g', -1, 64))
+		}
+	}
+	if len(facets) == 0 {
+		return ""
+	}
+	sort.Strings(facets)
+	return " (" + strings.Join(facets, ", ") + ")"
+}
+
+// literal quotes s as an N-Quads string literal, whose escaping is compatible with json's
+func literal(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
@@ -0,0 +1,175 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// earthRadius is the mean radius of the earth in metres, used to sort locations by distance
+const earthRadius = 6371008.8
+
+// NewPoint returns a geojson point for the latitude and longitude, which geojson stores the other way round
+func NewPoint(lat, long float64) Loc {
+	return Loc{
+		Type:   "Point",
+		Coords: []float64{long, lat},
+	}
+}
+
+// Lat returns the latitude of a point
+func (l Loc) Lat() float64 {
+	if len(l.Coords) < 2 {
+		return 0
+	}
+	return l.Coords[1]
+}
+
+// Long returns the longitude of a point
+func (l Loc) Long() float64 {
+	if len(l.Coords) < 2 {
+		return 0
+	}
+	return l.Coords[0]
+}
+
+// Distance returns the great circle distance between the two points in metres
+func Distance(a, b Loc) float64 {
+	lat1, lat2 := a.Lat()*math.Pi/180, b.Lat()*math.Pi/180
+	dLat := lat2 - lat1
+	dLong := (b.Long() - a.Long()) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLong/2)*math.Sin(dLong/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// GetLocationsNear returns the locations within radius metres of the point, nearest first.
+// Only locations whose coordinates were found while scraping can be returned.
+func (config *DB) GetLocationsNear(ctx context.Context, point Loc, radius float64, options ...Option) ([]Location, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	if point.Type != "Point" || len(point.Coords) != 2 {
+		return nil, errors.New("GetLocationsNear needs a point, see NewPoint")
+	}
+	if radius <= 0 {
+		return nil, fmt.Errorf("Invalid radius %v", radius)
+	}
+
+	txn := config.readTxn(ctx)
+	// Dgraph doesn't accept variables inside geo functions, the values are all floats so are safe to format in
+	q := fmt.Sprintf(`{
+		near(func: near(location.loc, [%f, %f], %d)) @filter(type(Location)) {
+			uid
+			location.id
+			location.name
+			location.loc
+			location.disabled_access
+			location.campus
+			location.capacity
+		}
+	}`, point.Long(), point.Lat(), int(math.Ceil(radius)))
+
+	resp, err := config.runQuery(ctx, txn, "GetLocationsNear", q, nil)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Near []Location `json:"near"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(r.Near, func(i, j int) bool {
+		return Distance(point, r.Near[i].Location) < Distance(point, r.Near[j].Location)
+	})
+	return r.Near, nil
+}
+
+// EventNear is an event found by GetEventsNear, along with how far away it is
+type EventNear struct {
+	Event Event
+	// Distance is how far the nearest of the event's locations is from the point, in metres as the crow flies
+	Distance float64
+}
+
+// GetEventsNear returns the events overlapping [from, to] taking place within radius metres of the point, nearest first
+// and then in the order they start. Only the events in locations whose coordinates were found while scraping can be returned.
+func (config *DB) GetEventsNear(ctx context.Context, point Loc, radius float64, from, to time.Time, options ...Option) ([]EventNear, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	if point.Type != "Point" || len(point.Coords) != 2 {
+		return nil, errors.New("GetEventsNear needs a point, see NewPoint")
+	}
+	if radius <= 0 {
+		return nil, fmt.Errorf("Invalid radius %v", radius)
+	}
+
+	txn := config.readTxn(ctx)
+	// The locations are returned along with the events, as the events' locations don't come with their coordinates
+	q := fmt.Sprintf(
+		`query EventsNear($from: string, $to: string) {
+			near as nearby(func: near(location.loc, [%f, %f], %d)) @filter(type(Location)) {
+				uid
+				location.loc
+			}
+			var(func: uid(near)) {
+				located as ~event.location
+			}
+			events(func: uid(located), orderasc: event.start_date) @filter(type(Event) AND NOT has(event.deleted_at) AND le(event.start_date, $to) AND ge(event.end_date, $from)) {
+				%s
+			}
+		}
+	`, point.Long(), point.Lat(), int(math.Ceil(radius)), eventPredicates)
+
+	vars := map[string]string{"$from": formatTime(from), "$to": formatTime(to)}
+	resp, err := config.runQuery(ctx, txn, "GetEventsNear", q, vars)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Near   []Location `json:"nearby"`
+		Events []Event    `json:"events"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	distances := make(map[string]float64, len(r.Near))
+	for _, l := range r.Near {
+		distances[l.UID] = Distance(point, l.Location)
+	}
+	return nearestEvents(r.Events, distances), nil
+}
+
+// nearestEvents returns the events with the distance of the nearest of their locations in distances,
+// which are only those near enough, nearest first and otherwise in the order they were given
+func nearestEvents(events []Event, distances map[string]float64) []EventNear {
+	near := make([]EventNear, 0, len(events))
+	for _, e := range events {
+		nearest, found := 0.0, false
+		for _, l := range e.Location {
+			if d, ok := distances[l.UID]; ok && (!found || d < nearest) {
+				nearest, found = d, true
+			}
+		}
+		if found {
+			near = append(near, EventNear{Event: e, Distance: nearest})
+		}
+	}
+	sort.SliceStable(near, func(i, j int) bool {
+		return near[i].Distance < near[j].Distance
+	})
+	return near
+}
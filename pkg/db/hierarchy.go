@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// maxLocationDepth bounds how far up the hierarchy GetLocationAncestors looks, in case of a loop in the data
+const maxLocationDepth = 10
+
+// locationRoot returns the root function finding the location by Uid if it has one, or by location.id otherwise,
+// and its query variable
+func locationRoot(loc Location) (string, map[string]string, error) {
+	switch {
+	case loc.UID != "":
+		return "uid($key)", map[string]string{"$key": loc.UID}, nil
+	case loc.ID != "":
+		return "eq(location.id, $key)", map[string]string{"$key": loc.ID}, nil
+	default:
+		return "", nil, errors.New("The location needs a Uid or an ID")
+	}
+}
+
+// GetBuildingRooms returns the locations which are part of the building, ordered by their id.
+// The building is looked up by Uid if it has one, or by location.id otherwise.
+func (config *DB) GetBuildingRooms(ctx context.Context, building Location, options ...Option) ([]Location, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	root, variables, err := locationRoot(building)
+	if err != nil {
+		return nil, err
+	}
+
+	txn := config.readTxn(ctx)
+	q := fmt.Sprintf(
+		`query BuildingRooms($key: string) {
+			building(func: %s) @filter(type(Location)) {
+				rooms: ~location.part_of (orderasc: location.id) @filter(type(Location)) {
+					uid
+					location.id
+					location.name
+					location.loc
+					location.disabled_access
+					location.campus
+					location.capacity
+				}
+			}
+		}
+	`, root)
+
+	resp, err := config.runQuery(ctx, txn, "GetBuildingRooms", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Building []struct {
+			Rooms []Location `json:"rooms"`
+		} `json:"building"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Building) == 0 {
+		return nil, notFound("Location", "key", variables["$key"])
+	}
+
+	rooms := r.Building[0].Rooms
+	if rooms == nil {
+		rooms = make([]Location, 0)
+	}
+	return rooms, nil
+}
+
+// GetLocationAncestors returns the locations containing the location, the closest first,
+// so a room returns its building and then whatever the building is part of.
+// The location is looked up by Uid if it has one, or by location.id otherwise.
+func (config *DB) GetLocationAncestors(ctx context.Context, loc Location, options ...Option) ([]Location, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	root, variables, err := locationRoot(loc)
+	if err != nil {
+		return nil, err
+	}
+
+	txn := config.readTxn(ctx)
+	q := fmt.Sprintf(
+		`query LocationAncestors($key: string) {
+			location(func: %s) @filter(type(Location)) @recurse(depth: %d, loop: false) {
+				uid
+				location.id
+				location.name
+				location.disabled_access
+				location.campus
+				location.capacity
+				location.part_of
+			}
+		}
+	`, root, maxLocationDepth+1)
+
+	resp, err := config.runQuery(ctx, txn, "GetLocationAncestors", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Location []Location `json:"location"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Location) == 0 {
+		return nil, notFound("Location", "key", variables["$key"])
+	}
+
+	ancestors := make([]Location, 0)
+	for parent := r.Location[0].PartOf; parent != nil; parent = parent.PartOf {
+		a := *parent
+		a.PartOf = nil
+		ancestors = append(ancestors, a)
+	}
+	return ancestors, nil
+}
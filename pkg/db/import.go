@@ -0,0 +1,308 @@
+package db
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// importKey is the predicate a type is upserted on when importing, and its dgraph type for the query variable
+type importKey struct {
+	predicate string
+	keyType   string
+}
+
+// importKeys are the upsert keys of each exported type, the same ones the Upsert... operations use
+var importKeys = map[string]importKey{
+	"Location":  {"location.id", "string"},
+	"Module":    {"module.code", "string"},
+	"Person":    {"person.name", "string"},
+	"Series":    {"series.id", "string"},
+	"Event":     {"event.id", "string"},
+	"Scrape":    {"scrape.id", "int"},
+	"ScrapeJob": {"job.id", "string"},
+	"Webhook":   {"webhook.id", "string"},
+	"Term":      {"term.id", "string"},
+	"User":      {"user.subject", "string"},
+}
+
+// pendingEdge is an edge of an imported node to a node further on in the dump, which has no uid yet
+type pendingEdge struct {
+	from      string
+	predicate string
+	edge      map[string]interface{}
+}
+
+// maxImportLine is the longest line Import will read, event descriptions can be long
+const maxImportLine = 16 * 1024 * 1024
+
+// Import reads a json lines dump, as written by ExportAll with ExportJSON, and upserts every node in it.
+// Nodes are matched against existing ones on the same keys as the Upsert... operations,
+// and the uids in the dump are remapped to the uids in this database, so edges point at the right nodes.
+// Edges to nodes in later chunks of the dump are added once every node has been imported,
+// and edges to nodes which aren't in the dump are dropped.
+// It returns the number of nodes imported.
+func (config *DB) Import(ctx context.Context, r io.Reader, options ...Option) (int, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLine)
+
+	// remap holds the uid each node in the dump was given in this database
+	remap := make(map[string]string)
+	pending := make([]pendingEdge, 0)
+	chunk := make([]map[string]interface{}, 0, DefaultBatchSize)
+	imported := 0
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var node map[string]interface{}
+		err := json.Unmarshal([]byte(line), &node)
+		if err != nil {
+			return imported, err
+		}
+		chunk = append(chunk, node)
+
+		if len(chunk) == DefaultBatchSize {
+			pending, err = config.importChunk(ctx, chunk, imported, remap, pending)
+			if err != nil {
+				return imported, err
+			}
+			imported += len(chunk)
+			chunk = chunk[:0]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return imported, err
+	}
+
+	if len(chunk) > 0 {
+		var err error
+		pending, err = config.importChunk(ctx, chunk, imported, remap, pending)
+		if err != nil {
+			return imported, err
+		}
+		imported += len(chunk)
+	}
+
+	for start := 0; start < len(pending); start += DefaultBatchSize {
+		end := start + DefaultBatchSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+		err := config.importPending(ctx, pending[start:end], remap)
+		if err != nil {
+			return imported, err
+		}
+	}
+	return imported, nil
+}
+
+// importPending adds the edges which pointed further on in the dump, now that every node in it has a uid
+func (config *DB) importPending(ctx context.Context, edges []pendingEdge, remap map[string]string) error {
+	toWrite := make([]map[string]interface{}, 0, len(edges))
+	for _, p := range edges {
+		target, _ := edgeUID(p.edge)
+		uid, ok := remap[target]
+		if !ok {
+			continue
+		}
+		toWrite = append(toWrite, map[string]interface{}{
+			"uid":       remap[p.from],
+			p.predicate: withUID(p.edge, uid),
+		})
+	}
+	if len(toWrite) == 0 {
+		return nil
+	}
+
+	pb, err := json.Marshal(toWrite)
+	if err != nil {
+		return err
+	}
+	_, err = config.commit(ctx, "Import", &Request{
+		Mutations: []*Mutation{{SetJSON: pb}},
+	})
+	return err
+}
+
+// importChunk writes a chunk of dumped nodes as one upsert block, and records the uid each one was given in remap.
+// The edges to nodes which it can't resolve yet are returned appended to pending.
+// offset is the position of the chunk within the dump, and keeps the query variables and blank nodes unique.
+func (config *DB) importChunk(ctx context.Context, chunk []map[string]interface{}, offset int, remap map[string]string, pending []pendingEdge) ([]pendingEdge, error) {
+	params := make([]string, 0)
+	blocks := make([]string, 0)
+	variables := make(map[string]string)
+
+	// refs are how each node is referred to within this mutation, before it has been given a uid
+	refs := make(map[string]string)
+	oldUIDs := make([]string, len(chunk))
+	for i, node := range chunk {
+		n := offset + i
+		oldUIDs[i], _ = node["uid"].(string)
+
+		ref := fmt.Sprintf("_:node%d", n)
+		if key, value, ok := nodeKey(node); ok {
+			params = append(params, fmt.Sprintf("$key%d: %s", n, key.keyType))
+			blocks = append(blocks, fmt.Sprintf("v%d as var(func: eq(%s, $key%d))", n, key.predicate, n))
+			blocks = append(blocks, fmt.Sprintf("u%d(func: uid(v%d)) { uid }", n, n))
+			variables[fmt.Sprintf("$key%d", n)] = value
+			ref = fmt.Sprintf("uid(v%d)", n)
+		}
+		refs[oldUIDs[i]] = ref
+	}
+
+	toWrite := make([]map[string]interface{}, len(chunk))
+	unresolved := make([]pendingEdge, 0)
+	for i, node := range chunk {
+		var later []pendingEdge
+		toWrite[i], later = remapNode(node, refs[oldUIDs[i]], func(old string) (string, bool) {
+			if uid, ok := remap[old]; ok {
+				return uid, true
+			}
+			ref, ok := refs[old]
+			return ref, ok
+		})
+		for _, p := range later {
+			p.from = oldUIDs[i]
+			unresolved = append(unresolved, p)
+		}
+	}
+
+	pb, err := json.Marshal(toWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &Request{
+		Mutations: []*Mutation{{SetJSON: pb}},
+	}
+	if len(blocks) > 0 {
+		req.Query = fmt.Sprintf("query Import(%s) {\n%s\n}", strings.Join(params, ", "), strings.Join(blocks, "\n"))
+		req.Vars = variables
+	}
+
+	assigned, err := config.commit(ctx, "Import", req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Existing nodes come back in the query blocks, new ones in the assigned uids
+	var existing map[string][]struct {
+		UID string `json:"uid"`
+	}
+	if len(blocks) > 0 {
+		err = json.Unmarshal(assigned.JSON, &existing)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i, old := range oldUIDs {
+		n := offset + i
+		ref := refs[old]
+		if strings.HasPrefix(ref, "_:") {
+			remap[old] = assigned.UIDs[strings.TrimPrefix(ref, "_:")]
+		} else if found := existing[fmt.Sprintf("u%d", n)]; len(found) > 0 {
+			remap[old] = found[0].UID
+		} else {
+			remap[old] = assigned.UIDs[ref]
+		}
+	}
+	return append(pending, unresolved...), nil
+}
+
+// nodeKey returns the upsert key of the dumped node and its value, if its type has one and it is set
+func nodeKey(node map[string]interface{}) (importKey, string, bool) {
+	types, _ := node["dgraph.type"].([]interface{})
+	for _, t := range types {
+		name, _ := t.(string)
+		key, ok := importKeys[name]
+		if !ok {
+			continue
+		}
+		switch value := node[key.predicate].(type) {
+		case string:
+			return key, value, value != ""
+		case float64:
+			return key, strconv.FormatInt(int64(value), 10), true
+		}
+	}
+	return importKey{}, "", false
+}
+
+// remapNode returns a copy of the dumped node with its uid replaced by ref,
+// and every edge pointed at the uid resolve returns for it, keeping its facets.
+// The edges resolve doesn't know are left out of the copy and returned, to be added later.
+func remapNode(node map[string]interface{}, ref string, resolve func(string) (string, bool)) (map[string]interface{}, []pendingEdge) {
+	out := make(map[string]interface{}, len(node))
+	later := make([]pendingEdge, 0)
+	for p, v := range node {
+		if p == "uid" {
+			continue
+		}
+		switch value := v.(type) {
+		case []interface{}:
+			values := make([]interface{}, 0, len(value))
+			for _, item := range value {
+				if edge, ok := edgeUID(item); ok {
+					if uid, ok := resolve(edge); ok {
+						values = append(values, withUID(item.(map[string]interface{}), uid))
+					} else {
+						later = append(later, pendingEdge{predicate: p, edge: item.(map[string]interface{})})
+					}
+					continue
+				}
+				values = append(values, item)
+			}
+			if len(values) > 0 {
+				out[p] = values
+			}
+		default:
+			if edge, ok := edgeUID(value); ok {
+				if uid, ok := resolve(edge); ok {
+					out[p] = withUID(value.(map[string]interface{}), uid)
+				} else {
+					later = append(later, pendingEdge{predicate: p, edge: value.(map[string]interface{})})
+				}
+				continue
+			}
+			out[p] = value
+		}
+	}
+	out["uid"] = ref
+	return out, later
+}
+
+// edgeUID returns the uid an edge in the dump points at.
+// Edges hold a uid and their facets, keyed by predicate|facet, and objects with anything else in them are geojson values.
+func edgeUID(v interface{}) (string, bool) {
+	object, ok := v.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	for key := range object {
+		if key != "uid" && !strings.Contains(key, "|") {
+			return "", false
+		}
+	}
+	uid, ok := object["uid"].(string)
+	return uid, ok
+}
+
+// withUID returns a copy of the edge pointed at uid, with the same facets
+func withUID(edge map[string]interface{}, uid string) map[string]interface{} {
+	out := make(map[string]interface{}, len(edge))
+	for key, v := range edge {
+		out[key] = v
+	}
+	out["uid"] = uid
+	return out
+}
@@ -0,0 +1,173 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// The statuses of a ScrapeJob
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// jobPredicates are the predicates of a ScrapeJob the getters return
+const jobPredicates = `uid
+	job.id
+	job.status
+	job.from
+	job.to
+	job.module
+	job.total
+	job.done
+	job.failed
+	job.error
+	job.requested_at
+	job.started_at
+	job.finished_at`
+
+// UpsertScrapeJob stores the job, matching jobs without a Uid on job.id
+func (config *DB) UpsertScrapeJob(ctx context.Context, job ScrapeJob, options ...Option) (*Response, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	if len(job.DType) == 0 {
+		job.DType = []string{"ScrapeJob"}
+	}
+	if job.UID == "" && job.ID == "" {
+		return nil, errors.New("UpsertScrapeJob needs a job with a Uid or an ID")
+	}
+	if job.UID == "" {
+		job.UID = upsertVar
+		req, err := upsertRequest("job.id", "string", job.ID, job)
+		if err != nil {
+			return nil, err
+		}
+		return config.commit(ctx, "UpsertScrapeJob", req)
+	}
+	req, err := mutationRequest(job)
+	if err != nil {
+		return nil, err
+	}
+	return config.commit(ctx, "UpsertScrapeJob", req)
+}
+
+// GetScrapeJob returns the job with the job.id, or an error wrapping ErrNotFound if there is no such job
+func (config *DB) GetScrapeJob(ctx context.Context, id string, options ...Option) (*ScrapeJob, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+	q := fmt.Sprintf(
+		`query ScrapeJob($id: string) {
+			job(func: eq(job.id, $id)) @filter(type(ScrapeJob)) {
+				%s
+			}
+		}
+	`, jobPredicates)
+	resp, err := config.runQuery(ctx, txn, "GetScrapeJob", q, map[string]string{"$id": id})
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Job []ScrapeJob `json:"job"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Job) == 0 {
+		return nil, notFound("ScrapeJob", "job.id", id)
+	}
+	return &r.Job[0], nil
+}
+
+// GetQueuedScrapeJobs returns up to limit of the jobs still queued, oldest first
+func (config *DB) GetQueuedScrapeJobs(ctx context.Context, limit int, options ...Option) ([]ScrapeJob, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+	q := fmt.Sprintf(
+		`query QueuedScrapeJobs($status: string, $first: int) {
+			jobs(func: eq(job.status, $status), orderasc: job.requested_at, first: $first) @filter(type(ScrapeJob)) {
+				%s
+			}
+		}
+	`, jobPredicates)
+	variables := make(map[string]string)
+	variables["$status"] = JobQueued
+	variables["$first"] = strconv.Itoa(ListOptions{First: limit}.first())
+
+	resp, err := config.runQuery(ctx, txn, "GetQueuedScrapeJobs", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Jobs []ScrapeJob `json:"jobs"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	if r.Jobs == nil {
+		return make([]ScrapeJob, 0), nil
+	}
+	return r.Jobs, nil
+}
+
+// GetModuleScrapeIDs returns the ids of the timetable feeds which found events of the module with the code, in order,
+// which are the feeds to rescrape to update the module's events.
+// An error wrapping ErrNotFound is returned if there is no such module.
+func (config *DB) GetModuleScrapeIDs(ctx context.Context, moduleCode string, options ...Option) ([]int, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+	q := `query ModuleScrapeIDs($code: string) {
+			module(func: eq(module.code, $code)) @filter(type(Module)) {
+				uid
+				~event.part_of_module {
+					found as ~scrape.found_event
+				}
+			}
+			scrapes(func: uid(found), orderasc: scrape.id) @filter(type(Scrape)) {
+				scrape.id
+			}
+		}
+	`
+	resp, err := config.runQuery(ctx, txn, "GetModuleScrapeIDs", q, map[string]string{"$code": moduleCode})
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Module []struct {
+			UID string `json:"uid"`
+		} `json:"module"`
+		Scrapes []Scrape `json:"scrapes"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Module) == 0 {
+		return nil, notFound("Module", "module.code", moduleCode)
+	}
+
+	ids := make([]int, 0, len(r.Scrapes))
+	for _, s := range r.Scrapes {
+		ids = append(ids, s.ID)
+	}
+	return ids, nil
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// leasePredicates are the predicates of a Lease the getters return
+const leasePredicates = `uid
+	lease.name
+	lease.holder
+	lease.expires_at
+	lease.cursor`
+
+// AcquireLease gives the lease with the name to the holder until ttl from now, if nobody else holds it or their hold has expired,
+// creating it if there is no such lease yet. The holder renews the lease by acquiring it again.
+// If someone else holds it an error wrapping ErrLeaseHeld is returned.
+// lease.name is an upsert index and the holder is written even when it is renewed, so replicas acquiring it at the same time
+// conflict and only one of them gets it.
+func (config *DB) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration, options ...Option) (*Lease, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	var acquired *Lease
+	err := config.WithTxn(ctx, func(txn *Txn) error {
+		lease, err := config.getLease(ctx, txn, name)
+		if err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		if lease == nil {
+			lease = &Lease{UID: "_:lease", Name: name}
+		} else if lease.Holder != holder && lease.ExpiresAt != nil && lease.ExpiresAt.After(now) {
+			return fmt.Errorf("%w: %s is held by %s until %s", ErrLeaseHeld, name, lease.Holder, lease.ExpiresAt.Format(time.RFC3339))
+		}
+		expires := now.Add(ttl)
+		lease.Holder, lease.ExpiresAt, lease.DType = holder, &expires, []string{"Lease"}
+
+		req, err := mutationRequest(lease)
+		if err != nil {
+			return err
+		}
+		resp, err := config.runRequest(ctx, txn, "AcquireLease", req)
+		if err != nil {
+			return err
+		}
+		if lease.UID == "_:lease" {
+			lease.UID = resp.UIDs["lease"]
+		}
+		lease.DType = nil
+		acquired = lease
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return acquired, nil
+}
+
+// SetLeaseCursor stores how far the holder of the lease has got, as long as they still hold it,
+// returning an error wrapping ErrLeaseHeld if someone else has taken it over
+func (config *DB) SetLeaseCursor(ctx context.Context, name, holder string, cursor int64, options ...Option) error {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	return config.WithTxn(ctx, func(txn *Txn) error {
+		lease, err := config.getLease(ctx, txn, name)
+		if err != nil {
+			return err
+		}
+		if lease == nil || lease.Holder != holder {
+			return fmt.Errorf("%w: %s isn't held by %s", ErrLeaseHeld, name, holder)
+		}
+		// Writing the holder again makes this conflict with another replica acquiring the lease at the same time
+		req, err := mutationRequest(Lease{UID: lease.UID, Holder: holder, Cursor: cursor})
+		if err != nil {
+			return err
+		}
+		_, err = config.runRequest(ctx, txn, "SetLeaseCursor", req)
+		return err
+	})
+}
+
+// getLease returns the lease with the name, or nil if there is no such lease
+func (config *DB) getLease(ctx context.Context, txn *Txn, name string) (*Lease, error) {
+	q := fmt.Sprintf(
+		`query Lease($name: string) {
+			lease(func: eq(lease.name, $name)) @filter(type(Lease)) {
+				%s
+			}
+		}
+	`, leasePredicates)
+	resp, err := config.runQuery(ctx, txn, "GetLease", q, map[string]string{"$name": name})
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Lease []Lease `json:"lease"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Lease) == 0 {
+		return nil, nil
+	}
+	return &r.Lease[0], nil
+}
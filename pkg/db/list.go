@@ -0,0 +1,602 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultListLimit is the page size used when ListOptions.First is not set
+	DefaultListLimit = 100
+	// MaxListLimit is the largest page size a list query will return
+	MaxListLimit = 1000
+)
+
+// eventPredicates is the body of a query block returning an event, along with its edges
+const eventPredicates = `
+	uid
+	event.id
+	event.title
+	event.description
+	event.start_date
+	event.end_date
+	event.organiser @facets(role) {
+		uid
+		person.name
+	}
+	event.part_of_module @facets(weight, required) {
+		uid
+		module.code
+		module.name
+	}
+	event.location {
+		uid
+		location.id
+		location.name
+		location.disabled_access
+		location.campus
+		location.capacity
+	}
+	event.series {
+		uid
+		series.id
+		series.title
+	}
+`
+
+// locationListPredicates is the body of a query block returning a location in a list, along with the location it is part of
+const locationListPredicates = `
+	uid
+	location.id
+	location.name
+	location.loc
+	location.disabled_access
+	location.campus
+	location.capacity
+	location.part_of {
+		uid
+		location.id
+		location.name
+		location.disabled_access
+		location.campus
+	}
+`
+
+// moduleListPredicates is the body of a query block returning a module in a list
+const moduleListPredicates = `
+	uid
+	module.code
+	module.name
+	module.subject
+`
+
+var uidRegex = regexp.MustCompile(`\A0x[0-9a-fA-F]+\z`)
+
+// ListOptions controls the pagination of list queries
+type ListOptions struct {
+	// First is the maximum number of results, defaulting to DefaultListLimit and capped at MaxListLimit
+	First int
+	// Offset skips this many results
+	Offset int
+	// After only returns nodes with a uid after this one, which is cheaper than Offset for deep pages.
+	// Dgraph can only page with After in uid order, so setting it ignores the usual ordering.
+	After string
+	// Descending reverses the ordering
+	Descending bool
+	// Sort orders the results by these predicates in turn, replacing the usual ordering which only breaks the ties,
+	// and Descending along with it. Each must be a scalar predicate of the nodes listed.
+	Sort []SortKey
+	// Accessible only lists the locations with disabled access, and the events in at least one of them,
+	// for ListEvents, ListEventsAfter and ListLocations
+	Accessible bool
+	// Campus, one of Campuses, only lists the locations on it and the events in at least one of them the same way
+	Campus string
+	// Fields narrows the results to these predicates, such as event.title, to query less for the clients only wanting some.
+	// The uid and the predicate the results are ordered by are always returned, and every predicate is without it.
+	Fields []string
+}
+
+// first returns the page size to use
+func (opts ListOptions) first() int {
+	if opts.First <= 0 {
+		return DefaultListLimit
+	}
+	if opts.First > MaxListLimit {
+		return MaxListLimit
+	}
+	return opts.First
+}
+
+// paginate returns the pagination and ordering arguments of a root query function, ordering by the predicate
+// The arguments refer to the $first and $offset variables, which are filled in by variables.
+func (opts ListOptions) paginate(orderBy string) (string, error) {
+	if opts.After != "" {
+		if !uidRegex.MatchString(opts.After) {
+			return "", fmt.Errorf("Invalid cursor %q", opts.After)
+		}
+		return fmt.Sprintf("first: $first, offset: $offset, after: %s", opts.After), nil
+	}
+	if len(opts.Sort) > 0 {
+		ordering, err := sortOrder(opts.Sort, orderBy)
+		if err != nil {
+			return "", err
+		}
+		return ordering + ", first: $first, offset: $offset", nil
+	}
+	order := "orderasc"
+	if opts.Descending {
+		order = "orderdesc"
+	}
+	return fmt.Sprintf("%s: %s, first: $first, offset: $offset", order, orderBy), nil
+}
+
+// variables returns the query variables used by paginate
+func (opts ListOptions) variables() map[string]string {
+	offset := opts.Offset
+	if offset < 0 {
+		offset = 0
+	}
+	return map[string]string{
+		"$first":  strconv.Itoa(opts.first()),
+		"$offset": strconv.Itoa(offset),
+	}
+}
+
+// Includes returns whether the location is one the Accessible and Campus of the options leave in a list
+func (opts ListOptions) Includes(l Location) bool {
+	return (!opts.Accessible || l.DisabledAccess) && (opts.Campus == "" || l.Campus == opts.Campus)
+}
+
+// locationFilter returns the filter on locations the Accessible and Campus of the options ask for, joined with AND,
+// or "" if they don't ask for either. The campus is put into the filter as it is, so it has to be one of Campuses.
+func (opts ListOptions) locationFilter() (string, error) {
+	var filters []string
+	if opts.Accessible {
+		filters = append(filters, "eq(location.disabled_access, true)")
+	}
+	if opts.Campus != "" {
+		if !IsCampus(opts.Campus) {
+			return "", fmt.Errorf("Unknown campus %q", opts.Campus)
+		}
+		filters = append(filters, fmt.Sprintf("eq(location.campus, %q)", opts.Campus))
+	}
+	return strings.Join(filters, " AND "), nil
+}
+
+// locatedEvents returns the query block and filter narrowing a list of events to those in at least one of the locations
+// Includes leaves in, or nothing if the options don't narrow the locations. The filter is joined onto the others with AND.
+func (opts ListOptions) locatedEvents() (string, string, error) {
+	filter, err := opts.locationFilter()
+	if err != nil || filter == "" {
+		return "", "", err
+	}
+	return fmt.Sprintf(`var(func: type(Location)) @filter(%s) {
+				located as ~event.location
+			}`, filter), " AND uid(located)", nil
+}
+
+// selectPredicates narrows the body of a query block to the predicates in fields, along with uid and those in keep.
+// The edges are kept with everything in their block. The whole body is returned if fields is empty.
+func selectPredicates(predicates string, fields []string, keep ...string) string {
+	if len(fields) == 0 {
+		return predicates
+	}
+	wanted := map[string]bool{"uid": true}
+	for _, f := range append(fields, keep...) {
+		wanted[f] = true
+	}
+	var selected []string
+	depth, keeping := 0, false
+	for _, line := range strings.Split(predicates, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		// Each predicate starts a line outside of any block, the lines in its block are kept along with it
+		if depth == 0 {
+			keeping = wanted[strings.Fields(trimmed)[0]]
+		}
+		depth += strings.Count(trimmed, "{") - strings.Count(trimmed, "}")
+		if keeping {
+			selected = append(selected, line)
+		}
+	}
+	return strings.Join(selected, "\n")
+}
+
+// ListEvents returns a page of events ordered by their start date
+func (config *DB) ListEvents(ctx context.Context, opts ListOptions, options ...Option) ([]Event, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+
+	pagination, err := opts.paginate("event.start_date")
+	if err != nil {
+		return nil, err
+	}
+	locatedBlock, locatedFilter, err := opts.locatedEvents()
+	if err != nil {
+		return nil, err
+	}
+	q := fmt.Sprintf(
+		`query ListEvents($first: int, $offset: int) {
+			%s
+			listEvents(func: type(Event), %s) @filter(NOT has(event.deleted_at)%s) {
+				%s
+			}
+		}
+	`, locatedBlock, pagination, locatedFilter, selectPredicates(eventPredicates, opts.Fields, "event.start_date"))
+
+	resp, err := config.runQuery(ctx, txn, "ListEvents", q, opts.variables())
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		ListEvents []Event `json:"listEvents"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.ListEvents, nil
+}
+
+// EventCursor is where a page of events listed by ListEventsAfter starts, just after the event with this start date and uid.
+// Unlike an offset it stays put as events are added and removed before it, so paging through every event doesn't skip or repeat any.
+type EventCursor struct {
+	Start time.Time
+	UID   string
+}
+
+// CursorAt returns the cursor just after the event, which must have a start date
+func CursorAt(e Event) EventCursor {
+	return EventCursor{Start: *e.StartDate, UID: e.UID}
+}
+
+// Precedes returns whether the event comes after the cursor, in the order of their start date and then their uid
+// the events are listed in. Events without a start date are never listed after a cursor.
+func (c EventCursor) Precedes(e Event) bool {
+	if e.StartDate == nil {
+		return false
+	}
+	if !e.StartDate.Equal(c.Start) {
+		return e.StartDate.After(c.Start)
+	}
+	return uidValue(e.UID) > uidValue(c.UID)
+}
+
+// uidValue returns the number a uid such as 0x1f stands for, uids are assigned in increasing order
+func uidValue(uid string) uint64 {
+	n, _ := strconv.ParseUint(strings.TrimPrefix(uid, "0x"), 16, 64)
+	return n
+}
+
+// ListEventsAfter returns up to opts.First events after the cursor, ordered by their start date and then their uid.
+// The events starting at the same time as the cursor are paged in uid order with after, ahead of the later ones,
+// which dgraph returns in uid order when they share a start date too. The offset and ordering of the options are ignored.
+func (config *DB) ListEventsAfter(ctx context.Context, cursor EventCursor, opts ListOptions, options ...Option) ([]Event, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+	return config.eventsAfter(ctx, "ListEventsAfter", cursor, opts, "", nil)
+}
+
+// eventsAfter runs the query of ListEventsAfter as the operation op, with the filter joined onto both of its blocks.
+// The filter can use the string variables in vars.
+func (config *DB) eventsAfter(ctx context.Context, op string, cursor EventCursor, opts ListOptions, filter string, vars map[string]string) ([]Event, error) {
+	if !uidRegex.MatchString(cursor.UID) {
+		return nil, fmt.Errorf("Invalid cursor %q", cursor.UID)
+	}
+	locatedBlock, locatedFilter, err := opts.locatedEvents()
+	if err != nil {
+		return nil, err
+	}
+	txn := config.readTxn(ctx)
+	predicates := selectPredicates(eventPredicates, opts.Fields, "event.start_date")
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	params := ""
+	for _, name := range names {
+		params += ", " + name + ": string"
+	}
+	locatedFilter += filter
+	q := fmt.Sprintf(
+		`query %s($start: string, $first: int%s) {
+			%s
+			same(func: eq(event.start_date, $start), first: $first, after: %s) @filter(type(Event) AND NOT has(event.deleted_at)%s) {
+				%s
+			}
+			later(func: gt(event.start_date, $start), orderasc: event.start_date, first: $first) @filter(type(Event) AND NOT has(event.deleted_at)%s) {
+				%s
+			}
+		}
+	`, op, params, locatedBlock, cursor.UID, locatedFilter, predicates, locatedFilter, predicates)
+	first := opts.first()
+	variables := map[string]string{
+		"$start": cursor.Start.UTC().Format(time.RFC3339Nano),
+		"$first": strconv.Itoa(first),
+	}
+	for name, value := range vars {
+		variables[name] = value
+	}
+	resp, err := config.runQuery(ctx, txn, op, q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Same  []Event `json:"same"`
+		Later []Event `json:"later"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	events := append(r.Same, r.Later...)
+	if len(events) > first {
+		events = events[:first]
+	}
+	if events == nil {
+		return make([]Event, 0), nil
+	}
+	return events, nil
+}
+
+// ListScrapes returns a page of scrapes ordered by when they were last scraped, the most out of date first.
+// Their found events are not included.
+func (config *DB) ListScrapes(ctx context.Context, opts ListOptions, options ...Option) ([]Scrape, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+
+	pagination, err := opts.paginate("scrape.last_scraped")
+	if err != nil {
+		return nil, err
+	}
+	q := fmt.Sprintf(
+		`query ListScrapes($first: int, $offset: int) {
+			listScrapes(func: type(Scrape), %s) {
+				uid
+				scrape.id
+				scrape.last_scraped
+			}
+		}
+	`, pagination)
+
+	resp, err := config.runQuery(ctx, txn, "ListScrapes", q, opts.variables())
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		ListScrapes []Scrape `json:"listScrapes"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.ListScrapes, nil
+}
+
+// GetScrapesSince returns up to limit scrapes which were last scraped after since, the least recently scraped first,
+// such as the scrapes which have finished since the last time they were checked.
+// A limit of 0 uses DefaultListLimit, and it is capped at MaxListLimit.
+func (config *DB) GetScrapesSince(ctx context.Context, since time.Time, limit int, options ...Option) ([]Scrape, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+	q :=
+		`query ScrapesSince($since: string, $first: int) {
+			scrapes(func: gt(scrape.last_scraped, $since), orderasc: scrape.last_scraped, first: $first) @filter(type(Scrape)) {
+				uid
+				scrape.id
+				scrape.last_scraped
+			}
+		}
+	`
+	variables := make(map[string]string)
+	variables["$since"] = since.UTC().Format(time.RFC3339Nano)
+	variables["$first"] = strconv.Itoa(ListOptions{First: limit}.first())
+
+	resp, err := config.runQuery(ctx, txn, "GetScrapesSince", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Scrapes []Scrape `json:"scrapes"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Scrapes, nil
+}
+
+// ListLocations returns a page of locations ordered by their location.id, along with the location each is part of
+func (config *DB) ListLocations(ctx context.Context, opts ListOptions, options ...Option) ([]Location, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+
+	pagination, err := opts.paginate("location.id")
+	if err != nil {
+		return nil, err
+	}
+	filter, err := opts.locationFilter()
+	if err != nil {
+		return nil, err
+	}
+	if filter != "" {
+		filter = "@filter(" + filter + ")"
+	}
+	q := fmt.Sprintf(
+		`query ListLocations($first: int, $offset: int) {
+			listLocations(func: type(Location), %s) %s {
+				%s
+			}
+		}
+	`, pagination, filter, selectPredicates(locationListPredicates, opts.Fields, "location.id"))
+
+	resp, err := config.runQuery(ctx, txn, "ListLocations", q, opts.variables())
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		ListLocations []Location `json:"listLocations"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.ListLocations, nil
+}
+
+// ListModules returns a page of modules ordered by their module code
+func (config *DB) ListModules(ctx context.Context, opts ListOptions, options ...Option) ([]Module, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+
+	pagination, err := opts.paginate("module.code")
+	if err != nil {
+		return nil, err
+	}
+	q := fmt.Sprintf(
+		`query ListModules($first: int, $offset: int) {
+			listModules(func: type(Module), %s) {
+				%s
+			}
+		}
+	`, pagination, selectPredicates(moduleListPredicates, opts.Fields, "module.code"))
+
+	resp, err := config.runQuery(ctx, txn, "ListModules", q, opts.variables())
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		ListModules []Module `json:"listModules"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.ListModules, nil
+}
+
+// ListPeople returns a page of people ordered by their name.
+// If name is set, only the people with any of its words in their name are returned.
+func (config *DB) ListPeople(ctx context.Context, name string, opts ListOptions, options ...Option) ([]Person, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+
+	pagination, err := opts.paginate("person.name")
+	if err != nil {
+		return nil, err
+	}
+	params, filter := peopleFilter(name)
+	q := fmt.Sprintf(
+		`query ListPeople($first: int, $offset: int%s) {
+			listPeople(func: type(Person), %s) %s {
+				uid
+				person.name
+				person.email
+			}
+		}
+	`, params, pagination, filter)
+	variables := opts.variables()
+	if name != "" {
+		variables["$name"] = name
+	}
+
+	resp, err := config.runQuery(ctx, txn, "ListPeople", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		ListPeople []Person `json:"listPeople"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.ListPeople, nil
+}
+
+// peopleFilter returns the extra query parameter and the filter matching people on any of the words in the name,
+// or nothing if the name isn't set
+func peopleFilter(name string) (string, string) {
+	if name == "" {
+		return "", ""
+	}
+	return ", $name: string", "@filter(anyofterms(person.name, $name))"
+}
+
+// GetScrapesOlderThan returns up to limit scrapes which were last scraped more than age ago, the most out of date first.
+// A limit of 0 uses DefaultListLimit, and it is capped at MaxListLimit.
+func (config *DB) GetScrapesOlderThan(ctx context.Context, age time.Duration, limit int, options ...Option) ([]Scrape, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+	q :=
+		`query ScrapesOlderThan($cutoff: string, $first: int) {
+			scrapes(func: lt(scrape.last_scraped, $cutoff), orderasc: scrape.last_scraped, first: $first) @filter(type(Scrape)) {
+				uid
+				scrape.id
+				scrape.last_scraped
+			}
+		}
+	`
+	variables := make(map[string]string)
+	variables["$cutoff"] = formatTime(time.Now().Add(-age))
+	variables["$first"] = strconv.Itoa(ListOptions{First: limit}.first())
+
+	resp, err := config.runQuery(ctx, txn, "GetScrapesOlderThan", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Scrapes []Scrape `json:"scrapes"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Scrapes, nil
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lru is a fixed size, least recently used cache whose entries also expire after a ttl.
+// It is safe for concurrent use.
+type lru struct {
+	mx      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+func newLRU(size int, ttl time.Duration) *lru {
+	return &lru{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// get returns the value stored for the key, if there is one which hasn't expired
+func (c *lru) get(key string) (interface{}, bool) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*lruEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return entry.value, true
+}
+
+// set stores the value, evicting the least recently used entry if the cache is full
+func (c *lru) set(key string, value interface{}) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	expires := time.Now().Add(c.ttl)
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*lruEntry)
+		entry.value, entry.expires = value, expires
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expires: expires})
+	for c.size > 0 && c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+// purge removes every entry
+func (c *lru) purge() {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+}
@@ -0,0 +1,143 @@
+package memdb
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+// RecordChanges stores the changes, numbering them on from the latest change recorded
+func (m *DB) RecordChanges(ctx context.Context, changes []db.Change, options ...db.Option) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	for _, c := range changes {
+		m.lastSeq++
+		stored := c
+		stored.UID = m.newUID()
+		stored.Seq = m.lastSeq
+		stored.Changes = append([]db.FieldChange(nil), c.Changes...)
+		stored.Topics = append([]string(nil), c.Topics...)
+		stored.DType = []string{"Change"}
+		if c.At == nil {
+			stored.At = &now
+		}
+		if c.Event != nil {
+			stored.Event = &db.Event{UID: c.Event.UID}
+		}
+		if c.Scrape != nil {
+			stored.Scrape = &db.Scrape{UID: c.Scrape.UID}
+		}
+		m.changes[stored.UID] = &stored
+	}
+	return nil
+}
+
+// GetLatestChange returns the latest change recorded, or an error wrapping db.ErrNotFound if there aren't any
+func (m *DB) GetLatestChange(ctx context.Context, options ...db.Option) (*db.Change, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	changes := m.sortedChanges()
+	if len(changes) == 0 {
+		return nil, notFound("Change", "type", "Change")
+	}
+	latest := m.resolveChange(changes[len(changes)-1])
+	return &latest, nil
+}
+
+// ListChanges returns a page of the changes the filter lets through, oldest first or newest first if opts is Descending
+func (m *DB) ListChanges(ctx context.Context, filter db.ChangeFilter, opts db.ListOptions, options ...db.Option) ([]db.Change, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	changes := m.sortedChanges()
+	if opts.Descending {
+		for i, j := 0, len(changes)-1; i < j; i, j = i+1, j-1 {
+			changes[i], changes[j] = changes[j], changes[i]
+		}
+	}
+	out := make([]db.Change, 0)
+	for _, c := range changes {
+		if len(out) == firstOf(opts.First) {
+			break
+		}
+		if (filter.After > 0 && c.Seq <= filter.After) || (filter.Before > 0 && c.Seq >= filter.Before) {
+			continue
+		}
+		if filter.EventsOnly && c.Type == db.ChangeScraped {
+			continue
+		}
+		if len(filter.Topics) > 0 && !anyString(c.Topics, filter.Topics) {
+			continue
+		}
+		out = append(out, m.resolveChange(c))
+	}
+	return out, nil
+}
+
+// DeleteChangesBefore removes up to limit of the changes recorded before the time, oldest first
+func (m *DB) DeleteChangesBefore(ctx context.Context, before time.Time, limit int, options ...db.Option) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deleted := 0
+	for _, c := range m.sortedChanges() {
+		if deleted == firstOf(limit) {
+			break
+		}
+		if c.At != nil && c.At.Before(before) {
+			delete(m.changes, c.UID)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// sortedChanges returns the stored changes in the order of their Seq
+func (m *DB) sortedChanges() []*db.Change {
+	changes := make([]*db.Change, 0, len(m.changes))
+	for _, c := range m.changes {
+		changes = append(changes, c)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Seq < changes[j].Seq
+	})
+	return changes
+}
+
+// resolveChange returns a copy of the stored change with its event and scrape as they are now, as the db getters return it
+func (m *DB) resolveChange(c *db.Change) db.Change {
+	out := *c
+	out.Changes = append([]db.FieldChange(nil), c.Changes...)
+	out.Topics = append([]string(nil), c.Topics...)
+	out.DType = nil
+	out.Event, out.Scrape = nil, nil
+	if c.Event != nil {
+		if e, ok := m.events[c.Event.UID]; ok {
+			event := m.resolveEvent(e)
+			out.Event = &event
+		}
+	}
+	if c.Scrape != nil {
+		if s, ok := m.scrapes[c.Scrape.UID]; ok {
+			out.Scrape = &db.Scrape{UID: s.UID, ID: s.ID, LastScraped: s.LastScraped}
+		}
+	}
+	return out
+}
+
+// anyString returns whether any of the values is in the list
+func anyString(list, values []string) bool {
+	for _, v := range values {
+		for _, l := range list {
+			if l == v {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,904 @@
+package memdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+// findEvent returns the stored event with the Uid if it has one, or the event.id otherwise
+func (m *DB) findEvent(event db.Event, withDeleted bool) *db.Event {
+	var found *db.Event
+	if event.UID != "" {
+		found = m.events[event.UID]
+	} else if event.ID != "" {
+		for _, uid := range m.eventUIDs() {
+			if m.events[uid].ID == event.ID {
+				found = m.events[uid]
+				break
+			}
+		}
+	}
+	if found != nil && found.DeletedAt != nil && !withDeleted {
+		return nil
+	}
+	return found
+}
+
+func eventNotFound(event db.Event) error {
+	if event.UID != "" {
+		return notFound("Event", "uid", event.UID)
+	}
+	return notFound("Event", "event.id", event.ID)
+}
+
+// eventUIDs returns the uids of every stored event, in the order they were created
+func (m *DB) eventUIDs() []string {
+	uids := make([]string, 0, len(m.events))
+	for uid := range m.events {
+		uids = append(uids, uid)
+	}
+	return sortedUIDs(uids)
+}
+
+// liveEvents returns the events which aren't soft deleted, ordered by their start date
+func (m *DB) liveEvents(keep func(e *db.Event) bool) []db.Event {
+	events := make([]db.Event, 0)
+	for _, uid := range m.eventUIDs() {
+		e := m.events[uid]
+		if e.DeletedAt == nil && keep(e) {
+			events = append(events, m.resolveEvent(e))
+		}
+	}
+	sortByStart(events)
+	return events
+}
+
+// sortByStart orders the events by start date, with those without one last as dgraph does
+func sortByStart(events []db.Event) {
+	sort.SliceStable(events, func(i, j int) bool {
+		a, b := events[i].StartDate, events[j].StartDate
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		return a.Before(*b)
+	})
+}
+
+// located returns whether the event takes place in at least one of the locations the options leave in
+func (m *DB) located(e *db.Event, opts db.ListOptions) bool {
+	if !opts.Accessible && opts.Campus == "" {
+		return true
+	}
+	for _, edge := range e.Location {
+		if l, ok := m.locations[edge.UID]; ok && opts.Includes(*l) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveEvent returns a copy of the stored event with its edges filled in, as the db getters return it.
+// Revisions are only returned by GetEventHistory.
+func (m *DB) resolveEvent(e *db.Event) db.Event {
+	out := *e
+	out.Organiser = nil
+	out.PartOfModule = nil
+	out.Location = nil
+	out.Revisions = nil
+	out.Attendees = nil
+	out.Series = nil
+	if e.Series != nil {
+		if s, ok := m.series[e.Series.UID]; ok {
+			out.Series = &db.Series{UID: s.UID, ID: s.ID, Title: s.Title}
+		}
+	}
+	for _, edge := range e.Organiser {
+		if p, ok := m.people[edge.UID]; ok {
+			out.Organiser = append(out.Organiser, db.Person{UID: p.UID, Name: p.Name, Role: edge.Role})
+		}
+	}
+	for _, edge := range e.PartOfModule {
+		if mod, ok := m.modules[edge.UID]; ok {
+			out.PartOfModule = append(out.PartOfModule, db.Module{
+				UID:      mod.UID,
+				Code:     mod.Code,
+				Name:     mod.Name,
+				Weight:   edge.Weight,
+				Required: edge.Required,
+			})
+		}
+	}
+	for _, edge := range e.Location {
+		if l, ok := m.locations[edge.UID]; ok {
+			out.Location = append(out.Location, db.Location{
+				UID:            l.UID,
+				ID:             l.ID,
+				Name:           l.Name,
+				DisabledAccess: l.DisabledAccess,
+				Campus:         l.Campus,
+				Capacity:       l.Capacity,
+			})
+		}
+	}
+	return out
+}
+
+func overlaps(e *db.Event, from, to time.Time) bool {
+	return e.StartDate != nil && e.EndDate != nil && !e.StartDate.After(to) && !e.EndDate.Before(from)
+}
+
+// overlapsOpen is overlaps without the events which only touch the window, ending at from or starting at to,
+// as the availability is worked out
+func overlapsOpen(e *db.Event, from, to time.Time) bool {
+	return e.StartDate != nil && e.EndDate != nil && e.StartDate.Before(to) && e.EndDate.After(from)
+}
+
+// GetEvent returns the event looked up by Uid if it has one, or by event.id otherwise,
+// or an error wrapping db.ErrNotFound if there is no such event or it is soft deleted
+func (m *DB) GetEvent(ctx context.Context, event db.Event, options ...db.Option) (*db.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e := m.findEvent(event, false)
+	if e == nil {
+		return nil, eventNotFound(event)
+	}
+	out := m.resolveEvent(e)
+	return &out, nil
+}
+
+// GetEventTxn is GetEvent
+func (m *DB) GetEventTxn(ctx context.Context, txn *db.Txn, event db.Event, options ...db.Option) (*db.Event, error) {
+	return m.GetEvent(ctx, event)
+}
+
+// UpsertEvent stores the event, matching events without a Uid on event.id.
+// As with db.DB, a revision is kept when a stored event changes, and upserting a soft deleted event restores it.
+func (m *DB) UpsertEvent(ctx context.Context, event db.Event, options ...db.Option) (*db.Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	uid, created := m.upsertEvent(event, true, true)
+	return response(uid, created), nil
+}
+
+// UpsertEventTxn is UpsertEvent
+func (m *DB) UpsertEventTxn(ctx context.Context, txn *db.Txn, event db.Event, options ...db.Option) (*db.Response, error) {
+	return m.UpsertEvent(ctx, event)
+}
+
+// UpsertEventIfNewer is UpsertEvent, skipped if the stored copy of the scrape was last scraped no earlier than this one
+func (m *DB) UpsertEventIfNewer(ctx context.Context, event db.Event, scrape db.Scrape, options ...db.Option) (bool, error) {
+	if scrape.LastScraped == nil {
+		return false, errors.New("UpsertEventIfNewer needs a scrape with LastScraped set")
+	}
+	if scrape.UID == "" && scrape.ID == 0 {
+		return false, errors.New("UpsertEventIfNewer needs a scrape with a Uid or an ID")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s := m.findScrape(scrape); s != nil && s.LastScraped != nil && !s.LastScraped.Before(*scrape.LastScraped) {
+		return false, nil
+	}
+	m.upsertEvent(event, true, true)
+	return true, nil
+}
+
+// upsertEvent writes the set fields of the event onto the stored one, creating it if needed.
+// Events are only matched on event.id if byKey is set, as nested events in a dgraph mutation aren't.
+func (m *DB) upsertEvent(event db.Event, byKey, revisions bool) (string, bool) {
+	var stored *db.Event
+	if event.UID != "" || byKey {
+		stored = m.findEvent(event, true)
+	}
+	created := stored == nil
+	if created {
+		stored = &db.Event{UID: event.UID}
+		if stored.UID == "" {
+			stored.UID = m.newUID()
+		}
+		m.claimUID(stored.UID)
+		m.events[stored.UID] = stored
+	} else {
+		if revisions && stored.DeletedAt == nil && eventChanged(m.resolveEvent(stored), event) {
+			stored.Revisions = append(stored.Revisions, m.snapshot(stored))
+		}
+		if byKey && event.UID == "" && event.DeletedAt == nil {
+			stored.DeletedAt = nil
+		}
+	}
+	m.setEventFields(stored, event)
+	return stored.UID, created
+}
+
+// setEventFields copies the set fields of the event onto the stored one, adding to its edges
+func (m *DB) setEventFields(stored *db.Event, event db.Event) {
+	if event.ID != "" {
+		stored.ID = event.ID
+	}
+	if event.Title != "" {
+		stored.Title = event.Title
+	}
+	if event.Description != "" {
+		stored.Description = event.Description
+	}
+	if event.StartDate != nil {
+		t := *event.StartDate
+		stored.StartDate = &t
+	}
+	if event.EndDate != nil {
+		t := *event.EndDate
+		stored.EndDate = &t
+	}
+	for _, p := range event.Organiser {
+		uid, _ := m.upsertPerson(p, false)
+		edge := db.Person{UID: uid, Role: p.Role}
+		stored.Organiser = setPersonEdge(stored.Organiser, edge)
+	}
+	for _, mod := range event.PartOfModule {
+		uid, _ := m.upsertModule(mod, false)
+		edge := db.Module{UID: uid, Weight: mod.Weight, Required: mod.Required}
+		stored.PartOfModule = setModuleEdge(stored.PartOfModule, edge)
+	}
+	for _, l := range event.Location {
+		uid, _ := m.upsertLocation(l, false)
+		stored.Location = setLocationEdge(stored.Location, db.Location{UID: uid})
+	}
+	if event.Series != nil {
+		uid, _ := m.upsertSeries(*event.Series, false)
+		stored.Series = &db.Series{UID: uid}
+	}
+	for _, p := range event.Attendees {
+		uid, _ := m.upsertPerson(p, false)
+		stored.Attendees = setPersonEdge(stored.Attendees, db.Person{UID: uid})
+	}
+	if event.DeletedAt != nil {
+		t := *event.DeletedAt
+		stored.DeletedAt = &t
+	}
+	for _, rev := range event.Revisions {
+		if rev.UID == "" || strings.HasPrefix(rev.UID, "_:") {
+			rev.UID = m.newUID()
+		}
+		stored.Revisions = append(stored.Revisions, rev)
+	}
+	if len(event.DType) > 0 {
+		stored.DType = event.DType
+	}
+}
+
+// The set...Edge helpers add the edge, or replace its facets if the edge is already there
+
+func setPersonEdge(edges []db.Person, edge db.Person) []db.Person {
+	for i := range edges {
+		if edges[i].UID == edge.UID {
+			edges[i] = edge
+			return edges
+		}
+	}
+	return append(edges, edge)
+}
+
+func setModuleEdge(edges []db.Module, edge db.Module) []db.Module {
+	for i := range edges {
+		if edges[i].UID == edge.UID {
+			edges[i] = edge
+			return edges
+		}
+	}
+	return append(edges, edge)
+}
+
+func setLocationEdge(edges []db.Location, edge db.Location) []db.Location {
+	for i := range edges {
+		if edges[i].UID == edge.UID {
+			return edges
+		}
+	}
+	return append(edges, edge)
+}
+
+// eventChanged returns whether the update changes the title, description, dates or location of the event,
+// the same way the db package decides whether to keep a revision
+func eventChanged(existing, update db.Event) bool {
+	return (update.Title != "" && update.Title != existing.Title) ||
+		(update.Description != "" && update.Description != existing.Description) ||
+		(update.StartDate != nil && !sameTime(update.StartDate, existing.StartDate)) ||
+		(update.EndDate != nil && !sameTime(update.EndDate, existing.EndDate)) ||
+		(len(update.Location) > 0 && !sameLocations(update.Location, existing.Location))
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func sameLocations(update, existing []db.Location) bool {
+	for _, loc := range update {
+		found := false
+		for _, loc2 := range existing {
+			found = found || loc.Equal(loc2)
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// snapshot returns a revision holding the current values of the stored event
+func (m *DB) snapshot(e *db.Event) db.Revision {
+	now := time.Now().UTC()
+	locations := make([]db.Location, len(e.Location))
+	for i, loc := range e.Location {
+		locations[i] = db.Location{UID: loc.UID}
+	}
+	return db.Revision{
+		UID:         m.newUID(),
+		ChangedAt:   &now,
+		Title:       e.Title,
+		Description: e.Description,
+		StartDate:   e.StartDate,
+		EndDate:     e.EndDate,
+		Location:    locations,
+		DType:       []string{"Revision"},
+	}
+}
+
+// GetEventHistory returns the previous versions of the event with the event.id, the most recent change first
+func (m *DB) GetEventHistory(ctx context.Context, eventID string, options ...db.Option) ([]db.Revision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e := m.findEvent(db.Event{ID: eventID}, true)
+	if e == nil {
+		return nil, notFound("Event", "event.id", eventID)
+	}
+
+	revisions := make([]db.Revision, 0, len(e.Revisions))
+	for i := len(e.Revisions) - 1; i >= 0; i-- {
+		rev := e.Revisions[i]
+		rev.Location = nil
+		for _, edge := range e.Revisions[i].Location {
+			if l, ok := m.locations[edge.UID]; ok {
+				rev.Location = append(rev.Location, db.Location{UID: l.UID, ID: l.ID, Name: l.Name, DisabledAccess: l.DisabledAccess, Campus: l.Campus})
+			}
+		}
+		revisions = append(revisions, rev)
+	}
+	sort.SliceStable(revisions, func(i, j int) bool {
+		a, b := revisions[i].ChangedAt, revisions[j].ChangedAt
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		return a.After(*b)
+	})
+	return revisions, nil
+}
+
+// clearableEventPredicates are the predicates MergeEvent can be asked to clear
+var clearableEventPredicates = map[string]bool{
+	"event.title":          true,
+	"event.description":    true,
+	"event.start_date":     true,
+	"event.end_date":       true,
+	"event.organiser":      true,
+	"event.part_of_module": true,
+	"event.location":       true,
+}
+
+// MergeEvent updates the stored event with the fields set in event, replacing its edge lists with any that are set,
+// and clearing the predicates named in clear. Events which don't exist yet are created.
+func (m *DB) MergeEvent(ctx context.Context, event db.Event, clear []string, options ...db.Option) (*db.Event, error) {
+	for _, p := range clear {
+		if !clearableEventPredicates[p] {
+			return nil, fmt.Errorf("Cannot clear %q on an event", p)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := m.findEvent(event, false)
+	if stored == nil {
+		for _, p := range clear {
+			clearEventField(&event, p)
+		}
+		uid, _ := m.upsertEvent(event, true, true)
+		out := m.resolveEvent(m.events[uid])
+		return &out, nil
+	}
+
+	if len(clear) > 0 || eventChanged(m.resolveEvent(stored), event) {
+		stored.Revisions = append(stored.Revisions, m.snapshot(stored))
+	}
+	if len(event.Organiser) > 0 {
+		stored.Organiser = nil
+	}
+	if len(event.PartOfModule) > 0 {
+		stored.PartOfModule = nil
+	}
+	if len(event.Location) > 0 {
+		stored.Location = nil
+	}
+	for _, p := range clear {
+		clearEventField(stored, p)
+		clearEventField(&event, p)
+	}
+	event.UID = stored.UID
+	m.setEventFields(stored, event)
+
+	out := m.resolveEvent(stored)
+	return &out, nil
+}
+
+// clearEventField zeroes the field of the event stored in the predicate
+func clearEventField(e *db.Event, predicate string) {
+	switch predicate {
+	case "event.title":
+		e.Title = ""
+	case "event.description":
+		e.Description = ""
+	case "event.start_date":
+		e.StartDate = nil
+	case "event.end_date":
+		e.EndDate = nil
+	case "event.organiser":
+		e.Organiser = nil
+	case "event.part_of_module":
+		e.PartOfModule = nil
+	case "event.location":
+		e.Location = nil
+	}
+}
+
+// DiffEvent returns what storing the incoming event would change, without writing anything
+func (m *DB) DiffEvent(ctx context.Context, incoming db.Event, options ...db.Option) (*db.EventDiff, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := m.findEvent(incoming, false)
+	if stored == nil {
+		return &db.EventDiff{Created: true, Changes: db.Event{}.Diff(incoming)}, nil
+	}
+	existing := m.resolveEvent(stored)
+	return &db.EventDiff{Changes: existing.Diff(incoming), Stored: &existing}, nil
+}
+
+// BatchUpsertEvents upserts each of the events, returning their uids in the same order.
+// As with db.DB, the events changed get a revision, and only the last of the events with the same event.id is stored.
+func (m *DB) BatchUpsertEvents(ctx context.Context, events []db.Event, chunkSize int, options ...db.Option) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	last := make(map[string]int)
+	for i, e := range events {
+		if e.UID == "" && e.ID != "" {
+			last[e.ID] = i
+		}
+	}
+
+	uids := make([]string, len(events))
+	upserted := make(map[string]string)
+	for i, e := range events {
+		if e.UID == "" && e.ID != "" {
+			if uid, ok := upserted[e.ID]; ok {
+				uids[i] = uid
+				continue
+			}
+			e = events[last[e.ID]]
+		}
+		uids[i], _ = m.upsertEvent(e, true, true)
+		if e.UID == "" && e.ID != "" {
+			upserted[e.ID] = uids[i]
+		}
+	}
+	return uids, nil
+}
+
+// ListEvents returns a page of the events ordered by their start date
+func (m *DB) ListEvents(ctx context.Context, opts db.ListOptions, options ...db.Option) ([]db.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := m.liveEvents(func(e *db.Event) bool { return m.located(e, opts) })
+	db.SortNodes(events, opts.Sort)
+	return pageEvents(events, opts)
+}
+
+// ListEventsAfter returns up to opts.First events after the cursor, ordered by their start date and then their uid
+func (m *DB) ListEventsAfter(ctx context.Context, cursor db.EventCursor, opts db.ListOptions, options ...db.Option) ([]db.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := m.liveEvents(func(e *db.Event) bool {
+		return cursor.Precedes(*e) && m.located(e, opts)
+	})
+	if n := firstOf(opts.First); len(events) > n {
+		events = events[:n]
+	}
+	return events, nil
+}
+
+// pageEvents returns the page of the ordered events chosen by the options
+func pageEvents(events []db.Event, opts db.ListOptions) ([]db.Event, error) {
+	byUID := make(map[string]db.Event, len(events))
+	uids := make([]string, len(events))
+	for i, e := range events {
+		byUID[e.UID] = e
+		uids[i] = e.UID
+	}
+	uids, err := page(uids, opts)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]db.Event, len(uids))
+	for i, uid := range uids {
+		out[i] = byUID[uid]
+	}
+	return out, nil
+}
+
+// GetEventsBetween returns a page of the events starting within [start, end], ordered by their start date,
+// only those in the locations the options leave in
+func (m *DB) GetEventsBetween(ctx context.Context, start, end time.Time, opts db.ListOptions, options ...db.Option) ([]db.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := m.liveEvents(func(e *db.Event) bool { return startsBetween(e, start, end) && m.located(e, opts) })
+	db.SortNodes(events, opts.Sort)
+	return pageEvents(events, opts)
+}
+
+// GetEventsBetweenAfter returns up to opts.First of the events starting within [start, end] after the cursor,
+// ordered by their start date and then their uid
+func (m *DB) GetEventsBetweenAfter(ctx context.Context, start, end time.Time, cursor db.EventCursor, opts db.ListOptions, options ...db.Option) ([]db.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := m.liveEvents(func(e *db.Event) bool {
+		return cursor.Precedes(*e) && startsBetween(e, start, end) && m.located(e, opts)
+	})
+	if n := firstOf(opts.First); len(events) > n {
+		events = events[:n]
+	}
+	return events, nil
+}
+
+// startsBetween returns whether the event starts within [start, end]
+func startsBetween(e *db.Event, start, end time.Time) bool {
+	return e.StartDate != nil && !e.StartDate.Before(start) && !e.StartDate.After(end)
+}
+
+// SearchEvents returns a page of the events whose title or description contain any of the words in the query,
+// scored the same way as db.DB out of the first db.MaxListLimit matches by start date, best matches first
+func (m *DB) SearchEvents(ctx context.Context, query string, opts db.ListOptions, options ...db.Option) ([]db.EventMatch, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return make([]db.EventMatch, 0), nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	matches := make([]db.EventMatch, 0)
+	for _, e := range m.liveEvents(func(*db.Event) bool { return true }) {
+		score := 2*scoreText(e.Title, terms) + scoreText(e.Description, terms)
+		if score > 0 && len(matches) < db.MaxListLimit {
+			matches = append(matches, db.EventMatch{Event: e, Score: score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+
+	offset := opts.Offset
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > len(matches) {
+		offset = len(matches)
+	}
+	matches = matches[offset:]
+	if first := firstOf(opts.First); len(matches) > first {
+		matches = matches[:first]
+	}
+	return matches, nil
+}
+
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+func scoreText(text string, terms []string) int {
+	words := make(map[string]bool)
+	for _, w := range searchTerms(text) {
+		words[w] = true
+	}
+	score := 0
+	for _, t := range terms {
+		if words[t] {
+			score++
+		}
+	}
+	return score
+}
+
+// GetEventsByModule returns every event which is part of the module with the given code, ordered by start date
+func (m *DB) GetEventsByModule(ctx context.Context, moduleCode string, options ...db.Option) ([]db.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.liveEvents(func(e *db.Event) bool {
+		for _, edge := range e.PartOfModule {
+			if mod, ok := m.modules[edge.UID]; ok && mod.Code == moduleCode {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+// GetEventsByModules returns the events of any of the modules with the codes which overlap [from, to], ordered by start date
+func (m *DB) GetEventsByModules(ctx context.Context, moduleCodes []string, from, to time.Time, options ...db.Option) ([]db.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	codes := make(map[string]bool, len(moduleCodes))
+	for _, code := range moduleCodes {
+		codes[code] = true
+	}
+	return m.liveEvents(func(e *db.Event) bool {
+		for _, edge := range e.PartOfModule {
+			if mod, ok := m.modules[edge.UID]; ok && codes[mod.Code] {
+				return overlaps(e, from, to)
+			}
+		}
+		return false
+	}), nil
+}
+
+// GetEventsByLocation returns the events at the location with the kent slug which overlap [from, to]
+func (m *DB) GetEventsByLocation(ctx context.Context, locationID string, from, to time.Time, options ...db.Option) ([]db.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.liveEvents(func(e *db.Event) bool {
+		for _, edge := range e.Location {
+			if l, ok := m.locations[edge.UID]; ok && l.ID == locationID {
+				return overlaps(e, from, to)
+			}
+		}
+		return false
+	}), nil
+}
+
+// GetEventsByOrganiser returns a page of the events organised by the person which overlap [from, to].
+// The person is looked up by Uid if it has one, or by name otherwise.
+func (m *DB) GetEventsByOrganiser(ctx context.Context, person db.Person, from, to time.Time, opts db.ListOptions, options ...db.Option) ([]db.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := m.liveEvents(func(e *db.Event) bool { return m.organisedBy(e, person, from, to) && m.located(e, opts) })
+	db.SortNodes(events, opts.Sort)
+	return pageEvents(events, opts)
+}
+
+// GetEventsByOrganiserAfter returns up to opts.First of the events GetEventsByOrganiser would list after the cursor,
+// ordered by their start date and then their uid
+func (m *DB) GetEventsByOrganiserAfter(ctx context.Context, person db.Person, from, to time.Time, cursor db.EventCursor, opts db.ListOptions, options ...db.Option) ([]db.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := m.liveEvents(func(e *db.Event) bool {
+		return cursor.Precedes(*e) && m.organisedBy(e, person, from, to) && m.located(e, opts)
+	})
+	if n := firstOf(opts.First); len(events) > n {
+		events = events[:n]
+	}
+	return events, nil
+}
+
+// organisedBy returns whether the event is organised by the person, looked up by uid if they have one or by name,
+// and overlaps the window [from, to]
+func (m *DB) organisedBy(e *db.Event, person db.Person, from, to time.Time) bool {
+	for _, edge := range e.Organiser {
+		p, ok := m.people[edge.UID]
+		if ok && (p.UID == person.UID || person.UID == "" && p.Name == person.Name) {
+			return overlaps(e, from, to)
+		}
+	}
+	return false
+}
+
+// DeleteEvent removes the event. If cascade is set, the scrapes which found it are unlinked from it as well.
+func (m *DB) DeleteEvent(ctx context.Context, event db.Event, cascade bool, options ...db.Option) error {
+	if event.UID == "" {
+		return fmt.Errorf("Cannot delete a node without a uid")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.events, event.UID)
+	if cascade {
+		for _, s := range m.scrapes {
+			kept := make([]db.Event, 0, len(s.FoundEvent))
+			for _, edge := range s.FoundEvent {
+				if edge.UID != event.UID {
+					kept = append(kept, edge)
+				}
+			}
+			s.FoundEvent = kept
+		}
+	}
+	return nil
+}
+
+// SoftDeleteEvent marks the event as deleted, hiding it from the getters and queries
+func (m *DB) SoftDeleteEvent(ctx context.Context, event db.Event, options ...db.Option) error {
+	now := time.Now().UTC()
+	return m.markEvent("SoftDeleteEvent", event, &now)
+}
+
+// RestoreEvent undoes SoftDeleteEvent
+func (m *DB) RestoreEvent(ctx context.Context, event db.Event, options ...db.Option) error {
+	return m.markEvent("RestoreEvent", event, nil)
+}
+
+func (m *DB) markEvent(op string, event db.Event, deletedAt *time.Time) error {
+	if event.UID == "" && event.ID == "" {
+		return fmt.Errorf("%s needs an event with a Uid or an ID", op)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e := m.findEvent(event, true)
+	if e == nil {
+		return eventNotFound(event)
+	}
+	e.DeletedAt = deletedAt
+	return nil
+}
+
+// ListDeletedEvents returns a page of the soft deleted events, ordered by when they were deleted
+func (m *DB) ListDeletedEvents(ctx context.Context, opts db.ListOptions, options ...db.Option) ([]db.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := make([]db.Event, 0)
+	for _, uid := range m.eventUIDs() {
+		if e := m.events[uid]; e.DeletedAt != nil {
+			events = append(events, m.resolveEvent(e))
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].DeletedAt.Before(*events[j].DeletedAt)
+	})
+	return pageEvents(events, opts)
+}
+
+// DeleteEventsDeletedBefore removes up to limit of the events soft deleted before the time for good, oldest first,
+// along with the scrape.found_event edges pointing at them
+func (m *DB) DeleteEventsDeletedBefore(ctx context.Context, before time.Time, limit int, options ...db.Option) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := make([]*db.Event, 0)
+	for _, uid := range m.eventUIDs() {
+		if e := m.events[uid]; e.DeletedAt != nil && e.DeletedAt.Before(before) {
+			events = append(events, e)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].DeletedAt.Before(*events[j].DeletedAt)
+	})
+	if len(events) > firstOf(limit) {
+		events = events[:firstOf(limit)]
+	}
+	removed := make(map[string]bool)
+	for _, e := range events {
+		removed[e.UID] = true
+		delete(m.events, e.UID)
+	}
+	for _, s := range m.scrapes {
+		kept := make([]db.Event, 0, len(s.FoundEvent))
+		for _, edge := range s.FoundEvent {
+			if !removed[edge.UID] {
+				kept = append(kept, edge)
+			}
+		}
+		s.FoundEvent = kept
+	}
+	return len(events), nil
+}
+
+// AddAttendee links the person to the event as one of the people attending it, whether or not it is soft deleted
+func (m *DB) AddAttendee(ctx context.Context, event db.Event, person db.Person, options ...db.Option) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, err := m.attendance("AddAttendee", event, person)
+	if err != nil {
+		return err
+	}
+	e.Attendees = setPersonEdge(e.Attendees, db.Person{UID: person.UID})
+	return nil
+}
+
+// RemoveAttendee undoes AddAttendee
+func (m *DB) RemoveAttendee(ctx context.Context, event db.Event, person db.Person, options ...db.Option) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, err := m.attendance("RemoveAttendee", event, person)
+	if err != nil {
+		return err
+	}
+	e.Attendees = removePersonEdge(e.Attendees, person.UID)
+	return nil
+}
+
+// attendance returns the stored event the person is being added to or removed from, checking they both exist
+func (m *DB) attendance(op string, event db.Event, person db.Person) (*db.Event, error) {
+	if person.UID == "" {
+		return nil, fmt.Errorf("%s needs a person with a Uid", op)
+	}
+	if event.UID == "" && event.ID == "" {
+		return nil, fmt.Errorf("%s needs an event with a Uid or an ID", op)
+	}
+	e := m.findEvent(event, true)
+	if e == nil {
+		return nil, eventNotFound(event)
+	}
+	if _, ok := m.people[person.UID]; !ok {
+		return nil, notFound("Person", "uid", person.UID)
+	}
+	return e, nil
+}
+
+func removePersonEdge(edges []db.Person, uid string) []db.Person {
+	kept := make([]db.Person, 0, len(edges))
+	for _, edge := range edges {
+		if edge.UID != uid {
+			kept = append(kept, edge)
+		}
+	}
+	return kept
+}
+
+// GetEventAttendees returns the people attending the event, ordered by name
+func (m *DB) GetEventAttendees(ctx context.Context, event db.Event, options ...db.Option) ([]db.Person, error) {
+	if event.UID == "" && event.ID == "" {
+		return nil, errors.New("GetEventAttendees needs an event with a Uid or an ID")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e := m.findEvent(event, false)
+	if e == nil {
+		return nil, eventNotFound(event)
+	}
+	people := make([]db.Person, 0, len(e.Attendees))
+	for _, edge := range e.Attendees {
+		if p, ok := m.people[edge.UID]; ok {
+			people = append(people, db.Person{UID: p.UID, Name: p.Name, Email: p.Email})
+		}
+	}
+	sort.SliceStable(people, func(i, j int) bool {
+		return people[i].Name < people[j].Name
+	})
+	return people, nil
+}
@@ -0,0 +1,154 @@
+package memdb
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+// UpsertScrapeJob stores the job, matching jobs without a Uid on job.id
+func (m *DB) UpsertScrapeJob(ctx context.Context, job db.ScrapeJob, options ...db.Option) (*db.Response, error) {
+	if job.UID == "" && job.ID == "" {
+		return nil, errors.New("UpsertScrapeJob needs a job with a Uid or an ID")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := m.findJob(job)
+	created := stored == nil
+	if created {
+		stored = &db.ScrapeJob{UID: job.UID, DType: []string{"ScrapeJob"}}
+		if stored.UID == "" {
+			stored.UID = m.newUID()
+		}
+		m.claimUID(stored.UID)
+		m.jobs[stored.UID] = stored
+	}
+	if job.ID != "" {
+		stored.ID = job.ID
+	}
+	if job.Status != "" {
+		stored.Status = job.Status
+	}
+	if job.From != 0 {
+		stored.From = job.From
+	}
+	if job.To != 0 {
+		stored.To = job.To
+	}
+	if job.Module != "" {
+		stored.Module = job.Module
+	}
+	if job.Total != 0 {
+		stored.Total = job.Total
+	}
+	if job.Done != 0 {
+		stored.Done = job.Done
+	}
+	if job.Failed != 0 {
+		stored.Failed = job.Failed
+	}
+	if job.Error != "" {
+		stored.Error = job.Error
+	}
+	if job.RequestedAt != nil {
+		t := *job.RequestedAt
+		stored.RequestedAt = &t
+	}
+	if job.StartedAt != nil {
+		t := *job.StartedAt
+		stored.StartedAt = &t
+	}
+	if job.FinishedAt != nil {
+		t := *job.FinishedAt
+		stored.FinishedAt = &t
+	}
+	return response(stored.UID, created), nil
+}
+
+func (m *DB) findJob(job db.ScrapeJob) *db.ScrapeJob {
+	if job.UID != "" {
+		return m.jobs[job.UID]
+	}
+	for _, j := range m.jobs {
+		if j.ID == job.ID {
+			return j
+		}
+	}
+	return nil
+}
+
+// GetScrapeJob returns the job with the job.id, or an error wrapping db.ErrNotFound
+func (m *DB) GetScrapeJob(ctx context.Context, id string, options ...db.Option) (*db.ScrapeJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j := m.findJob(db.ScrapeJob{ID: id})
+	if j == nil || id == "" {
+		return nil, notFound("ScrapeJob", "job.id", id)
+	}
+	found := *j
+	found.DType = nil
+	return &found, nil
+}
+
+// GetQueuedScrapeJobs returns up to limit of the jobs still queued, oldest first
+func (m *DB) GetQueuedScrapeJobs(ctx context.Context, limit int, options ...db.Option) ([]db.ScrapeJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	jobs := make([]db.ScrapeJob, 0)
+	for _, j := range m.jobs {
+		if j.Status == db.JobQueued {
+			found := *j
+			found.DType = nil
+			jobs = append(jobs, found)
+		}
+	}
+	sort.SliceStable(jobs, func(i, j int) bool {
+		a, b := jobs[i].RequestedAt, jobs[j].RequestedAt
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		return a.Before(*b)
+	})
+	if len(jobs) > firstOf(limit) {
+		jobs = jobs[:firstOf(limit)]
+	}
+	return jobs, nil
+}
+
+// GetModuleScrapeIDs returns the ids of the scrapes which found events of the module with the code, in order,
+// or an error wrapping db.ErrNotFound if there is no such module
+func (m *DB) GetModuleScrapeIDs(ctx context.Context, moduleCode string, options ...db.Option) ([]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	module := m.findModule(db.Module{Code: moduleCode}, true)
+	if module == nil {
+		return nil, notFound("Module", "module.code", moduleCode)
+	}
+	ids := make([]int, 0)
+	for _, s := range m.scrapes {
+		for _, edge := range s.FoundEvent {
+			e, ok := m.events[edge.UID]
+			if ok && hasModule(e, module.UID) {
+				ids = append(ids, s.ID)
+				break
+			}
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func hasModule(e *db.Event, uid string) bool {
+	for _, edge := range e.PartOfModule {
+		if edge.UID == uid {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package memdb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+// AcquireLease gives the lease with the name to the holder until ttl from now, if nobody else holds it or their hold has expired,
+// returning an error wrapping db.ErrLeaseHeld otherwise
+func (m *DB) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration, options ...db.Option) (*db.Lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	lease := m.leases[name]
+	if lease == nil {
+		lease = &db.Lease{UID: m.newUID(), Name: name, DType: []string{"Lease"}}
+		m.leases[name] = lease
+	} else if lease.Holder != holder && lease.ExpiresAt != nil && lease.ExpiresAt.After(now) {
+		return nil, fmt.Errorf("%w: %s is held by %s until %s", db.ErrLeaseHeld, name, lease.Holder, lease.ExpiresAt.Format(time.RFC3339))
+	}
+	expires := now.Add(ttl)
+	lease.Holder, lease.ExpiresAt = holder, &expires
+	found := *lease
+	found.DType = nil
+	return &found, nil
+}
+
+// SetLeaseCursor stores how far the holder of the lease has got, as long as they still hold it
+func (m *DB) SetLeaseCursor(ctx context.Context, name, holder string, cursor int64, options ...db.Option) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lease := m.leases[name]
+	if lease == nil || lease.Holder != holder {
+		return fmt.Errorf("%w: %s isn't held by %s", db.ErrLeaseHeld, name, holder)
+	}
+	lease.Cursor = cursor
+	return nil
+}
@@ -0,0 +1,455 @@
+// Package memdb is an implementation of db.Client which keeps everything in memory,
+// so the api and scraper can be run in tests without a dgraph cluster.
+//
+// It follows the upsert semantics of dgraph: only the fields which are set are written,
+// and edge lists are added to rather than replaced.
+// Nothing is isolated, so WithTxn runs the function directly against the store,
+// and the db.Options given to the operations are ignored.
+package memdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+// DB holds the nodes of each type keyed by their uid.
+// Edges are stored as nodes holding only a uid, and any facets, and are resolved when they are read.
+type DB struct {
+	mu        sync.Mutex
+	lastUID   uint64
+	events    map[string]*db.Event
+	locations map[string]*db.Location
+	modules   map[string]*db.Module
+	people    map[string]*db.Person
+	scrapes   map[string]*db.Scrape
+	series    map[string]*db.Series
+	jobs      map[string]*db.ScrapeJob
+	webhooks  map[string]*db.Webhook
+	terms     map[string]*db.Term
+	users     map[string]*db.User
+	changes   map[string]*db.Change
+	// deliveries are the WebhookDelivery of every webhook, notifications are keyed by notification.key, and leases by lease.name
+	deliveries    map[string]*db.WebhookDelivery
+	notifications map[string]*db.Notification
+	leases        map[string]*db.Lease
+	// lastSeq is the Seq of the latest change recorded
+	lastSeq int64
+}
+
+var _ db.Client = (*DB)(nil)
+
+// New returns an empty database
+func New() *DB {
+	return &DB{
+		events:    make(map[string]*db.Event),
+		locations: make(map[string]*db.Location),
+		modules:   make(map[string]*db.Module),
+		people:    make(map[string]*db.Person),
+		scrapes:   make(map[string]*db.Scrape),
+		series:    make(map[string]*db.Series),
+		jobs:      make(map[string]*db.ScrapeJob),
+		webhooks:  make(map[string]*db.Webhook),
+		terms:     make(map[string]*db.Term),
+		users:     make(map[string]*db.User),
+		changes:   make(map[string]*db.Change),
+
+		deliveries:    make(map[string]*db.WebhookDelivery),
+		notifications: make(map[string]*db.Notification),
+		leases:        make(map[string]*db.Lease),
+	}
+}
+
+// newUID returns the next uid, in the same format dgraph uses
+func (m *DB) newUID() string {
+	m.lastUID++
+	return fmt.Sprintf("0x%x", m.lastUID)
+}
+
+// claimUID makes sure a uid given by the caller is never handed out again
+func (m *DB) claimUID(uid string) {
+	if n := uidValue(uid); n > m.lastUID {
+		m.lastUID = n
+	}
+}
+
+var uidRegex = regexp.MustCompile(`\A0x[0-9a-fA-F]+\z`)
+
+func uidValue(uid string) uint64 {
+	n, _ := strconv.ParseUint(strings.TrimPrefix(uid, "0x"), 16, 64)
+	return n
+}
+
+// sortedUIDs sorts the uids into the order they were assigned in
+func sortedUIDs(uids []string) []string {
+	sort.Slice(uids, func(i, j int) bool {
+		return uidValue(uids[i]) < uidValue(uids[j])
+	})
+	return uids
+}
+
+func notFound(kind, field, value string) error {
+	return fmt.Errorf("%w: no %s with %s %q", db.ErrNotFound, kind, field, value)
+}
+
+// response is what the upserts return, with the uid of a new node under the same name dgraph gives it
+func response(uid string, created bool) *db.Response {
+	resp := &db.Response{UIDs: make(map[string]string)}
+	if created {
+		resp.UIDs["uid(v)"] = uid
+	}
+	return resp
+}
+
+// Setup does nothing, there is no schema to apply
+func (m *DB) Setup(ctx context.Context, options ...db.Option) error {
+	return nil
+}
+
+// CheckVersion always succeeds, memdb is never down
+func (m *DB) CheckVersion(ctx context.Context, options ...db.Option) (string, error) {
+	return "memdb", nil
+}
+
+// CheckSchema never finds anything missing, memdb has no schema to apply
+func (m *DB) CheckSchema(ctx context.Context, options ...db.Option) ([]string, error) {
+	return []string{}, nil
+}
+
+// WithTxn calls fn once with a nil transaction.
+// The Txn variants of the operations ignore the transaction they are given, so they can be called from fn.
+func (m *DB) WithTxn(ctx context.Context, fn func(txn *db.Txn) error, options ...db.Option) error {
+	return fn(nil)
+}
+
+// ReadOnly always fails, raw dgraph queries can't be run against memory
+func (m *DB) ReadOnly(ctx context.Context, q string, options ...db.Option) ([]byte, error) {
+	return nil, errors.New("Raw queries are not supported by memdb")
+}
+
+// GetScrape returns the scrape looked up by Uid if it has one, or by scrape.id otherwise,
+// or an error wrapping db.ErrNotFound
+func (m *DB) GetScrape(ctx context.Context, scrape db.Scrape, options ...db.Option) (*db.Scrape, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.getScrape(scrape)
+}
+
+// GetScrapeTxn is GetScrape
+func (m *DB) GetScrapeTxn(ctx context.Context, txn *db.Txn, scrape db.Scrape, options ...db.Option) (*db.Scrape, error) {
+	return m.GetScrape(ctx, scrape)
+}
+
+func (m *DB) getScrape(scrape db.Scrape) (*db.Scrape, error) {
+	s := m.findScrape(scrape)
+	if s == nil {
+		if scrape.UID != "" {
+			return nil, notFound("Scrape", "uid", scrape.UID)
+		}
+		return nil, notFound("Scrape", "scrape.id", strconv.Itoa(scrape.ID))
+	}
+	return m.resolveScrape(s), nil
+}
+
+func (m *DB) findScrape(scrape db.Scrape) *db.Scrape {
+	if scrape.UID != "" {
+		return m.scrapes[scrape.UID]
+	}
+	if scrape.ID == 0 {
+		return nil
+	}
+	for _, s := range m.scrapes {
+		if s.ID == scrape.ID {
+			return s
+		}
+	}
+	return nil
+}
+
+// resolveScrape returns a copy of the scrape with the uid, id and title of the events it found
+func (m *DB) resolveScrape(s *db.Scrape) *db.Scrape {
+	out := *s
+	out.FoundEvent = nil
+	for _, edge := range s.FoundEvent {
+		if e, ok := m.events[edge.UID]; ok {
+			out.FoundEvent = append(out.FoundEvent, db.Event{UID: e.UID, ID: e.ID, Title: e.Title})
+		}
+	}
+	return &out
+}
+
+// UpsertScrape stores the scrape, matching scrapes without a Uid on scrape.id.
+// Found events are stored as well, those without a Uid as new events as dgraph would.
+func (m *DB) UpsertScrape(ctx context.Context, scrape db.Scrape, options ...db.Option) (*db.Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.findScrape(scrape)
+	created := s == nil
+	if created {
+		s = &db.Scrape{UID: scrape.UID}
+		if s.UID == "" {
+			s.UID = m.newUID()
+		}
+		m.claimUID(s.UID)
+		m.scrapes[s.UID] = s
+	}
+	if scrape.ID != 0 {
+		s.ID = scrape.ID
+	}
+	if scrape.LastScraped != nil {
+		t := *scrape.LastScraped
+		s.LastScraped = &t
+	}
+	for _, e := range scrape.FoundEvent {
+		uid, _ := m.upsertEvent(e, false, false)
+		if !hasEdge(s.FoundEvent, uid) {
+			s.FoundEvent = append(s.FoundEvent, db.Event{UID: uid})
+		}
+	}
+	if len(scrape.DType) > 0 {
+		s.DType = scrape.DType
+	}
+	return response(s.UID, created), nil
+}
+
+// UpsertScrapeTxn is UpsertScrape
+func (m *DB) UpsertScrapeTxn(ctx context.Context, txn *db.Txn, scrape db.Scrape, options ...db.Option) (*db.Response, error) {
+	return m.UpsertScrape(ctx, scrape)
+}
+
+func hasEdge(events []db.Event, uid string) bool {
+	for _, e := range events {
+		if e.UID == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteScrape removes the scrape
+func (m *DB) DeleteScrape(ctx context.Context, scrape db.Scrape, cascade bool, options ...db.Option) error {
+	if scrape.UID == "" {
+		return errors.New("Cannot delete a node without a uid")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.scrapes, scrape.UID)
+	return nil
+}
+
+// GetOldestScrape returns the scrape which was scraped longest ago,
+// or one last scraped at the unix epoch if there are no scrapes at all
+func (m *DB) GetOldestScrape(ctx context.Context, options ...db.Option) (*db.Scrape, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	scrapes := m.sortedScrapes()
+	if len(scrapes) == 0 {
+		nilTime := time.Unix(0, 0)
+		return &db.Scrape{
+			LastScraped: &nilTime,
+		}, nil
+	}
+	oldest := *scrapes[0]
+	oldest.FoundEvent = nil
+	return &oldest, nil
+}
+
+// GetLatestScrape returns the scrape which was scraped most recently
+func (m *DB) GetLatestScrape(ctx context.Context, options ...db.Option) (*db.Scrape, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	scrapes := m.sortedScrapes()
+	for i := len(scrapes) - 1; i >= 0; i-- {
+		// The scrapes never scraped are last
+		if scrapes[i].LastScraped != nil {
+			latest := *scrapes[i]
+			latest.FoundEvent = nil
+			return &latest, nil
+		}
+	}
+	return nil, notFound("Scrape", "type", "Scrape")
+}
+
+// sortedScrapes returns the scrapes ordered by when they were last scraped, those never scraped last like dgraph
+func (m *DB) sortedScrapes() []*db.Scrape {
+	scrapes := make([]*db.Scrape, 0, len(m.scrapes))
+	for _, s := range m.scrapes {
+		scrapes = append(scrapes, s)
+	}
+	sort.Slice(scrapes, func(i, j int) bool {
+		return uidValue(scrapes[i].UID) < uidValue(scrapes[j].UID)
+	})
+	sort.SliceStable(scrapes, func(i, j int) bool {
+		a, b := scrapes[i].LastScraped, scrapes[j].LastScraped
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		return a.Before(*b)
+	})
+	return scrapes
+}
+
+// ListScrapes returns a page of scrapes ordered by when they were last scraped
+func (m *DB) ListScrapes(ctx context.Context, opts db.ListOptions, options ...db.Option) ([]db.Scrape, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	scrapes := m.sortedScrapes()
+	uids := make([]string, len(scrapes))
+	for i, s := range scrapes {
+		uids[i] = s.UID
+	}
+	uids, err := page(uids, opts)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]db.Scrape, len(uids))
+	for i, uid := range uids {
+		out[i] = *m.scrapes[uid]
+		out[i].FoundEvent = nil
+	}
+	return out, nil
+}
+
+// GetScrapesOlderThan returns up to limit scrapes last scraped more than age ago, the oldest first
+func (m *DB) GetScrapesOlderThan(ctx context.Context, age time.Duration, limit int, options ...db.Option) ([]db.Scrape, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cutoff := time.Now().Add(-age)
+	out := make([]db.Scrape, 0)
+	for _, s := range m.sortedScrapes() {
+		if len(out) == firstOf(limit) {
+			break
+		}
+		if s.LastScraped != nil && s.LastScraped.Before(cutoff) {
+			scrape := *s
+			scrape.FoundEvent = nil
+			out = append(out, scrape)
+		}
+	}
+	return out, nil
+}
+
+// GetScrapesSince returns up to limit scrapes last scraped after since, the least recently scraped first
+func (m *DB) GetScrapesSince(ctx context.Context, since time.Time, limit int, options ...db.Option) ([]db.Scrape, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]db.Scrape, 0)
+	for _, s := range m.sortedScrapes() {
+		if len(out) == firstOf(limit) {
+			break
+		}
+		if s.LastScraped != nil && s.LastScraped.After(since) {
+			scrape := *s
+			scrape.FoundEvent = nil
+			out = append(out, scrape)
+		}
+	}
+	return out, nil
+}
+
+// PurgeStaleEvents unlinks the events starting within [from, to] which the scrape found before but not this time,
+// soft deleting and returning those no other scrape found
+func (m *DB) PurgeStaleEvents(ctx context.Context, scrape db.Scrape, currentEventIDs []string, from, to time.Time, options ...db.Option) ([]db.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.findScrape(scrape)
+	if s == nil {
+		return nil, notFound("Scrape", "scrape.id", strconv.Itoa(scrape.ID))
+	}
+
+	current := make(map[string]bool)
+	for _, id := range currentEventIDs {
+		current[id] = true
+	}
+
+	now := time.Now().UTC()
+	deleted := make([]db.Event, 0)
+	kept := make([]db.Event, 0, len(s.FoundEvent))
+	for _, edge := range s.FoundEvent {
+		e, ok := m.events[edge.UID]
+		if !ok || e.StartDate == nil || e.StartDate.Before(from) || e.StartDate.After(to) || current[e.ID] {
+			kept = append(kept, edge)
+			continue
+		}
+		if m.scrapesFinding(e.UID) <= 1 && e.DeletedAt == nil {
+			deleted = append(deleted, m.resolveEvent(e))
+			e.DeletedAt = &now
+		}
+	}
+	s.FoundEvent = kept
+	return deleted, nil
+}
+
+// scrapesFinding returns how many scrapes have found the event
+func (m *DB) scrapesFinding(uid string) int {
+	n := 0
+	for _, s := range m.scrapes {
+		if hasEdge(s.FoundEvent, uid) {
+			n++
+		}
+	}
+	return n
+}
+
+// firstOf returns the page size a limit is treated as, the same way db.ListOptions does
+func firstOf(limit int) int {
+	if limit <= 0 {
+		return db.DefaultListLimit
+	}
+	if limit > db.MaxListLimit {
+		return db.MaxListLimit
+	}
+	return limit
+}
+
+// page returns the page of the ordered uids chosen by the options, which have been sorted by opts.Sort if it is set.
+// As with dgraph, paging with After ignores the ordering and goes by uid.
+func page(uids []string, opts db.ListOptions) ([]string, error) {
+	if opts.After != "" {
+		if !uidRegex.MatchString(opts.After) {
+			return nil, fmt.Errorf("Invalid cursor %q", opts.After)
+		}
+		after := uidValue(opts.After)
+		filtered := make([]string, 0, len(uids))
+		for _, uid := range sortedUIDs(append([]string{}, uids...)) {
+			if uidValue(uid) > after {
+				filtered = append(filtered, uid)
+			}
+		}
+		uids = filtered
+	} else if opts.Descending && len(opts.Sort) == 0 {
+		reversed := make([]string, len(uids))
+		for i, uid := range uids {
+			reversed[len(uids)-1-i] = uid
+		}
+		uids = reversed
+	}
+
+	offset := opts.Offset
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > len(uids) {
+		offset = len(uids)
+	}
+	uids = uids[offset:]
+	if first := firstOf(opts.First); len(uids) > first {
+		uids = uids[:first]
+	}
+	return uids, nil
+}
@@ -0,0 +1,801 @@
+package memdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+// maxLocationDepth bounds how far up the hierarchy GetLocationAncestors looks, in case of a loop in the data
+const maxLocationDepth = 10
+
+// GetLocationFromKentSlug returns the location with the location.id, or an error wrapping db.ErrNotFound
+func (m *DB) GetLocationFromKentSlug(ctx context.Context, slug string, options ...db.Option) (*db.Location, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l := m.findLocation(db.Location{ID: slug}, true)
+	if l == nil {
+		return nil, notFound("Location", "location.id", slug)
+	}
+	return &db.Location{UID: l.UID, ID: l.ID, Name: l.Name, DisabledAccess: l.DisabledAccess, Campus: l.Campus, Capacity: l.Capacity}, nil
+}
+
+// ListLocations returns a page of the locations ordered by their location.id, along with the location each is part of
+func (m *DB) ListLocations(ctx context.Context, opts db.ListOptions, options ...db.Option) ([]db.Location, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	uids := make([]string, 0, len(m.locations))
+	for _, uid := range m.locationUIDs() {
+		if opts.Includes(*m.locations[uid]) {
+			uids = append(uids, uid)
+		}
+	}
+	sort.SliceStable(uids, func(i, j int) bool {
+		return m.locations[uids[i]].ID < m.locations[uids[j]].ID
+	})
+	if len(opts.Sort) > 0 {
+		locations := make([]*db.Location, len(uids))
+		for i, uid := range uids {
+			locations[i] = m.locations[uid]
+		}
+		db.SortNodes(locations, opts.Sort)
+		for i, l := range locations {
+			uids[i] = l.UID
+		}
+	}
+	uids, err := page(uids, opts)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]db.Location, len(uids))
+	for i, uid := range uids {
+		found := *m.locations[uid]
+		found.DType = nil
+		if found.PartOf != nil {
+			if parent, ok := m.locations[found.PartOf.UID]; ok {
+				found.PartOf = &db.Location{UID: parent.UID, ID: parent.ID, Name: parent.Name, DisabledAccess: parent.DisabledAccess, Campus: parent.Campus}
+			}
+		}
+		out[i] = found
+	}
+	return out, nil
+}
+
+// SearchLocations returns the locations whose name contains any of the words in the query,
+// scored the same way as db.DB, best matches first
+func (m *DB) SearchLocations(ctx context.Context, query string, options ...db.Option) ([]db.LocationMatch, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return make([]db.LocationMatch, 0), nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	matches := make([]db.LocationMatch, 0)
+	for _, l := range m.locations {
+		if score := 2 * scoreText(l.Name, terms); score > 0 {
+			matches = append(matches, db.LocationMatch{
+				Location: db.Location{UID: l.UID, ID: l.ID, Name: l.Name, DisabledAccess: l.DisabledAccess, Campus: l.Campus, Capacity: l.Capacity},
+				Score:    score,
+			})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Location.ID < matches[j].Location.ID
+	})
+	return matches, nil
+}
+
+// GetLocationFromKentSlugTxn is GetLocationFromKentSlug
+func (m *DB) GetLocationFromKentSlugTxn(ctx context.Context, txn *db.Txn, slug string, options ...db.Option) (*db.Location, error) {
+	return m.GetLocationFromKentSlug(ctx, slug)
+}
+
+// findLocation returns the stored location with the Uid if it has one, or the location.id if byKey is set
+func (m *DB) findLocation(loc db.Location, byKey bool) *db.Location {
+	if loc.UID != "" {
+		return m.locations[loc.UID]
+	}
+	if !byKey || loc.ID == "" {
+		return nil
+	}
+	for _, l := range m.locations {
+		if l.ID == loc.ID {
+			return l
+		}
+	}
+	return nil
+}
+
+// UpsertLocation stores the location, matching locations without a Uid on location.id
+func (m *DB) UpsertLocation(ctx context.Context, loc db.Location, options ...db.Option) (*db.Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	uid, created := m.upsertLocation(loc, true)
+	return response(uid, created), nil
+}
+
+// UpsertLocationTxn is UpsertLocation
+func (m *DB) UpsertLocationTxn(ctx context.Context, txn *db.Txn, loc db.Location, options ...db.Option) (*db.Response, error) {
+	return m.UpsertLocation(ctx, loc)
+}
+
+func (m *DB) upsertLocation(loc db.Location, byKey bool) (string, bool) {
+	stored := m.findLocation(loc, byKey)
+	created := stored == nil
+	if created {
+		stored = &db.Location{UID: loc.UID}
+		if stored.UID == "" {
+			stored.UID = m.newUID()
+		}
+		m.claimUID(stored.UID)
+		m.locations[stored.UID] = stored
+	}
+	if loc.ID != "" {
+		stored.ID = loc.ID
+	}
+	if loc.Name != "" {
+		stored.Name = loc.Name
+	}
+	if loc.Location.Type != "" {
+		stored.Location = db.Loc{
+			Type:   loc.Location.Type,
+			Coords: append([]float64{}, loc.Location.Coords...),
+		}
+	}
+	// location.disabled_access isn't omitempty, so dgraph writes it every time
+	stored.DisabledAccess = loc.DisabledAccess
+	if loc.Capacity != 0 {
+		stored.Capacity = loc.Capacity
+	}
+	if loc.Campus != "" {
+		stored.Campus = loc.Campus
+	}
+	if loc.ImportedAt != nil {
+		t := *loc.ImportedAt
+		stored.ImportedAt = &t
+	}
+	if loc.PartOf != nil {
+		uid, _ := m.upsertLocation(*loc.PartOf, false)
+		stored.PartOf = &db.Location{UID: uid}
+	}
+	if len(loc.DType) > 0 {
+		stored.DType = loc.DType
+	}
+	return stored.UID, created
+}
+
+// locationUIDs returns the uids of every stored location, in the order they were created
+func (m *DB) locationUIDs() []string {
+	uids := make([]string, 0, len(m.locations))
+	for uid := range m.locations {
+		uids = append(uids, uid)
+	}
+	return sortedUIDs(uids)
+}
+
+// lookupLocation returns the location looked up by Uid if it has one, or by location.id otherwise
+func (m *DB) lookupLocation(loc db.Location) (*db.Location, error) {
+	if loc.UID == "" && loc.ID == "" {
+		return nil, errors.New("The location needs a Uid or an ID")
+	}
+	l := m.findLocation(loc, true)
+	if l == nil {
+		if loc.UID != "" {
+			return nil, notFound("Location", "key", loc.UID)
+		}
+		return nil, notFound("Location", "key", loc.ID)
+	}
+	return l, nil
+}
+
+// GetBuildingRooms returns the locations which are part of the building, ordered by their id
+func (m *DB) GetBuildingRooms(ctx context.Context, building db.Location, options ...db.Option) ([]db.Location, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, err := m.lookupLocation(building)
+	if err != nil {
+		return nil, err
+	}
+
+	rooms := make([]db.Location, 0)
+	for _, uid := range m.locationUIDs() {
+		l := m.locations[uid]
+		if l.PartOf != nil && l.PartOf.UID == b.UID {
+			room := *l
+			room.PartOf = nil
+			room.DType = nil
+			rooms = append(rooms, room)
+		}
+	}
+	sort.SliceStable(rooms, func(i, j int) bool {
+		return rooms[i].ID < rooms[j].ID
+	})
+	return rooms, nil
+}
+
+// GetLocationAncestors returns the locations containing the location, the closest first
+func (m *DB) GetLocationAncestors(ctx context.Context, loc db.Location, options ...db.Option) ([]db.Location, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l, err := m.lookupLocation(loc)
+	if err != nil {
+		return nil, err
+	}
+
+	ancestors := make([]db.Location, 0)
+	seen := map[string]bool{l.UID: true}
+	for parent := l.PartOf; parent != nil && len(ancestors) < maxLocationDepth; {
+		p, ok := m.locations[parent.UID]
+		if !ok || seen[p.UID] {
+			break
+		}
+		seen[p.UID] = true
+		ancestors = append(ancestors, db.Location{UID: p.UID, ID: p.ID, Name: p.Name, DisabledAccess: p.DisabledAccess, Campus: p.Campus, Capacity: p.Capacity})
+		parent = p.PartOf
+	}
+	return ancestors, nil
+}
+
+// GetLocationsNear returns the locations within radius metres of the point, nearest first
+func (m *DB) GetLocationsNear(ctx context.Context, point db.Loc, radius float64, options ...db.Option) ([]db.Location, error) {
+	if point.Type != "Point" || len(point.Coords) != 2 {
+		return nil, errors.New("GetLocationsNear needs a point, see NewPoint")
+	}
+	if radius <= 0 {
+		return nil, fmt.Errorf("Invalid radius %v", radius)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	near := make([]db.Location, 0)
+	for _, uid := range m.locationUIDs() {
+		l := m.locations[uid]
+		if l.Location.Type == "Point" && db.Distance(point, l.Location) <= radius {
+			found := *l
+			found.PartOf = nil
+			found.DType = nil
+			near = append(near, found)
+		}
+	}
+	sort.SliceStable(near, func(i, j int) bool {
+		return db.Distance(point, near[i].Location) < db.Distance(point, near[j].Location)
+	})
+	return near, nil
+}
+
+// GetEventsNear returns the events overlapping [from, to] taking place within radius metres of the point,
+// nearest first and then in the order they start
+func (m *DB) GetEventsNear(ctx context.Context, point db.Loc, radius float64, from, to time.Time, options ...db.Option) ([]db.EventNear, error) {
+	if point.Type != "Point" || len(point.Coords) != 2 {
+		return nil, errors.New("GetEventsNear needs a point, see NewPoint")
+	}
+	if radius <= 0 {
+		return nil, fmt.Errorf("Invalid radius %v", radius)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	distances := make(map[string]float64)
+	for uid, l := range m.locations {
+		if l.Location.Type == "Point" {
+			if d := db.Distance(point, l.Location); d <= radius {
+				distances[uid] = d
+			}
+		}
+	}
+
+	near := make([]db.EventNear, 0)
+	for _, e := range m.liveEvents(func(e *db.Event) bool { return overlaps(e, from, to) }) {
+		nearest, found := 0.0, false
+		for _, l := range e.Location {
+			if d, ok := distances[l.UID]; ok && (!found || d < nearest) {
+				nearest, found = d, true
+			}
+		}
+		if found {
+			near = append(near, db.EventNear{Event: e, Distance: nearest})
+		}
+	}
+	sort.SliceStable(near, func(i, j int) bool {
+		return near[i].Distance < near[j].Distance
+	})
+	return near, nil
+}
+
+// GetFreeLocations returns the locations with no events overlapping (from, to), ordered by their id,
+// only those in the building with the location.id if it is set
+func (m *DB) GetFreeLocations(ctx context.Context, from, to time.Time, building string, options ...db.Option) ([]db.Location, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b *db.Location
+	if building != "" {
+		b = m.findLocation(db.Location{ID: building}, true)
+		if b == nil {
+			return nil, notFound("Location", "location.id", building)
+		}
+	}
+
+	busy := make(map[string]bool)
+	for _, e := range m.events {
+		if e.DeletedAt == nil && overlapsOpen(e, from, to) {
+			for _, edge := range e.Location {
+				busy[edge.UID] = true
+			}
+		}
+	}
+
+	free := make([]db.Location, 0)
+	for _, uid := range m.locationUIDs() {
+		l := m.locations[uid]
+		if busy[uid] || (b != nil && (l.PartOf == nil || l.PartOf.UID != b.UID)) {
+			continue
+		}
+		found := *l
+		found.PartOf = nil
+		found.DType = nil
+		free = append(free, found)
+	}
+	sort.SliceStable(free, func(i, j int) bool {
+		return free[i].ID < free[j].ID
+	})
+	return free, nil
+}
+
+// GetEventsDuring returns the events overlapping [from, to] and starting within db.MaxEventDuration of from,
+// ordered by their start date, only those in the building with the location.id or one of its rooms if it is set
+func (m *DB) GetEventsDuring(ctx context.Context, from, to time.Time, building string, options ...db.Option) ([]db.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b *db.Location
+	if building != "" {
+		b = m.findLocation(db.Location{ID: building}, true)
+		if b == nil {
+			return nil, notFound("Location", "location.id", building)
+		}
+	}
+
+	earliest := from.Add(-db.MaxEventDuration)
+	return m.liveEvents(func(e *db.Event) bool {
+		if !overlaps(e, from, to) || e.StartDate.Before(earliest) {
+			return false
+		}
+		if b == nil {
+			return true
+		}
+		for _, edge := range e.Location {
+			l := m.locations[edge.UID]
+			if edge.UID == b.UID || (l != nil && l.PartOf != nil && l.PartOf.UID == b.UID) {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+// DeleteLocation removes the location. If cascade is set, the events taking place there are unlinked from it as well.
+func (m *DB) DeleteLocation(ctx context.Context, loc db.Location, cascade bool, options ...db.Option) error {
+	if loc.UID == "" {
+		return errors.New("Cannot delete a node without a uid")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.locations, loc.UID)
+	if cascade {
+		for _, e := range m.events {
+			kept := make([]db.Location, 0, len(e.Location))
+			for _, edge := range e.Location {
+				if edge.UID != loc.UID {
+					kept = append(kept, edge)
+				}
+			}
+			e.Location = kept
+		}
+	}
+	return nil
+}
+
+// GetModule returns the module looked up by Uid if it has one, or by module code otherwise,
+// or an error wrapping db.ErrNotFound
+func (m *DB) GetModule(ctx context.Context, mod db.Module, options ...db.Option) (*db.Module, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	found := m.findModule(mod, true)
+	if found == nil {
+		if mod.UID != "" {
+			return nil, notFound("Module", "uid", mod.UID)
+		}
+		return nil, notFound("Module", "module.code", mod.Code)
+	}
+	return &db.Module{UID: found.UID, Code: found.Code, Name: found.Name, Subject: found.Subject}, nil
+}
+
+// GetModuleTxn is GetModule
+func (m *DB) GetModuleTxn(ctx context.Context, txn *db.Txn, mod db.Module, options ...db.Option) (*db.Module, error) {
+	return m.GetModule(ctx, mod)
+}
+
+// GetModuleFromSDSCode returns the module with the code
+func (m *DB) GetModuleFromSDSCode(ctx context.Context, slug string, options ...db.Option) (*db.Module, error) {
+	return m.GetModule(ctx, db.Module{Code: slug})
+}
+
+func (m *DB) findModule(mod db.Module, byKey bool) *db.Module {
+	if mod.UID != "" {
+		return m.modules[mod.UID]
+	}
+	if !byKey || mod.Code == "" {
+		return nil
+	}
+	for _, found := range m.modules {
+		if found.Code == mod.Code {
+			return found
+		}
+	}
+	return nil
+}
+
+// ListModules returns a page of the modules ordered by their module code
+func (m *DB) ListModules(ctx context.Context, opts db.ListOptions, options ...db.Option) ([]db.Module, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	modules := make([]*db.Module, 0, len(m.modules))
+	for _, mod := range m.modules {
+		modules = append(modules, mod)
+	}
+	sort.Slice(modules, func(i, j int) bool {
+		return modules[i].Code < modules[j].Code
+	})
+	db.SortNodes(modules, opts.Sort)
+	uids := make([]string, len(modules))
+	for i, mod := range modules {
+		uids[i] = mod.UID
+	}
+	uids, err := page(uids, opts)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]db.Module, len(uids))
+	for i, uid := range uids {
+		found := m.modules[uid]
+		out[i] = db.Module{UID: found.UID, Code: found.Code, Name: found.Name, Subject: found.Subject}
+	}
+	return out, nil
+}
+
+// SearchModules returns the modules whose code is one of the words in the query, or whose name contains any of them,
+// scored the same way as db.DB, best matches first
+func (m *DB) SearchModules(ctx context.Context, query string, options ...db.Option) ([]db.ModuleMatch, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return make([]db.ModuleMatch, 0), nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	matches := make([]db.ModuleMatch, 0)
+	for _, mod := range m.modules {
+		score := 2 * scoreText(mod.Name, terms)
+		for _, t := range terms {
+			if strings.EqualFold(t, mod.Code) {
+				score += 2
+			}
+		}
+		if score > 0 {
+			matches = append(matches, db.ModuleMatch{
+				Module: db.Module{UID: mod.UID, Code: mod.Code, Name: mod.Name, Subject: mod.Subject},
+				Score:  score,
+			})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Module.Code < matches[j].Module.Code
+	})
+	return matches, nil
+}
+
+// UpsertModule stores the module, matching modules without a Uid on module.code
+func (m *DB) UpsertModule(ctx context.Context, mod db.Module, options ...db.Option) (*db.Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	uid, created := m.upsertModule(mod, true)
+	return response(uid, created), nil
+}
+
+// UpsertModuleTxn is UpsertModule
+func (m *DB) UpsertModuleTxn(ctx context.Context, txn *db.Txn, mod db.Module, options ...db.Option) (*db.Response, error) {
+	return m.UpsertModule(ctx, mod)
+}
+
+// upsertModule stores the module's own fields, the facets are kept on the event's edge instead
+func (m *DB) upsertModule(mod db.Module, byKey bool) (string, bool) {
+	stored := m.findModule(mod, byKey)
+	created := stored == nil
+	if created {
+		stored = &db.Module{UID: mod.UID, DType: []string{"Module"}}
+		if stored.UID == "" {
+			stored.UID = m.newUID()
+		}
+		m.claimUID(stored.UID)
+		m.modules[stored.UID] = stored
+	}
+	if mod.Code != "" {
+		stored.Code = mod.Code
+	}
+	if mod.Name != "" {
+		stored.Name = mod.Name
+	}
+	if mod.Subject != "" {
+		stored.Subject = mod.Subject
+	}
+	if len(mod.DType) > 0 {
+		stored.DType = mod.DType
+	}
+	return stored.UID, created
+}
+
+// GetPerson returns the person looked up by Uid if they have one, or by name otherwise,
+// or an error wrapping db.ErrNotFound
+func (m *DB) GetPerson(ctx context.Context, person db.Person, options ...db.Option) (*db.Person, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	found := m.findPerson(person, true)
+	if found == nil {
+		if person.UID != "" {
+			return nil, notFound("Person", "uid", person.UID)
+		}
+		return nil, notFound("Person", "person.name", person.Name)
+	}
+	return &db.Person{UID: found.UID, Name: found.Name, Email: found.Email}, nil
+}
+
+// GetPersonTxn is GetPerson
+func (m *DB) GetPersonTxn(ctx context.Context, txn *db.Txn, person db.Person, options ...db.Option) (*db.Person, error) {
+	return m.GetPerson(ctx, person)
+}
+
+// ListPeople returns a page of the people ordered by their name, only the ones with any of the words of name if it is set
+func (m *DB) ListPeople(ctx context.Context, name string, opts db.ListOptions, options ...db.Option) ([]db.Person, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	people := m.matchPeople(name)
+	uids := make([]string, len(people))
+	for i, p := range people {
+		uids[i] = p.UID
+	}
+	uids, err := page(uids, opts)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]db.Person, len(uids))
+	for i, uid := range uids {
+		found := m.people[uid]
+		out[i] = db.Person{UID: found.UID, Name: found.Name, Email: found.Email}
+	}
+	return out, nil
+}
+
+// matchPeople returns the people ListPeople matches on name, ordered by their name
+func (m *DB) matchPeople(name string) []*db.Person {
+	terms := searchTerms(name)
+	people := make([]*db.Person, 0, len(m.people))
+	for _, p := range m.people {
+		if len(terms) == 0 || scoreText(p.Name, terms) > 0 {
+			people = append(people, p)
+		}
+	}
+	sort.Slice(people, func(i, j int) bool {
+		return people[i].Name < people[j].Name
+	})
+	return people
+}
+
+func (m *DB) findPerson(person db.Person, byKey bool) *db.Person {
+	if person.UID != "" {
+		return m.people[person.UID]
+	}
+	if !byKey || person.Name == "" {
+		return nil
+	}
+	for _, found := range m.people {
+		if found.Name == person.Name {
+			return found
+		}
+	}
+	return nil
+}
+
+// UpsertPerson stores the person, matching people without a Uid on person.name
+func (m *DB) UpsertPerson(ctx context.Context, person db.Person, options ...db.Option) (*db.Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	uid, created := m.upsertPerson(person, true)
+	return response(uid, created), nil
+}
+
+// UpsertPersonTxn is UpsertPerson
+func (m *DB) UpsertPersonTxn(ctx context.Context, txn *db.Txn, person db.Person, options ...db.Option) (*db.Response, error) {
+	return m.UpsertPerson(ctx, person)
+}
+
+// upsertPerson stores the person's own fields, their role is kept on the event's edge instead
+func (m *DB) upsertPerson(person db.Person, byKey bool) (string, bool) {
+	stored := m.findPerson(person, byKey)
+	created := stored == nil
+	if created {
+		stored = &db.Person{UID: person.UID, DType: []string{"Person"}}
+		if stored.UID == "" {
+			stored.UID = m.newUID()
+		}
+		m.claimUID(stored.UID)
+		m.people[stored.UID] = stored
+	}
+	if person.Name != "" {
+		stored.Name = person.Name
+	}
+	if person.Email != "" {
+		stored.Email = person.Email
+	}
+	if len(person.DType) > 0 {
+		stored.DType = person.DType
+	}
+	return stored.UID, created
+}
+
+// GetPersonFreeBusy returns when the person with the Uid is busy within (from, to), going by the events they organise
+func (m *DB) GetPersonFreeBusy(ctx context.Context, personUID string, from, to time.Time, options ...db.Option) ([]db.Interval, error) {
+	if personUID == "" {
+		return nil, errors.New("GetPersonFreeBusy needs the Uid of a person")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.people[personUID]; !ok {
+		return nil, notFound("Person", "uid", personUID)
+	}
+	events := m.liveEvents(func(e *db.Event) bool {
+		for _, edge := range e.Organiser {
+			if edge.UID == personUID {
+				return overlapsOpen(e, from, to)
+			}
+		}
+		return false
+	})
+	return db.BusyIntervals(events, from, to), nil
+}
+
+// DeletePerson removes the person. If cascade is set, the events they organise or attend are unlinked from them as well.
+func (m *DB) DeletePerson(ctx context.Context, person db.Person, cascade bool, options ...db.Option) error {
+	if person.UID == "" {
+		return errors.New("Cannot delete a node without a uid")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.people, person.UID)
+	if cascade {
+		for _, e := range m.events {
+			e.Organiser = removePersonEdge(e.Organiser, person.UID)
+			e.Attendees = removePersonEdge(e.Attendees, person.UID)
+		}
+	}
+	return nil
+}
+
+// UpsertSeries stores the series, matching series without a Uid on series.id
+func (m *DB) UpsertSeries(ctx context.Context, series db.Series, options ...db.Option) (*db.Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	uid, created := m.upsertSeries(series, true)
+	return response(uid, created), nil
+}
+
+func (m *DB) upsertSeries(series db.Series, byKey bool) (string, bool) {
+	stored := m.findSeries(series, byKey)
+	created := stored == nil
+	if created {
+		stored = &db.Series{UID: series.UID, DType: []string{"Series"}}
+		if stored.UID == "" {
+			stored.UID = m.newUID()
+		}
+		m.claimUID(stored.UID)
+		m.series[stored.UID] = stored
+	}
+	if series.ID != "" {
+		stored.ID = series.ID
+	}
+	if series.Title != "" {
+		stored.Title = series.Title
+	}
+	if len(series.DType) > 0 {
+		stored.DType = series.DType
+	}
+	return stored.UID, created
+}
+
+func (m *DB) findSeries(series db.Series, byKey bool) *db.Series {
+	if series.UID != "" {
+		return m.series[series.UID]
+	}
+	if !byKey || series.ID == "" {
+		return nil
+	}
+	for _, found := range m.series {
+		if found.ID == series.ID {
+			return found
+		}
+	}
+	return nil
+}
+
+// lookupSeries returns the series looked up by Uid if it has one, or by series.id otherwise
+func (m *DB) lookupSeries(op string, series db.Series) (*db.Series, error) {
+	if series.UID == "" && series.ID == "" {
+		return nil, fmt.Errorf("%s needs a series with a Uid or an ID", op)
+	}
+	found := m.findSeries(series, true)
+	if found == nil {
+		if series.UID != "" {
+			return nil, notFound("Series", "uid", series.UID)
+		}
+		return nil, notFound("Series", "series.id", series.ID)
+	}
+	return found, nil
+}
+
+// GetSeries returns the series looked up by Uid if it has one, or by series.id otherwise,
+// or an error wrapping db.ErrNotFound
+func (m *DB) GetSeries(ctx context.Context, series db.Series, options ...db.Option) (*db.Series, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	found, err := m.lookupSeries("GetSeries", series)
+	if err != nil {
+		return nil, err
+	}
+	return &db.Series{UID: found.UID, ID: found.ID, Title: found.Title}, nil
+}
+
+// GetSeriesOccurrences returns the events of the series in start date order, leaving out soft deleted ones
+func (m *DB) GetSeriesOccurrences(ctx context.Context, series db.Series, options ...db.Option) ([]db.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	found, err := m.lookupSeries("GetSeriesOccurrences", series)
+	if err != nil {
+		return nil, err
+	}
+	return m.liveEvents(func(e *db.Event) bool {
+		return e.Series != nil && e.Series.UID == found.UID
+	}), nil
+}
@@ -0,0 +1,276 @@
+package memdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+// CountNodesWithField returns the number of nodes which hold the predicate,
+// which must be one of the predicates in db.Schema
+func (m *DB) CountNodesWithField(ctx context.Context, f string, options ...db.Option) (*int, error) {
+	if !db.IsKnownPredicate(f) {
+		return nil, fmt.Errorf("Unknown predicate %q", f)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Marshalling each node gives the predicates it holds, as the json tags leave out the empty ones
+	nodes := make([]interface{}, 0)
+	for _, e := range m.events {
+		nodes = append(nodes, e)
+		for _, rev := range e.Revisions {
+			nodes = append(nodes, rev)
+		}
+	}
+	for _, l := range m.locations {
+		nodes = append(nodes, l)
+	}
+	for _, mod := range m.modules {
+		nodes = append(nodes, mod)
+	}
+	for _, p := range m.people {
+		nodes = append(nodes, p)
+	}
+	for _, s := range m.scrapes {
+		nodes = append(nodes, s)
+	}
+	for _, s := range m.series {
+		nodes = append(nodes, s)
+	}
+
+	count := 0
+	for _, node := range nodes {
+		b, err := json.Marshal(node)
+		if err != nil {
+			return nil, err
+		}
+		var predicates map[string]json.RawMessage
+		err = json.Unmarshal(b, &predicates)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := predicates[f]; ok {
+			count++
+		}
+	}
+	return &count, nil
+}
+
+// CountEvents returns the number of events, soft deleted or not
+func (m *DB) CountEvents(ctx context.Context, options ...db.Option) (*int, error) {
+	return m.CountNodesWithField(ctx, "event.id")
+}
+
+// CountLiveEvents returns the number of events which haven't been soft deleted
+func (m *DB) CountLiveEvents(ctx context.Context, options ...db.Option) (*int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := len(m.liveEvents(func(*db.Event) bool { return true }))
+	return &count, nil
+}
+
+// CountFilteredEvents returns the number of events which haven't been soft deleted in at least one of the locations
+// the Accessible and Campus of the options leave in
+func (m *DB) CountFilteredEvents(ctx context.Context, opts db.ListOptions, options ...db.Option) (*int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := len(m.liveEvents(func(e *db.Event) bool { return m.located(e, opts) }))
+	return &count, nil
+}
+
+// CountEventsBetween returns the number of events GetEventsBetween pages through with the options
+func (m *DB) CountEventsBetween(ctx context.Context, start, end time.Time, opts db.ListOptions, options ...db.Option) (*int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := len(m.liveEvents(func(e *db.Event) bool { return startsBetween(e, start, end) && m.located(e, opts) }))
+	return &count, nil
+}
+
+// CountEventsByOrganiser returns the number of events GetEventsByOrganiser pages through with the options
+func (m *DB) CountEventsByOrganiser(ctx context.Context, person db.Person, from, to time.Time, opts db.ListOptions, options ...db.Option) (*int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := len(m.liveEvents(func(e *db.Event) bool { return m.organisedBy(e, person, from, to) && m.located(e, opts) }))
+	return &count, nil
+}
+
+// CountFilteredLocations returns the number of locations the Accessible and Campus of the options leave in
+func (m *DB) CountFilteredLocations(ctx context.Context, opts db.ListOptions, options ...db.Option) (*int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for _, l := range m.locations {
+		if opts.Includes(*l) {
+			count++
+		}
+	}
+	return &count, nil
+}
+
+// CountLocations returns the number of locations
+func (m *DB) CountLocations(ctx context.Context, options ...db.Option) (*int, error) {
+	return m.CountNodesWithField(ctx, "location.id")
+}
+
+// CountModules returns the number of modules
+func (m *DB) CountModules(ctx context.Context, options ...db.Option) (*int, error) {
+	return m.CountNodesWithField(ctx, "module.code")
+}
+
+// CountPeople returns the number of people ListPeople matches on name
+func (m *DB) CountPeople(ctx context.Context, name string, options ...db.Option) (*int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := len(m.matchPeople(name))
+	return &count, nil
+}
+
+// CountScrapes returns the number of scrapes
+func (m *DB) CountScrapes(ctx context.Context, options ...db.Option) (*int, error) {
+	return m.CountNodesWithField(ctx, "scrape.id")
+}
+
+// GetEventCountsByModule returns the modules with the most events, up to limit of them, heaviest first
+func (m *DB) GetEventCountsByModule(ctx context.Context, limit int, options ...db.Option) ([]db.ModuleEventCount, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	perModule := make(map[string]int)
+	for _, e := range m.events {
+		if e.DeletedAt != nil {
+			continue
+		}
+		for _, edge := range e.PartOfModule {
+			perModule[edge.UID]++
+		}
+	}
+
+	counts := make([]db.ModuleEventCount, 0)
+	for uid, n := range perModule {
+		if mod, ok := m.modules[uid]; ok {
+			counts = append(counts, db.ModuleEventCount{
+				Module: db.Module{UID: mod.UID, Code: mod.Code, Name: mod.Name},
+				Count:  n,
+			})
+		}
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return uidValue(counts[i].Module.UID) < uidValue(counts[j].Module.UID)
+	})
+	if first := firstOf(limit); len(counts) > first {
+		counts = counts[:first]
+	}
+	return counts, nil
+}
+
+// GetEventCountsByLocation returns the locations with the most events, up to limit of them, busiest first
+func (m *DB) GetEventCountsByLocation(ctx context.Context, limit int, options ...db.Option) ([]db.LocationEventCount, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	perLocation := make(map[string]int)
+	for _, e := range m.events {
+		if e.DeletedAt != nil {
+			continue
+		}
+		for _, edge := range e.Location {
+			perLocation[edge.UID]++
+		}
+	}
+
+	counts := make([]db.LocationEventCount, 0)
+	for uid, n := range perLocation {
+		if l, ok := m.locations[uid]; ok {
+			counts = append(counts, db.LocationEventCount{
+				Location: db.Location{UID: l.UID, ID: l.ID, Name: l.Name, DisabledAccess: l.DisabledAccess, Campus: l.Campus, Capacity: l.Capacity},
+				Count:    n,
+			})
+		}
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return uidValue(counts[i].Location.UID) < uidValue(counts[j].Location.UID)
+	})
+	if first := firstOf(limit); len(counts) > first {
+		counts = counts[:first]
+	}
+	return counts, nil
+}
+
+// GetEventsPerDay returns how many events start on each day within [from, to], in date order
+func (m *DB) GetEventsPerDay(ctx context.Context, from, to time.Time, options ...db.Option) ([]db.DayEventCount, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	perDay := make(map[time.Time]int)
+	for _, e := range m.events {
+		if e.DeletedAt != nil || e.StartDate == nil || e.StartDate.Before(from) || e.StartDate.After(to) {
+			continue
+		}
+		start := e.StartDate.UTC()
+		perDay[time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)]++
+	}
+
+	counts := make([]db.DayEventCount, 0, len(perDay))
+	for day, n := range perDay {
+		counts = append(counts, db.DayEventCount{Day: day, Count: n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		return counts[i].Day.Before(counts[j].Day)
+	})
+	return counts, nil
+}
+
+// GetBuildingOccupancy returns how many of the rooms of the building with the location.id are booked during each hour
+// from from until to, counting them the same way as db.DB
+func (m *DB) GetBuildingOccupancy(ctx context.Context, building string, from, to time.Time, options ...db.Option) (*db.Occupancy, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b := m.findLocation(db.Location{ID: building}, true)
+	if b == nil {
+		return nil, notFound("Location", "location.id", building)
+	}
+	rooms := make(map[string]bool)
+	for uid, l := range m.locations {
+		if l.PartOf != nil && l.PartOf.UID == b.UID {
+			rooms[uid] = true
+		}
+	}
+
+	events := m.liveEvents(func(e *db.Event) bool {
+		return e.StartDate != nil && e.EndDate != nil && e.StartDate.Before(to) && !e.EndDate.Before(from)
+	})
+	for i, e := range events {
+		located := make([]db.Location, 0, len(e.Location))
+		for _, l := range e.Location {
+			if rooms[l.UID] {
+				located = append(located, l)
+			}
+		}
+		events[i].Location = located
+	}
+
+	return &db.Occupancy{
+		Building: db.Location{UID: b.UID, ID: b.ID, Name: b.Name, DisabledAccess: b.DisabledAccess, Campus: b.Campus},
+		Rooms:    len(rooms),
+		Hours:    db.HourlyOccupancy(from, to, events),
+	}, nil
+}
@@ -0,0 +1,85 @@
+package memdb
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+// UpsertTerm stores the term, matching terms without a Uid on term.id
+func (m *DB) UpsertTerm(ctx context.Context, term db.Term, options ...db.Option) (*db.Response, error) {
+	if term.UID == "" && term.ID == "" {
+		return nil, errors.New("UpsertTerm needs a term with a Uid or an ID")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := m.findTerm(term)
+	created := stored == nil
+	if created {
+		stored = &db.Term{UID: term.UID, DType: []string{"Term"}}
+		if stored.UID == "" {
+			stored.UID = m.newUID()
+		}
+		m.claimUID(stored.UID)
+		m.terms[stored.UID] = stored
+	}
+	if term.ID != "" {
+		stored.ID = term.ID
+	}
+	if term.Name != "" {
+		stored.Name = term.Name
+	}
+	if term.AcademicYear != 0 {
+		stored.AcademicYear = term.AcademicYear
+	}
+	if term.StartDate != nil {
+		t := *term.StartDate
+		stored.StartDate = &t
+	}
+	if term.EndDate != nil {
+		t := *term.EndDate
+		stored.EndDate = &t
+	}
+	return response(stored.UID, created), nil
+}
+
+func (m *DB) findTerm(term db.Term) *db.Term {
+	if term.UID != "" {
+		return m.terms[term.UID]
+	}
+	for _, t := range m.terms {
+		if t.ID == term.ID {
+			return t
+		}
+	}
+	return nil
+}
+
+// ListTerms returns the terms of the academic year starting in the year, or every term if it is 0, in the order they start
+func (m *DB) ListTerms(ctx context.Context, year int, options ...db.Option) ([]db.Term, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	terms := make([]db.Term, 0)
+	for _, t := range m.terms {
+		if year == 0 || t.AcademicYear == year {
+			found := *t
+			found.DType = nil
+			terms = append(terms, found)
+		}
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		a, b := terms[i].StartDate, terms[j].StartDate
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		if !a.Equal(*b) {
+			return a.Before(*b)
+		}
+		return terms[i].ID < terms[j].ID
+	})
+	return terms, nil
+}
@@ -0,0 +1,232 @@
+package memdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+// SetUserTimetable stores the user, matching on user.subject, replacing the modules of their timetable with user.Modules
+func (m *DB) SetUserTimetable(ctx context.Context, user db.User, options ...db.Option) (*db.Response, error) {
+	if user.Subject == "" {
+		return nil, errors.New("SetUserTimetable needs a user with a Subject")
+	}
+	for _, mod := range user.Modules {
+		if mod.UID == "" {
+			return nil, fmt.Errorf("The module %s of the timetable needs a Uid", mod.Code)
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := m.findUser(user.Subject)
+	created := stored == nil
+	if created {
+		stored = &db.User{UID: m.newUID(), Subject: user.Subject, DType: []string{"User"}}
+		m.users[stored.UID] = stored
+	}
+	if user.Email != "" {
+		stored.Email = user.Email
+	}
+	if user.Name != "" {
+		stored.Name = user.Name
+	}
+	if user.UpdatedAt != nil {
+		t := *user.UpdatedAt
+		stored.UpdatedAt = &t
+	}
+	stored.Modules = make([]db.Module, 0, len(user.Modules))
+	seen := make(map[string]bool)
+	for _, mod := range user.Modules {
+		// Like dgraph, an edge to a module which doesn't exist points at an empty node, which is left out when read
+		if !seen[mod.UID] {
+			seen[mod.UID] = true
+			stored.Modules = append(stored.Modules, db.Module{UID: mod.UID})
+		}
+	}
+	return response(stored.UID, created), nil
+}
+
+func (m *DB) findUser(subject string) *db.User {
+	for _, u := range m.users {
+		if u.Subject == subject {
+			return u
+		}
+	}
+	return nil
+}
+
+// GetUser returns the user with the user.subject, with the modules of their timetable in module code order,
+// or an error wrapping db.ErrNotFound if they have never saved a timetable
+func (m *DB) GetUser(ctx context.Context, subject string, options ...db.Option) (*db.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.findUser(subject)
+	if u == nil {
+		return nil, notFound("User", "user.subject", subject)
+	}
+	found := *u
+	found.DType = nil
+	found.Modules = make([]db.Module, 0, len(u.Modules))
+	for _, edge := range u.Modules {
+		if mod, ok := m.modules[edge.UID]; ok {
+			found.Modules = append(found.Modules, db.Module{UID: mod.UID, Code: mod.Code, Name: mod.Name, Subject: mod.Subject})
+		}
+	}
+	sort.SliceStable(found.Modules, func(i, j int) bool {
+		return found.Modules[i].Code < found.Modules[j].Code
+	})
+	return &found, nil
+}
+
+// GetUserEvents returns the events of the modules of the user's timetable overlapping [from, to], ordered by start date
+func (m *DB) GetUserEvents(ctx context.Context, subject string, from, to time.Time, options ...db.Option) ([]db.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.findUser(subject)
+	if u == nil {
+		return make([]db.Event, 0), nil
+	}
+	modules := make(map[string]bool, len(u.Modules))
+	for _, mod := range u.Modules {
+		modules[mod.UID] = true
+	}
+	return m.liveEvents(func(e *db.Event) bool {
+		for _, edge := range e.PartOfModule {
+			if modules[edge.UID] {
+				return overlaps(e, from, to)
+			}
+		}
+		return false
+	}), nil
+}
+
+// SetUserNotifications stores the user, matching on user.subject, replacing how they want to be told about the changes
+// to the events of their modules, and setting their unsubscribe hash if they have one
+func (m *DB) SetUserNotifications(ctx context.Context, user db.User, options ...db.Option) (*db.Response, error) {
+	if user.Subject == "" {
+		return nil, errors.New("SetUserNotifications needs a user with a Subject")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := m.findUser(user.Subject)
+	created := stored == nil
+	if created {
+		stored = &db.User{UID: m.newUID(), Subject: user.Subject, DType: []string{"User"}}
+		m.users[stored.UID] = stored
+	}
+	if user.Email != "" {
+		stored.Email = user.Email
+	}
+	if user.Name != "" {
+		stored.Name = user.Name
+	}
+	if user.UpdatedAt != nil {
+		t := *user.UpdatedAt
+		stored.UpdatedAt = &t
+	}
+	if user.UnsubscribeHash != "" {
+		stored.UnsubscribeHash = user.UnsubscribeHash
+	}
+	stored.NotifyChannels = distinct(user.NotifyChannels)
+	stored.NotifyChanges = distinct(user.NotifyChanges)
+	stored.PushSubscriptions = distinct(user.PushSubscriptions)
+	return response(stored.UID, created), nil
+}
+
+// distinct returns the values without their repeats, as dgraph stores a list, in their order
+func distinct(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(values))
+	seen := make(map[string]bool)
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// GetUserByUnsubscribeHash returns the user with the user.unsubscribe_hash,
+// or an error wrapping db.ErrNotFound if no user has it
+func (m *DB) GetUserByUnsubscribeHash(ctx context.Context, hash string, options ...db.Option) (*db.User, error) {
+	m.mu.Lock()
+	var subject string
+	for _, u := range m.users {
+		if hash != "" && u.UnsubscribeHash == hash {
+			subject = u.Subject
+		}
+	}
+	m.mu.Unlock()
+
+	if subject == "" {
+		return nil, notFound("User", "user.unsubscribe_hash", hash)
+	}
+	return m.GetUser(ctx, subject)
+}
+
+// ListUsersToNotify returns the users with any of the modules in their timetable and a notification channel,
+// ordered by user.subject
+func (m *DB) ListUsersToNotify(ctx context.Context, moduleCodes []string, options ...db.Option) ([]db.User, error) {
+	codes := make(map[string]bool, len(moduleCodes))
+	for _, code := range moduleCodes {
+		codes[code] = true
+	}
+	m.mu.Lock()
+	subjects := make([]string, 0)
+	for _, u := range m.users {
+		if len(u.NotifyChannels) == 0 {
+			continue
+		}
+		for _, edge := range u.Modules {
+			if mod, ok := m.modules[edge.UID]; ok && codes[mod.Code] {
+				subjects = append(subjects, u.Subject)
+				break
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	sort.Strings(subjects)
+	users := make([]db.User, 0, len(subjects))
+	for _, subject := range subjects {
+		u, err := m.GetUser(ctx, subject)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *u)
+	}
+	return users, nil
+}
+
+// ClaimNotification records that the user with the subject is being told about the change with the Seq,
+// returning false if they already have been
+func (m *DB) ClaimNotification(ctx context.Context, change int64, subject string, options ...db.Option) (bool, error) {
+	if subject == "" {
+		return false, errors.New("ClaimNotification needs the subject of the user")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := db.NotificationKey(change, subject)
+	if m.notifications[key] != nil {
+		return false, nil
+	}
+	now := time.Now().UTC()
+	n := &db.Notification{UID: m.newUID(), Key: key, Change: change, SentAt: &now, DType: []string{"Notification"}}
+	if u := m.findUser(subject); u != nil {
+		n.User = &db.User{UID: u.UID}
+	}
+	m.notifications[key] = n
+	return true, nil
+}
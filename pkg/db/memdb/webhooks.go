@@ -0,0 +1,273 @@
+package memdb
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+// UpsertWebhook stores the webhook, matching webhooks without a Uid on webhook.id.
+// The filter lists are added to, as dgraph does.
+func (m *DB) UpsertWebhook(ctx context.Context, webhook db.Webhook, options ...db.Option) (*db.Response, error) {
+	if webhook.UID == "" && webhook.ID == "" {
+		return nil, errors.New("UpsertWebhook needs a webhook with a Uid or an ID")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := m.findWebhook(webhook)
+	created := stored == nil
+	if created {
+		stored = &db.Webhook{UID: webhook.UID, DType: []string{"Webhook"}}
+		if stored.UID == "" {
+			stored.UID = m.newUID()
+		}
+		m.claimUID(stored.UID)
+		m.webhooks[stored.UID] = stored
+	}
+	if webhook.ID != "" {
+		stored.ID = webhook.ID
+	}
+	if webhook.URL != "" {
+		stored.URL = webhook.URL
+	}
+	if webhook.Secret != "" {
+		stored.Secret = webhook.Secret
+	}
+	stored.Modules = addStrings(stored.Modules, webhook.Modules)
+	stored.Locations = addStrings(stored.Locations, webhook.Locations)
+	stored.Changes = addStrings(stored.Changes, webhook.Changes)
+	if webhook.CreatedAt != nil {
+		t := *webhook.CreatedAt
+		stored.CreatedAt = &t
+	}
+	return response(stored.UID, created), nil
+}
+
+// addStrings adds the values not already in list, as dgraph adds to a [string] predicate
+func addStrings(list, values []string) []string {
+	for _, v := range values {
+		found := false
+		for _, l := range list {
+			found = found || l == v
+		}
+		if !found {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func (m *DB) findWebhook(webhook db.Webhook) *db.Webhook {
+	if webhook.UID != "" {
+		return m.webhooks[webhook.UID]
+	}
+	for _, w := range m.webhooks {
+		if w.ID == webhook.ID {
+			return w
+		}
+	}
+	return nil
+}
+
+// copyWebhook returns a copy of the stored webhook as the getters return it
+func copyWebhook(w *db.Webhook) db.Webhook {
+	found := *w
+	found.Modules = append([]string(nil), w.Modules...)
+	found.Locations = append([]string(nil), w.Locations...)
+	found.Changes = append([]string(nil), w.Changes...)
+	found.DType = nil
+	return found
+}
+
+// GetWebhook returns the webhook with the webhook.id, or an error wrapping db.ErrNotFound
+func (m *DB) GetWebhook(ctx context.Context, id string, options ...db.Option) (*db.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w := m.findWebhook(db.Webhook{ID: id})
+	if w == nil || id == "" {
+		return nil, notFound("Webhook", "webhook.id", id)
+	}
+	found := copyWebhook(w)
+	return &found, nil
+}
+
+// ListWebhooks returns every webhook, oldest first
+func (m *DB) ListWebhooks(ctx context.Context, options ...db.Option) ([]db.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	webhooks := make([]db.Webhook, 0, len(m.webhooks))
+	for _, uid := range m.webhookUIDs() {
+		webhooks = append(webhooks, copyWebhook(m.webhooks[uid]))
+	}
+	sort.SliceStable(webhooks, func(i, j int) bool {
+		a, b := webhooks[i].CreatedAt, webhooks[j].CreatedAt
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		return a.Before(*b)
+	})
+	return webhooks, nil
+}
+
+func (m *DB) webhookUIDs() []string {
+	uids := make([]string, 0, len(m.webhooks))
+	for uid := range m.webhooks {
+		uids = append(uids, uid)
+	}
+	return sortedUIDs(uids)
+}
+
+// DeleteWebhook removes the webhook, along with the log of its deliveries
+func (m *DB) DeleteWebhook(ctx context.Context, webhook db.Webhook, options ...db.Option) error {
+	if webhook.UID == "" {
+		return errors.New("Cannot delete a node without a uid")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.webhooks, webhook.UID)
+	for uid, d := range m.deliveries {
+		if d.Webhook != nil && d.Webhook.UID == webhook.UID {
+			delete(m.deliveries, uid)
+		}
+	}
+	return nil
+}
+
+// ClaimWebhookDelivery stores the delivery to its Webhook before it is posted, returning it with its Uid and Key,
+// or nil if the change has already been claimed for the webhook
+func (m *DB) ClaimWebhookDelivery(ctx context.Context, delivery db.WebhookDelivery, options ...db.Option) (*db.WebhookDelivery, error) {
+	if delivery.Webhook == nil || delivery.Webhook.UID == "" || delivery.Webhook.ID == "" {
+		return nil, errors.New("ClaimWebhookDelivery needs a webhook with a Uid and an ID")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	webhook := delivery.Webhook
+	delivery.Key = db.WebhookDeliveryKey(delivery.Change, webhook.ID)
+	for _, d := range m.deliveries {
+		if d.Key == delivery.Key {
+			return nil, nil
+		}
+	}
+	if delivery.At == nil {
+		now := time.Now().UTC()
+		delivery.At = &now
+	}
+	delivery.UID = m.newUID()
+	stored := delivery
+	stored.Webhook = &db.Webhook{UID: webhook.UID}
+	stored.DType = []string{"WebhookDelivery"}
+	m.deliveries[stored.UID] = &stored
+	return &delivery, nil
+}
+
+// UpdateWebhookDelivery stores how the attempts at the claimed delivery with the Uid went
+func (m *DB) UpdateWebhookDelivery(ctx context.Context, delivery db.WebhookDelivery, options ...db.Option) (*db.Response, error) {
+	if delivery.UID == "" {
+		return nil, errors.New("UpdateWebhookDelivery needs a delivery with a Uid")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := m.deliveries[delivery.UID]
+	if stored == nil {
+		stored = &db.WebhookDelivery{UID: delivery.UID, DType: []string{"WebhookDelivery"}}
+		m.claimUID(stored.UID)
+		m.deliveries[stored.UID] = stored
+	}
+	if delivery.ID != "" {
+		stored.ID = delivery.ID
+	}
+	if delivery.Change != 0 {
+		stored.Change = delivery.Change
+	}
+	if delivery.Type != "" {
+		stored.Type = delivery.Type
+	}
+	if delivery.Event != "" {
+		stored.Event = delivery.Event
+	}
+	if delivery.Attempts != 0 {
+		stored.Attempts = delivery.Attempts
+	}
+	if delivery.Status != 0 {
+		stored.Status = delivery.Status
+	}
+	if delivery.Error != "" {
+		stored.Error = delivery.Error
+	}
+	if delivery.Delivered {
+		stored.Delivered = true
+	}
+	if delivery.At != nil {
+		t := *delivery.At
+		stored.At = &t
+	}
+	return response(stored.UID, false), nil
+}
+
+// ListWebhookDeliveries returns up to limit of the latest deliveries to the webhook with the Uid, newest first
+func (m *DB) ListWebhookDeliveries(ctx context.Context, webhook db.Webhook, limit int, options ...db.Option) ([]db.WebhookDelivery, error) {
+	if webhook.UID == "" {
+		return nil, errors.New("ListWebhookDeliveries needs a webhook with a Uid")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deliveries := make([]db.WebhookDelivery, 0)
+	for _, d := range m.sortedDeliveries() {
+		if d.Webhook != nil && d.Webhook.UID == webhook.UID {
+			found := *d
+			found.Webhook, found.DType = nil, nil
+			deliveries = append(deliveries, found)
+		}
+	}
+	for i, j := 0, len(deliveries)-1; i < j; i, j = i+1, j-1 {
+		deliveries[i], deliveries[j] = deliveries[j], deliveries[i]
+	}
+	if len(deliveries) > firstOf(limit) {
+		deliveries = deliveries[:firstOf(limit)]
+	}
+	return deliveries, nil
+}
+
+// DeleteWebhookDeliveriesBefore removes up to limit of the deliveries claimed before the time, oldest first
+func (m *DB) DeleteWebhookDeliveriesBefore(ctx context.Context, before time.Time, limit int, options ...db.Option) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deleted := 0
+	for _, d := range m.sortedDeliveries() {
+		if deleted == firstOf(limit) {
+			break
+		}
+		if d.At != nil && d.At.Before(before) {
+			delete(m.deliveries, d.UID)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// sortedDeliveries returns the stored deliveries oldest first, in the order they were claimed when they were claimed at once
+func (m *DB) sortedDeliveries() []*db.WebhookDelivery {
+	uids := make([]string, 0, len(m.deliveries))
+	for uid := range m.deliveries {
+		uids = append(uids, uid)
+	}
+	deliveries := make([]*db.WebhookDelivery, 0, len(uids))
+	for _, uid := range sortedUIDs(uids) {
+		deliveries = append(deliveries, m.deliveries[uid])
+	}
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		a, b := deliveries[i].At, deliveries[j].At
+		return a != nil && b != nil && a.Before(*b)
+	})
+	return deliveries
+}
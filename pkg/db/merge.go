@@ -0,0 +1,158 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// clearableEventPredicates are the predicates MergeEvent can be asked to clear.
+// event.id is the upsert key, so it can't be.
+var clearableEventPredicates = map[string]bool{
+	"event.title":          true,
+	"event.description":    true,
+	"event.start_date":     true,
+	"event.end_date":       true,
+	"event.organiser":      true,
+	"event.part_of_module": true,
+	"event.location":       true,
+}
+
+// MergeEvent updates the stored event with the fields set in event, leaving the others as they are,
+// and returns the event as it is now stored.
+// Set edge lists replace the existing edges instead of being added to them, so a moved lecture doesn't end up in two rooms.
+// Fields can only be removed by naming their predicates in clear, e.g. "event.description".
+// Events which don't exist yet are created, as with UpsertEvent.
+func (config *DB) MergeEvent(ctx context.Context, event Event, clear []string, options ...Option) (*Event, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	for _, p := range clear {
+		if !clearableEventPredicates[p] {
+			return nil, fmt.Errorf("Cannot clear %q on an event", p)
+		}
+	}
+
+	var merged *Event
+	err := config.WithTxn(ctx, func(txn *Txn) error {
+		existing, err := config.GetEventTxn(ctx, txn, event)
+		if errors.Is(err, ErrNotFound) {
+			for _, p := range clear {
+				clearEventField(&event, p)
+			}
+			_, err = config.UpsertEventTxn(ctx, txn, event)
+			merged = &event
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		// Built here rather than kept from a previous attempt, as WithTxn may call this more than once
+		update := event
+		update.UID = existing.UID
+		result := mergeEvent(*existing, update)
+		if len(clear) > 0 || eventChanged(*existing, update) {
+			update.Revisions = []Revision{snapshot(*existing)}
+		}
+
+		replaced := make([]string, 0)
+		if len(update.Organiser) > 0 {
+			replaced = append(replaced, "event.organiser")
+		}
+		if len(update.PartOfModule) > 0 {
+			replaced = append(replaced, "event.part_of_module")
+		}
+		if len(update.Location) > 0 {
+			replaced = append(replaced, "event.location")
+		}
+		for _, p := range clear {
+			clearEventField(&update, p)
+			clearEventField(&result, p)
+			replaced = append(replaced, p)
+		}
+
+		if len(replaced) > 0 {
+			nquads := make([]string, len(replaced))
+			for i, p := range replaced {
+				nquads[i] = fmt.Sprintf("<%s> <%s> * .", existing.UID, p)
+			}
+			_, err = config.runRequest(ctx, txn, "MergeEvent", &Request{
+				Mutations: []*Mutation{{DelNquads: []byte(strings.Join(nquads, "\n"))}},
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		// Only the fields which are set are written, so everything else is left as it was
+		req, err := mutationRequest(update)
+		if err != nil {
+			return err
+		}
+		_, err = config.runRequest(ctx, txn, "MergeEvent", req)
+		if err != nil {
+			return err
+		}
+		merged = &result
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// mergeEvent returns the existing event with every non-empty field of update copied over it
+func mergeEvent(existing, update Event) Event {
+	merged := existing
+	if update.ID != "" {
+		merged.ID = update.ID
+	}
+	if update.Title != "" {
+		merged.Title = update.Title
+	}
+	if update.Description != "" {
+		merged.Description = update.Description
+	}
+	if update.StartDate != nil {
+		merged.StartDate = update.StartDate
+	}
+	if update.EndDate != nil {
+		merged.EndDate = update.EndDate
+	}
+	if len(update.Organiser) > 0 {
+		merged.Organiser = update.Organiser
+	}
+	if len(update.PartOfModule) > 0 {
+		merged.PartOfModule = update.PartOfModule
+	}
+	if len(update.Location) > 0 {
+		merged.Location = update.Location
+	}
+	if len(update.DType) > 0 {
+		merged.DType = update.DType
+	}
+	return merged
+}
+
+// clearEventField zeroes the field of the event stored in the predicate
+func clearEventField(e *Event, predicate string) {
+	switch predicate {
+	case "event.title":
+		e.Title = ""
+	case "event.description":
+		e.Description = ""
+	case "event.start_date":
+		e.StartDate = nil
+	case "event.end_date":
+		e.EndDate = nil
+	case "event.organiser":
+		e.Organiser = nil
+	case "event.part_of_module":
+		e.PartOfModule = nil
+	case "event.location":
+		e.Location = nil
+	}
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics holds the prometheus collectors recording every query and mutation sent to dgraph
+type Metrics struct {
+	operations *prometheus.CounterVec
+	duration   *prometheus.HistogramVec
+	retries    prometheus.Counter
+}
+
+// NewMetrics creates the collectors and registers them with reg
+func NewMetrics(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "whatsupkent",
+			Subsystem: "db",
+			Name:      "operations_total",
+			Help:      "Number of dgraph queries and mutations, by operation, kind and result.",
+		}, []string{"operation", "kind", "result"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "whatsupkent",
+			Subsystem: "db",
+			Name:      "operation_duration_seconds",
+			Help:      "Latency of dgraph queries and mutations, by operation and kind.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation", "kind"}),
+		retries: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "whatsupkent",
+			Subsystem: "db",
+			Name:      "aborted_retries_total",
+			Help:      "Number of times a mutation was retried after its transaction was aborted.",
+		}),
+	}
+
+	for _, c := range []prometheus.Collector{m.operations, m.duration, m.retries} {
+		err := reg.Register(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Instrument records metrics for every operation made through the client from now on
+func (config *DB) Instrument(reg prometheus.Registerer) error {
+	m, err := NewMetrics(reg)
+	if err != nil {
+		return err
+	}
+	config.Metrics = m
+	return nil
+}
+
+// observe records an operation which started at start, it does nothing if the client isn't instrumented
+func (m *Metrics) observe(op, kind string, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	m.operations.WithLabelValues(op, kind, result).Inc()
+	m.duration.WithLabelValues(op, kind).Observe(time.Since(start).Seconds())
+}
+
+// retried records a retry after an aborted transaction, it does nothing if the client isn't instrumented
+func (m *Metrics) retried() {
+	if m == nil {
+		return
+	}
+	m.retries.Inc()
+}
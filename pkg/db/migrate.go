@@ -0,0 +1,163 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Migration is a single numbered step in the evolution of the data model
+type Migration struct {
+	// Version orders the migrations, and must be unique and greater than zero
+	Version int
+	Name    string
+	// Schema is altered into the database before Up runs, and can be left empty.
+	// Dgraph cannot alter the schema inside a transaction, so this part is not rolled back on failure.
+	Schema string
+	// Up makes the data changes for the migration.
+	// It runs inside the same transaction which records the migration, so either both commit or neither.
+	Up func(ctx context.Context, txn *Txn) error
+}
+
+// MigrationRecord is the node stored in the database for every migration that has been applied
+type MigrationRecord struct {
+	UID       string     `json:"uid,omitempty"`
+	Version   int        `json:"migration.version,omitempty"`
+	Name      string     `json:"migration.name,omitempty"`
+	AppliedAt *time.Time `json:"migration.applied_at,omitempty"`
+	DType     []string   `json:"dgraph.type,omitempty"`
+}
+
+// MigrationHistory returns every migration applied to the database, oldest first
+func (config *DB) MigrationHistory(ctx context.Context, options ...Option) ([]MigrationRecord, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+
+	q := `{
+		history(func: type(Migration), orderasc: migration.version) {
+			uid
+			migration.version
+			migration.name
+			migration.applied_at
+		}
+	}`
+
+	resp, err := config.runQuery(ctx, txn, "MigrationHistory", q, nil)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		History []MigrationRecord `json:"history"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.History, nil
+}
+
+// SchemaVersion returns the version of the latest migration applied, or 0 if there are none
+func (config *DB) SchemaVersion(ctx context.Context, options ...Option) (int, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	history, err := config.MigrationHistory(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(history) == 0 {
+		return 0, nil
+	}
+	return history[len(history)-1].Version, nil
+}
+
+// Migrate applies every migration newer than the current schema version, in order,
+// and returns the records of the ones it applied.
+// It stops at the first migration to fail, leaving the earlier ones applied.
+func (config *DB) Migrate(ctx context.Context, migrations []Migration, options ...Option) ([]MigrationRecord, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	steps := make([]Migration, len(migrations))
+	copy(steps, migrations)
+	sort.Slice(steps, func(i, j int) bool {
+		return steps[i].Version < steps[j].Version
+	})
+	for i, m := range steps {
+		if m.Version <= 0 {
+			return nil, fmt.Errorf("Migration %q has invalid version %d", m.Name, m.Version)
+		}
+		if i > 0 && steps[i-1].Version == m.Version {
+			return nil, fmt.Errorf("Migrations %q and %q share version %d", steps[i-1].Name, m.Name, m.Version)
+		}
+	}
+
+	current, err := config.SchemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make([]MigrationRecord, 0)
+	for _, m := range steps {
+		if m.Version <= current {
+			continue
+		}
+		record, err := config.applyMigration(ctx, m)
+		if err != nil {
+			return applied, fmt.Errorf("Migration %d (%s) failed: %v", m.Version, m.Name, err)
+		}
+		applied = append(applied, *record)
+	}
+
+	return applied, nil
+}
+
+func (config *DB) applyMigration(ctx context.Context, m Migration) (*MigrationRecord, error) {
+
+	if m.Schema != "" {
+		err := checkWritable(ctx, "Migrate")
+		if err != nil {
+			return nil, err
+		}
+		err = config.client.alter(ctx, m.Schema)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	record := MigrationRecord{
+		Version:   m.Version,
+		Name:      m.Name,
+		AppliedAt: &now,
+		DType:     []string{"Migration"},
+	}
+	pb, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.WithTxn(ctx, func(txn *Txn) error {
+		if m.Up != nil {
+			err := m.Up(ctx, txn)
+			if err != nil {
+				return err
+			}
+		}
+		_, err := config.runRequest(ctx, txn, "Migrate", &Request{
+			Mutations: []*Mutation{{SetJSON: pb}},
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
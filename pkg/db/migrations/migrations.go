@@ -0,0 +1,33 @@
+// Package migrations contains the numbered data migrations for the WhatsUpKent knowledge graph.
+// Add new steps to the end of All with the next version number, and never edit one that has shipped.
+package migrations
+
+import (
+	"context"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+// All is every migration, in order
+var All = []db.Migration{
+	{
+		Version: 1,
+		Name:    "type untyped locations",
+		Up:      typeUntypedLocations,
+	},
+}
+
+// typeUntypedLocations adds the Location type to the locations the scraper used to create on the fly
+// for rooms it couldn't find, which were stored without a dgraph.type and so never showed up in type(Location).
+func typeUntypedLocations(ctx context.Context, txn *db.Txn) error {
+	req := &db.Request{
+		Query: `{
+			l as var(func: has(location.name)) @filter(NOT type(Location))
+		}`,
+		Mutations: []*db.Mutation{{
+			SetNquads: []byte(`uid(l) <dgraph.type> "Location" .`),
+		}},
+	}
+	_, err := txn.Do(ctx, req)
+	return err
+}
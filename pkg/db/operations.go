@@ -3,11 +3,9 @@ package db
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"strconv"
 	"time"
-
-	"github.com/dgraph-io/dgo/v200/protos/api"
 )
 
 // This file should contain methods for interacting with the data easily.
@@ -15,17 +13,25 @@ import (
 
 // GetScrape should recieve a dgraph client and a scrape struct,
 // and return the official scrape struct from the database, complete with Uid for referencing
-// if no such struct exists, then it returns an error
-func (config *ConfigDB) GetScrape(scrape Scrape) (*Scrape, error) {
+// if no such scrape exists, then it returns an error wrapping ErrNotFound
+func (config *DB) GetScrape(ctx context.Context, scrape Scrape, options ...Option) (*Scrape, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+	return config.GetScrapeTxn(ctx, config.readTxn(ctx), scrape)
+}
+
+// GetScrapeTxn is GetScrape, run inside the given transaction
+func (config *DB) GetScrapeTxn(ctx context.Context, txn *Txn, scrape Scrape, options ...Option) (*Scrape, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
 	if scrape.UID != "" {
-		return config.getScrapeWithID(scrape)
+		return config.getScrapeWithID(ctx, txn, scrape)
 	}
-	return config.getScrapeWithoutID(scrape)
+	return config.getScrapeWithoutID(ctx, txn, scrape)
 }
 
-func (config *ConfigDB) getScrapeWithID(scrape Scrape) (*Scrape, error) {
-	txn := config.DBClient.NewReadOnlyTxn()
-	ctx := context.Background()
+func (config *DB) getScrapeWithID(ctx context.Context, txn *Txn, scrape Scrape) (*Scrape, error) {
 	q :=
 		`query FindScrape($uid: string) {
 			findScrape(func: uid($uid)) {
@@ -43,7 +49,7 @@ func (config *ConfigDB) getScrapeWithID(scrape Scrape) (*Scrape, error) {
 	variables := make(map[string]string)
 	variables["$uid"] = scrape.UID
 
-	resp, err := txn.QueryWithVars(ctx, q, variables)
+	resp, err := config.runQuery(ctx, txn, "GetScrape", q, variables)
 	if err != nil {
 		return nil, err
 	}
@@ -52,20 +58,18 @@ func (config *ConfigDB) getScrapeWithID(scrape Scrape) (*Scrape, error) {
 	}
 
 	var r Root
-	err = json.Unmarshal(resp.Json, &r)
+	err = json.Unmarshal(resp.JSON, &r)
 	if err != nil {
 		return nil, err
 	}
 	if len(r.FindScrape) == 0 {
-		return nil, fmt.Errorf("No Scrape found with id %s", scrape.UID)
+		return nil, notFound("Scrape", "uid", scrape.UID)
 	}
 
 	return &r.FindScrape[0], nil
 }
 
-func (config *ConfigDB) getScrapeWithoutID(scrape Scrape) (*Scrape, error) {
-	txn := config.DBClient.NewReadOnlyTxn()
-	ctx := context.Background()
+func (config *DB) getScrapeWithoutID(ctx context.Context, txn *Txn, scrape Scrape) (*Scrape, error) {
 	q :=
 		`query FindScrapeNoID($id: int) {
 			findScrapeNoID(func: eq(scrape.id, $id)) {
@@ -83,7 +87,7 @@ func (config *ConfigDB) getScrapeWithoutID(scrape Scrape) (*Scrape, error) {
 	variables := make(map[string]string)
 	variables["$id"] = strconv.Itoa(scrape.ID)
 
-	resp, err := txn.QueryWithVars(ctx, q, variables)
+	resp, err := config.runQuery(ctx, txn, "GetScrape", q, variables)
 	if err != nil {
 		return nil, err
 	}
@@ -92,84 +96,85 @@ func (config *ConfigDB) getScrapeWithoutID(scrape Scrape) (*Scrape, error) {
 	}
 
 	var r Root
-	err = json.Unmarshal(resp.Json, &r)
+	err = json.Unmarshal(resp.JSON, &r)
 	if err != nil {
 		return nil, err
 	}
 	if len(r.FindScrapeNoID) == 0 {
-		return nil, nil
+		return nil, notFound("Scrape", "scrape.id", strconv.Itoa(scrape.ID))
 	}
 
 	return &r.FindScrapeNoID[0], nil
 }
 
-// UpsertScrape upserts the scrape struct into the database
-func (config *ConfigDB) UpsertScrape(scrape Scrape) (*api.Response, error) {
-	mu := &api.Mutation{
-		CommitNow: true,
-	}
-	ctx := context.Background()
-	pb, err := json.Marshal(scrape)
-	if err != nil {
-		return nil, err
-	}
+// UpsertScrape upserts the scrape struct into the database.
+// Scrapes without a Uid are matched on scrape.id, so the same scrape is never stored twice.
+func (config *DB) UpsertScrape(ctx context.Context, scrape Scrape, options ...Option) (*Response, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
 
-	mu.SetJson = pb
-	assigned, err := config.DBClient.NewTxn().Mutate(ctx, mu)
+	req, err := scrapeRequest(scrape)
 	if err != nil {
 		return nil, err
 	}
-	return assigned, nil
+	return config.commit(ctx, "UpsertScrape", req)
 }
 
-//RemoveScrape deletes the specified scrape from the database.
-func (config *ConfigDB) RemoveScrape(scrape Scrape) error {
-	ctx := context.Background()
-	d := map[string]string{"uid": scrape.UID}
-	pb, err := json.Marshal(d)
-	if err != nil {
-		return err
-	}
+// UpsertScrapeTxn is UpsertScrape, run as part of the given transaction
+func (config *DB) UpsertScrapeTxn(ctx context.Context, txn *Txn, scrape Scrape, options ...Option) (*Response, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
 
-	mu := &api.Mutation{
-		CommitNow:  true,
-		DeleteJson: pb,
+	req, err := scrapeRequest(scrape)
+	if err != nil {
+		return nil, err
 	}
+	return config.runRequest(ctx, txn, "UpsertScrape", req)
+}
 
-	_, err = config.DBClient.NewTxn().Mutate(ctx, mu)
-	if err != nil {
-		return err
+func scrapeRequest(scrape Scrape) (*Request, error) {
+	if scrape.UID == "" && scrape.ID != 0 {
+		scrape.UID = upsertVar
+		return upsertRequest("scrape.id", "int", strconv.Itoa(scrape.ID), scrape)
 	}
-	return nil
+	return mutationRequest(scrape)
 }
 
 // GetEvent should recieve a dgraph client and an event struct,
 // and return the official event struct from the database, complete with Uid for referencing
-// if no such event exists, then it returns an error
-func (config *ConfigDB) GetEvent(event Event) (*Event, error) {
+// if no such event exists, then it returns an error wrapping ErrNotFound
+func (config *DB) GetEvent(ctx context.Context, event Event, options ...Option) (*Event, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+	return config.GetEventTxn(ctx, config.readTxn(ctx), event)
+}
+
+// GetEventTxn is GetEvent, run inside the given transaction
+func (config *DB) GetEventTxn(ctx context.Context, txn *Txn, event Event, options ...Option) (*Event, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
 	if event.UID != "" {
-		return config.getEventWithUID(event)
+		return config.getEventWithUID(ctx, txn, event)
 	}
-	return config.getEventWithoutUID(event)
+	return config.getEventWithoutUID(ctx, txn, event)
 }
 
-func (config *ConfigDB) getEventWithUID(event Event) (*Event, error) {
-	txn := config.DBClient.NewReadOnlyTxn()
-	ctx := context.Background()
+func (config *DB) getEventWithUID(ctx context.Context, txn *Txn, event Event) (*Event, error) {
 	q :=
 		`query FindEvent($id: string) {
-			findEvent(func: uid($id)) {
+			findEvent(func: uid($id)) @filter(NOT has(event.deleted_at)) {
 				uid
 				event.id
 				event.title
 				event.description
 				event.start_date
 				event.end_date
-				event.organiser {
+				event.organiser @facets(role) {
 					uid
 					person.name
 				}
-				event.part_of_module {
+				event.part_of_module @facets(weight, required) {
 					uid
 					module.code
 				}
@@ -177,6 +182,13 @@ func (config *ConfigDB) getEventWithUID(event Event) (*Event, error) {
 					uid
 					location.id
 					location.name
+					location.disabled_access
+					location.campus
+				}
+				event.series {
+					uid
+					series.id
+					series.title
 				}
 			}
 		}
@@ -184,7 +196,7 @@ func (config *ConfigDB) getEventWithUID(event Event) (*Event, error) {
 	variables := make(map[string]string)
 	variables["$id"] = event.UID
 
-	resp, err := txn.QueryWithVars(ctx, q, variables)
+	resp, err := config.runQuery(ctx, txn, "GetEvent", q, variables)
 	if err != nil {
 		return nil, err
 	}
@@ -193,35 +205,33 @@ func (config *ConfigDB) getEventWithUID(event Event) (*Event, error) {
 	}
 
 	var r Root
-	err = json.Unmarshal(resp.Json, &r)
+	err = json.Unmarshal(resp.JSON, &r)
 	if err != nil {
 		return nil, err
 	}
 
 	if len(r.FindEvent) == 0 {
-		return nil, fmt.Errorf("No Event found with uid %s", event.UID)
+		return nil, notFound("Event", "uid", event.UID)
 	}
 
 	return &r.FindEvent[0], nil
 }
 
-func (config *ConfigDB) getEventWithoutUID(event Event) (*Event, error) {
-	txn := config.DBClient.NewReadOnlyTxn()
-	ctx := context.Background()
+func (config *DB) getEventWithoutUID(ctx context.Context, txn *Txn, event Event) (*Event, error) {
 	q :=
 		`query FindEventNoUID($id: string) {
-			findEvent(func: eq(event.id, $id)) {
+			findEvent(func: eq(event.id, $id)) @filter(NOT has(event.deleted_at)) {
 				uid
 				event.id
 				event.title
 				event.description
 				event.start_date
 				event.end_date
-				event.organiser {
+				event.organiser @facets(role) {
 					uid
 					person.name
 				}
-				event.part_of_module {
+				event.part_of_module @facets(weight, required) {
 					uid
 					module.code
 				}
@@ -229,6 +239,13 @@ func (config *ConfigDB) getEventWithoutUID(event Event) (*Event, error) {
 					uid
 					location.id
 					location.name
+					location.disabled_access
+					location.campus
+				}
+				event.series {
+					uid
+					series.id
+					series.title
 				}
 			}
 		}
@@ -236,7 +253,7 @@ func (config *ConfigDB) getEventWithoutUID(event Event) (*Event, error) {
 	variables := make(map[string]string)
 	variables["$id"] = event.ID
 
-	resp, err := txn.QueryWithVars(ctx, q, variables)
+	resp, err := config.runQuery(ctx, txn, "GetEvent", q, variables)
 	if err != nil {
 		return nil, err
 	}
@@ -245,42 +262,94 @@ func (config *ConfigDB) getEventWithoutUID(event Event) (*Event, error) {
 	}
 
 	var r Root
-	err = json.Unmarshal(resp.Json, &r)
+	err = json.Unmarshal(resp.JSON, &r)
 	if err != nil {
 		return nil, err
 	}
 	if len(r.FindEvent) == 0 {
-		return nil, nil
+		return nil, notFound("Event", "event.id", event.ID)
 	}
 
 	return &r.FindEvent[0], nil
 }
 
-// UpsertEvent upserts the event struct into the database
-func (config *ConfigDB) UpsertEvent(event Event) (*api.Response, error) {
-	mu := &api.Mutation{
-		CommitNow: true,
+// UpsertEvent upserts the event struct into the database.
+// Events without a Uid are matched on event.id, so the same event is never stored twice.
+// If the title, description, dates or location of a stored event change, a revision with the previous values is kept.
+func (config *DB) UpsertEvent(ctx context.Context, event Event, options ...Option) (*Response, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	var resp *Response
+	err := config.WithTxn(ctx, func(txn *Txn) error {
+		var err error
+		resp, err = config.UpsertEventTxn(ctx, txn, event)
+		return err
+	})
+	return resp, err
+}
+
+// UpsertEventTxn is UpsertEvent, run as part of the given transaction
+func (config *DB) UpsertEventTxn(ctx context.Context, txn *Txn, event Event, options ...Option) (*Response, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	event, err := config.withRevision(ctx, txn, event)
+	if err != nil {
+		return nil, err
+	}
+	req, err := eventRequest(event)
+	if err != nil {
+		return nil, err
+	}
+	return config.runRequest(ctx, txn, "UpsertEvent", req)
+}
+
+// withRevision returns the event with a revision of the stored copy appended, if storing it would change that copy
+func (config *DB) withRevision(ctx context.Context, txn *Txn, event Event) (Event, error) {
+	if event.UID == "" && event.ID == "" {
+		return event, nil
+	}
+	existing, err := config.GetEventTxn(ctx, txn, event)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return event, err
 	}
-	ctx := context.Background()
-	pb, jsonErr := json.Marshal(event)
-	if jsonErr != nil {
-		return nil, jsonErr
+	if existing != nil {
+		if rev := revisionOf(*existing, event); rev != nil {
+			event.Revisions = append(event.Revisions, *rev)
+		}
 	}
+	return event, nil
+}
 
-	mu.SetJson = pb
-	assigned, upsertErr := config.DBClient.NewTxn().Mutate(ctx, mu)
-	if upsertErr != nil {
-		// if upsertErr == y.ErrAborted {
-		// }
-		return nil, upsertErr
+func eventRequest(event Event) (*Request, error) {
+	if event.UID == "" && event.ID != "" {
+		event.UID = upsertVar
+		req, err := upsertRequest("event.id", "string", event.ID, event)
+		if err != nil || event.DeletedAt != nil {
+			return req, err
+		}
+		// Storing an event again means it is back on the timetable, so it is restored if it was soft deleted
+		req.Mutations = append(req.Mutations, &Mutation{
+			DelNquads: []byte(upsertVar + " <event.deleted_at> * ."),
+		})
+		return req, nil
 	}
-	return assigned, nil
+	return mutationRequest(event)
+}
+
+//GetLocationFromKentSlug returns a matching location from the slug kent uses internally, or ErrNotFound if it doesnt exist
+func (config *DB) GetLocationFromKentSlug(ctx context.Context, slug string, options ...Option) (*Location, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+	return config.GetLocationFromKentSlugTxn(ctx, config.readTxn(ctx), slug)
 }
 
-//GetLocationFromKentSlug returns a matching location from the slug kent uses internally
-func (config *ConfigDB) GetLocationFromKentSlug(slug string) (*Location, error) {
-	txn := config.DBClient.NewReadOnlyTxn()
-	ctx := context.Background()
+// GetLocationFromKentSlugTxn is GetLocationFromKentSlug, run inside the given transaction
+func (config *DB) GetLocationFromKentSlugTxn(ctx context.Context, txn *Txn, slug string, options ...Option) (*Location, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
 	q :=
 		`query FindLocationFromSlug($id: string) {
 			findLocation(func: eq(location.id, $id)) {
@@ -288,13 +357,15 @@ func (config *ConfigDB) GetLocationFromKentSlug(slug string) (*Location, error)
 				location.id
 				location.name
 				location.disabled_access
+				location.campus
+				location.capacity
 			}
 		}
 	`
 	variables := make(map[string]string)
 	variables["$id"] = slug
 
-	resp, err := txn.QueryWithVars(ctx, q, variables)
+	resp, err := config.runQuery(ctx, txn, "GetLocationFromKentSlug", q, variables)
 	if err != nil {
 		return nil, err
 	}
@@ -303,40 +374,105 @@ func (config *ConfigDB) GetLocationFromKentSlug(slug string) (*Location, error)
 	}
 
 	var r Root
-	err = json.Unmarshal(resp.Json, &r)
+	err = json.Unmarshal(resp.JSON, &r)
 	if err != nil {
 		return nil, err
 	}
 	if len(r.FindLocation) == 0 {
-		return nil, nil
+		return nil, notFound("Location", "location.id", slug)
 	}
 
 	return &r.FindLocation[0], nil
 }
 
-// UpsertLocation upserts the location struct into the database
-func (config *ConfigDB) UpsertLocation(loc Location) (*api.Response, error) {
-	mu := &api.Mutation{
-		CommitNow: true,
+// UpsertLocation upserts the location struct into the database.
+// Locations without a Uid are matched on location.id, so the same location is never stored twice.
+func (config *DB) UpsertLocation(ctx context.Context, loc Location, options ...Option) (*Response, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	req, err := locationRequest(loc)
+	if err != nil {
+		return nil, err
+	}
+	return config.commit(ctx, "UpsertLocation", req)
+}
+
+// UpsertLocationTxn is UpsertLocation, run as part of the given transaction
+func (config *DB) UpsertLocationTxn(ctx context.Context, txn *Txn, loc Location, options ...Option) (*Response, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	req, err := locationRequest(loc)
+	if err != nil {
+		return nil, err
+	}
+	return config.runRequest(ctx, txn, "UpsertLocation", req)
+}
+
+func locationRequest(loc Location) (*Request, error) {
+	if loc.UID == "" && loc.ID != "" {
+		loc.UID = upsertVar
+		return upsertRequest("location.id", "string", loc.ID, loc)
+	}
+	return mutationRequest(loc)
+}
+
+// GetModule should recieve a module struct, and return the official module struct from the database,
+// looked up by Uid if it has one, or by module code otherwise.
+// if no such module exists, then it returns an error wrapping ErrNotFound
+func (config *DB) GetModule(ctx context.Context, m Module, options ...Option) (*Module, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+	return config.GetModuleTxn(ctx, config.readTxn(ctx), m)
+}
+
+// GetModuleTxn is GetModule, run inside the given transaction
+func (config *DB) GetModuleTxn(ctx context.Context, txn *Txn, m Module, options ...Option) (*Module, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	if m.UID != "" {
+		return config.getModuleWithUID(ctx, txn, m)
 	}
-	ctx := context.Background()
-	pb, err := json.Marshal(loc)
+	return config.getModuleWithoutUID(ctx, txn, m)
+}
+
+func (config *DB) getModuleWithUID(ctx context.Context, txn *Txn, m Module) (*Module, error) {
+	q :=
+		`query FindModule($uid: string) {
+			findModule(func: uid($uid)) @filter(type(Module)) {
+				uid
+				module.code
+				module.name
+				module.subject
+			}
+		}
+	`
+	variables := make(map[string]string)
+	variables["$uid"] = m.UID
+
+	resp, err := config.runQuery(ctx, txn, "GetModule", q, variables)
 	if err != nil {
 		return nil, err
 	}
+	type Root struct {
+		FindModule []Module `json:"findModule"`
+	}
 
-	mu.SetJson = pb
-	assigned, err := config.DBClient.NewTxn().Mutate(ctx, mu)
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
 	if err != nil {
 		return nil, err
 	}
-	return assigned, nil
+	if len(r.FindModule) == 0 {
+		return nil, notFound("Module", "uid", m.UID)
+	}
+
+	return &r.FindModule[0], nil
 }
 
-//GetModuleFromSDSCode returns a matching module from the slug kent uses internally, or nil if it doesnt exist
-func (config *ConfigDB) GetModuleFromSDSCode(slug string) (*Module, error) {
-	txn := config.DBClient.NewReadOnlyTxn()
-	ctx := context.Background()
+func (config *DB) getModuleWithoutUID(ctx context.Context, txn *Txn, m Module) (*Module, error) {
 	q :=
 		`query FindModuleFromCode($id: string) {
 			findModule(func: eq(module.code, $id)) {
@@ -348,9 +484,9 @@ func (config *ConfigDB) GetModuleFromSDSCode(slug string) (*Module, error) {
 		}
 	`
 	variables := make(map[string]string)
-	variables["$id"] = slug
+	variables["$id"] = m.Code
 
-	resp, err := txn.QueryWithVars(ctx, q, variables)
+	resp, err := config.runQuery(ctx, txn, "GetModule", q, variables)
 	if err != nil {
 		return nil, err
 	}
@@ -359,78 +495,195 @@ func (config *ConfigDB) GetModuleFromSDSCode(slug string) (*Module, error) {
 	}
 
 	var r Root
-	err = json.Unmarshal(resp.Json, &r)
+	err = json.Unmarshal(resp.JSON, &r)
 	if err != nil {
 		return nil, err
 	}
 	if len(r.FindModule) == 0 {
-		return nil, nil
+		return nil, notFound("Module", "module.code", m.Code)
 	}
 
 	return &r.FindModule[0], nil
 }
 
-// UpsertModule upserts the location struct into the database
-func (config *ConfigDB) UpsertModule(m Module) (*api.Response, error) {
-	mu := &api.Mutation{
-		CommitNow: true,
-	}
-	ctx := context.Background()
-	pb, err := json.Marshal(m)
+//GetModuleFromSDSCode returns a matching module from the slug kent uses internally, or ErrNotFound if it doesnt exist
+func (config *DB) GetModuleFromSDSCode(ctx context.Context, slug string, options ...Option) (*Module, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+	return config.getModuleWithoutUID(ctx, config.readTxn(ctx), Module{Code: slug})
+}
+
+// UpsertModule upserts the module struct into the database.
+// Modules without a Uid are matched on module.code, so the same module is never stored twice.
+func (config *DB) UpsertModule(ctx context.Context, m Module, options ...Option) (*Response, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	req, err := moduleRequest(m)
 	if err != nil {
 		return nil, err
 	}
+	return config.commit(ctx, "UpsertModule", req)
+}
+
+// UpsertModuleTxn is UpsertModule, run as part of the given transaction
+func (config *DB) UpsertModuleTxn(ctx context.Context, txn *Txn, m Module, options ...Option) (*Response, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
 
-	mu.SetJson = pb
-	assigned, err := config.DBClient.NewTxn().Mutate(ctx, mu)
+	req, err := moduleRequest(m)
 	if err != nil {
 		return nil, err
 	}
-	return assigned, nil
+	return config.runRequest(ctx, txn, "UpsertModule", req)
 }
 
-// CountNodesWithFieldUnsafe returns the number of nodes which contain the specified field
-// this is a good indicator of the number of nodes of a certain type
-// this is unsafe, there is no input sanitation and is open to injection attacks
-func (config *ConfigDB) CountNodesWithFieldUnsafe(f string) (*int, error) {
-	txn := config.DBClient.NewReadOnlyTxn()
-	ctx := context.Background()
+func moduleRequest(m Module) (*Request, error) {
+	// Facets only mean something on an event's edge, not on the module itself
+	m.Weight, m.Required = 0, false
+	if len(m.DType) == 0 {
+		m.DType = []string{"Module"}
+	}
+	if m.UID == "" && m.Code != "" {
+		m.UID = upsertVar
+		return upsertRequest("module.code", "string", m.Code, m)
+	}
+	return mutationRequest(m)
+}
+
+// GetPerson should recieve a person struct, and return the official person struct from the database,
+// looked up by Uid if it has one, or by name otherwise.
+// if no such person exists, then it returns an error wrapping ErrNotFound
+func (config *DB) GetPerson(ctx context.Context, person Person, options ...Option) (*Person, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+	return config.GetPersonTxn(ctx, config.readTxn(ctx), person)
+}
 
-	q := fmt.Sprintf(
-		`query Count {
-			nodeCount(func: has(%s)) {
-				nodeCount: count(uid)
+// GetPersonTxn is GetPerson, run inside the given transaction
+func (config *DB) GetPersonTxn(ctx context.Context, txn *Txn, person Person, options ...Option) (*Person, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	if person.UID != "" {
+		return config.getPersonWithUID(ctx, txn, person)
+	}
+	return config.getPersonWithoutUID(ctx, txn, person)
+}
+
+func (config *DB) getPersonWithUID(ctx context.Context, txn *Txn, person Person) (*Person, error) {
+	q :=
+		`query FindPerson($uid: string) {
+			findPerson(func: uid($uid)) @filter(type(Person)) {
+				uid
+				person.name
+				person.email
 			}
 		}
-		`, f)
+	`
+	variables := make(map[string]string)
+	variables["$uid"] = person.UID
 
-	resp, err := txn.Query(ctx, q)
+	resp, err := config.runQuery(ctx, txn, "GetPerson", q, variables)
 	if err != nil {
 		return nil, err
 	}
+	type Root struct {
+		FindPerson []Person `json:"findPerson"`
+	}
 
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.FindPerson) == 0 {
+		return nil, notFound("Person", "uid", person.UID)
+	}
+
+	return &r.FindPerson[0], nil
+}
+
+func (config *DB) getPersonWithoutUID(ctx context.Context, txn *Txn, person Person) (*Person, error) {
+	q :=
+		`query FindPersonNoUID($name: string) {
+			findPerson(func: eq(person.name, $name)) {
+				uid
+				person.name
+				person.email
+			}
+		}
+	`
+	variables := make(map[string]string)
+	variables["$name"] = person.Name
+
+	resp, err := config.runQuery(ctx, txn, "GetPerson", q, variables)
+	if err != nil {
+		return nil, err
+	}
 	type Root struct {
-		NodeCount []struct {
-			NodeCount int `json:"nodeCount"`
-		} `json:"nodeCount"`
+		FindPerson []Person `json:"findPerson"`
 	}
 
 	var r Root
-	err = json.Unmarshal(resp.Json, &r)
+	err = json.Unmarshal(resp.JSON, &r)
 	if err != nil {
 		return nil, err
 	}
+	if len(r.FindPerson) == 0 {
+		return nil, notFound("Person", "person.name", person.Name)
+	}
 
-	return &r.NodeCount[0].NodeCount, nil
+	return &r.FindPerson[0], nil
+}
+
+// UpsertPerson upserts the person struct into the database.
+// People without a Uid are matched on person.name, so the same organiser is never stored twice.
+func (config *DB) UpsertPerson(ctx context.Context, person Person, options ...Option) (*Response, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	req, err := personRequest(person)
+	if err != nil {
+		return nil, err
+	}
+	return config.commit(ctx, "UpsertPerson", req)
+}
+
+// UpsertPersonTxn is UpsertPerson, run as part of the given transaction
+func (config *DB) UpsertPersonTxn(ctx context.Context, txn *Txn, person Person, options ...Option) (*Response, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	req, err := personRequest(person)
+	if err != nil {
+		return nil, err
+	}
+	return config.runRequest(ctx, txn, "UpsertPerson", req)
+}
+
+func personRequest(person Person) (*Request, error) {
+	// Facets only mean something on an event's edge, not on the person themselves
+	person.Role = ""
+	if len(person.DType) == 0 {
+		person.DType = []string{"Person"}
+	}
+	if person.UID == "" && person.Name != "" {
+		person.UID = upsertVar
+		return upsertRequest("person.name", "string", person.Name, person)
+	}
+	return mutationRequest(person)
 }
 
 //GetOldestScrape retrieves the oldest scrape from the database
-func (config *ConfigDB) GetOldestScrape() (*Scrape, error) {
-	txn := config.DBClient.NewReadOnlyTxn()
-	ctx := context.Background()
+func (config *DB) GetOldestScrape(ctx context.Context, options ...Option) (*Scrape, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
 
 	//First, check if there even is anything in the database
-	tot, totErr := config.CountNodesWithFieldUnsafe("scrape.id")
+	tot, totErr := config.CountScrapes(ctx)
 	if totErr != nil {
 		return nil, totErr
 	}
@@ -449,7 +702,7 @@ func (config *ConfigDB) GetOldestScrape() (*Scrape, error) {
 		}
 	}`
 
-	resp, err := txn.Query(ctx, q)
+	resp, err := config.runQuery(ctx, txn, "GetOldestScrape", q, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -458,27 +711,63 @@ func (config *ConfigDB) GetOldestScrape() (*Scrape, error) {
 	}
 
 	var r Root
-	err = json.Unmarshal(resp.Json, &r)
+	err = json.Unmarshal(resp.JSON, &r)
 	if err != nil {
 		return nil, err
 	}
 	if len(r.OldestScrape) == 0 {
-		return nil, nil
+		return nil, notFound("Scrape", "type", "Scrape")
 	}
 
 	return &r.OldestScrape[0], nil
 }
 
+//GetLatestScrape retrieves the scrape which was scraped most recently, which says when the timetable last changed
+func (config *DB) GetLatestScrape(ctx context.Context, options ...Option) (*Scrape, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+
+	q := `{
+		latestScrape(func: type(Scrape), orderdesc: scrape.last_scraped, first: 1) @filter(has(scrape.last_scraped)) {
+			uid
+			scrape.id
+			scrape.last_scraped
+		}
+	}`
+
+	resp, err := config.runQuery(ctx, txn, "GetLatestScrape", q, nil)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		LatestScrape []Scrape `json:"latestScrape"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.LatestScrape) == 0 {
+		return nil, notFound("Scrape", "type", "Scrape")
+	}
+
+	return &r.LatestScrape[0], nil
+}
+
 //ReadOnly is a read only transaction on the database - this is assumed to be ok
-func (config *ConfigDB) ReadOnly(q string) ([]byte, error) {
-	txn := config.DBClient.NewReadOnlyTxn()
-	txn.BestEffort()
-	ctx := context.Background()
+func (config *DB) ReadOnly(ctx context.Context, q string, options ...Option) ([]byte, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := &Txn{txn: config.client.newReadOnlyTxn(true)}
 
-	resp, err := txn.Query(ctx, q)
+	resp, err := config.runQuery(ctx, txn, "ReadOnly", q, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	return resp.Json, nil
+	return resp.JSON, nil
 }
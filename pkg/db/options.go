@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// Option changes how a single operation is run, e.g. db.GetEvent(ctx, event, db.WithBestEffort()).
+// Every operation accepts them, those which don't apply to it are ignored.
+type Option func(*callOptions)
+
+// callOptions holds the settings chosen by the Options given to an operation
+type callOptions struct {
+	timeout    time.Duration
+	readOnly   bool
+	bestEffort bool
+	// attempts overrides DB.MaxAttempts when it is set
+	attempts int
+}
+
+// WithTimeout gives up on the operation, including any retries, once d has passed
+func WithTimeout(d time.Duration) Option {
+	return func(o *callOptions) {
+		o.timeout = d
+	}
+}
+
+// WithReadOnly makes the operation fail with ErrReadOnly instead of writing anything,
+// for callers such as the api which should never change the data
+func WithReadOnly() Option {
+	return func(o *callOptions) {
+		o.readOnly = true
+	}
+}
+
+// WithBestEffort makes a read a best effort query, which is answered from whatever the alpha has
+// instead of waiting for the latest timestamp. The result may be a little stale, but comes back sooner,
+// which suits latency sensitive reads like what is on now.
+func WithBestEffort() Option {
+	return func(o *callOptions) {
+		o.bestEffort = true
+	}
+}
+
+// WithRetries sets how many times a write is retried if its transaction is aborted, overriding DB.MaxAttempts.
+// WithRetries(0) tries it only once.
+func WithRetries(n int) Option {
+	return func(o *callOptions) {
+		if n < 0 {
+			n = 0
+		}
+		o.attempts = n + 1
+	}
+}
+
+type optionsKey struct{}
+
+// withOptions returns the context to run an operation in, carrying its options for the helpers it calls,
+// and bounded by the timeout if one is given. Options already set by an operation calling this one are kept
+// unless they are overridden. The cancel function must be called once the operation is finished.
+func withOptions(ctx context.Context, options []Option) (context.Context, context.CancelFunc) {
+	if len(options) == 0 {
+		return ctx, func() {}
+	}
+	o := optionsFrom(ctx)
+	for _, opt := range options {
+		opt(&o)
+	}
+	ctx = context.WithValue(ctx, optionsKey{}, o)
+	if o.timeout > 0 {
+		return context.WithTimeout(ctx, o.timeout)
+	}
+	return ctx, func() {}
+}
+
+// optionsFrom returns the options the operation running in ctx was given
+func optionsFrom(ctx context.Context) callOptions {
+	o, _ := ctx.Value(optionsKey{}).(callOptions)
+	return o
+}
+
+// readTxn returns the read only transaction a getter runs its query in
+func (config *DB) readTxn(ctx context.Context) *Txn {
+	return &Txn{txn: config.client.newReadOnlyTxn(optionsFrom(ctx).bestEffort)}
+}
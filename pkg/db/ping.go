@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// PingTimeout is how long Ping waits for the database before reporting it as down
+const PingTimeout = 2 * time.Second
+
+// Status is the health of the database, as reported by Ping
+type Status struct {
+	// OK is whether the database answered within PingTimeout
+	OK bool `json:"ok"`
+	// Version is the version tag the database reported, if it answered
+	Version string `json:"version,omitempty"`
+	// Latency is how long the database took to answer, or to time out
+	Latency time.Duration `json:"latency_ns"`
+	// Error describes why the database is down
+	Error string `json:"error,omitempty"`
+	// CheckedAt is when the check was made
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Ping checks the database is answering by asking it for its version, giving up after PingTimeout.
+// It never blocks for longer than that, so it is safe to call from a readiness probe.
+func Ping(ctx context.Context, c Client) Status {
+	ctx, cancel := context.WithTimeout(ctx, PingTimeout)
+	defer cancel()
+
+	start := time.Now()
+	version, err := c.CheckVersion(ctx)
+	status := Status{
+		OK:        err == nil,
+		Version:   version,
+		Latency:   time.Since(start),
+		CheckedAt: start.UTC(),
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	return status
+}
+
+// CheckVersion returns the version tag of the dgraph cluster, trying each connection in the pool until one answers
+func (config *DB) CheckVersion(ctx context.Context, options ...Option) (string, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	if len(config.conns) == 0 {
+		return "", errors.New("The database has no connections to check")
+	}
+
+	ctx, span := config.startSpan(ctx, "CheckVersion", "query", "", nil)
+	start := time.Now()
+	version, err := config.client.checkVersion(ctx)
+	config.Metrics.observe("CheckVersion", "query", start, err)
+	endSpan(span, nil, err)
+	if err != nil {
+		return "", &QueryError{Op: "CheckVersion", Err: err}
+	}
+	return version, nil
+}
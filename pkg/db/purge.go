@@ -0,0 +1,114 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PurgeStaleEvents unlinks the events linked to the scrape which weren't found in its latest run,
+// soft deleting and returning those no other scrape found, with their modules and locations.
+// They are soft deleted like the cancelled events, so they are restored if they turn up again,
+// and are only removed for good by DeleteEventsDeletedBefore.
+// Only events starting within [from, to] are considered, which should be the window the ical feed was parsed with,
+// as anything outside of it was never going to be found.
+// The same event can appear in more than one timetable feed, so events which another scrape still points at
+// are only unlinked from this one rather than deleted.
+func (config *DB) PurgeStaleEvents(ctx context.Context, scrape Scrape, currentEventIDs []string, from, to time.Time, options ...Option) ([]Event, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	if scrape.UID == "" {
+		current, err := config.GetScrape(ctx, scrape)
+		if err != nil {
+			return nil, err
+		}
+		scrape.UID = current.UID
+	}
+
+	txn := config.readTxn(ctx)
+	q :=
+		`query StaleEvents($uid: string, $from: string, $to: string) {
+			scrape(func: uid($uid)) {
+				scrape.found_event @filter(between(event.start_date, $from, $to)) {
+					uid
+					event.id
+					event.deleted_at
+					event.part_of_module {
+						module.code
+					}
+					event.location {
+						location.id
+					}
+					scrapes: count(~scrape.found_event)
+				}
+			}
+		}
+	`
+	variables := make(map[string]string)
+	variables["$uid"] = scrape.UID
+	variables["$from"] = formatTime(from)
+	variables["$to"] = formatTime(to)
+
+	resp, err := config.runQuery(ctx, txn, "PurgeStaleEvents", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Scrape []struct {
+			FoundEvent []struct {
+				Event
+				Scrapes int `json:"scrapes"`
+			} `json:"scrape.found_event"`
+		} `json:"scrape"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]bool)
+	for _, id := range currentEventIDs {
+		current[id] = true
+	}
+
+	deleted := make([]Event, 0)
+	uids := make([]string, 0)
+	nquads := make([]string, 0)
+	for _, s := range r.Scrape {
+		for _, e := range s.FoundEvent {
+			if current[e.ID] {
+				continue
+			}
+			nquads = append(nquads, fmt.Sprintf("<%s> <scrape.found_event> <%s> .", scrape.UID, e.UID))
+			// An event which was already soft deleted keeps when it was
+			if e.Scrapes <= 1 && e.DeletedAt == nil {
+				uids = append(uids, e.UID)
+				deleted = append(deleted, e.Event)
+			}
+		}
+	}
+	if len(nquads) == 0 {
+		return deleted, nil
+	}
+
+	req := &Request{
+		Mutations: []*Mutation{{DelNquads: []byte(strings.Join(nquads, "\n"))}},
+	}
+	if len(uids) > 0 {
+		mu, err := softDeleteMutation(time.Now().UTC(), uids...)
+		if err != nil {
+			return nil, err
+		}
+		req.Mutations = append(req.Mutations, mu)
+	}
+	_, err = config.commit(ctx, "PurgeStaleEvents", req)
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
@@ -0,0 +1,446 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// This file contains the read only queries used to look up events in bulk,
+// as opposed to operations.go which fetches and stores single nodes.
+
+// formatTime formats a time the way dgraph expects datetime query variables
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// GetEventsBetween returns a page of the events starting within [start, end], ordered by their start date,
+// only those in the locations the Accessible and Campus of the options leave in
+func (config *DB) GetEventsBetween(ctx context.Context, start, end time.Time, opts ListOptions, options ...Option) ([]Event, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	pagination, err := opts.paginate("event.start_date")
+	if err != nil {
+		return nil, err
+	}
+	locatedBlock, locatedFilter, err := opts.locatedEvents()
+	if err != nil {
+		return nil, err
+	}
+	txn := config.readTxn(ctx)
+	q := fmt.Sprintf(
+		`query EventsBetween($start: string, $end: string, $first: int, $offset: int) {
+			%s
+			events(func: between(event.start_date, $start, $end), %s) @filter(type(Event) AND NOT has(event.deleted_at)%s) {
+				%s
+			}
+		}
+	`, locatedBlock, pagination, locatedFilter, eventPredicates)
+	variables := opts.variables()
+	variables["$start"] = formatTime(start)
+	variables["$end"] = formatTime(end)
+
+	resp, err := config.runQuery(ctx, txn, "GetEventsBetween", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Events []Event `json:"events"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Events, nil
+}
+
+// GetEventsBetweenAfter returns up to opts.First of the events starting within [start, end] after the cursor,
+// ordered by their start date and then their uid, the same way as ListEventsAfter
+func (config *DB) GetEventsBetweenAfter(ctx context.Context, start, end time.Time, cursor EventCursor, opts ListOptions, options ...Option) ([]Event, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	vars := map[string]string{
+		"$from": formatTime(start),
+		"$to":   formatTime(end),
+	}
+	return config.eventsAfter(ctx, "GetEventsBetweenAfter", cursor, opts, " AND ge(event.start_date, $from) AND le(event.start_date, $to)", vars)
+}
+
+// EventMatch is an event found by SearchEvents, along with how well it matched
+type EventMatch struct {
+	Event Event
+	// Score is higher for better matches, title matches count double description matches
+	Score int
+}
+
+// SearchEvents returns a page of the events whose title or description match any of the terms in the query,
+// best matches first.
+// Dgraph doesn't rank fulltext results, so they are scored here on how many query terms each one contains,
+// out of the first MaxListLimit matches by start date. Only opts.First and opts.Offset are used.
+func (config *DB) SearchEvents(ctx context.Context, query string, opts ListOptions, options ...Option) ([]EventMatch, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return []EventMatch{}, nil
+	}
+
+	txn := config.readTxn(ctx)
+	q := fmt.Sprintf(
+		`query SearchEvents($query: string, $max: int) {
+			t as var(func: anyoftext(event.title, $query))
+			d as var(func: anyoftext(event.description, $query))
+			events(func: uid(t, d), orderasc: event.start_date, first: $max) @filter(type(Event) AND NOT has(event.deleted_at)) {
+				%s
+			}
+		}
+	`, eventPredicates)
+	variables := make(map[string]string)
+	variables["$query"] = query
+	variables["$max"] = strconv.Itoa(MaxListLimit)
+
+	resp, err := config.runQuery(ctx, txn, "SearchEvents", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Events []Event `json:"events"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]EventMatch, len(r.Events))
+	for i, e := range r.Events {
+		matches[i] = EventMatch{
+			Event: e,
+			Score: scoreText(e.Title, terms)*2 + scoreText(e.Description, terms),
+		}
+	}
+	// Stable, so equally good matches stay in date order
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+
+	offset := opts.Offset
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > len(matches) {
+		offset = len(matches)
+	}
+	matches = matches[offset:]
+	if first := opts.first(); len(matches) > first {
+		matches = matches[:first]
+	}
+	return matches, nil
+}
+
+// searchTerms splits a query into the lower case words it is made up of
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// scoreText returns how many of the terms appear as words in the text
+func scoreText(text string, terms []string) int {
+	words := make(map[string]bool)
+	for _, w := range searchTerms(text) {
+		words[w] = true
+	}
+	score := 0
+	for _, t := range terms {
+		if words[t] {
+			score++
+		}
+	}
+	return score
+}
+
+// GetEventsByModule returns every event which is part of the module with the given code, ordered by start date
+func (config *DB) GetEventsByModule(ctx context.Context, moduleCode string, options ...Option) ([]Event, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+	q := fmt.Sprintf(
+		`query EventsByModule($code: string) {
+			module(func: eq(module.code, $code)) {
+				events: ~event.part_of_module (orderasc: event.start_date) @filter(type(Event) AND NOT has(event.deleted_at)) {
+					%s
+				}
+			}
+		}
+	`, eventPredicates)
+	variables := make(map[string]string)
+	variables["$code"] = moduleCode
+
+	resp, err := config.runQuery(ctx, txn, "GetEventsByModule", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Module []struct {
+			Events []Event `json:"events"`
+		} `json:"module"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]Event, 0)
+	for _, m := range r.Module {
+		events = append(events, m.Events...)
+	}
+	return events, nil
+}
+
+// GetEventsByModules returns the events which are part of any of the modules with the given codes and overlap
+// the window [from, to], ordered by start date, such as for the modules of a graphql query at once.
+// An event of several of the modules is only returned once.
+func (config *DB) GetEventsByModules(ctx context.Context, moduleCodes []string, from, to time.Time, options ...Option) ([]Event, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	if len(moduleCodes) == 0 {
+		return make([]Event, 0), nil
+	}
+	// As in ListUsersToNotify, each code is looked up in its own block
+	params := []string{"$from: string", "$to: string"}
+	blocks := make([]string, len(moduleCodes))
+	vars := make([]string, len(moduleCodes))
+	variables := make(map[string]string)
+	variables["$from"] = formatTime(from)
+	variables["$to"] = formatTime(to)
+	for i, code := range moduleCodes {
+		params = append(params, fmt.Sprintf("$c%d: string", i))
+		blocks[i] = fmt.Sprintf(`var(func: eq(module.code, $c%d)) {
+				e%d as ~event.part_of_module @filter(type(Event) AND NOT has(event.deleted_at) AND le(event.start_date, $to) AND ge(event.end_date, $from))
+			}`, i, i)
+		vars[i] = fmt.Sprintf("e%d", i)
+		variables[fmt.Sprintf("$c%d", i)] = code
+	}
+
+	txn := config.readTxn(ctx)
+	q := fmt.Sprintf(
+		`query EventsByModules(%s) {
+			%s
+			events(func: uid(%s), orderasc: event.start_date) {
+				%s
+			}
+		}
+	`, strings.Join(params, ", "), strings.Join(blocks, "\n\t\t\t"), strings.Join(vars, ", "), eventPredicates)
+
+	resp, err := config.runQuery(ctx, txn, "GetEventsByModules", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Events []Event `json:"events"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	if r.Events == nil {
+		return make([]Event, 0), nil
+	}
+	return r.Events, nil
+}
+
+// GetEventsByLocation returns the events taking place at the location with the given kent slug
+// which overlap the window [from, to], ordered by start date
+func (config *DB) GetEventsByLocation(ctx context.Context, locationID string, from, to time.Time, options ...Option) ([]Event, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+	q := fmt.Sprintf(
+		`query EventsByLocation($id: string, $from: string, $to: string) {
+			location(func: eq(location.id, $id)) {
+				events: ~event.location (orderasc: event.start_date) @filter(type(Event) AND NOT has(event.deleted_at) AND le(event.start_date, $to) AND ge(event.end_date, $from)) {
+					%s
+				}
+			}
+		}
+	`, eventPredicates)
+	variables := make(map[string]string)
+	variables["$id"] = locationID
+	variables["$from"] = formatTime(from)
+	variables["$to"] = formatTime(to)
+
+	resp, err := config.runQuery(ctx, txn, "GetEventsByLocation", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Location []struct {
+			Events []Event `json:"events"`
+		} `json:"location"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]Event, 0)
+	for _, l := range r.Location {
+		events = append(events, l.Events...)
+	}
+	return events, nil
+}
+
+// GetEventsByOrganiser returns a page of the events organised by the person which overlap the window [from, to],
+// ordered by start date, only those in the locations the Accessible and Campus of the options leave in.
+// The person is looked up by Uid if it has one, or by name otherwise.
+func (config *DB) GetEventsByOrganiser(ctx context.Context, person Person, from, to time.Time, opts ListOptions, options ...Option) ([]Event, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+
+	root, key := organiserRoot(person)
+	pagination, err := opts.paginate("event.start_date")
+	if err != nil {
+		return nil, err
+	}
+	locatedBlock, locatedFilter, err := opts.locatedEvents()
+	if err != nil {
+		return nil, err
+	}
+
+	q := fmt.Sprintf(
+		`query EventsByOrganiser($key: string, $from: string, $to: string, $first: int, $offset: int) {
+			%s
+			person(func: %s) @filter(type(Person)) {
+				events: ~event.organiser (%s) @filter(type(Event) AND NOT has(event.deleted_at) AND le(event.start_date, $to) AND ge(event.end_date, $from)%s) {
+					%s
+				}
+			}
+		}
+	`, locatedBlock, root, pagination, locatedFilter, eventPredicates)
+	variables := opts.variables()
+	variables["$key"] = key
+	variables["$from"] = formatTime(from)
+	variables["$to"] = formatTime(to)
+
+	resp, err := config.runQuery(ctx, txn, "GetEventsByOrganiser", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Person []struct {
+			Events []Event `json:"events"`
+		} `json:"person"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]Event, 0)
+	for _, p := range r.Person {
+		events = append(events, p.Events...)
+	}
+	return events, nil
+}
+
+// GetEventsByOrganiserAfter returns up to opts.First of the events GetEventsByOrganiser would list after the cursor,
+// ordered by their start date and then their uid, the same way as ListEventsAfter
+func (config *DB) GetEventsByOrganiserAfter(ctx context.Context, person Person, from, to time.Time, cursor EventCursor, opts ListOptions, options ...Option) ([]Event, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	if !uidRegex.MatchString(cursor.UID) {
+		return nil, fmt.Errorf("Invalid cursor %q", cursor.UID)
+	}
+	locatedBlock, locatedFilter, err := opts.locatedEvents()
+	if err != nil {
+		return nil, err
+	}
+	txn := config.readTxn(ctx)
+
+	root, key := organiserRoot(person)
+	filter := "type(Event) AND NOT has(event.deleted_at) AND le(event.start_date, $to) AND ge(event.end_date, $from)" + locatedFilter
+	q := fmt.Sprintf(
+		`query EventsByOrganiserAfter($key: string, $from: string, $to: string, $start: string, $first: int) {
+			%s
+			person(func: %s) @filter(type(Person)) {
+				same: ~event.organiser (first: $first, after: %s) @filter(%s AND eq(event.start_date, $start)) {
+					%s
+				}
+				later: ~event.organiser (orderasc: event.start_date, first: $first) @filter(%s AND gt(event.start_date, $start)) {
+					%s
+				}
+			}
+		}
+	`, locatedBlock, root, cursor.UID, filter, eventPredicates, filter, eventPredicates)
+	first := opts.first()
+	variables := map[string]string{
+		"$key":   key,
+		"$from":  formatTime(from),
+		"$to":    formatTime(to),
+		"$start": cursor.Start.UTC().Format(time.RFC3339Nano),
+		"$first": strconv.Itoa(first),
+	}
+
+	resp, err := config.runQuery(ctx, txn, "GetEventsByOrganiserAfter", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Person []struct {
+			Same  []Event `json:"same"`
+			Later []Event `json:"later"`
+		} `json:"person"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]Event, 0)
+	for _, p := range r.Person {
+		events = append(events, p.Same...)
+		events = append(events, p.Later...)
+	}
+	if len(events) > first {
+		events = events[:first]
+	}
+	return events, nil
+}
+
+// organiserRoot returns the root function finding the person, by uid if they have one and by name otherwise,
+// along with the $key it is looked up by
+func organiserRoot(person Person) (string, string) {
+	if person.UID != "" {
+		return "uid($key)", person.UID
+	}
+	return "eq(person.name, $key)", person.Name
+}
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+const (
+	// DefaultMaxAttempts is how many times a mutation is tried before giving up on an aborted transaction
+	DefaultMaxAttempts = 5
+	// DefaultRetryBackoff is the delay before the first retry, it doubles on every attempt after that
+	DefaultRetryBackoff = 50 * time.Millisecond
+)
+
+// retry runs op until it succeeds, fails with something other than an aborted transaction,
+// or runs out of attempts.
+// Aborts happen when concurrent scrapers write the same nodes, so waiting a random,
+// exponentially growing amount of time usually lets the other transaction finish first.
+// op must start a new transaction every time it is called, as an aborted one can't be reused.
+// Waiting stops early if ctx is done, returning the last error.
+// The number of attempts can be changed for a single operation with WithRetries.
+func (config *DB) retry(ctx context.Context, op func() error) error {
+	attempts := config.MaxAttempts
+	if o := optionsFrom(ctx); o.attempts > 0 {
+		attempts = o.attempts
+	}
+	if attempts <= 0 {
+		attempts = DefaultMaxAttempts
+	}
+	backoff := config.RetryBackoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = op()
+		if !errors.Is(err, ErrAborted) {
+			return err
+		}
+		if attempt == attempts {
+			break
+		}
+
+		config.Metrics.retried()
+
+		// Half of the delay is fixed and the other half is jitter, so the retries spread out
+		delay := backoff << uint(attempt-1)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))):
+		}
+	}
+	return err
+}
@@ -0,0 +1,121 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// revisionOf returns a revision holding the existing values of the event, if the update changes any of them
+func revisionOf(existing, update Event) *Revision {
+	if !eventChanged(existing, update) {
+		return nil
+	}
+	rev := snapshot(existing)
+	return &rev
+}
+
+// eventChanged returns whether the update changes the title, description, dates or location of the event.
+// Fields which aren't set in the update are left as they are by the upsert, so they don't count as changes.
+func eventChanged(existing, update Event) bool {
+	return (update.Title != "" && update.Title != existing.Title) ||
+		(update.Description != "" && update.Description != existing.Description) ||
+		(update.StartDate != nil && !sameTime(update.StartDate, existing.StartDate)) ||
+		(update.EndDate != nil && !sameTime(update.EndDate, existing.EndDate)) ||
+		(len(update.Location) > 0 && !sameLocations(update.Location, existing.Location))
+}
+
+// snapshot returns a new revision node holding the current values of the event
+func snapshot(existing Event) Revision {
+	now := time.Now().UTC()
+	locations := make([]Location, len(existing.Location))
+	for i, loc := range existing.Location {
+		locations[i] = Location{UID: loc.UID}
+	}
+	return Revision{
+		UID:         "_:revision",
+		ChangedAt:   &now,
+		Title:       existing.Title,
+		Description: existing.Description,
+		StartDate:   existing.StartDate,
+		EndDate:     existing.EndDate,
+		Location:    locations,
+		DType:       []string{"Revision"},
+	}
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// sameLocations returns whether every location in the update is already one of the event's locations
+func sameLocations(update, existing []Location) bool {
+	for _, loc := range update {
+		found := false
+		for _, loc2 := range existing {
+			found = found || loc.Equal(loc2)
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// GetEventHistory returns the previous versions of the event with the event.id, the most recent change first.
+// It returns an error wrapping ErrNotFound if there is no such event, soft deleted or not.
+func (config *DB) GetEventHistory(ctx context.Context, eventID string, options ...Option) ([]Revision, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+	q :=
+		`query EventHistory($id: string) {
+			event(func: eq(event.id, $id)) {
+				event.revision (orderdesc: revision.changed_at) {
+					uid
+					revision.changed_at
+					revision.title
+					revision.description
+					revision.start_date
+					revision.end_date
+					revision.location {
+						uid
+						location.id
+						location.name
+						location.disabled_access
+						location.campus
+					}
+				}
+			}
+		}
+	`
+	variables := make(map[string]string)
+	variables["$id"] = eventID
+
+	resp, err := config.runQuery(ctx, txn, "GetEventHistory", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Event []Event `json:"event"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Event) == 0 {
+		return nil, notFound("Event", "event.id", eventID)
+	}
+
+	revisions := r.Event[0].Revisions
+	if revisions == nil {
+		revisions = make([]Revision, 0)
+	}
+	return revisions, nil
+}
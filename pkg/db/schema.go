@@ -0,0 +1,157 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// SchemaDiff describes what ApplySchema changed in the database
+type SchemaDiff struct {
+	// Added holds the predicates and types which did not exist before
+	Added []string
+	// Changed holds the predicates and types whose definition (type, index, reverse...) changed
+	Changed []string
+}
+
+// Empty returns whether the schema was already up to date
+func (d *SchemaDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Changed) == 0
+}
+
+// ApplySchema alters the database with the predicates, indexes and types in Schema,
+// and returns what was different compared to the schema already installed
+func (config *DB) ApplySchema(ctx context.Context, options ...Option) (*SchemaDiff, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	before, err := config.currentSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkWritable(ctx, "ApplySchema")
+	if err != nil {
+		return nil, err
+	}
+	err = config.client.alter(ctx, Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := config.currentSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &SchemaDiff{
+		Added:   make([]string, 0),
+		Changed: make([]string, 0),
+	}
+	for name, definition := range after {
+		old, ok := before[name]
+		if !ok {
+			diff.Added = append(diff.Added, name)
+		} else if old != definition {
+			diff.Changed = append(diff.Changed, name)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Changed)
+
+	return diff, nil
+}
+
+// currentSchema returns the installed schema as a map of predicate or type name to its definition.
+// Types are prefixed with "type " so they can't clash with predicates, and dgraph internals are skipped.
+func (config *DB) currentSchema(ctx context.Context) (map[string]string, error) {
+	txn := config.readTxn(ctx)
+
+	resp, err := config.runQuery(ctx, txn, "ApplySchema", `schema {}`, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	type Root struct {
+		Schema []map[string]interface{} `json:"schema"`
+		Types  []map[string]interface{} `json:"types"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]string)
+	for _, pred := range r.Schema {
+		name, _ := pred["predicate"].(string)
+		if strings.HasPrefix(name, "dgraph.") {
+			continue
+		}
+		definition, err := json.Marshal(pred)
+		if err != nil {
+			return nil, err
+		}
+		current[name] = string(definition)
+	}
+	for _, t := range r.Types {
+		name, _ := t["name"].(string)
+		if strings.HasPrefix(name, "dgraph.") {
+			continue
+		}
+		definition, err := json.Marshal(t)
+		if err != nil {
+			return nil, err
+		}
+		current["type "+name] = string(definition)
+	}
+
+	return current, nil
+}
+
+// CheckSchema returns the predicates and types of Schema which are missing from the database, sorted.
+// It is empty once the schema has been applied, and only reads, so it is safe to call from a readiness probe.
+func (config *DB) CheckSchema(ctx context.Context, options ...Option) ([]string, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	current, err := config.currentSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	missing := make([]string, 0)
+	for _, name := range schemaNames(Schema) {
+		if _, ok := current[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	return missing, nil
+}
+
+// schemaNames returns the names of the predicates and types defined in the schema,
+// with types prefixed with "type " as in currentSchema
+func schemaNames(schema string) []string {
+	names := make([]string, 0)
+	inType := false
+	for _, line := range strings.Split(schema, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case inType:
+			// The fields of a type are predicates defined above it
+			inType = line != "}"
+		case strings.HasPrefix(line, "type ") && strings.HasSuffix(line, "{"):
+			names = append(names, "type "+strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "type "), "{")))
+			inType = true
+		default:
+			if i := strings.Index(line, ":"); i > 0 {
+				names = append(names, strings.TrimSpace(line[:i]))
+			}
+		}
+	}
+	return names
+}
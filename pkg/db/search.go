@@ -0,0 +1,148 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ModuleMatch is a module found by SearchModules, along with how well it matched
+type ModuleMatch struct {
+	Module Module
+	// Score is scored like EventMatch.Score, the module code and name count as much as an event title
+	Score int
+}
+
+// LocationMatch is a location found by SearchLocations, along with how well it matched
+type LocationMatch struct {
+	Location Location
+	// Score is scored like EventMatch.Score, the location name counts as much as an event title
+	Score int
+}
+
+// SearchModules returns the modules whose code is one of the words in the query, or whose name matches any of them,
+// best matches first, then in module code order
+func (config *DB) SearchModules(ctx context.Context, query string, options ...Option) ([]ModuleMatch, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return []ModuleMatch{}, nil
+	}
+
+	// Module codes are only exactly indexed, so each word is looked up as an upper case code in its own block
+	params := "$query: string"
+	blocks := make([]string, len(terms))
+	vars := []string{"n"}
+	variables := make(map[string]string)
+	variables["$query"] = query
+	for i, term := range terms {
+		params += fmt.Sprintf(", $c%d: string", i)
+		blocks[i] = fmt.Sprintf("c%d as var(func: eq(module.code, $c%d))", i, i)
+		vars = append(vars, fmt.Sprintf("c%d", i))
+		variables[fmt.Sprintf("$c%d", i)] = strings.ToUpper(term)
+	}
+
+	txn := config.readTxn(ctx)
+	q := fmt.Sprintf(
+		`query SearchModules(%s) {
+			n as var(func: anyoftext(module.name, $query))
+			%s
+			modules(func: uid(%s), orderasc: module.code) @filter(type(Module)) {
+				uid
+				module.code
+				module.name
+				module.subject
+			}
+		}
+	`, params, strings.Join(blocks, "\n\t\t\t"), strings.Join(vars, ", "))
+
+	resp, err := config.runQuery(ctx, txn, "SearchModules", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Modules []Module `json:"modules"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]ModuleMatch, len(r.Modules))
+	for i, m := range r.Modules {
+		matches[i] = ModuleMatch{Module: m, Score: scoreModule(m, terms)}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+
+	return matches, nil
+}
+
+// scoreModule scores the module for SearchModules
+func scoreModule(m Module, terms []string) int {
+	score := scoreText(m.Name, terms) * 2
+	for _, t := range terms {
+		if strings.EqualFold(t, m.Code) {
+			score += 2
+		}
+	}
+	return score
+}
+
+// SearchLocations returns the locations whose name matches any of the words in the query,
+// best matches first, then in location.id order
+func (config *DB) SearchLocations(ctx context.Context, query string, options ...Option) ([]LocationMatch, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return []LocationMatch{}, nil
+	}
+
+	txn := config.readTxn(ctx)
+	q := `query SearchLocations($query: string) {
+			locations(func: anyofterms(location.name, $query), orderasc: location.id) @filter(type(Location)) {
+				uid
+				location.id
+				location.name
+				location.disabled_access
+				location.campus
+				location.capacity
+			}
+		}
+	`
+	variables := make(map[string]string)
+	variables["$query"] = query
+
+	resp, err := config.runQuery(ctx, txn, "SearchLocations", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Locations []Location `json:"locations"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]LocationMatch, len(r.Locations))
+	for i, l := range r.Locations {
+		matches[i] = LocationMatch{Location: l, Score: scoreText(l.Name, terms) * 2}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+
+	return matches, nil
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// UpsertSeries stores the series, matching series without a Uid on series.id
+func (config *DB) UpsertSeries(ctx context.Context, series Series, options ...Option) (*Response, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	req, err := seriesRequest(series)
+	if err != nil {
+		return nil, err
+	}
+	return config.commit(ctx, "UpsertSeries", req)
+}
+
+func seriesRequest(series Series) (*Request, error) {
+	if len(series.DType) == 0 {
+		series.DType = []string{"Series"}
+	}
+	if series.UID == "" && series.ID != "" {
+		series.UID = upsertVar
+		return upsertRequest("series.id", "string", series.ID, series)
+	}
+	return mutationRequest(series)
+}
+
+// seriesRoot returns the query root matching the series on its Uid or series.id, bound to $key
+func seriesRoot(op string, series Series) (string, string, error) {
+	switch {
+	case series.UID != "":
+		return "uid($key)", series.UID, nil
+	case series.ID != "":
+		return "eq(series.id, $key)", series.ID, nil
+	}
+	return "", "", fmt.Errorf("%s needs a series with a Uid or an ID", op)
+}
+
+func seriesNotFound(series Series) error {
+	if series.UID != "" {
+		return notFound("Series", "uid", series.UID)
+	}
+	return notFound("Series", "series.id", series.ID)
+}
+
+// GetSeries returns the series with the Uid, or the series.id if it has no Uid,
+// or an error wrapping ErrNotFound if there is no such series
+func (config *DB) GetSeries(ctx context.Context, series Series, options ...Option) (*Series, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	root, key, err := seriesRoot("GetSeries", series)
+	if err != nil {
+		return nil, err
+	}
+
+	txn := config.readTxn(ctx)
+
+	q := fmt.Sprintf(
+		`query FindSeries($key: string) {
+			findSeries(func: %s) @filter(type(Series)) {
+				uid
+				series.id
+				series.title
+			}
+		}`, root)
+
+	resp, err := config.runQuery(ctx, txn, "GetSeries", q, map[string]string{"$key": key})
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		FindSeries []Series `json:"findSeries"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.FindSeries) == 0 {
+		return nil, seriesNotFound(series)
+	}
+	return &r.FindSeries[0], nil
+}
+
+// GetSeriesOccurrences returns the events of the series in start date order, leaving out soft deleted ones.
+// An error wrapping ErrNotFound is returned if there is no such series.
+func (config *DB) GetSeriesOccurrences(ctx context.Context, series Series, options ...Option) ([]Event, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	root, key, err := seriesRoot("GetSeriesOccurrences", series)
+	if err != nil {
+		return nil, err
+	}
+
+	txn := config.readTxn(ctx)
+
+	q := fmt.Sprintf(
+		`query SeriesOccurrences($key: string) {
+			series(func: %s) @filter(type(Series)) {
+				occurrences: ~event.series (orderasc: event.start_date) @filter(type(Event) AND NOT has(event.deleted_at)) {
+					%s
+				}
+			}
+		}`, root, eventPredicates)
+
+	resp, err := config.runQuery(ctx, txn, "GetSeriesOccurrences", q, map[string]string{"$key": key})
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Series []struct {
+			Occurrences []Event `json:"occurrences"`
+		} `json:"series"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Series) == 0 {
+		return nil, seriesNotFound(series)
+	}
+	if r.Series[0].Occurrences == nil {
+		return []Event{}, nil
+	}
+	return r.Series[0].Occurrences, nil
+}
@@ -0,0 +1,194 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SoftDeleteEvent marks the event as deleted instead of removing it, for lectures which have been cancelled.
+// Soft deleted events are hidden from the getters and queries, but are kept for ListDeletedEvents,
+// and are restored if they are upserted again.
+// The event is looked up by Uid if it has one, or by event.id otherwise.
+func (config *DB) SoftDeleteEvent(ctx context.Context, event Event, options ...Option) error {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	mu, err := softDeleteMutation(time.Now().UTC(), upsertVar)
+	if err != nil {
+		return err
+	}
+	return config.markEvent(ctx, "SoftDeleteEvent", event, mu)
+}
+
+// softDeleteMutation returns the mutation marking the events with the uids as deleted at the time,
+// shared by SoftDeleteEvent and PurgeStaleEvents
+func softDeleteMutation(at time.Time, uids ...string) (*Mutation, error) {
+	marks := make([]map[string]interface{}, len(uids))
+	for i, uid := range uids {
+		marks[i] = map[string]interface{}{
+			"uid":              uid,
+			"event.deleted_at": at,
+		}
+	}
+	pb, err := json.Marshal(marks)
+	if err != nil {
+		return nil, err
+	}
+	return &Mutation{SetJSON: pb}, nil
+}
+
+// RestoreEvent undoes SoftDeleteEvent
+func (config *DB) RestoreEvent(ctx context.Context, event Event, options ...Option) error {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+	return config.markEvent(ctx, "RestoreEvent", event, &Mutation{
+		DelNquads: []byte(upsertVar + " <event.deleted_at> * ."),
+	})
+}
+
+// markEvent runs the mutation against the event whether or not it is soft deleted,
+// returning an error wrapping ErrNotFound if there is no such event
+func (config *DB) markEvent(ctx context.Context, op string, event Event, mu *Mutation) error {
+	req := &Request{}
+	switch {
+	case event.UID != "":
+		req.Query = `query Mark($key: string) {
+			v as var(func: uid($key)) @filter(type(Event))
+			found(func: uid(v)) { uid }
+		}`
+		req.Vars = map[string]string{"$key": event.UID}
+	case event.ID != "":
+		req.Query = `query Mark($key: string) {
+			v as var(func: eq(event.id, $key))
+			found(func: uid(v)) { uid }
+		}`
+		req.Vars = map[string]string{"$key": event.ID}
+	default:
+		return fmt.Errorf("%s needs an event with a Uid or an ID", op)
+	}
+	// Without the condition a missing event would be created as an empty node
+	mu.Cond = "@if(gt(len(v), 0))"
+	req.Mutations = []*Mutation{mu}
+
+	resp, err := config.commit(ctx, op, req)
+	if err != nil {
+		return err
+	}
+	type Root struct {
+		Found []struct {
+			UID string `json:"uid"`
+		} `json:"found"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return err
+	}
+	if len(r.Found) == 0 {
+		if event.UID != "" {
+			return notFound("Event", "uid", event.UID)
+		}
+		return notFound("Event", "event.id", event.ID)
+	}
+	return nil
+}
+
+// DeleteEventsDeletedBefore removes up to limit of the events soft deleted before the time for good, oldest first,
+// along with the scrape.found_event edges pointing at them, returning how many were removed
+func (config *DB) DeleteEventsDeletedBefore(ctx context.Context, before time.Time, limit int, options ...Option) (int, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+	q :=
+		`query OldDeletedEvents($before: string, $first: int) {
+			events(func: lt(event.deleted_at, $before), orderasc: event.deleted_at, first: $first) @filter(type(Event)) {
+				uid
+				~scrape.found_event {
+					uid
+				}
+			}
+		}
+	`
+	variables := make(map[string]string)
+	variables["$before"] = formatTime(before)
+	variables["$first"] = strconv.Itoa(ListOptions{First: limit}.first())
+	resp, err := config.runQuery(ctx, txn, "DeleteEventsDeletedBefore", q, variables)
+	if err != nil {
+		return 0, err
+	}
+	type Root struct {
+		Events []struct {
+			UID    string `json:"uid"`
+			Scrape []struct {
+				UID string `json:"uid"`
+			} `json:"~scrape.found_event"`
+		} `json:"events"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return 0, err
+	}
+	if len(r.Events) == 0 {
+		return 0, nil
+	}
+	nquads := make([]string, 0, len(r.Events))
+	for _, e := range r.Events {
+		nquads = append(nquads, fmt.Sprintf("<%s> * * .", e.UID))
+		for _, s := range e.Scrape {
+			nquads = append(nquads, fmt.Sprintf("<%s> <scrape.found_event> <%s> .", s.UID, e.UID))
+		}
+	}
+	req := &Request{
+		Mutations: []*Mutation{{DelNquads: []byte(strings.Join(nquads, "\n"))}},
+	}
+	_, err = config.commit(ctx, "DeleteEventsDeletedBefore", req)
+	if err != nil {
+		return 0, err
+	}
+	return len(r.Events), nil
+}
+
+// ListDeletedEvents returns a page of the soft deleted events, ordered by when they were deleted
+func (config *DB) ListDeletedEvents(ctx context.Context, opts ListOptions, options ...Option) ([]Event, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+
+	pagination, err := opts.paginate("event.deleted_at")
+	if err != nil {
+		return nil, err
+	}
+	q := fmt.Sprintf(
+		`query ListDeletedEvents($first: int, $offset: int) {
+			listEvents(func: has(event.deleted_at), %s) @filter(type(Event)) {
+				%s
+				event.deleted_at
+			}
+		}
+	`, pagination, eventPredicates)
+
+	resp, err := config.runQuery(ctx, txn, "ListDeletedEvents", q, opts.variables())
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		ListEvents []Event `json:"listEvents"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.ListEvents, nil
+}
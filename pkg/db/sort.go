@@ -0,0 +1,149 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SortKey orders the results of a list query by one of their predicates, see ListOptions.Sort
+type SortKey struct {
+	Predicate  string
+	Descending bool
+}
+
+// sortOrder returns the ordering arguments of a root query function for the keys, followed by orderBy to break the ties.
+// The predicates are put into the query as they are, so they have to be in the schema.
+func sortOrder(keys []SortKey, orderBy string) (string, error) {
+	args := make([]string, 0, len(keys)+1)
+	tieBroken := false
+	for _, key := range keys {
+		if !IsKnownPredicate(key.Predicate) {
+			return "", fmt.Errorf("Unknown predicate %q to sort by", key.Predicate)
+		}
+		order := "orderasc"
+		if key.Descending {
+			order = "orderdesc"
+		}
+		args = append(args, order+": "+key.Predicate)
+		tieBroken = tieBroken || key.Predicate == orderBy
+	}
+	if !tieBroken {
+		args = append(args, "orderasc: "+orderBy)
+	}
+	return strings.Join(args, ", "), nil
+}
+
+// SortNodes stably sorts a slice of nodes, such as a []Event or []*Module, by the keys the way dgraph does,
+// for the lists which are sorted in memory. The predicates are the json names of the nodes' fields,
+// and the nodes without one are put after those with it.
+func SortNodes(nodes interface{}, keys []SortKey) {
+	if len(keys) == 0 {
+		return
+	}
+	slice := reflect.ValueOf(nodes)
+	sort.SliceStable(nodes, func(i, j int) bool {
+		a, b := slice.Index(i), slice.Index(j)
+		for _, key := range keys {
+			av, bv := present(predicateValue(a, key.Predicate)), present(predicateValue(b, key.Predicate))
+			// The nodes missing the predicate are last whichever way the key goes
+			if !av.IsValid() || !bv.IsValid() {
+				if av.IsValid() != bv.IsValid() {
+					return av.IsValid()
+				}
+				continue
+			}
+			c := compareValues(av, bv)
+			if c == 0 {
+				continue
+			}
+			if key.Descending {
+				c = -c
+			}
+			return c < 0
+		}
+		return false
+	})
+}
+
+// predicateValue returns the field of the node with the predicate as its json name, or an invalid value if it hasn't one
+func predicateValue(node reflect.Value, predicate string) reflect.Value {
+	for node.Kind() == reflect.Ptr || node.Kind() == reflect.Interface {
+		if node.IsNil() {
+			return reflect.Value{}
+		}
+		node = node.Elem()
+	}
+	if node.Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+	t := node.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if strings.Split(t.Field(i).Tag.Get("json"), ",")[0] == predicate {
+			return node.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+// compareValues returns -1, 0 or 1 as a is before, the same as or after b, which are both present
+func compareValues(a, b reflect.Value) int {
+	if at, ok := a.Interface().(time.Time); ok {
+		bt, _ := b.Interface().(time.Time)
+		switch {
+		case at.Before(bt):
+			return -1
+		case at.After(bt):
+			return 1
+		}
+		return 0
+	}
+	switch a.Kind() {
+	case reflect.String:
+		return strings.Compare(a.String(), b.String())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return compareFloats(float64(a.Int()), float64(b.Int()))
+	case reflect.Float32, reflect.Float64:
+		return compareFloats(a.Float(), b.Float())
+	case reflect.Bool:
+		return compareFloats(boolValue(a.Bool()), boolValue(b.Bool()))
+	}
+	return 0
+}
+
+// present dereferences the value, returning an invalid value if it is missing.
+// Nil pointers and the zero time are missing, as dgraph wouldn't have them.
+func present(v reflect.Value) reflect.Value {
+	for v.IsValid() && v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return v
+	}
+	if t, ok := v.Interface().(time.Time); ok && t.IsZero() {
+		return reflect.Value{}
+	}
+	return v
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,288 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ModuleEventCount is how many events a module has
+type ModuleEventCount struct {
+	Module Module
+	Count  int
+}
+
+// LocationEventCount is how many events take place in a location
+type LocationEventCount struct {
+	Location Location
+	Count    int
+}
+
+// DayEventCount is how many events start on a day
+type DayEventCount struct {
+	// Day is midnight UTC at the start of the day
+	Day   time.Time
+	Count int
+}
+
+// GetEventCountsByModule returns the modules with the most events, up to limit of them, heaviest first.
+// A limit of 0 uses DefaultListLimit, and it is capped at MaxListLimit. Soft deleted events aren't counted.
+func (config *DB) GetEventCountsByModule(ctx context.Context, limit int, options ...Option) ([]ModuleEventCount, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+	q :=
+		`query EventCountsByModule($first: int) {
+			var(func: type(Module)) {
+				c as count(~event.part_of_module @filter(type(Event) AND NOT has(event.deleted_at)))
+			}
+			counts(func: uid(c), orderdesc: val(c), first: $first) @filter(gt(val(c), 0)) {
+				uid
+				module.code
+				module.name
+				count: val(c)
+			}
+		}
+	`
+	variables := make(map[string]string)
+	variables["$first"] = strconv.Itoa(ListOptions{First: limit}.first())
+
+	resp, err := config.runQuery(ctx, txn, "GetEventCountsByModule", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Counts []struct {
+			Module
+			Count int `json:"count"`
+		} `json:"counts"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make([]ModuleEventCount, len(r.Counts))
+	for i, c := range r.Counts {
+		counts[i] = ModuleEventCount{Module: c.Module, Count: c.Count}
+	}
+	return counts, nil
+}
+
+// GetEventCountsByLocation returns the locations with the most events, up to limit of them, busiest first.
+// A limit of 0 uses DefaultListLimit, and it is capped at MaxListLimit. Soft deleted events aren't counted.
+func (config *DB) GetEventCountsByLocation(ctx context.Context, limit int, options ...Option) ([]LocationEventCount, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+	q :=
+		`query EventCountsByLocation($first: int) {
+			var(func: type(Location)) {
+				c as count(~event.location @filter(type(Event) AND NOT has(event.deleted_at)))
+			}
+			counts(func: uid(c), orderdesc: val(c), first: $first) @filter(gt(val(c), 0)) {
+				uid
+				location.id
+				location.name
+				location.disabled_access
+				location.campus
+				location.capacity
+				count: val(c)
+			}
+		}
+	`
+	variables := make(map[string]string)
+	variables["$first"] = strconv.Itoa(ListOptions{First: limit}.first())
+
+	resp, err := config.runQuery(ctx, txn, "GetEventCountsByLocation", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Counts []struct {
+			Location
+			Count int `json:"count"`
+		} `json:"counts"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make([]LocationEventCount, len(r.Counts))
+	for i, c := range r.Counts {
+		counts[i] = LocationEventCount{Location: c.Location, Count: c.Count}
+	}
+	return counts, nil
+}
+
+// GetEventsPerDay returns how many events start on each day within [from, to], in date order.
+// Days without any events are left out. Soft deleted events aren't counted.
+func (config *DB) GetEventsPerDay(ctx context.Context, from, to time.Time, options ...Option) ([]DayEventCount, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+	// Dgraph can't group by day, but lectures start on the hour so grouping by start time keeps the response small
+	q :=
+		`query EventsPerDay($from: string, $to: string) {
+			starts(func: between(event.start_date, $from, $to)) @filter(type(Event) AND NOT has(event.deleted_at)) @groupby(event.start_date) {
+				count(uid)
+			}
+		}
+	`
+	variables := make(map[string]string)
+	variables["$from"] = formatTime(from)
+	variables["$to"] = formatTime(to)
+
+	resp, err := config.runQuery(ctx, txn, "GetEventsPerDay", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Starts []struct {
+			GroupBy []struct {
+				StartDate time.Time `json:"event.start_date"`
+				Count     int       `json:"count"`
+			} `json:"@groupby"`
+		} `json:"starts"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	perDay := make(map[time.Time]int)
+	for _, s := range r.Starts {
+		for _, g := range s.GroupBy {
+			start := g.StartDate.UTC()
+			day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+			perDay[day] += g.Count
+		}
+	}
+
+	counts := make([]DayEventCount, 0, len(perDay))
+	for day, n := range perDay {
+		counts = append(counts, DayEventCount{Day: day, Count: n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		return counts[i].Day.Before(counts[j].Day)
+	})
+	return counts, nil
+}
+
+// HourOccupancy is how many of a building's rooms are booked during an hour
+type HourOccupancy struct {
+	// Start is the start of the hour
+	Start time.Time `json:"start"`
+	// Booked is how many of the rooms have an event during any of the hour
+	Booked int `json:"booked"`
+}
+
+// Occupancy is how many of the rooms of a building are booked, hour by hour
+type Occupancy struct {
+	Building Location `json:"building"`
+	// Rooms is how many rooms the building has
+	Rooms int             `json:"rooms"`
+	Hours []HourOccupancy `json:"hours"`
+}
+
+// GetBuildingOccupancy returns how many of the rooms of the building with the location.id are booked during each hour
+// from from until to, which should be on the hour. An event booked in several of the rooms counts for each of them,
+// while the events booked in the building itself rather than one of its rooms aren't counted. Soft deleted events aren't either.
+func (config *DB) GetBuildingOccupancy(ctx context.Context, building string, from, to time.Time, options ...Option) (*Occupancy, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+	// The events' locations are narrowed to the rooms, so counting them counts the rooms booked
+	q :=
+		`query BuildingOccupancy($building: string, $from: string, $to: string) {
+			building(func: eq(location.id, $building)) @filter(type(Location)) {
+				uid
+				location.id
+				location.name
+				location.disabled_access
+				location.campus
+				rooms as ~location.part_of
+			}
+			var(func: uid(rooms)) {
+				located as ~event.location
+			}
+			rooms(func: uid(rooms)) {
+				count(uid)
+			}
+			events(func: ge(event.end_date, $from)) @filter(uid(located) AND type(Event) AND NOT has(event.deleted_at) AND lt(event.start_date, $to)) {
+				event.start_date
+				event.end_date
+				event.location @filter(uid(rooms)) {
+					uid
+				}
+			}
+		}
+	`
+	variables := make(map[string]string)
+	variables["$building"] = building
+	variables["$from"] = formatTime(from)
+	variables["$to"] = formatTime(to)
+
+	resp, err := config.runQuery(ctx, txn, "GetBuildingOccupancy", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Building []Location `json:"building"`
+		Rooms    []struct {
+			Count int `json:"count"`
+		} `json:"rooms"`
+		Events []Event `json:"events"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Building) == 0 {
+		return nil, notFound("Location", "location.id", building)
+	}
+
+	occupancy := &Occupancy{Building: r.Building[0], Hours: HourlyOccupancy(from, to, r.Events)}
+	if len(r.Rooms) > 0 {
+		occupancy.Rooms = r.Rooms[0].Count
+	}
+	return occupancy, nil
+}
+
+// HourlyOccupancy counts the locations of the events during each hour from from until to, the last of which is cut short at to.
+// The events' locations should already be narrowed to the rooms being counted.
+func HourlyOccupancy(from, to time.Time, events []Event) []HourOccupancy {
+	hours := make([]HourOccupancy, 0)
+	for start := from; start.Before(to); start = start.Add(time.Hour) {
+		end := start.Add(time.Hour)
+		if end.After(to) {
+			end = to
+		}
+		booked := make(map[string]bool)
+		for _, e := range events {
+			if e.StartDate == nil || e.EndDate == nil || !e.StartDate.Before(end) || !e.EndDate.After(start) {
+				continue
+			}
+			for _, l := range e.Location {
+				booked[l.UID] = true
+			}
+		}
+		hours = append(hours, HourOccupancy{Start: start, Booked: len(booked)})
+	}
+	return hours
+}
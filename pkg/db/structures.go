@@ -18,6 +18,10 @@ type Module struct {
 	Subject string `json:"module.subject,omitempty"`
 	// URL     string   `json:"module.url,omitempty"`
 	DType []string `json:"dgraph.type,omitempty"`
+
+	// Weight and Required are facets on the event.part_of_module edge, so are only set on an event's modules
+	Weight   float64 `json:"event.part_of_module|weight,omitempty"`
+	Required bool    `json:"event.part_of_module|required,omitempty"`
 }
 
 type Scrape struct {
@@ -33,8 +37,17 @@ type Person struct {
 	Name  string   `json:"person.name,omitempty"`
 	Email string   `json:"person.email,omitempty"`
 	DType []string `json:"dgraph.type,omitempty"`
+
+	// Role is a facet on the event.organiser edge, describing how the person takes part in that event
+	Role string `json:"event.organiser|role,omitempty"`
 }
 
+// Roles an organiser can have in an event
+const (
+	RoleLecturer      = "lecturer"
+	RoleSeminarLeader = "seminar leader"
+)
+
 type Location struct {
 	UID            string   `json:"uid,omitempty"`
 	ID             string   `json:"location.id,omitempty"`
@@ -42,6 +55,16 @@ type Location struct {
 	Location       Loc      `json:"location.loc,omitempty"`
 	DisabledAccess bool     `json:"location.disabled_access"`
 	DType          []string `json:"dgraph.type,omitempty"`
+
+	// PartOf is the location this one is inside of, such as the building a room is in
+	PartOf *Location `json:"location.part_of,omitempty"`
+	// Capacity is how many people the room seats, it is 0 if kent doesn't say
+	Capacity int `json:"location.capacity,omitempty"`
+	// Campus is which of Campuses the location is on, it is empty if kent doesn't say
+	Campus string `json:"location.campus,omitempty"`
+	// ImportedAt is when the location was imported from the kent api,
+	// it is nil for the rooms the scraper stored on the fly because kent doesn't list them
+	ImportedAt *time.Time `json:"location.imported_at,omitempty"`
 }
 
 type Event struct {
@@ -54,6 +77,182 @@ type Event struct {
 	Organiser    []Person   `json:"event.organiser,omitempty"`
 	PartOfModule []Module   `json:"event.part_of_module,omitempty"`
 	Location     []Location `json:"event.location,omitempty"`
+	// DeletedAt is when the event was soft deleted, deleted events are hidden from the getters
+	DeletedAt *time.Time `json:"event.deleted_at,omitempty"`
+	// Revisions hold the previous values of the event, they are only loaded by GetEventHistory
+	Revisions []Revision `json:"event.revision,omitempty"`
+	// Attendees are the people attending the event, they are only loaded by GetEventAttendees
+	Attendees []Person `json:"event.attendee,omitempty"`
+	// Series is the weekly series the event is an occurrence of, if it repeats
+	Series *Series `json:"event.series,omitempty"`
+
+	DType []string `json:"dgraph.type,omitempty"`
+}
+
+// Series is a set of events repeating every week, such as the lectures of a module.
+// Its occurrences point at it with their event.series edge.
+type Series struct {
+	UID   string   `json:"uid,omitempty"`
+	ID    string   `json:"series.id,omitempty"`
+	Title string   `json:"series.title,omitempty"`
+	DType []string `json:"dgraph.type,omitempty"`
+}
+
+// Revision is a snapshot of an event from before it was changed
+type Revision struct {
+	UID         string     `json:"uid,omitempty"`
+	ChangedAt   *time.Time `json:"revision.changed_at,omitempty"`
+	Title       string     `json:"revision.title,omitempty"`
+	Description string     `json:"revision.description,omitempty"`
+	StartDate   *time.Time `json:"revision.start_date,omitempty"`
+	EndDate     *time.Time `json:"revision.end_date,omitempty"`
+	Location    []Location `json:"revision.location,omitempty"`
+
+	DType []string `json:"dgraph.type,omitempty"`
+}
+
+// ScrapeJob is a scrape asked for on demand, of a range of timetable feeds or those of a module,
+// which the scraper picks up ahead of its scheduled rescrapes
+type ScrapeJob struct {
+	UID    string `json:"uid,omitempty"`
+	ID     string `json:"job.id,omitempty"`
+	Status string `json:"job.status,omitempty"`
+	// From and To are the range of feed ids [From, To) to scrape, unless Module is set
+	From   int    `json:"job.from,omitempty"`
+	To     int    `json:"job.to,omitempty"`
+	Module string `json:"job.module,omitempty"`
+	// Total is how many feeds there are to scrape, once the job has started, and Done how many have been scraped so far
+	Total int `json:"job.total,omitempty"`
+	Done  int `json:"job.done,omitempty"`
+	// Failed is how many of the feeds scraped so far failed, and Error why the last of them did
+	Failed      int        `json:"job.failed,omitempty"`
+	Error       string     `json:"job.error,omitempty"`
+	RequestedAt *time.Time `json:"job.requested_at,omitempty"`
+	StartedAt   *time.Time `json:"job.started_at,omitempty"`
+	FinishedAt  *time.Time `json:"job.finished_at,omitempty"`
+
+	DType []string `json:"dgraph.type,omitempty"`
+}
+
+// Webhook is a URL registered to be posted the changes to the events matching its filters
+type Webhook struct {
+	UID string `json:"uid,omitempty"`
+	ID  string `json:"webhook.id,omitempty"`
+	URL string `json:"webhook.url,omitempty"`
+	// Secret signs the deliveries, so the receiver can check they came from whatsupkent
+	Secret string `json:"webhook.secret,omitempty"`
+	// Modules and Locations are the module codes and location ids whose events are delivered, every event's if both are empty
+	Modules   []string `json:"webhook.module,omitempty"`
+	Locations []string `json:"webhook.location,omitempty"`
+	// Changes are the types of changes delivered, such as added or cancelled, every type if it is empty
+	Changes   []string   `json:"webhook.change,omitempty"`
+	CreatedAt *time.Time `json:"webhook.created_at,omitempty"`
+
+	DType []string `json:"dgraph.type,omitempty"`
+}
+
+// WebhookDelivery is a change posted to a webhook, claimed before it is posted so it is only ever posted once,
+// then updated with how the attempts at it went
+type WebhookDelivery struct {
+	UID string `json:"uid,omitempty"`
+	// Key is the Seq of the change and the webhook.id of the webhook, see WebhookDeliveryKey
+	Key     string   `json:"delivery.key,omitempty"`
+	ID      string   `json:"delivery.id,omitempty"`
+	Webhook *Webhook `json:"delivery.webhook,omitempty"`
+	Change  int64    `json:"delivery.change,omitempty"`
+	Type    string   `json:"delivery.type,omitempty"`
+	// Event is the event.id of the event which changed
+	Event    string `json:"delivery.event,omitempty"`
+	Attempts int    `json:"delivery.attempts,omitempty"`
+	// Status is what the webhook answered the last attempt with, 0 if it couldn't be reached
+	Status    int        `json:"delivery.status,omitempty"`
+	Error     string     `json:"delivery.error,omitempty"`
+	Delivered bool       `json:"delivery.delivered,omitempty"`
+	At        *time.Time `json:"delivery.at,omitempty"`
+
+	DType []string `json:"dgraph.type,omitempty"`
+}
+
+// Term is one of the terms of an academic year, such as the autumn term of 2024/25
+type Term struct {
+	UID string `json:"uid,omitempty"`
+	// ID is the academic year and name of the term, such as 2024-autumn, see TermID
+	ID   string `json:"term.id,omitempty"`
+	Name string `json:"term.name,omitempty"`
+	// AcademicYear is the year the academic year the term is in starts in, 2024 for 2024/25
+	AcademicYear int `json:"term.academic_year,omitempty"`
+	// StartDate is the first day of the term, and EndDate the day after its last
+	StartDate *time.Time `json:"term.start_date,omitempty"`
+	EndDate   *time.Time `json:"term.end_date,omitempty"`
+
+	DType []string `json:"dgraph.type,omitempty"`
+}
+
+// User is someone signed in with the OIDC provider, such as the university SSO, with the modules of their saved timetable
+type User struct {
+	UID string `json:"uid,omitempty"`
+	// Subject is what the provider identifies the user by
+	Subject string `json:"user.subject,omitempty"`
+	Email   string `json:"user.email,omitempty"`
+	Name    string `json:"user.name,omitempty"`
+	// Modules are the modules the user chose for their timetable
+	Modules   []Module   `json:"user.module,omitempty"`
+	UpdatedAt *time.Time `json:"user.updated_at,omitempty"`
+	// NotifyChannels are how the user is told about the changes to the events of their modules, email or push,
+	// they aren't told if it is empty
+	NotifyChannels []string `json:"user.notify_channel,omitempty"`
+	// NotifyChanges are the types of changes they are told about, such as moved or cancelled
+	NotifyChanges []string `json:"user.notify_change,omitempty"`
+	// PushSubscriptions are the web push subscriptions of the user's browsers, each the json of a PushSubscription
+	PushSubscriptions []string `json:"user.push_subscription,omitempty"`
+	// UnsubscribeHash is the hex SHA-256 of the token of the unsubscribe links in the emails, which turn the notifications
+	// off without signing in. Only the hash is stored so the token can't be read back out of the database.
+	UnsubscribeHash string `json:"user.unsubscribe_hash,omitempty"`
+
+	DType []string `json:"dgraph.type,omitempty"`
+}
+
+// Notification records that a user has been told about a change, so they are only told once, whichever replica tells them
+type Notification struct {
+	UID string `json:"uid,omitempty"`
+	// Key is the Seq of the change and the subject of the user, see NotificationKey
+	Key    string     `json:"notification.key,omitempty"`
+	Change int64      `json:"notification.change,omitempty"`
+	User   *User      `json:"notification.user,omitempty"`
+	SentAt *time.Time `json:"notification.sent_at,omitempty"`
+
+	DType []string `json:"dgraph.type,omitempty"`
+}
+
+// Lease is held by one of the api replicas at a time, for the work only one of them should do, such as sending the notifications.
+// Its holder renews it before ExpiresAt, otherwise another replica takes it over, carrying on from the Cursor it left.
+type Lease struct {
+	UID       string     `json:"uid,omitempty"`
+	Name      string     `json:"lease.name,omitempty"`
+	Holder    string     `json:"lease.holder,omitempty"`
+	ExpiresAt *time.Time `json:"lease.expires_at,omitempty"`
+	// Cursor is how far the holders have got through the work, such as the Seq of the last change notified
+	Cursor int64 `json:"lease.cursor,omitempty"`
+
+	DType []string `json:"dgraph.type,omitempty"`
+}
+
+// Change is a change to the timetable the scraper found, recorded so the api can push it to its subscribers.
+// Seq increases with every change recorded, so the changes can be read in order and resumed from where they were left off.
+type Change struct {
+	UID string `json:"uid,omitempty"`
+	Seq int64  `json:"change.seq,omitempty"`
+	// Type is one of ChangeAdded, ChangeMoved, ChangeUpdated, ChangeCancelled or ChangeScraped
+	Type  string `json:"change.type,omitempty"`
+	Event *Event `json:"change.event,omitempty"`
+	// Changes holds the fields which changed, for moved and updated events. They are stored as json in Fields.
+	Changes []FieldChange `json:"-"`
+	Fields  string        `json:"change.fields,omitempty"`
+	// Scrape is the scrape which finished, for ChangeScraped
+	Scrape *Scrape `json:"change.scrape,omitempty"`
+	// Topics are the modules and locations of the event before and after the change, see ChangeTopics
+	Topics []string   `json:"change.topic,omitempty"`
+	At     *time.Time `json:"change.at,omitempty"`
 
 	DType []string `json:"dgraph.type,omitempty"`
 }
@@ -71,6 +270,9 @@ func (e Event) Equal(e2 Event) bool {
 	if len(e.PartOfModule) != len(e2.PartOfModule) {
 		return false
 	}
+	if (e.Series == nil) != (e2.Series == nil) || (e.Series != nil && e.Series.UID != e2.Series.UID) {
+		return false
+	}
 
 	locEqual := true
 	for _, loc := range e.Location {
@@ -112,36 +314,128 @@ func (m Module) Equal(m2 Module) bool {
 // Schema is the database schema
 var Schema = `
 location.id: string @index(exact) .
-location.name: string .
-location.loc: geo .
+location.name: string @index(term) .
+location.loc: geo @index(geo) .
 location.disabled_access: bool .
+location.capacity: int @index(int) .
+location.campus: string @index(exact) .
+location.part_of: uid @reverse .
+location.imported_at: datetime .
 
 module.code: string @index(exact) .
 module.name: string @index(fulltext) .
 module.subject: string @index(fulltext, exact) .
 
-person.name: string .
+person.name: string @index(exact, term) .
 person.email: string .
 
 scrape.id: int @index(int) .
-scrape.last_scraped: datetime .
+scrape.last_scraped: datetime @index(hour) .
 scrape.found_event: [uid] @reverse .
 
 event.id: string @index(hash) .
 event.title: string @index(fulltext, term) .
-event.description: string .
+event.description: string @index(fulltext) .
 event.start_date: datetime @index(hour) .
 event.end_date: datetime @index(hour).
 event.organiser: [uid] @reverse .
 event.part_of_module: [uid] @reverse .
 event.location: [uid] @reverse .
+event.deleted_at: datetime @index(hour) .
+event.revision: [uid] .
+event.attendee: [uid] @reverse .
+event.series: uid @reverse .
+
+series.id: string @index(hash) .
+series.title: string .
+
+revision.changed_at: datetime @index(hour) .
+revision.title: string .
+revision.description: string .
+revision.start_date: datetime .
+revision.end_date: datetime .
+revision.location: [uid] .
 
+job.id: string @index(hash) .
+job.status: string @index(exact) .
+job.from: int .
+job.to: int .
+job.module: string .
+job.total: int .
+job.done: int .
+job.failed: int .
+job.error: string .
+job.requested_at: datetime @index(hour) .
+job.started_at: datetime .
+job.finished_at: datetime .
+
+webhook.id: string @index(hash) .
+webhook.url: string .
+webhook.secret: string .
+webhook.module: [string] .
+webhook.location: [string] .
+webhook.change: [string] .
+webhook.created_at: datetime .
+
+delivery.key: string @index(hash) @upsert .
+delivery.id: string .
+delivery.webhook: uid @reverse .
+delivery.change: int .
+delivery.type: string .
+delivery.event: string .
+delivery.attempts: int .
+delivery.status: int .
+delivery.error: string .
+delivery.delivered: bool .
+delivery.at: datetime @index(hour) .
+
+term.id: string @index(hash) .
+term.name: string .
+term.academic_year: int @index(int) .
+term.start_date: datetime @index(hour) .
+term.end_date: datetime .
+
+user.subject: string @index(hash) .
+user.email: string .
+user.name: string .
+user.module: [uid] @reverse .
+user.updated_at: datetime .
+user.notify_channel: [string] @index(exact) .
+user.notify_change: [string] .
+user.push_subscription: [string] .
+user.unsubscribe_hash: string @index(hash) .
+
+notification.key: string @index(hash) @upsert .
+notification.change: int .
+notification.user: uid .
+notification.sent_at: datetime .
+
+lease.name: string @index(hash) @upsert .
+lease.holder: string .
+lease.expires_at: datetime .
+lease.cursor: int .
+
+change.seq: int @index(int) @upsert .
+change.type: string @index(exact) .
+change.event: uid .
+change.fields: string .
+change.scrape: uid .
+change.topic: [string] @index(exact) .
+change.at: datetime @index(hour) .
+
+migration.version: int @index(int) .
+migration.name: string .
+migration.applied_at: datetime .
 
 type Location {
 	location.id: string
 	location.name: string
 	location.loc: geo
 	location.disabled_access: bool
+	location.capacity: int
+	location.campus: string
+	location.part_of: Location
+	location.imported_at: datetime
 }
 
 type Module {
@@ -170,5 +464,112 @@ type Event {
 	event.organiser: [Person]
 	event.part_of_module: [Module]
 	event.location: [Location]
+	event.deleted_at: datetime
+	event.revision: [Revision]
+	event.attendee: [Person]
+	event.series: Series
+}
+
+type Series {
+	series.id: string
+	series.title: string
+}
+
+type Revision {
+	revision.changed_at: datetime
+	revision.title: string
+	revision.description: string
+	revision.start_date: datetime
+	revision.end_date: datetime
+	revision.location: [Location]
+}
+
+type ScrapeJob {
+	job.id: string
+	job.status: string
+	job.from: int
+	job.to: int
+	job.module: string
+	job.total: int
+	job.done: int
+	job.failed: int
+	job.error: string
+	job.requested_at: datetime
+	job.started_at: datetime
+	job.finished_at: datetime
+}
+
+type Webhook {
+	webhook.id: string
+	webhook.url: string
+	webhook.secret: string
+	webhook.module: [string]
+	webhook.location: [string]
+	webhook.change: [string]
+	webhook.created_at: datetime
+}
+
+type WebhookDelivery {
+	delivery.key: string
+	delivery.id: string
+	delivery.webhook: Webhook
+	delivery.change: int
+	delivery.type: string
+	delivery.event: string
+	delivery.attempts: int
+	delivery.status: int
+	delivery.error: string
+	delivery.delivered: bool
+	delivery.at: datetime
+}
+
+type Term {
+	term.id: string
+	term.name: string
+	term.academic_year: int
+	term.start_date: datetime
+	term.end_date: datetime
+}
+
+type User {
+	user.subject: string
+	user.email: string
+	user.name: string
+	user.module: [Module]
+	user.updated_at: datetime
+	user.notify_channel: [string]
+	user.notify_change: [string]
+	user.push_subscription: [string]
+	user.unsubscribe_hash: string
+}
+
+type Notification {
+	notification.key: string
+	notification.change: int
+	notification.user: User
+	notification.sent_at: datetime
+}
+
+type Lease {
+	lease.name: string
+	lease.holder: string
+	lease.expires_at: datetime
+	lease.cursor: int
+}
+
+type Change {
+	change.seq: int
+	change.type: string
+	change.event: Event
+	change.fields: string
+	change.scrape: Scrape
+	change.topic: [string]
+	change.at: datetime
+}
+
+type Migration {
+	migration.version: int
+	migration.name: string
+	migration.applied_at: datetime
 }
 `
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// termPredicates are the predicates of a Term the getters return
+const termPredicates = `uid
+	term.id
+	term.name
+	term.academic_year
+	term.start_date
+	term.end_date`
+
+// TermID returns the term.id of the term with the name in the academic year starting in the year, such as 2024-autumn
+func TermID(year int, name string) string {
+	return strconv.Itoa(year) + "-" + strings.ToLower(strings.Join(strings.Fields(name), "-"))
+}
+
+// UpsertTerm stores the term, matching terms without a Uid on term.id
+func (config *DB) UpsertTerm(ctx context.Context, term Term, options ...Option) (*Response, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	if len(term.DType) == 0 {
+		term.DType = []string{"Term"}
+	}
+	if term.UID == "" && term.ID == "" {
+		return nil, errors.New("UpsertTerm needs a term with a Uid or an ID")
+	}
+	if term.UID == "" {
+		term.UID = upsertVar
+		req, err := upsertRequest("term.id", "string", term.ID, term)
+		if err != nil {
+			return nil, err
+		}
+		return config.commit(ctx, "UpsertTerm", req)
+	}
+	req, err := mutationRequest(term)
+	if err != nil {
+		return nil, err
+	}
+	return config.commit(ctx, "UpsertTerm", req)
+}
+
+// ListTerms returns the terms of the academic year starting in the year, or every term if it is 0, in the order they start.
+// There are only ever a few a year, so they aren't paged.
+func (config *DB) ListTerms(ctx context.Context, year int, options ...Option) ([]Term, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+	params, root := "", "type(Term)"
+	var vars map[string]string
+	if year != 0 {
+		params, root = "($year: int)", "eq(term.academic_year, $year)"
+		vars = map[string]string{"$year": strconv.Itoa(year)}
+	}
+	q := fmt.Sprintf(
+		`query ListTerms%s {
+			terms(func: %s, orderasc: term.start_date) @filter(type(Term)) {
+				%s
+			}
+		}
+	`, params, root, termPredicates)
+	resp, err := config.runQuery(ctx, txn, "ListTerms", q, vars)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Terms []Term `json:"terms"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	if r.Terms == nil {
+		return make([]Term, 0), nil
+	}
+	return r.Terms, nil
+}
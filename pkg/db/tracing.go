@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation name the spans are reported under
+const tracerName = "github.com/jamesjarvis/WhatsUpKent/pkg/db"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the id of the request an operation is run for,
+// which is recorded on the spans around its calls to dgraph so they can be found from the request's logs
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the id set by WithRequestID, or "" if there isn't one
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// tracer returns the tracer from the configured TracerProvider, or the global one if there isn't one.
+// The global provider does nothing until the application installs one, so tracing is off by default.
+func (config *DB) tracer() trace.Tracer {
+	if config.TracerProvider != nil {
+		return config.TracerProvider.Tracer(tracerName)
+	}
+	return otel.Tracer(tracerName)
+}
+
+// startSpan starts a client span for a call to dgraph as a child of whatever span is in ctx,
+// recording the operation, the query and its variables, and the request it is run for
+func (config *DB) startSpan(ctx context.Context, op, kind, q string, vars map[string]string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", "dgraph"),
+		attribute.String("db.operation", op),
+		attribute.String("db.dgraph.kind", kind),
+	}
+	if q != "" {
+		attrs = append(attrs, attribute.String("db.statement", q))
+	}
+	if id := RequestIDFromContext(ctx); id != "" {
+		attrs = append(attrs, attribute.String("request.id", id))
+	}
+	for k, v := range vars {
+		attrs = append(attrs, attribute.String("db.dgraph.var."+k, v))
+	}
+	return config.tracer().Start(ctx, op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...))
+}
+
+// endSpan records the size of the response or the error, and ends the span
+func endSpan(span trace.Span, resp *Response, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else if resp != nil {
+		span.SetAttributes(attribute.Int("db.dgraph.response_bytes", len(resp.JSON)))
+	}
+	span.End()
+}
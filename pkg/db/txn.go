@@ -0,0 +1,35 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// WithTxn runs fn inside a single transaction, which is committed if fn returns nil and discarded otherwise.
+// Use the ...Txn variants of the operations inside fn, so that all of the writes commit or abort together.
+// Aborted transactions are retried, so fn may be called more than once and shouldn't have other side effects.
+func (config *DB) WithTxn(ctx context.Context, fn func(txn *Txn) error, options ...Option) error {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+	return config.retry(ctx, func() error {
+		txn := &Txn{txn: config.client.newTxn()}
+		defer txn.txn.discard(ctx)
+
+		err := fn(txn)
+		if err != nil {
+			return err
+		}
+		commitCtx, span := config.startSpan(ctx, "WithTxn", "commit", "", nil)
+		start := time.Now()
+		err = txn.txn.commit(commitCtx)
+		config.Metrics.observe("WithTxn", "commit", start, err)
+		endSpan(span, nil, err)
+		if err != nil {
+			return &MutationError{Op: "WithTxn", Err: err}
+		}
+		for _, fn := range txn.committed {
+			fn()
+		}
+		return nil
+	})
+}
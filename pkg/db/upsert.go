@@ -0,0 +1,58 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// upsertVar is the query variable bound to the existing node in an upsert block.
+// Nodes written through upsertRequest should use it as their uid.
+const upsertVar = "uid(v)"
+
+// upsertRequest builds an upsert block keyed on the given predicate,
+// so that if a node with the same key already exists it is updated instead of duplicated.
+// keyType is the dgraph type of the predicate, as used in the query variable (string or int).
+func upsertRequest(predicate, keyType, key string, node interface{}) (*Request, error) {
+	pb, err := json.Marshal(node)
+	if err != nil {
+		return nil, err
+	}
+
+	q := fmt.Sprintf(
+		`query Upsert($key: %s) {
+			v as var(func: eq(%s, $key))
+		}`, keyType, predicate)
+
+	return &Request{
+		Query:     q,
+		Vars:      map[string]string{"$key": key},
+		Mutations: []*Mutation{{SetJSON: pb}},
+	}, nil
+}
+
+// mutationRequest builds a plain set mutation, used when there is no key to upsert on
+func mutationRequest(node interface{}) (*Request, error) {
+	pb, err := json.Marshal(node)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Request{
+		Mutations: []*Mutation{{SetJSON: pb}},
+	}, nil
+}
+
+// commit runs the request in a transaction of its own, committing it straight away.
+// Aborted transactions are retried, and failures are wrapped in a MutationError naming the operation.
+func (config *DB) commit(ctx context.Context, op string, req *Request) (*Response, error) {
+	req.CommitNow = true
+
+	var resp *Response
+	err := config.retry(ctx, func() error {
+		var err error
+		resp, err = config.runRequest(ctx, &Txn{txn: config.client.newTxn()}, op, req)
+		return err
+	})
+	return resp, err
+}
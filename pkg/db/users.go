@@ -0,0 +1,310 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// userPredicates are the predicates of a User the getters return, with the modules of their timetable in module code order
+const userPredicates = `uid
+	user.subject
+	user.email
+	user.name
+	user.updated_at
+	user.notify_channel
+	user.notify_change
+	user.push_subscription
+	user.unsubscribe_hash
+	user.module (orderasc: module.code) {
+		uid
+		module.code
+		module.name
+		module.subject
+	}`
+
+// SetUserTimetable stores the user, matching on user.subject, with user.Modules as the modules of their timetable.
+// Unlike the other lists in dgraph the modules are replaced rather than added to, so a module left out is dropped.
+// The modules are linked by their Uid, which each of them needs.
+func (config *DB) SetUserTimetable(ctx context.Context, user User, options ...Option) (*Response, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	if user.Subject == "" {
+		return nil, errors.New("SetUserTimetable needs a user with a Subject")
+	}
+	modules := make([]Module, len(user.Modules))
+	for i, m := range user.Modules {
+		if m.UID == "" {
+			return nil, fmt.Errorf("The module %s of the timetable needs a Uid", m.Code)
+		}
+		modules[i] = Module{UID: m.UID}
+	}
+	user.Modules = modules
+	if len(user.DType) == 0 {
+		user.DType = []string{"User"}
+	}
+
+	user.UID = upsertVar
+	req, err := upsertRequest("user.subject", "string", user.Subject, user)
+	if err != nil {
+		return nil, err
+	}
+	// The old modules are deleted before the new ones are set, only if the user is already stored
+	req.Mutations = append([]*Mutation{{
+		DelNquads: []byte(upsertVar + " <user.module> * ."),
+		Cond:      "@if(gt(len(v), 0))",
+	}}, req.Mutations...)
+	return config.commit(ctx, "SetUserTimetable", req)
+}
+
+// GetUser returns the user with the user.subject, or an error wrapping ErrNotFound if they have never saved a timetable
+func (config *DB) GetUser(ctx context.Context, subject string, options ...Option) (*User, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+	q := fmt.Sprintf(
+		`query User($subject: string) {
+			user(func: eq(user.subject, $subject)) @filter(type(User)) {
+				%s
+			}
+		}
+	`, userPredicates)
+	resp, err := config.runQuery(ctx, txn, "GetUser", q, map[string]string{"$subject": subject})
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		User []User `json:"user"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.User) == 0 {
+		return nil, notFound("User", "user.subject", subject)
+	}
+	return &r.User[0], nil
+}
+
+// GetUserEvents returns the events of the modules of the user's timetable overlapping [from, to], ordered by start date.
+// An event of several of the modules is only returned once, and there are none for a user who hasn't saved a timetable.
+func (config *DB) GetUserEvents(ctx context.Context, subject string, from, to time.Time, options ...Option) ([]Event, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+	q := fmt.Sprintf(
+		`query UserEvents($subject: string, $from: string, $to: string) {
+			var(func: eq(user.subject, $subject)) @filter(type(User)) {
+				user.module {
+					e as ~event.part_of_module @filter(type(Event) AND NOT has(event.deleted_at) AND le(event.start_date, $to) AND ge(event.end_date, $from))
+				}
+			}
+			events(func: uid(e), orderasc: event.start_date) {
+				%s
+			}
+		}
+	`, eventPredicates)
+	vars := map[string]string{"$subject": subject, "$from": formatTime(from), "$to": formatTime(to)}
+	resp, err := config.runQuery(ctx, txn, "GetUserEvents", q, vars)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Events []Event `json:"events"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	if r.Events == nil {
+		return make([]Event, 0), nil
+	}
+	return r.Events, nil
+}
+
+// SetUserNotifications stores the user, matching on user.subject, with how they want to be told about the changes to
+// the events of their modules. NotifyChannels, NotifyChanges and PushSubscriptions are replaced with the user's,
+// the unsubscribe hash is only set if the user has one, and the modules of their timetable are left as they are.
+func (config *DB) SetUserNotifications(ctx context.Context, user User, options ...Option) (*Response, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	if user.Subject == "" {
+		return nil, errors.New("SetUserNotifications needs a user with a Subject")
+	}
+	user.Modules = nil
+	if len(user.DType) == 0 {
+		user.DType = []string{"User"}
+	}
+
+	user.UID = upsertVar
+	req, err := upsertRequest("user.subject", "string", user.Subject, user)
+	if err != nil {
+		return nil, err
+	}
+	// As in SetUserTimetable, the old lists are deleted before the new ones are set
+	req.Mutations = append([]*Mutation{{
+		DelNquads: []byte(strings.Join([]string{
+			upsertVar + " <user.notify_channel> * .",
+			upsertVar + " <user.notify_change> * .",
+			upsertVar + " <user.push_subscription> * .",
+		}, "\n")),
+		Cond: "@if(gt(len(v), 0))",
+	}}, req.Mutations...)
+	return config.commit(ctx, "SetUserNotifications", req)
+}
+
+// GetUserByUnsubscribeHash returns the user with the user.unsubscribe_hash,
+// or an error wrapping ErrNotFound if no user has it
+func (config *DB) GetUserByUnsubscribeHash(ctx context.Context, hash string, options ...Option) (*User, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	// An empty hash would match every user without one
+	if hash == "" {
+		return nil, notFound("User", "user.unsubscribe_hash", hash)
+	}
+	txn := config.readTxn(ctx)
+	q := fmt.Sprintf(
+		`query UserByUnsubscribeHash($hash: string) {
+			user(func: eq(user.unsubscribe_hash, $hash)) @filter(type(User)) {
+				%s
+			}
+		}
+	`, userPredicates)
+	resp, err := config.runQuery(ctx, txn, "GetUserByUnsubscribeHash", q, map[string]string{"$hash": hash})
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		User []User `json:"user"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.User) == 0 {
+		return nil, notFound("User", "user.unsubscribe_hash", hash)
+	}
+	return &r.User[0], nil
+}
+
+// ListUsersToNotify returns the users with any of the modules in their timetable who want to be told about the changes
+// to their events, those with a notification channel, ordered by user.subject
+func (config *DB) ListUsersToNotify(ctx context.Context, moduleCodes []string, options ...Option) ([]User, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	if len(moduleCodes) == 0 {
+		return []User{}, nil
+	}
+	// Like SearchModules, each code is looked up in its own block, as a list can't be passed as a variable
+	params := make([]string, len(moduleCodes))
+	blocks := make([]string, len(moduleCodes))
+	vars := make([]string, len(moduleCodes))
+	variables := make(map[string]string)
+	for i, code := range moduleCodes {
+		params[i] = fmt.Sprintf("$c%d: string", i)
+		blocks[i] = fmt.Sprintf(`var(func: eq(module.code, $c%d)) {
+				u%d as ~user.module @filter(type(User) AND has(user.notify_channel))
+			}`, i, i)
+		vars[i] = fmt.Sprintf("u%d", i)
+		variables[fmt.Sprintf("$c%d", i)] = code
+	}
+
+	txn := config.readTxn(ctx)
+	q := fmt.Sprintf(
+		`query UsersToNotify(%s) {
+			%s
+			users(func: uid(%s), orderasc: user.subject) {
+				%s
+			}
+		}
+	`, strings.Join(params, ", "), strings.Join(blocks, "\n\t\t\t"), strings.Join(vars, ", "), userPredicates)
+
+	resp, err := config.runQuery(ctx, txn, "ListUsersToNotify", q, variables)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Users []User `json:"users"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	if r.Users == nil {
+		return make([]User, 0), nil
+	}
+	return r.Users, nil
+}
+
+// NotificationKey returns the notification.key of the user being told about the change with the Seq
+func NotificationKey(change int64, subject string) string {
+	return strconv.FormatInt(change, 10) + ":" + subject
+}
+
+// ClaimNotification records that the user with the subject is being told about the change with the Seq,
+// returning false if they already have been, so they are told once even if two replicas try.
+// notification.key is an upsert index, so two claims of the same notification conflict and the retried one finds the other.
+func (config *DB) ClaimNotification(ctx context.Context, change int64, subject string, options ...Option) (bool, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	if subject == "" {
+		return false, errors.New("ClaimNotification needs the subject of the user")
+	}
+	now := time.Now().UTC()
+	key := NotificationKey(change, subject)
+	pb, err := json.Marshal(Notification{
+		UID:    "_:notification",
+		Key:    key,
+		Change: change,
+		User:   &User{UID: "uid(u)"},
+		SentAt: &now,
+		DType:  []string{"Notification"},
+	})
+	if err != nil {
+		return false, err
+	}
+	req := &Request{
+		Query: `query Claim($key: string, $subject: string) {
+			v as var(func: eq(notification.key, $key))
+			u as var(func: eq(user.subject, $subject)) @filter(type(User))
+			found(func: uid(v)) { uid }
+		}`,
+		Vars:      map[string]string{"$key": key, "$subject": subject},
+		Mutations: []*Mutation{{SetJSON: pb, Cond: "@if(eq(len(v), 0))"}},
+	}
+	resp, err := config.commit(ctx, "ClaimNotification", req)
+	if err != nil {
+		return false, err
+	}
+	type Root struct {
+		Found []struct {
+			UID string `json:"uid"`
+		} `json:"found"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return false, err
+	}
+	return len(r.Found) == 0, nil
+}
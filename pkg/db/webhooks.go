@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// webhookPredicates are the predicates of a Webhook the getters return
+const webhookPredicates = `uid
+	webhook.id
+	webhook.url
+	webhook.secret
+	webhook.module
+	webhook.location
+	webhook.change
+	webhook.created_at`
+
+// UpsertWebhook stores the webhook, matching webhooks without a Uid on webhook.id.
+// The filter lists are added to rather than replaced, as with every list in dgraph.
+func (config *DB) UpsertWebhook(ctx context.Context, webhook Webhook, options ...Option) (*Response, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	if len(webhook.DType) == 0 {
+		webhook.DType = []string{"Webhook"}
+	}
+	if webhook.UID == "" && webhook.ID == "" {
+		return nil, errors.New("UpsertWebhook needs a webhook with a Uid or an ID")
+	}
+	if webhook.UID == "" {
+		webhook.UID = upsertVar
+		req, err := upsertRequest("webhook.id", "string", webhook.ID, webhook)
+		if err != nil {
+			return nil, err
+		}
+		return config.commit(ctx, "UpsertWebhook", req)
+	}
+	req, err := mutationRequest(webhook)
+	if err != nil {
+		return nil, err
+	}
+	return config.commit(ctx, "UpsertWebhook", req)
+}
+
+// GetWebhook returns the webhook with the webhook.id, or an error wrapping ErrNotFound if there is no such webhook
+func (config *DB) GetWebhook(ctx context.Context, id string, options ...Option) (*Webhook, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+	q := fmt.Sprintf(
+		`query Webhook($id: string) {
+			webhook(func: eq(webhook.id, $id)) @filter(type(Webhook)) {
+				%s
+			}
+		}
+	`, webhookPredicates)
+	resp, err := config.runQuery(ctx, txn, "GetWebhook", q, map[string]string{"$id": id})
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Webhook []Webhook `json:"webhook"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Webhook) == 0 {
+		return nil, notFound("Webhook", "webhook.id", id)
+	}
+	return &r.Webhook[0], nil
+}
+
+// ListWebhooks returns every webhook, oldest first. There are only ever a handful, so they aren't paged.
+func (config *DB) ListWebhooks(ctx context.Context, options ...Option) ([]Webhook, error) {
+	ctx, cancel := withOptions(ctx, options)
+	defer cancel()
+
+	txn := config.readTxn(ctx)
+	q := fmt.Sprintf(
+		`{
+			webhooks(func: type(Webhook), orderasc: webhook.created_at) {
+				%s
+			}
+		}
+	`, webhookPredicates)
+	resp, err := config.runQuery(ctx, txn, "ListWebhooks", q, nil)
+	if err != nil {
+		return nil, err
+	}
+	type Root struct {
+		Webhooks []Webhook `json:"webhooks"`
+	}
+
+	var r Root
+	err = json.Unmarshal(resp.JSON, &r)
+	if err != nil {
+		return nil, err
+	}
+	if r.Webhooks == nil {
+		return make([]Webhook, 0), nil
+	}
+	return r.Webhooks, nil
+}
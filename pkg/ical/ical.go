@@ -0,0 +1,120 @@
+//Package ical writes calendars in the iCalendar format (RFC 5545), so they can be subscribed to from calendar apps
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+//ProdID identifies whatsupkent as the product which made the calendar
+const ProdID = "-//WhatsUpKent//WhatsUpKent//EN"
+
+//maxLineOctets is the longest a content line can be before it has to be folded, not counting the CRLF
+const maxLineOctets = 75
+
+//Calendar is a VCALENDAR of events
+type Calendar struct {
+	//Name is shown as the name of the calendar by the apps supporting X-WR-CALNAME
+	Name   string
+	Events []Event
+	//Stamp is when the calendar last changed, which the events are stamped with. It is the current time if it isn't set.
+	Stamp time.Time
+}
+
+//Event is a VEVENT
+type Event struct {
+	//UID has to be globally unique and stay the same across updates, so apps can tell events apart
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	Start, End  time.Time
+	//Categories are shown by some apps to group the events, such as the modules they are part of
+	Categories []string
+}
+
+//Write writes the calendar to w, stamping the events with cal.Stamp
+func Write(w io.Writer, cal Calendar) error {
+	stamp := cal.Stamp
+	if stamp.IsZero() {
+		stamp = time.Now()
+	}
+	buf := bufio.NewWriter(w)
+	line := func(name, value string) {
+		writeLine(buf, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", ProdID)
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if cal.Name != "" {
+		line("X-WR-CALNAME", escape(cal.Name))
+	}
+	for _, e := range cal.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", escape(e.UID))
+		line("DTSTAMP", formatTime(stamp))
+		line("DTSTART", formatTime(e.Start))
+		if !e.End.IsZero() {
+			line("DTEND", formatTime(e.End))
+		}
+		line("SUMMARY", escape(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION", escape(e.Description))
+		}
+		if e.Location != "" {
+			line("LOCATION", escape(e.Location))
+		}
+		if len(e.Categories) > 0 {
+			categories := make([]string, len(e.Categories))
+			for i, c := range e.Categories {
+				categories[i] = escape(c)
+			}
+			line("CATEGORIES", strings.Join(categories, ","))
+		}
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return buf.Flush()
+}
+
+//formatTime formats the time as a UTC date-time
+func formatTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+//escape escapes the characters which mean something in a text value
+func escape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", `\n`,
+	).Replace(s)
+}
+
+//writeLine writes the content line ending in a CRLF, folding it onto continuation lines starting with a space
+//wherever it gets too long, without splitting a character in two
+func writeLine(w *bufio.Writer, s string) {
+	limit := maxLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		w.WriteString(s[:cut])
+		w.WriteString("\r\n ")
+		s = s[cut:]
+		// The space starting the continuation line counts towards its length
+		limit = maxLineOctets - 1
+	}
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
@@ -0,0 +1,113 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+//SMTPConfig is the server the emails are sent through
+type SMTPConfig struct {
+	//Addr is the host and port of the server, such as "smtp.kent.ac.uk:587". STARTTLS is used if the server offers it.
+	Addr string
+	//Username and Password sign in to the server, with PLAIN auth, if Username is set
+	Username string
+	Password string
+	//From is who the emails are from, such as "WhatsUpKent <noreply@whatsupkent.com>"
+	From string
+}
+
+//Mailer sends the notifications by email
+type Mailer struct {
+	config SMTPConfig
+	from   *mail.Address
+	auth   smtp.Auth
+	//send sends a message through the server, it is smtp.SendMail
+	send func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+//NewMailer returns a mailer sending through the server the config describes. The server isn't contacted until an email is sent.
+func NewMailer(config SMTPConfig) (*Mailer, error) {
+	host, _, err := net.SplitHostPort(config.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("The SMTP address %q needs a host and a port: %w", config.Addr, err)
+	}
+	from, err := mail.ParseAddress(config.From)
+	if err != nil {
+		return nil, fmt.Errorf("The SMTP from address %q isn't valid: %w", config.From, err)
+	}
+	m := &Mailer{config: config, from: from, send: smtp.SendMail}
+	if config.Username != "" {
+		m.auth = smtp.PlainAuth("", config.Username, config.Password, host)
+	}
+	return m, nil
+}
+
+//Send emails the message to the address, with List-Unsubscribe headers (RFC 2369 and RFC 8058) if it has an UnsubscribeURL
+//so mail clients can offer to unsubscribe with one click
+func (m *Mailer) Send(to string, msg Message) error {
+	addr, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("The email address %q isn't valid: %w", to, err)
+	}
+	body, err := m.message(addr, msg)
+	if err != nil {
+		return err
+	}
+	return m.send(m.config.Addr, m.auth, m.from.Address, []string{addr.Address}, body)
+}
+
+//message returns the email of the message to the address, with its body quoted-printable so any line length is fine
+func (m *Mailer) message(to *mail.Address, msg Message) ([]byte, error) {
+	if strings.ContainsAny(msg.Subject, "\r\n") || strings.ContainsAny(msg.UnsubscribeURL, "\r\n<>") {
+		return nil, errors.New("The subject and unsubscribe url of an email can't have line breaks in them")
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domain := m.from.Address[strings.LastIndex(m.from.Address, "@")+1:]
+
+	var b bytes.Buffer
+	header := func(name, value string) {
+		b.WriteString(name + ": " + value + "\r\n")
+	}
+	header("From", m.from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", "<"+hex.EncodeToString(id)+"@"+domain+">")
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	if msg.UnsubscribeURL != "" {
+		header("List-Unsubscribe", "<"+msg.UnsubscribeURL+">")
+		header("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+	}
+	b.WriteString("\r\n")
+
+	text := msg.Body
+	if msg.URL != "" {
+		text += "\n\n" + msg.URL
+	}
+	if msg.UnsubscribeURL != "" {
+		text += "\n\nTo stop these emails, unsubscribe at " + msg.UnsubscribeURL
+	}
+	qp := quotedprintable.NewWriter(&b)
+	if _, err := qp.Write([]byte(strings.Replace(text, "\n", "\r\n", -1))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,32 @@
+//Package notify sends notifications to users, by email over SMTP with a Mailer
+//or to their browsers as web push messages (RFC 8030) with a Pusher
+package notify
+
+import "encoding/json"
+
+//Message is a notification, as it is sent to one user
+type Message struct {
+	//Subject is a line saying what happened, such as "Moved: CO324 Lecture"
+	Subject string
+	//Body is the plain text of the notification
+	Body string
+	//URL is where more can be seen, it can be empty
+	URL string
+	//UnsubscribeURL turns the notifications off without signing in, the emails link to it
+	UnsubscribeURL string
+	//Tag is the same for the messages about the same thing, so a browser replaces the notification rather than adding another
+	Tag string
+}
+
+//pushPayload is the json a Pusher sends the browsers, for the site's service worker to show
+type pushPayload struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	URL   string `json:"url,omitempty"`
+	Tag   string `json:"tag,omitempty"`
+}
+
+//payload returns the message as it is pushed to the browsers
+func (m Message) payload() ([]byte, error) {
+	return json.Marshal(pushPayload{Title: m.Subject, Body: m.Body, URL: m.URL, Tag: m.Tag})
+}
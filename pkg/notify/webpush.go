@@ -0,0 +1,276 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	//PushTTL is how long a push service keeps a message for a browser which is offline before dropping it
+	PushTTL = 24 * time.Hour
+	//pushTimeout bounds each message sent to a push service
+	pushTimeout = 10 * time.Second
+	//pushRecordSize is the record size of the encrypted messages, which are sent as a single record
+	pushRecordSize = 4096
+	//MaxPushPayload is the most a message can be, once it is json, to fit one record with its padding delimiter and tag
+	MaxPushPayload = pushRecordSize - 17
+	//vapidExpiry is how long the VAPID tokens are valid for, the push services refuse ones valid for more than a day
+	vapidExpiry = 12 * time.Hour
+)
+
+//ErrSubscriptionGone is returned when the push service says the subscription has expired or been unsubscribed,
+//so it should be forgotten
+var ErrSubscriptionGone = errors.New("The push subscription has gone")
+
+//Subscription is a browser's push subscription, the json of the PushSubscription a service worker subscribes with
+type Subscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		//P256dh is the browser's public key, and Auth the secret shared with it, both base64url
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+//Validate checks the subscription can be sent to, an https endpoint with the browser's keys
+func (s Subscription) Validate() error {
+	endpoint, err := url.Parse(s.Endpoint)
+	if err != nil || endpoint.Scheme != "https" || endpoint.Host == "" {
+		return errors.New("The endpoint of a push subscription has to be an https URL")
+	}
+	if _, err := decodeKey(s.Keys.P256dh, 65); err != nil {
+		return fmt.Errorf("The p256dh key of the push subscription isn't valid: %w", err)
+	}
+	if _, err := decodeKey(s.Keys.Auth, 16); err != nil {
+		return fmt.Errorf("The auth secret of the push subscription isn't valid: %w", err)
+	}
+	return nil
+}
+
+//decodeKey decodes the base64url key, with or without its padding, checking it is n bytes long
+func decodeKey(key string, n int) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(trimPadding(key))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != n {
+		return nil, fmt.Errorf("It is %d bytes rather than %d", len(b), n)
+	}
+	return b, nil
+}
+
+func trimPadding(s string) string {
+	for len(s) > 0 && s[len(s)-1] == '=' {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+//Pusher sends the notifications to the browsers' push services, identifying the api with its VAPID keys (RFC 8292)
+type Pusher struct {
+	key       *ecdsa.PrivateKey
+	publicKey string
+	subject   string
+	//Client sends the messages, it is http.DefaultClient if it isn't set
+	Client *http.Client
+}
+
+//NewPusher returns a pusher signing with the VAPID private key, the base64url P-256 scalar GenerateVAPIDKeys makes.
+//The subject is how the push services can contact whoever runs the api, a mailto: or https: URL.
+func NewPusher(privateKey, subject string) (*Pusher, error) {
+	d, err := decodeKey(privateKey, 32)
+	if err != nil {
+		return nil, fmt.Errorf("The VAPID private key isn't valid: %w", err)
+	}
+	key, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return nil, fmt.Errorf("The VAPID private key isn't valid: %w", err)
+	}
+	if subject == "" {
+		return nil, errors.New("A VAPID subject, a mailto: or https: URL, has to be set")
+	}
+	public := key.PublicKey().Bytes()
+	signer := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(public[1:33]),
+			Y:     new(big.Int).SetBytes(public[33:]),
+		},
+		D: new(big.Int).SetBytes(d),
+	}
+	return &Pusher{key: signer, publicKey: base64.RawURLEncoding.EncodeToString(public), subject: subject}, nil
+}
+
+//GenerateVAPIDKeys returns a new VAPID key pair, base64url, the private key for NewPusher
+//and the public key for the browsers to subscribe with as their applicationServerKey
+func GenerateVAPIDKeys() (privateKey, publicKey string, err error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(key.Bytes()), base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()), nil
+}
+
+//PublicKey returns the VAPID public key, which the browsers subscribe with as their applicationServerKey
+func (p *Pusher) PublicKey() string {
+	return p.publicKey
+}
+
+//Send pushes the message to the browser with the subscription, encrypted for it (RFC 8291).
+//It returns ErrSubscriptionGone if the push service says the subscription is no more.
+func (p *Pusher) Send(ctx context.Context, sub Subscription, msg Message) error {
+	if err := sub.Validate(); err != nil {
+		return err
+	}
+	payload, err := msg.payload()
+	if err != nil {
+		return err
+	}
+	if len(payload) > MaxPushPayload {
+		return fmt.Errorf("The push message is %d bytes, at most %d can be sent", len(payload), MaxPushPayload)
+	}
+	body, err := encrypt(sub, payload)
+	if err != nil {
+		return err
+	}
+	auth, err := p.authorization(sub.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pushTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(PushTTL.Seconds())))
+	req.Header.Set("Urgency", "normal")
+	req.Header.Set("Authorization", auth)
+	if msg.Tag != "" {
+		// The push service replaces a message it is still holding with the same topic, which is at most 32 url safe characters
+		topic := sha256.Sum256([]byte(msg.Tag))
+		req.Header.Set("Topic", base64.RawURLEncoding.EncodeToString(topic[:24]))
+	}
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrSubscriptionGone
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return fmt.Errorf("The push service answered with %d", resp.StatusCode)
+	}
+	return nil
+}
+
+//authorization returns the VAPID Authorization header for the endpoint's push service, a token signed for its origin
+func (p *Pusher) authorization(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": time.Now().Add(vapidExpiry).Unix(),
+		"sub": p.subject,
+	})
+	signed, err := token.SignedString(p.key)
+	if err != nil {
+		return "", err
+	}
+	return "vapid t=" + signed + ", k=" + p.publicKey, nil
+}
+
+//encrypt encrypts the payload for the browser with the subscription, as a single aes128gcm record (RFC 8188)
+//keyed from a new ECDH key pair and the browser's auth secret as RFC 8291 describes
+func encrypt(sub Subscription, payload []byte) ([]byte, error) {
+	uaPublic, err := decodeKey(sub.Keys.P256dh, 65)
+	if err != nil {
+		return nil, err
+	}
+	authSecret, err := decodeKey(sub.Keys.Auth, 16)
+	if err != nil {
+		return nil, err
+	}
+	browserKey, err := ecdh.P256().NewPublicKey(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	local, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := local.ECDH(browserKey)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := local.PublicKey().Bytes()
+
+	keyInfo := append(append([]byte("WebPush: info\x00"), uaPublic...), asPublic...)
+	ikm := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, authSecret, keyInfo), ikm); err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	prk := hkdf.Extract(sha256.New, ikm, salt)
+	cek := make([]byte, 16)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, prk, []byte("Content-Encoding: aes128gcm\x00")), cek); err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 12)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, prk, []byte("Content-Encoding: nonce\x00")), nonce); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// The header is the salt, the record size and the key the browser derives the secret with
+	header := make([]byte, 0, 16+4+1+len(asPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, pushRecordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+	// 0x02 marks the last, and only, record, without any padding after it
+	plaintext := append(append([]byte{}, payload...), 0x02)
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}
@@ -0,0 +1,289 @@
+//Package oidc verifies the ID and access tokens issued by an OpenID Connect provider, such as the university SSO,
+//against the signing keys the provider publishes
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	//DefaultLeeway is how far the clocks of the provider and the api can disagree about when a token expires
+	DefaultLeeway = time.Minute
+	//keysTTL is how long the provider's signing keys are used before they are fetched again
+	keysTTL = time.Hour
+	//minRefresh is how often the keys can be fetched again for a token signed with a key that isn't known,
+	//so a stream of forged tokens can't make the api hammer the provider
+	minRefresh = time.Minute
+)
+
+//signingMethods are the algorithms a token can be signed with, the asymmetric ones the providers publish keys for
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+//ErrInvalidToken is wrapped by every error of a token which can't be trusted
+var ErrInvalidToken = errors.New("Invalid token")
+
+//Config says which provider the tokens come from and who they have to be for
+type Config struct {
+	//Issuer is the provider's issuer url, such as "https://login.microsoftonline.com/<tenant>/v2.0",
+	//which the tokens' iss has to be
+	Issuer string
+	//Audience is the client id the tokens' aud has to contain
+	Audience string
+	//JWKSURL is where the provider's signing keys are, it is found from the issuer's discovery document if it isn't set
+	JWKSURL string
+	//Leeway is DefaultLeeway if it isn't set
+	Leeway time.Duration
+	//Client fetches the provider's documents, it is http.DefaultClient if it isn't set
+	Client *http.Client
+}
+
+//Claims are the claims of a verified token which the api uses
+type Claims struct {
+	//Subject identifies the user, and is only unique for the issuer
+	Subject string
+	Issuer  string
+	Email   string
+	Name    string
+	Expires time.Time
+}
+
+//Verifier verifies tokens from the provider, fetching its signing keys as they are needed
+type Verifier struct {
+	config Config
+
+	mu        sync.Mutex
+	jwksURL   string
+	keys      map[string]interface{}
+	fetchedAt time.Time
+}
+
+//New returns a verifier for the tokens the config describes. The provider isn't contacted until a token is verified.
+func New(config Config) (*Verifier, error) {
+	if config.Issuer == "" {
+		return nil, errors.New("An OIDC issuer has to be set")
+	}
+	if config.Audience == "" {
+		return nil, errors.New("An OIDC audience has to be set")
+	}
+	if config.Leeway == 0 {
+		config.Leeway = DefaultLeeway
+	}
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	return &Verifier{config: config, jwksURL: config.JWKSURL}, nil
+}
+
+//Verify returns the claims of the token, if it was signed by the provider for the audience and hasn't expired
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	parser := jwt.Parser{ValidMethods: signingMethods, SkipClaimsValidation: true}
+	claims := jwt.MapClaims{}
+	// Not being able to fetch the keys says nothing about the token, so it isn't reported as invalid
+	var fetchErr error
+	_, err := parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := v.key(ctx, kid)
+		if err != nil && !errors.Is(err, ErrInvalidToken) {
+			fetchErr = err
+		}
+		return key, err
+	})
+	if fetchErr != nil {
+		return nil, fetchErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	now := time.Now()
+	leeway := int64(v.config.Leeway / time.Second)
+	if !claims.VerifyExpiresAt(now.Unix()-leeway, true) {
+		return nil, fmt.Errorf("%w: it has expired", ErrInvalidToken)
+	}
+	if !claims.VerifyNotBefore(now.Unix()+leeway, false) {
+		return nil, fmt.Errorf("%w: it isn't valid yet", ErrInvalidToken)
+	}
+	if !claims.VerifyIssuer(v.config.Issuer, true) {
+		return nil, fmt.Errorf("%w: it wasn't issued by %s", ErrInvalidToken, v.config.Issuer)
+	}
+	if !claims.VerifyAudience(v.config.Audience, true) {
+		return nil, fmt.Errorf("%w: it isn't for %s", ErrInvalidToken, v.config.Audience)
+	}
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, fmt.Errorf("%w: it doesn't have a subject", ErrInvalidToken)
+	}
+
+	out := &Claims{Subject: subject, Issuer: v.config.Issuer}
+	out.Email, _ = claims["email"].(string)
+	out.Name, _ = claims["name"].(string)
+	if exp, ok := claims["exp"].(float64); ok {
+		out.Expires = time.Unix(int64(exp), 0)
+	}
+	return out, nil
+}
+
+//key returns the provider's signing key with the id, fetching the keys again if they are old or it isn't one of them
+func (v *Verifier) key(ctx context.Context, kid string) (interface{}, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	age := time.Since(v.fetchedAt)
+	key, ok := v.keys[kid]
+	if (!ok && age > minRefresh) || age > keysTTL {
+		keys, err := v.fetchKeys(ctx)
+		if err != nil {
+			return nil, err
+		}
+		v.keys, v.fetchedAt = keys, time.Now()
+		key, ok = v.keys[kid]
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: the key %q isn't one of the provider's", ErrInvalidToken, kid)
+	}
+	return key, nil
+}
+
+//discovery is the part of the provider's /.well-known/openid-configuration the verifier needs
+type discovery struct {
+	Issuer  string `json:"issuer"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+//jwk is a public key of a JSON Web Key Set (RFC 7517), RSA or elliptic curve
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+//fetchKeys fetches the provider's signing keys by their id, finding where they are first if it doesn't know yet.
+//It is called with v.mu held.
+func (v *Verifier) fetchKeys(ctx context.Context) (map[string]interface{}, error) {
+	if v.jwksURL == "" {
+		var d discovery
+		if err := v.getJSON(ctx, strings.TrimSuffix(v.config.Issuer, "/")+"/.well-known/openid-configuration", &d); err != nil {
+			return nil, err
+		}
+		if d.Issuer != v.config.Issuer {
+			return nil, fmt.Errorf("The provider's issuer is %s rather than %s", d.Issuer, v.config.Issuer)
+		}
+		if d.JWKSURI == "" {
+			return nil, errors.New("The provider doesn't publish its signing keys")
+		}
+		v.jwksURL = d.JWKSURI
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := v.getJSON(ctx, v.jwksURL, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			// A key of a kind the verifier can't use doesn't stop the others being used
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+//getJSON decodes the json at the url into out
+func (v *Verifier) getJSON(ctx context.Context, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.config.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Fetching %s failed: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+//publicKey returns the key as an *rsa.PublicKey or *ecdsa.PublicKey
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("The RSA exponent is too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("The curve %s isn't supported", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("The point isn't on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("The key type %s isn't supported", k.Kty)
+	}
+}
+
+//decodeBigInt decodes a base64url encoded big endian integer
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("The key is missing a value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -1,20 +1,40 @@
 package scrape
 
 import (
+	"context"
 	"log"
 	"sync"
 	"time"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
 )
 
 //Continuous is the continous scraper
 func (config *InitialConfig) Continuous() error {
+	ctx := context.Background()
 	var eventMX = &sync.Mutex{}
+	var pruned time.Time
 
 	for {
 		time.Sleep(config.SlowInterval)
 
+		//Scrape whatever has been asked for through the api first
+		jobErr := config.RunJobs(ctx, eventMX)
+		if jobErr != nil {
+			return jobErr
+		}
+
+		//Forget the old changes and deleted events once an hour, the api has long since pushed them
+		if time.Since(pruned) > time.Hour {
+			pruneErr := config.prune(ctx)
+			if pruneErr != nil {
+				return pruneErr
+			}
+			pruned = time.Now()
+		}
+
 		//Get oldest scrape
-		oldestScrape, oldErr := config.DBClient.GetOldestScrape()
+		oldestScrape, oldErr := config.DBClient.GetOldestScrape(ctx)
 		if oldErr != nil {
 			return oldErr
 		}
@@ -28,7 +48,7 @@ func (config *InitialConfig) Continuous() error {
 			}
 			//Remove the dead scrape
 			log.Printf("Scrape %d seems dead, removing from database...", oldestScrape.ID)
-			removeScrapeErr := config.DBClient.RemoveScrape(*oldestScrape)
+			removeScrapeErr := config.DBClient.DeleteScrape(ctx, *oldestScrape, true)
 			if removeScrapeErr != nil {
 				return removeScrapeErr
 			}
@@ -40,3 +60,38 @@ func (config *InitialConfig) Continuous() error {
 		}
 	}
 }
+
+//prune removes the changes recorded, and the webhook deliveries claimed, longer than ChangeRetention ago,
+//and the events soft deleted longer than DeletedEventRetention ago
+func (config *InitialConfig) prune(ctx context.Context) error {
+	if err := pruneBefore(ctx, "changes", config.ChangeRetention, config.DBClient.DeleteChangesBefore); err != nil {
+		return err
+	}
+	if err := pruneBefore(ctx, "webhook deliveries", config.ChangeRetention, config.DBClient.DeleteWebhookDeliveriesBefore); err != nil {
+		return err
+	}
+	return pruneBefore(ctx, "deleted events", config.DeletedEventRetention, config.DBClient.DeleteEventsDeletedBefore)
+}
+
+//pruneBefore removes what is older than the retention with deleteBefore, a page at a time, keeping it forever without a retention
+func pruneBefore(ctx context.Context, what string, retention time.Duration, deleteBefore func(context.Context, time.Time, int, ...db.Option) (int, error)) error {
+	if retention <= 0 {
+		return nil
+	}
+	before := time.Now().Add(-retention)
+	total := 0
+	for {
+		deleted, err := deleteBefore(ctx, before, db.MaxListLimit)
+		if err != nil {
+			return err
+		}
+		total += deleted
+		if deleted < db.MaxListLimit {
+			break
+		}
+	}
+	if total > 0 {
+		log.Printf("Removed %d %s older than %s", total, what, retention)
+	}
+	return nil
+}
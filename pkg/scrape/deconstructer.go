@@ -1,6 +1,8 @@
 package scrape
 
 import (
+	"context"
+	"errors"
 	"log"
 	"os"
 	"regexp"
@@ -23,6 +25,7 @@ import (
 
 // ParseCal opens the file and starts the parsing
 func (config *InitialConfig) ParseCal(fid *FilesIds, mx *sync.Mutex) error {
+	ctx := context.Background()
 	f, _ := os.Open(fid.filename)
 	defer f.Close()
 
@@ -43,21 +46,26 @@ func (config *InitialConfig) ParseCal(fid *FilesIds, mx *sync.Mutex) error {
 		DType:       []string{"Scrape"},
 	}
 
-	currentScrape, err := config.DBClient.GetScrape(scrapeEvent)
+	currentScrape, err := config.DBClient.GetScrape(ctx, scrapeEvent)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		return err
+	}
+
+	series, err := config.storeSeries(parser.Events, mx)
 	if err != nil {
 		return err
 	}
 
 	events := make([]db.Event, 0)
 	eventsChan := make(chan gocal.Event, 10000)
-	resultsChan := make(chan db.Event, 10000)
+	resultsChan := make(chan storedEvent, 10000)
 	var wg sync.WaitGroup
 
 	numberOfWorkers := config.EventProcessPool
 
 	for i := 0; i <= numberOfWorkers; i++ {
 		wg.Add(1)
-		go config.handleGenerator(mx, eventsChan, resultsChan, &wg)
+		go config.handleGenerator(scrapeEvent, series, mx, eventsChan, resultsChan, &wg)
 	}
 
 	for _, e := range parser.Events {
@@ -68,18 +76,50 @@ func (config *InitialConfig) ParseCal(fid *FilesIds, mx *sync.Mutex) error {
 	wg.Wait()
 	close(resultsChan)
 
+	eventIDs := make([]string, 0)
+	changes := make([]db.Change, 0)
 	for ev := range resultsChan {
 		tempEvent := db.Event{
-			UID: ev.UID,
+			UID: ev.event.UID,
 		}
 		events = append(events, tempEvent)
+		eventIDs = append(eventIDs, ev.event.ID)
+		if ev.change != nil {
+			changes = append(changes, *ev.change)
+		}
 	}
 
 	if currentScrape != nil {
 		scrapeEvent.UID = currentScrape.UID
+
+		//Remove the events kent has taken off this timetable since the last scrape
+		purged, purgeErr := config.DBClient.PurgeStaleEvents(ctx, *currentScrape, eventIDs, start, end)
+		if purgeErr != nil {
+			return purgeErr
+		}
+		if len(purged) > 0 {
+			log.Printf("Purged %d stale events from %d", len(purged), fid.id)
+		}
+		for _, e := range purged {
+			changes = append(changes, db.Change{Type: db.ChangeCancelled, Event: &db.Event{UID: e.UID}, Topics: db.ChangeTopics(e)})
+		}
 	}
 	scrapeEvent.FoundEvent = events
-	_, err = config.DBClient.UpsertScrape(scrapeEvent)
+	_, err = config.DBClient.UpsertScrape(ctx, scrapeEvent)
+	if err != nil {
+		return err
+	}
+	if scrapeEvent.UID == "" {
+		stored, getErr := config.DBClient.GetScrape(ctx, db.Scrape{ID: fid.id})
+		if getErr != nil {
+			return getErr
+		}
+		scrapeEvent.UID = stored.UID
+	}
+
+	//Record what changed, so the api can tell its subscribers
+	changes = append(changes, db.Change{Type: db.ChangeScraped, Scrape: &db.Scrape{UID: scrapeEvent.UID}, Topics: []string{db.ScrapesTopic}})
+	err = config.DBClient.RecordChanges(ctx, changes)
 	if err != nil {
 		return err
 	}
@@ -89,37 +129,49 @@ func (config *InitialConfig) ParseCal(fid *FilesIds, mx *sync.Mutex) error {
 	return nil
 }
 
-func (config *InitialConfig) handleGenerator(mx *sync.Mutex, eventsChan <-chan gocal.Event, resultsChan chan<- db.Event, wg *sync.WaitGroup) {
+//storedEvent is an event generateEvent stored, along with the change storing it made, if it made any
+type storedEvent struct {
+	event  db.Event
+	change *db.Change
+}
+
+func (config *InitialConfig) handleGenerator(scrape db.Scrape, series map[string]*db.Series, mx *sync.Mutex, eventsChan <-chan gocal.Event, resultsChan chan<- storedEvent, wg *sync.WaitGroup) {
 	for e := range eventsChan {
-		event, genErr := config.generateEvent(&e, mx)
+		event, change, genErr := config.generateEvent(&e, scrape, series, mx)
+		if errors.Is(genErr, errStaleScrape) {
+			continue
+		}
 		if genErr != nil {
 			log.Fatal(genErr)
 		}
 		tempEvent := db.Event{
 			UID: event.UID,
+			ID:  event.ID,
 		}
-		resultsChan <- tempEvent
+		resultsChan <- storedEvent{event: tempEvent, change: change}
 	}
 	wg.Done()
 }
 
-func (config *InitialConfig) generateEvent(scrapedEvent *gocal.Event, mx *sync.Mutex) (*db.Event, error) {
+func (config *InitialConfig) generateEvent(scrapedEvent *gocal.Event, scrape db.Scrape, series map[string]*db.Series, mx *sync.Mutex) (*db.Event, *db.Change, error) {
+	ctx := context.Background()
 	eventID, idErr := generateEventID(scrapedEvent.Uid)
 	if idErr != nil {
-		return nil, idErr
+		return nil, nil, idErr
 	}
 
 	//Locations connecting
 	locations := make([]db.Location, 0)
-	loc, locErr := config.DBClient.GetLocationFromKentSlug(scrapedEvent.Location)
-	if locErr != nil {
-		return nil, locErr
+	loc, locErr := config.DBClient.GetLocationFromKentSlug(ctx, scrapedEvent.Location)
+	if locErr != nil && !errors.Is(locErr, db.ErrNotFound) {
+		return nil, nil, locErr
 	}
 	if loc != nil {
 		locations = append(locations, *loc)
 	} else {
 		locations = append(locations, db.Location{
-			Name: scrapedEvent.Location,
+			Name:  scrapedEvent.Location,
+			DType: []string{"Location"},
 		})
 	}
 
@@ -127,11 +179,11 @@ func (config *InitialConfig) generateEvent(scrapedEvent *gocal.Event, mx *sync.M
 	modules := make([]db.Module, 0)
 	sdsCode, sdsErr := getModuleCodeFromEvent(scrapedEvent.Summary)
 	if sdsErr != nil {
-		return nil, sdsErr
+		return nil, nil, sdsErr
 	}
-	mod, modErr := config.DBClient.GetModuleFromSDSCode(sdsCode)
-	if modErr != nil {
-		return nil, modErr
+	mod, modErr := config.DBClient.GetModuleFromSDSCode(ctx, sdsCode)
+	if modErr != nil && !errors.Is(modErr, db.ErrNotFound) {
+		return nil, nil, modErr
 	}
 	if mod != nil {
 		modules = append(modules, *mod)
@@ -139,7 +191,7 @@ func (config *InitialConfig) generateEvent(scrapedEvent *gocal.Event, mx *sync.M
 
 	description, err := removeUselessInfoFromDescription(scrapedEvent.Description)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	event := db.Event{
@@ -150,44 +202,64 @@ func (config *InitialConfig) generateEvent(scrapedEvent *gocal.Event, mx *sync.M
 		EndDate:      scrapedEvent.End,
 		Location:     locations,
 		PartOfModule: modules,
+		Series:       series[seriesKey(scrapedEvent)],
 		DType:        []string{"Event"},
 	}
 
 	//Mutually exclude read,write operations on the database
 	mx.Lock()
-	storedEvent, storingErr := config.StoreEvent(&event)
+	stored, change, storingErr := config.StoreEvent(&event, scrape)
 	mx.Unlock()
 	if storingErr != nil {
-		return nil, storingErr
+		return nil, nil, storingErr
 	}
-	if storedEvent != nil {
-		return storedEvent, nil
+	if stored == nil {
+		//It has just been written, so it is retrieved from the database
+		stored, err = config.DBClient.GetEvent(ctx, event)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
-
-	//Exits here if it created a new event, and has then retrieved that event from the database
-	return config.DBClient.GetEvent(event)
+	if change != nil {
+		change.Event = &db.Event{UID: stored.UID}
+	}
+	return stored, change, nil
 }
 
+//errStaleScrape is returned by StoreEvent when a newer scrape of the timetable has already been stored,
+//and the event it would have created isn't in the database
+var errStaleScrape = errors.New("A newer scrape of this timetable has already been stored")
+
 //StoreEvent handles the read and write operations
-//Returns the event if it already exists, or nil, with a nil error if it has just been created
-func (config *InitialConfig) StoreEvent(e *db.Event) (*db.Event, error) {
-	currentEvent, getErr := config.DBClient.GetEvent(*e)
-	if getErr != nil {
-		return nil, getErr
+//Returns the event if it is left as it was, or nil, with a nil error if it has just been created or updated,
+//along with the change writing it made, for the api to tell its subscribers about
+//The event is only written if scrape is newer than the stored scrape, so that a slow run doesn't overwrite a faster one
+func (config *InitialConfig) StoreEvent(e *db.Event, scrape db.Scrape) (*db.Event, *db.Change, error) {
+	ctx := context.Background()
+	diff, diffErr := config.DBClient.DiffEvent(ctx, *e)
+	if diffErr != nil {
+		return nil, nil, diffErr
 	}
+	currentEvent := diff.Stored
 	if currentEvent != nil {
 		e.UID = currentEvent.UID
 		//Check if the event is basically the same
 		//If it is, then dont bother upserting it.
 		if e.Equal(*currentEvent) {
-			return currentEvent, nil
+			return currentEvent, nil, nil
 		}
 	}
-	_, upsertErr := config.DBClient.UpsertEvent(*e)
+	written, upsertErr := config.DBClient.UpsertEventIfNewer(ctx, *e, scrape)
 	if upsertErr != nil {
-		return nil, upsertErr
+		return nil, nil, upsertErr
+	}
+	if !written {
+		if currentEvent != nil {
+			return currentEvent, nil, nil
+		}
+		return nil, nil, errStaleScrape
 	}
-	return nil, nil
+	return nil, db.ChangeOf(currentEvent, *e, *diff), nil
 }
 
 func generateEventID(currentID string) (string, error) {
@@ -33,7 +33,15 @@ type InitialConfig struct {
 	//EventProcessPool is the number of workers spawned to process the events within a file being parsed
 	//If you have 3 event process workers, and 4 process workers, then you'll have 12 concurrent event workers
 	EventProcessPool int
-	DBClient         *db.ConfigDB
+	//TermsFile is a json file of the term dates to store, see LoadTerms, which are scraped from kent without it
+	TermsFile string
+	//ChangeRetention is how long the changes the scraper records for the api, and the deliveries of them to the webhooks,
+	//are kept, they are kept forever without it
+	ChangeRetention time.Duration
+	//DeletedEventRetention is how long the events soft deleted, once no timetable has them any more, are kept
+	//before they are removed for good, they are kept forever without it
+	DeletedEventRetention time.Duration
+	DBClient              db.Client
 }
 
 // The point of this section is to concurrently download ical files from a specified ID, and cache them on the system.
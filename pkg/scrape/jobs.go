@@ -0,0 +1,87 @@
+package scrape
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+// queuedJobs is how many of the queued scrape jobs are picked up at a time
+const queuedJobs = 10
+
+// RunJobs runs the scrape jobs queued through the api, oldest first, until there are none left
+func (config *InitialConfig) RunJobs(ctx context.Context, mx *sync.Mutex) error {
+	for {
+		jobs, err := config.DBClient.GetQueuedScrapeJobs(ctx, queuedJobs)
+		if err != nil {
+			return err
+		}
+		if len(jobs) == 0 {
+			return nil
+		}
+		for _, job := range jobs {
+			if err := config.runJob(ctx, job, mx); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// jobIDs returns the ids of the feeds the job scrapes
+func (config *InitialConfig) jobIDs(ctx context.Context, job db.ScrapeJob) ([]int, error) {
+	if job.Module != "" {
+		return config.DBClient.GetModuleScrapeIDs(ctx, job.Module)
+	}
+	ids := make([]int, 0, job.To-job.From)
+	for id := job.From; id < job.To; id++ {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// runJob scrapes the feeds of the job, recording its progress after each one so it can be polled.
+// Feeds which turn out not to exist count as done, the job only fails if every feed it scraped failed.
+// The error returned is from recording the progress, a feed failing doesn't stop the rest being scraped.
+func (config *InitialConfig) runJob(ctx context.Context, job db.ScrapeJob, mx *sync.Mutex) error {
+	started := time.Now()
+	ids, err := config.jobIDs(ctx, job)
+	if err != nil {
+		_, err = config.DBClient.UpsertScrapeJob(ctx, db.ScrapeJob{UID: job.UID, Status: db.JobFailed, Error: err.Error(), FinishedAt: &started})
+		return err
+	}
+	log.Printf("Running scrape job %s of %d feeds", job.ID, len(ids))
+	_, err = config.DBClient.UpsertScrapeJob(ctx, db.ScrapeJob{UID: job.UID, Status: db.JobRunning, Total: len(ids), StartedAt: &started})
+	if err != nil {
+		return err
+	}
+
+	progress := db.ScrapeJob{UID: job.UID}
+	for _, id := range ids {
+		fid, scrapeErr := DownloadFile(id)
+		if scrapeErr == nil {
+			scrapeErr = config.ProcessFile(fid, mx)
+		}
+		progress.Done++
+		if scrapeErr != nil && scrapeErr != ErrInvalidID {
+			log.Printf("Scrape job %s failed to scrape %d: %v", job.ID, id, scrapeErr)
+			progress.Failed++
+			progress.Error = scrapeErr.Error()
+		}
+		if _, err := config.DBClient.UpsertScrapeJob(ctx, progress); err != nil {
+			return err
+		}
+	}
+
+	finished := time.Now()
+	progress.FinishedAt = &finished
+	progress.Status = db.JobDone
+	if progress.Failed > 0 && progress.Failed == len(ids) {
+		progress.Status = db.JobFailed
+	}
+	_, err = config.DBClient.UpsertScrapeJob(ctx, progress)
+	log.Printf("Scrape job %s is %s, after %s", job.ID, progress.Status, finished.Sub(started))
+	return err
+}
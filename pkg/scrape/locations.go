@@ -1,6 +1,7 @@
 package scrape
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
@@ -8,6 +9,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
 )
@@ -133,36 +135,53 @@ func tryAndGetTheLocationFromARoom(lo *LocationInfo) *db.Loc {
 		return nil
 	}
 
-	g := &db.Loc{
-		Type:   "Point",
-		Coords: []float64{lon, lat},
-	}
+	g := db.NewPoint(lat, lon)
 
 	// g := geom.NewPointFlat(geom.XY, []float64{lat, lon})
 
 	// Finally, if nothing has failed, then return the coordinates
-	return g
+	return &g
 }
 
-//Locations scrapes the locations from kent api if they dont already exist
+//Locations scrapes the locations from kent api if they haven't been imported yet,
+//including if they were scraped before the import stamped them, to fill in what has been added since such as the campus.
+//location.imported_at is what is counted, as every location imported has it, whereas kent leaves the campus of some blank.
 func (config *InitialConfig) Locations() error {
-	n, countErr := config.DBClient.CountNodesWithFieldUnsafe("location.id")
+	ctx := context.Background()
+	n, countErr := config.DBClient.CountNodesWithField(ctx, "location.imported_at")
 	if countErr != nil {
 		return countErr
 	}
 	if *n == 0 {
+		importedAt := time.Now().UTC()
 		apiLocations, apiErr := downloadAndMarshal()
 		if apiErr != nil {
 			return apiErr
 		}
 
+		//Rooms are linked to the site (building) kent lists them under
+		sites := make(map[string]string)
 		for _, loc := range *apiLocations {
 			tempLoc := db.Location{
 				ID:             loc.ID,
 				Name:           loc.UFName,
 				DisabledAccess: yesNoToBool(loc.DisabledAccess),
+				Campus:         db.CampusFromName(loc.Campus),
+				ImportedAt:     &importedAt,
 				DType:          []string{"Location"},
 			}
+			// Kent leaves the capacity blank for some rooms, which are stored without one
+			if capacity, err := strconv.Atoi(loc.Capacity); err == nil && capacity > 0 {
+				tempLoc.Capacity = capacity
+			}
+
+			if loc.SiteID != "" {
+				siteUID, siteErr := config.siteLocation(ctx, sites, &loc, importedAt)
+				if siteErr != nil {
+					return siteErr
+				}
+				tempLoc.PartOf = &db.Location{UID: siteUID}
+			}
 
 			// If it can find the location, then add the damn location
 			latlon := tryAndGetTheLocationFromARoom(&loc)
@@ -170,7 +189,7 @@ func (config *InitialConfig) Locations() error {
 				tempLoc.Location = *latlon
 			}
 
-			_, er1 := config.DBClient.UpsertLocation(tempLoc)
+			_, er1 := config.DBClient.UpsertLocation(ctx, tempLoc)
 			if er1 != nil {
 				return er1
 			}
@@ -179,3 +198,30 @@ func (config *InitialConfig) Locations() error {
 
 	return nil
 }
+
+//siteLocation returns the uid of the location for the site the room is in, storing it first if needed
+//sites caches the uids already found, by site id
+func (config *InitialConfig) siteLocation(ctx context.Context, sites map[string]string, lo *LocationInfo, importedAt time.Time) (string, error) {
+	if uid, ok := sites[lo.SiteID]; ok {
+		return uid, nil
+	}
+
+	siteID := "site:" + lo.SiteID
+	_, err := config.DBClient.UpsertLocation(ctx, db.Location{
+		ID:         siteID,
+		Name:       lo.Site,
+		Campus:     db.CampusFromName(lo.Campus),
+		ImportedAt: &importedAt,
+		DType:      []string{"Location"},
+	})
+	if err != nil {
+		return "", err
+	}
+	site, err := config.DBClient.GetLocationFromKentSlug(ctx, siteID)
+	if err != nil {
+		return "", err
+	}
+
+	sites[lo.SiteID] = site.UID
+	return site.UID, nil
+}
@@ -1,7 +1,9 @@
 package scrape
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"net/http"
 
@@ -72,7 +74,8 @@ func downloadAndMarshalModules() (*[]ModuleInfo, error) {
 
 //Modules scrapes the modules from kent api if they dont already exist
 func (config *InitialConfig) Modules() error {
-	n, countErr := config.DBClient.CountNodesWithFieldUnsafe("module.code")
+	ctx := context.Background()
+	n, countErr := config.DBClient.CountNodesWithField(ctx, "module.code")
 	if countErr != nil {
 		return countErr
 	}
@@ -94,12 +97,12 @@ func (config *InitialConfig) Modules() error {
 				DType:   []string{"Module"},
 			}
 
-			checkExist, existErr := config.DBClient.GetModuleFromSDSCode(m.SDSCode)
-			if existErr != nil {
+			checkExist, existErr := config.DBClient.GetModuleFromSDSCode(ctx, m.SDSCode)
+			if existErr != nil && !errors.Is(existErr, db.ErrNotFound) {
 				return existErr
 			}
 			if checkExist == nil {
-				_, er1 := config.DBClient.UpsertModule(tempMod)
+				_, er1 := config.DBClient.UpsertModule(ctx, tempMod)
 				if er1 != nil {
 					return er1
 				}
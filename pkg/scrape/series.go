@@ -0,0 +1,64 @@
+package scrape
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/apognu/gocal"
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+//seriesKey identifies the weekly series an event belongs to, from its title, location, weekday and time of day
+//Times are taken in the event's own timezone, so the key stays the same when the clocks change
+//Returns an empty key for events without a start or end
+func seriesKey(e *gocal.Event) string {
+	if e.Start == nil || e.End == nil {
+		return ""
+	}
+	raw := fmt.Sprintf("%s\n%s\n%s\n%s-%s", e.Summary, e.Location, e.Start.Weekday(), e.Start.Format("15:04"), e.End.Format("15:04"))
+	sum := sha1.Sum([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+//storeSeries groups the events which repeat every week into series, and stores each series
+//Returns the stored series keyed by seriesKey, events which only happen once aren't part of one
+func (config *InitialConfig) storeSeries(events []gocal.Event, mx *sync.Mutex) (map[string]*db.Series, error) {
+	ctx := context.Background()
+	occurrences := make(map[string]int)
+	titles := make(map[string]string)
+	for i := range events {
+		key := seriesKey(&events[i])
+		if key == "" {
+			continue
+		}
+		occurrences[key]++
+		titles[key] = events[i].Summary
+	}
+
+	series := make(map[string]*db.Series)
+	for key, n := range occurrences {
+		if n < 2 {
+			continue
+		}
+		//Mutually exclude read,write operations on the database, as other timetables can contain the same series
+		mx.Lock()
+		_, err := config.DBClient.UpsertSeries(ctx, db.Series{
+			ID:    key,
+			Title: titles[key],
+			DType: []string{"Series"},
+		})
+		var stored *db.Series
+		if err == nil {
+			stored, err = config.DBClient.GetSeries(ctx, db.Series{ID: key})
+		}
+		mx.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		series[key] = stored
+	}
+	return series, nil
+}
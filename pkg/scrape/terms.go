@@ -0,0 +1,147 @@
+package scrape
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	// The time zone database is embedded, so the term dates are read in kent's time wherever the scraper runs
+	_ "time/tzdata"
+
+	"github.com/jamesjarvis/WhatsUpKent/pkg/db"
+)
+
+// This file stores kent's term dates, which the api numbers the weeks of the academic year by
+
+//termDatesURL is the page kent lists its term dates on, as it has no api for them
+const termDatesURL = "https://www.kent.ac.uk/student/term-dates"
+
+//termDateLayout is how the days of the terms are written in a TermsFile
+const termDateLayout = "2006-01-02"
+
+//kentTime is the time zone the days of the terms are in
+var kentTime = func() *time.Location {
+	loc, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		panic(fmt.Sprintf("The Europe/London time zone isn't in the embedded time zone database: %v", err))
+	}
+	return loc
+}()
+
+//TermInfo is one of the terms in a TermsFile, such as
+//{"academic_year": 2024, "name": "Autumn", "start": "2024-09-23", "end": "2024-12-13"}
+//End is the last day of the term.
+type TermInfo struct {
+	AcademicYear int    `json:"academic_year"`
+	Name         string `json:"name"`
+	Start        string `json:"start"`
+	End          string `json:"end"`
+}
+
+//LoadTerms reads the terms from the json file at path, a list of TermInfo
+func LoadTerms(path string) ([]db.Term, error) {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var infos []TermInfo
+	if err := json.Unmarshal(body, &infos); err != nil {
+		return nil, fmt.Errorf("Could not read the terms in %s: %w", path, err)
+	}
+	terms := make([]db.Term, 0, len(infos))
+	for _, info := range infos {
+		start, err := time.ParseInLocation(termDateLayout, info.Start, kentTime)
+		if err != nil {
+			return nil, fmt.Errorf("The %s term of %d has an invalid start: %w", info.Name, info.AcademicYear, err)
+		}
+		end, err := time.ParseInLocation(termDateLayout, info.End, kentTime)
+		if err != nil {
+			return nil, fmt.Errorf("The %s term of %d has an invalid end: %w", info.Name, info.AcademicYear, err)
+		}
+		if info.Name == "" || info.AcademicYear == 0 || end.Before(start) {
+			return nil, fmt.Errorf("The %s term of %d needs a name, an academic year and to end after it starts", info.Name, info.AcademicYear)
+		}
+		terms = append(terms, newTerm(info.AcademicYear, info.Name, start, end))
+	}
+	return terms, nil
+}
+
+//newTerm returns the term, stored as ending the day after its last day
+func newTerm(year int, name string, start, last time.Time) db.Term {
+	end := last.AddDate(0, 0, 1)
+	return db.Term{
+		ID:           db.TermID(year, name),
+		Name:         name,
+		AcademicYear: year,
+		StartDate:    &start,
+		EndDate:      &end,
+		DType:        []string{"Term"},
+	}
+}
+
+//termRegex finds the terms on the term dates page, such as "Autumn term: 22 September 2025 to 12 December 2025"
+var termRegex = regexp.MustCompile(`(?i)(autumn|spring|summer) term\W+(\d{1,2} [a-z]+ \d{4})\s*(?:-|–|to)\s*(\d{1,2} [a-z]+ \d{4})`)
+
+//tagRegex matches the html tags, which are stripped from the page before looking for the terms in it
+var tagRegex = regexp.MustCompile(`<[^>]*>`)
+
+//downloadTerms scrapes the terms off kent's term dates page.
+//Like tryAndGetTheLocationFromARoom it is at the mercy of the page, so it returns no terms rather than failing if it can't read them.
+func downloadTerms() []db.Term {
+	resp, err := http.Get(termDatesURL)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	text := strings.Join(strings.Fields(tagRegex.ReplaceAllString(string(body), " ")), " ")
+	terms := make([]db.Term, 0)
+	for _, match := range termRegex.FindAllStringSubmatch(text, -1) {
+		start, err := time.ParseInLocation("2 January 2006", match[2], kentTime)
+		if err != nil {
+			continue
+		}
+		last, err := time.ParseInLocation("2 January 2006", match[3], kentTime)
+		if err != nil || last.Before(start) {
+			continue
+		}
+		// The spring and summer terms are in the academic year which started the autumn before
+		year := start.Year()
+		if start.Month() < time.August {
+			year--
+		}
+		name := strings.ToUpper(match[1][:1]) + strings.ToLower(match[1][1:])
+		terms = append(terms, newTerm(year, name, start, last))
+	}
+	return terms
+}
+
+//Terms stores the term dates from the TermsFile, or scraped from kent if it isn't set
+func (config *InitialConfig) Terms() error {
+	ctx := context.Background()
+	var terms []db.Term
+	if config.TermsFile != "" {
+		var err error
+		terms, err = LoadTerms(config.TermsFile)
+		if err != nil {
+			return err
+		}
+	} else {
+		terms = downloadTerms()
+	}
+
+	for _, term := range terms {
+		if _, err := config.DBClient.UpsertTerm(ctx, term); err != nil {
+			return err
+		}
+	}
+	return nil
+}